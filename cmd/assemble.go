@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/hioki-daichi/imgconv/conversion"
+	"github.com/hioki-daichi/imgconv/gathering"
+)
+
+// Assembler assembles the frames under a directory into an animated GIF.
+type Assembler struct {
+	// Usually, stdout is specified, and at the time of testing, buffer is specified.
+	OutStream io.Writer
+
+	// The frames are detected by Decoder, or by Candidates when Decoder is nil. See gathering.Gatherer.
+	Decoder    conversion.Decoder
+	Candidates []conversion.Decoder
+
+	// Encoder writes the animated GIF. Its Palette is replaced with the one shared across all the frames unless specified.
+	Encoder *conversion.Gif
+
+	// Delay of each frame in 100ths of a second.
+	Delay int
+
+	// LoopCount is as of conversion.Animation. 0 loops forever.
+	LoopCount int
+
+	// Overwrite the destination when it exists.
+	Force bool
+}
+
+// Run gathers the frames directly under dirname, not in its subdirectories, and writes the animated GIF to dstPath.
+// The frames are ordered in the natural order of their names, in which "frame_2.png" precedes "frame_10.png", and must be all of the same size.
+func (a *Assembler) Run(dirname string, dstPath string) error {
+	gatherer := &gathering.Gatherer{Decoder: a.Decoder, Candidates: a.Candidates, NoRecursion: true, NaturalOrder: true}
+	paths, err := gatherer.Gather(dirname)
+	if err != nil {
+		return err
+	}
+
+	var frames []image.Image
+	h := &conversion.Histogram{}
+	for _, path := range paths {
+		// The destination of the previous run
+		if filepath.Clean(path) == filepath.Clean(dstPath) {
+			continue
+		}
+
+		img, err := decodeFrame(path, gatherer.Decoders[path])
+		if err != nil {
+			return &conversion.Error{Path: path, Stage: conversion.StageDecode, Err: err}
+		}
+		if len(frames) > 0 && img.Bounds().Size() != frames[0].Bounds().Size() {
+			return &conversion.Error{Path: path, Stage: conversion.StageDecode, Err: fmt.Errorf("frame size %v differs from the first one %v", img.Bounds().Size(), frames[0].Bounds().Size())}
+		}
+		frames = append(frames, img)
+		h.Add(img)
+	}
+	if len(frames) == 0 {
+		return errors.New("no frames found in " + dirname)
+	}
+
+	if !a.Force {
+		_, err := os.Stat(dstPath)
+		if err == nil {
+			return errors.New("File already exists: " + dstPath)
+		}
+	}
+
+	anim := &conversion.Animation{
+		Frames:    make([]image.Image, len(frames)),
+		Delays:    make([]int, len(frames)),
+		Disposals: make([]byte, len(frames)),
+		LoopCount: a.LoopCount,
+		Width:     frames[0].Bounds().Dx(),
+		Height:    frames[0].Bounds().Dy(),
+	}
+	for i, frame := range frames {
+		anim.Frames[i] = frame
+		// Each frame covers the whole canvas, so that the previous one must be cleared.
+		anim.Delays[i], anim.Disposals[i] = a.Delay, gif.DisposalBackground
+	}
+
+	encoder := withSharedPalette(a.Encoder, h)
+	_, err = conversion.WriteFile(dstPath, a.Force, func(w io.Writer) error {
+		err := encoder.EncodeAnimation(w, anim)
+		if err != nil {
+			return &conversion.Error{Path: dstPath, Stage: conversion.StageEncode, Err: err}
+		}
+		return nil
+	})
+	if _, ok := err.(*conversion.Error); err != nil && !ok {
+		err = &conversion.Error{Path: dstPath, Stage: conversion.StageWrite, Err: err}
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(a.OutStream, "Assembled: %q from %d frames\n", dstPath, len(frames))
+
+	return nil
+}
+
+// decodeFrame decodes the frame at path, whose origin is moved to (0, 0).
+func decodeFrame(path string, decoder conversion.Decoder) (image.Image, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	img, err := decoder.Decode(fp)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	if bounds.Min == (image.Point{}) {
+		return img, nil
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Rect, img, bounds.Min, draw.Src)
+	return dst, nil
+}
+
+// withSharedPalette returns a copy of the encoder whose Palette is computed from the histogram of all the images unless specified.
+// The palette is computed by Options.Quantizer, or MedianCut when it is nil, within Options.NumColors.
+func withSharedPalette(g *conversion.Gif, h *conversion.Histogram) *conversion.Gif {
+	encoder := *g
+	if encoder.Palette != nil {
+		return &encoder
+	}
+
+	numColors := 256
+	var quantizer draw.Quantizer
+	if encoder.Options != nil {
+		if encoder.Options.NumColors > 0 {
+			numColors = encoder.Options.NumColors
+		}
+		quantizer = encoder.Options.Quantizer
+	}
+	// Without colors, e.g. when no image is decoded, each image is quantized as usual.
+	if p := h.Palette(numColors, quantizer); len(p) > 0 {
+		encoder.Palette = p
+	}
+
+	return &encoder
+}
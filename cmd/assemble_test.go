@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hioki-daichi/imgconv/conversion"
+)
+
+func TestCmd_Assembler_Run(t *testing.T) {
+	t.Parallel()
+
+	tempdir, err := ioutil.TempDir("", "imgconv")
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	colors := []color.RGBA{{R: 0xFF, A: 0xFF}, {G: 0xFF, A: 0xFF}, {B: 0xFF, A: 0xFF}}
+	for i, c := range colors {
+		img := image.NewRGBA(image.Rect(0, 0, 4, 3))
+		for x := 0; x < 4; x++ {
+			img.SetRGBA(x, 1, c)
+		}
+		writePng(t, filepath.Join(tempdir, "frames", "frame_000"+string('1'+rune(i))+".png"), img)
+	}
+
+	buf := &bytes.Buffer{}
+	dstPath := filepath.Join(tempdir, "anim.gif")
+
+	assembler := &Assembler{OutStream: buf, Candidates: []conversion.Decoder{pngDecoder(t)}, Encoder: &conversion.Gif{Options: &gif.Options{NumColors: 256}}, Delay: 5, LoopCount: 2}
+
+	err = assembler.Run(filepath.Join(tempdir, "frames"), dstPath)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	expected := `Assembled: "` + dstPath + `" from 3 frames
+`
+	if actual := buf.String(); actual != expected {
+		t.Errorf(`expected="%s" actual="%s"`, expected, actual)
+	}
+
+	fp, err := os.Open(dstPath)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	defer fp.Close()
+
+	g, err := gif.DecodeAll(fp)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	if len(g.Image) != 3 {
+		t.Fatalf(`expected=3 actual=%d`, len(g.Image))
+	}
+	if expected := []int{5, 5, 5}; !reflect.DeepEqual(g.Delay, expected) {
+		t.Errorf(`expected="%v" actual="%v"`, expected, g.Delay)
+	}
+	if g.LoopCount != 2 {
+		t.Errorf(`expected=2 actual=%d`, g.LoopCount)
+	}
+	for i, frame := range g.Image {
+		// Shared across the frames
+		if !reflect.DeepEqual(frame.Palette, g.Image[0].Palette) {
+			t.Errorf(`expected="%v" actual="%v"`, g.Image[0].Palette, frame.Palette)
+		}
+		// In the order of the file names
+		if actual := color.RGBAModel.Convert(frame.At(0, 1)); actual != colors[i] {
+			t.Errorf(`expected="%v" actual="%v"`, colors[i], actual)
+		}
+	}
+
+	err = assembler.Run(filepath.Join(tempdir, "frames"), dstPath)
+	if err == nil || err.Error() != "File already exists: "+dstPath {
+		t.Errorf(`expected="File already exists: %s" actual="%v"`, dstPath, err)
+	}
+}
+
+func TestCmd_Assembler_Run_Order(t *testing.T) {
+	t.Parallel()
+
+	tempdir, err := ioutil.TempDir("", "imgconv")
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	// frame_10.png follows frame_2.png, and the subdirectory is not gathered.
+	names := []string{"frame_1.png", "frame_2.png", "frame_10.png"}
+	for i, name := range names {
+		img := image.NewGray(image.Rect(0, 0, 2, 2))
+		img.Pix[0] = uint8(0x40 * (i + 1))
+		writePng(t, filepath.Join(tempdir, "frames", name), img)
+	}
+	writePng(t, filepath.Join(tempdir, "frames", "sub", "frame_3.png"), image.NewGray(image.Rect(0, 0, 2, 2)))
+
+	dstPath := filepath.Join(tempdir, "anim.gif")
+
+	assembler := &Assembler{OutStream: &bytes.Buffer{}, Candidates: []conversion.Decoder{pngDecoder(t)}, Encoder: &conversion.Gif{Options: &gif.Options{NumColors: 256}}}
+
+	err = assembler.Run(filepath.Join(tempdir, "frames"), dstPath)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	fp, err := os.Open(dstPath)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	defer fp.Close()
+
+	g, err := gif.DecodeAll(fp)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	if len(g.Image) != len(names) {
+		t.Fatalf(`expected=%d actual=%d`, len(names), len(g.Image))
+	}
+	for i, frame := range g.Image {
+		expected := color.Gray{Y: uint8(0x40 * (i + 1))}
+		if actual := color.GrayModel.Convert(frame.At(0, 0)); actual != expected {
+			t.Errorf(`%s: expected="%v" actual="%v"`, names[i], expected, actual)
+		}
+	}
+}
+
+func TestCmd_Assembler_Run_Failure(t *testing.T) {
+	cases := map[string]struct {
+		sizes    []int
+		expected string
+	}{
+		"no frames":      {sizes: nil, expected: "no frames found in "},
+		"different size": {sizes: []int{2, 3}, expected: "frame size (3,3) differs from the first one (2,2)"},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			tempdir, err := ioutil.TempDir("", "imgconv")
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+			defer os.RemoveAll(tempdir)
+
+			for i, size := range c.sizes {
+				writePng(t, filepath.Join(tempdir, "frame_000"+string('1'+rune(i))+".png"), image.NewGray(image.Rect(0, 0, size, size)))
+			}
+
+			assembler := &Assembler{OutStream: &bytes.Buffer{}, Candidates: []conversion.Decoder{pngDecoder(t)}, Encoder: &conversion.Gif{}}
+
+			err = assembler.Run(tempdir, filepath.Join(tempdir, "anim.gif"))
+			if err == nil || !strings.HasPrefix(err.Error(), c.expected) {
+				t.Errorf(`expected="%s..." actual="%v"`, c.expected, err)
+			}
+		})
+	}
+}
+
+func writePng(t *testing.T, path string, img image.Image) {
+	t.Helper()
+
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	fp, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	defer fp.Close()
+
+	err = png.Encode(fp, img)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+}
@@ -5,7 +5,11 @@ package cmd
 
 import (
 	"fmt"
+	"image/color"
 	"io"
+	"os"
+	"sync"
+	"time"
 
 	"github.com/hioki-daichi/imgconv/conversion"
 	"github.com/hioki-daichi/imgconv/gathering"
@@ -20,28 +24,334 @@ type Runner struct {
 	Decoder conversion.Decoder
 	Encoder conversion.Encoder
 
+	// When Decoder is nil, the input file format is detected among these by magic bytes.
+	Candidates []conversion.Decoder
+
+	// Applied to each decoded image in order, e.g. resizing.Resizer.
+	Transformers []conversion.Transformer
+
 	// Overwrite when the converted file name duplicates.
 	Force bool
+
+	// Destination root under which the directory structure of the source tree is recreated. When empty, files are converted next to the sources.
+	OutDir string
+
+	// Number of files converted concurrently. Zero or less is treated as 1.
+	Jobs int
+
+	// Skip the files whose destinations are up to date, judged by modification times or by the content hashes in the manifest file at ManifestPath.
+	Incremental  bool
+	ManifestPath string
+	manifest     *conversion.Manifest
+
+	// Only report the planned conversions and the conflicts without writing anything.
+	DryRun bool
+
+	// Record the files which failed in Failures and continue instead of stopping at the first error.
+	KeepGoing bool
+	Failures  []*Failure
+
+	// ReportFormatText (default) or ReportFormatJSON.
+	ReportFormat string
+
+	// Write each frame of animated files to its own file. See conversion.Converter.ExtractFrames.
+	ExtractFrames bool
+
+	// Images with transparency are composited onto it for the encoders which cannot hold transparency. See conversion.Converter.Background.
+	Background color.Color
+
+	// When Encoder is a *conversion.Gif without Palette, compute one palette across the first frames of all the gathered files
+	// and convert all of them with it, so that they share identical colors.
+	SharedPalette bool
+	encoder       conversion.Encoder
+}
+
+// Failure records a file which failed to be gathered or converted.
+type Failure struct {
+	Path string
+
+	// One of "gather", "decode", "transform", "encode" and "write".
+	Stage string
+
+	Err error
+}
+
+const stageGather = "gather"
+
+type result struct {
+	result   *conversion.Result
+	decoder  conversion.Decoder
+	duration time.Duration
+	err      error
 }
 
 // Run gathers and converts the target files.
-func (r *Runner) Run(dirname string) error {
-	gatherer := &gathering.Gatherer{Decoder: r.Decoder}
+// Files are converted concurrently by Jobs workers, but the results are written in the gathered order.
+// It stops at the first error in that order unless KeepGoing is set,
+// in which case the failures are summarized at the end and an error telling their number is returned.
+func (r *Runner) Run(dirname string) (err error) {
+	start := time.Now()
+	rep := r.newReporter()
+	r.encoder = r.Encoder
+
+	r.manifest = nil
+	if r.ManifestPath != "" {
+		r.manifest, err = conversion.LoadManifest(r.ManifestPath)
+		if err != nil {
+			return err
+		}
+		if !r.DryRun {
+			// Save after all the workers finish, even if some files fail.
+			defer func() {
+				saveErr := r.manifest.Save(r.ManifestPath)
+				if err == nil {
+					err = saveErr
+				}
+			}()
+		}
+	}
+
+	gatherer := &gathering.Gatherer{Decoder: r.Decoder, Candidates: r.Candidates, KeepGoing: r.KeepGoing}
 	paths, err := gatherer.Gather(dirname)
 	if err != nil {
 		return err
 	}
 
-	converter := &conversion.Converter{Decoder: r.Decoder, Encoder: r.Encoder}
+	r.Failures = nil
+	for _, e := range gatherer.Errors {
+		f := newFailure(e.Path, e.Err)
+		if f.Stage == "" {
+			f.Stage = stageGather
+		}
+		r.Failures = append(r.Failures, f)
+		rep.failed(f, result{})
+	}
+
+	sum := &summary{total: len(paths) + len(gatherer.Errors)}
+
+	if r.DryRun {
+		return r.plan(rep, dirname, paths, gatherer.Decoders, sum, start)
+	}
+
+	if r.SharedPalette {
+		r.encoder = r.sharedPaletteEncoder(paths, gatherer.Decoders)
+	}
+
+	conflicts := r.reserve(dirname, paths, gatherer.Decoders)
+
+	results := make([]chan result, len(paths))
+	for i := range results {
+		results[i] = make(chan result, 1)
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	indexes := make(chan int)
+	go func() {
+		defer close(indexes)
+		for i := range paths {
+			select {
+			case indexes <- i:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for n := 0; n < r.jobs(); n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if conflicts[i] != nil {
+					results[i] <- result{decoder: gatherer.Decoders[paths[i]], err: conflicts[i]}
+					continue
+				}
+				results[i] <- r.convert(dirname, gatherer.Decoders[paths[i]], paths[i])
+			}
+		}()
+	}
+
+	for i, ch := range results {
+		res := <-ch
+		if res.err != nil {
+			f := newFailure(paths[i], res.err)
+			r.Failures = append(r.Failures, f)
+			rep.failed(f, res)
+			if !r.KeepGoing {
+				r.finish(rep, sum, start)
+				return res.err
+			}
+			continue
+		}
+
+		if res.result.Skipped {
+			sum.skipped++
+		} else {
+			sum.converted++
+		}
+		rep.converted(paths[i], res)
+	}
+
+	return r.finish(rep, sum, start)
+}
+
+// reserve assigns each destination to the first file converted into it before the conversions start,
+// so that the concurrent conversions never write the same destination. It returns the conflict errors of the other files by index.
+func (r *Runner) reserve(dirname string, paths []string, decoders map[string]conversion.Decoder) []error {
+	conflicts := make([]error, len(paths))
+	reserved := make(map[string]string)
+
+	for i, path := range paths {
+		// The error is left to the conversion.
+		dstPath, err := r.newConverter(dirname, decoders[path]).DstPath(path)
+		if err != nil {
+			continue
+		}
+
+		if first, ok := reserved[dstPath]; ok {
+			conflicts[i] = &conversion.Error{Path: path, Stage: conversion.StageWrite, Err: newConflictError(first, dstPath)}
+			continue
+		}
+		reserved[dstPath] = path
+	}
+
+	return conflicts
+}
+
+// newConflictError tells that the destination is also converted from the earlier file.
+func newConflictError(first string, dstPath string) error {
+	return fmt.Errorf("Destination conflicts with %q: %s", first, dstPath)
+}
+
+func newFailure(path string, err error) *Failure {
+	if e, ok := err.(*conversion.Error); ok {
+		return &Failure{Path: e.Path, Stage: string(e.Stage), Err: e.Err}
+	}
+	return &Failure{Path: path, Err: err}
+}
+
+func (r *Runner) finish(rep reporter, sum *summary, start time.Time) error {
+	sum.failures = r.Failures
+	sum.elapsed = time.Since(start)
+	rep.finish(sum)
+
+	if len(r.Failures) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("%d file(s) failed", len(r.Failures))
+}
+
+// plan reports what would happen to each destination of each file, which is decoded to know its pages:
+// "skip" when the destination is up to date in incremental mode, "convert" when it is free,
+// "overwrite" when it exists and Force is set or it is stale in incremental mode, and "blocked" otherwise when it exists.
+// Destinations planned for earlier files are blocked even with Force, as they conflict in Run. See reserve.
+func (r *Runner) plan(rep reporter, dirname string, paths []string, decoders map[string]conversion.Decoder, sum *summary, start time.Time) error {
+	planned := make(map[string]bool)
 
 	for _, path := range paths {
-		fp, err := converter.Convert(path, r.Force)
+		converter := r.newConverter(dirname, decoders[path])
+
+		dstPath, err := converter.DstPath(path)
+		if err == nil && r.Incremental && !planned[dstPath] {
+			var upToDate bool
+			upToDate, err = converter.UpToDate(path)
+			if err == nil && upToDate {
+				planned[dstPath] = true
+				rep.planned(path, dstPath, actionSkip)
+				continue
+			}
+		}
 		if err != nil {
-			return err
+			err = &conversion.Error{Path: path, Stage: conversion.StageWrite, Err: err}
 		}
 
-		fmt.Fprintf(r.OutStream, "Converted: %q\n", fp.Name())
+		// The pages of multi-page files and the extracted frames of animations are written to their own files.
+		var dstPaths []string
+		if err == nil {
+			dstPaths, err = converter.DstPaths(path)
+		}
+		if err != nil {
+			f := newFailure(path, err)
+			r.Failures = append(r.Failures, f)
+			rep.failed(f, result{decoder: decoders[path]})
+			if !r.KeepGoing {
+				return err
+			}
+			continue
+		}
+
+		for _, dstPath := range dstPaths {
+			_, err = os.Stat(dstPath)
+			conflicts := planned[dstPath]
+			exists := err == nil || conflicts
+			// In incremental mode, the existing destinations which are not up to date are stale and rebuilt.
+			stale := r.Incremental && !conflicts
+			planned[dstPath] = true
+
+			switch {
+			case !exists:
+				rep.planned(path, dstPath, actionConvert)
+			case !conflicts && (r.Force || stale):
+				rep.planned(path, dstPath, actionOverwrite)
+			default:
+				rep.planned(path, dstPath, actionBlocked)
+			}
+		}
 	}
 
-	return nil
+	return r.finish(rep, sum, start)
+}
+
+func (r *Runner) newConverter(dirname string, decoder conversion.Decoder) *conversion.Converter {
+	return &conversion.Converter{
+		Decoder:       decoder,
+		Encoder:       r.encoder,
+		Transformers:  r.Transformers,
+		SrcDir:        dirname,
+		OutDir:        r.OutDir,
+		Incremental:   r.Incremental,
+		Manifest:      r.manifest,
+		ExtractFrames: r.ExtractFrames,
+		Background:    r.Background,
+	}
+}
+
+// sharedPaletteEncoder returns a copy of the GIF encoder with the palette computed across the first frames of the files.
+// The files which cannot be decoded are left to fail in their conversion.
+func (r *Runner) sharedPaletteEncoder(paths []string, decoders map[string]conversion.Decoder) conversion.Encoder {
+	g, ok := r.Encoder.(*conversion.Gif)
+	if !ok {
+		return r.Encoder
+	}
+
+	// Only the colors are kept, so that the images are not held all at once.
+	h := &conversion.Histogram{}
+	for _, path := range paths {
+		img, err := decodeFrame(path, decoders[path])
+		if err != nil {
+			continue
+		}
+		h.Add(img)
+	}
+
+	return withSharedPalette(g, h)
+}
+
+func (r *Runner) jobs() int {
+	if r.Jobs < 1 {
+		return 1
+	}
+	return r.Jobs
+}
+
+func (r *Runner) convert(dirname string, decoder conversion.Decoder, path string) result {
+	start := time.Now()
+	res, err := r.newConverter(dirname, decoder).Convert(path, r.Force)
+	return result{result: res, decoder: decoder, duration: time.Since(start), err: err}
 }
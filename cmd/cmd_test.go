@@ -2,12 +2,21 @@ package cmd
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
 	"image/gif"
 	"image/jpeg"
 	"image/png"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/hioki-daichi/imgconv/conversion"
 	"github.com/hioki-daichi/imgconv/fileutil"
@@ -46,6 +55,7 @@ Converted: "` + tempdir + `/png/sample2.gif"
 		}},
 		"GIF to JPEG": {decoder: gifDecoder(t), encoder: jpegEncoder(t), force: true, expected: func(tempdir string) string {
 			return `Converted: "` + tempdir + `/gif/sample1.jpg"
+Warning: "` + tempdir + `/gif/sample1.gif" is animated, but only the first of 44 frames is converted since the output file format cannot hold animation
 `
 		}},
 		"GIF to PNG": {decoder: gifDecoder(t), encoder: pngEncoder(t), force: true, expected: func(tempdir string) string {
@@ -81,6 +91,653 @@ Converted: "` + tempdir + `/png/sample2.gif"
 	}
 }
 
+func TestCmd_Run_Candidates(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+
+	runner := Runner{OutStream: buf, Encoder: pngEncoder(t), Candidates: []conversion.Decoder{jpegDecoder(t), gifDecoder(t)}, Force: true}
+
+	tempdir, cleanFn := withTempDir(t)
+	defer cleanFn()
+
+	expected := `Converted: "` + tempdir + `/gif/sample1.png"
+Converted: "` + tempdir + `/jpeg/sample1.png"
+Converted: "` + tempdir + `/jpeg/sample2.png"
+Converted: "` + tempdir + `/jpeg/sample3.png"
+`
+
+	err := runner.Run(tempdir)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	actual := buf.String()
+	if actual != expected {
+		t.Errorf(`expected="%s" actual="%s"`, expected, actual)
+	}
+}
+
+func TestCmd_Run_Candidates_Unrecognized(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+
+	runner := Runner{OutStream: buf, Encoder: pngEncoder(t), Candidates: []conversion.Decoder{jpegDecoder(t), gifDecoder(t)}, Force: true, KeepGoing: true}
+
+	tempdir, cleanFn := withTempDir(t)
+	defer cleanFn()
+
+	// PNG named ".jpg" is reported instead of being skipped silently.
+	misnamed := filepath.Join(tempdir, "jpeg", "misnamed.jpg")
+	copyFile(t, filepath.Join(tempdir, "png", "sample1.png"), misnamed)
+
+	err := runner.Run(tempdir)
+
+	expected := "1 file(s) failed"
+	if err == nil || err.Error() != expected {
+		t.Errorf(`expected="%s" actual="%v"`, expected, err)
+	}
+
+	expectedOut := `Converted: "` + tempdir + `/gif/sample1.png"
+Converted: "` + tempdir + `/jpeg/sample1.png"
+Converted: "` + tempdir + `/jpeg/sample2.png"
+Converted: "` + tempdir + `/jpeg/sample3.png"
+Failed: "` + misnamed + `" at decode: image: unknown format
+`
+	actualOut := buf.String()
+	if actualOut != expectedOut {
+		t.Errorf(`expected="%s" actual="%s"`, expectedOut, actualOut)
+	}
+}
+
+func TestCmd_Run_Candidates_Tga(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+
+	tempdir, err := ioutil.TempDir("", "imgconv")
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	// An uncompressed true-color TGA starts with "\x00\x00\x02\x00", which are the magic bytes of CUR.
+	fp, err := os.Create(tempdir + "/a.tga")
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	err = (&conversion.Tga{}).Encode(fp, image.NewRGBA(image.Rect(0, 0, 2, 2)))
+	fp.Close()
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	runner := Runner{OutStream: buf, Encoder: pngEncoder(t), Candidates: []conversion.Decoder{&conversion.Ico{}, &conversion.Tga{}}}
+
+	err = runner.Run(tempdir)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	expected := `Converted: "` + tempdir + `/a.png"
+`
+	actual := buf.String()
+	if actual != expected {
+		t.Errorf(`expected="%s" actual="%s"`, expected, actual)
+	}
+}
+
+func TestCmd_Run_Jobs(t *testing.T) {
+	for _, jobs := range []int{0, 1, 2, 8} {
+		jobs := jobs
+		t.Run(fmt.Sprintf("jobs=%d", jobs), func(t *testing.T) {
+			t.Parallel()
+
+			buf := &bytes.Buffer{}
+
+			runner := Runner{OutStream: buf, Decoder: jpegDecoder(t), Encoder: pngEncoder(t), Force: true, Jobs: jobs}
+
+			tempdir, cleanFn := withTempDir(t)
+			defer cleanFn()
+
+			expected := `Converted: "` + tempdir + `/jpeg/sample1.png"
+Converted: "` + tempdir + `/jpeg/sample2.png"
+Converted: "` + tempdir + `/jpeg/sample3.png"
+`
+
+			err := runner.Run(tempdir)
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+
+			actual := buf.String()
+			if actual != expected {
+				t.Errorf(`expected="%s" actual="%s"`, expected, actual)
+			}
+		})
+	}
+}
+
+func TestCmd_Run_Jobs_Conflict(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+
+	tempdir, cleanFn := withTempDir(t)
+	defer cleanFn()
+
+	// Only the second file conflicts.
+	fp, err := os.Create(tempdir + "/jpeg/sample2.png")
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	fp.Close()
+
+	runner := Runner{OutStream: buf, Decoder: jpegDecoder(t), Encoder: pngEncoder(t), Force: false, Jobs: 3}
+
+	err = runner.Run(tempdir)
+
+	expected := "File already exists: " + tempdir + "/jpeg/sample2.png"
+	actual := err.Error()
+	if actual != expected {
+		t.Errorf(`expected="%s" actual="%s"`, expected, actual)
+	}
+
+	expectedOut := `Converted: "` + tempdir + `/jpeg/sample1.png"
+`
+	actualOut := buf.String()
+	if actualOut != expectedOut {
+		t.Errorf(`expected="%s" actual="%s"`, expectedOut, actualOut)
+	}
+}
+
+func TestCmd_Run_Jobs_Duplicate(t *testing.T) {
+	t.Parallel()
+
+	tempdir, err := ioutil.TempDir("", "imgconv")
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	// Each img<n>.jpeg, which is gathered first, and img<n>.jpg are converted into img<n>.png.
+	const n = 10
+	for i := 0; i < n; i++ {
+		for ext, width := range map[string]int{".jpeg": 2, ".jpg": 3} {
+			fp, err := os.Create(fmt.Sprintf("%s/img%d%s", tempdir, i, ext))
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+			err = jpeg.Encode(fp, image.NewGray(image.Rect(0, 0, width, 1)), nil)
+			fp.Close()
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+		}
+	}
+
+	for run := 0; run < 5; run++ {
+		buf := &bytes.Buffer{}
+		runner := Runner{OutStream: buf, Decoder: jpegDecoder(t), Encoder: pngEncoder(t), Force: true, Jobs: 8, KeepGoing: true}
+
+		err = runner.Run(tempdir)
+
+		expected := fmt.Sprintf("%d file(s) failed", n)
+		if err == nil || err.Error() != expected {
+			t.Fatalf(`expected="%s" actual="%v"`, expected, err)
+		}
+
+		for i := 0; i < n; i++ {
+			expectedOut := fmt.Sprintf(`Failed: "%s/img%d.jpg" at write: Destination conflicts with "%s/img%d.jpeg": %s/img%d.png`, tempdir, i, tempdir, i, tempdir, i)
+			if !strings.Contains(buf.String(), expectedOut) {
+				t.Errorf(`expected="%s" actual="%s"`, expectedOut, buf.String())
+			}
+
+			fp, err := os.Open(fmt.Sprintf("%s/img%d.png", tempdir, i))
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+			config, err := png.DecodeConfig(fp)
+			fp.Close()
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+			if config.Width != 2 {
+				t.Errorf("img%d.png is overwritten by img%d.jpg", i, i)
+			}
+		}
+	}
+}
+
+func TestCmd_Run_KeepGoing(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+
+	tempdir, cleanFn := withTempDir(t)
+	defer cleanFn()
+
+	err := ioutil.WriteFile(tempdir+"/jpeg/broken.jpg", []byte("\xFF\xD8\xFF"), 0644)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	runner := Runner{OutStream: buf, Decoder: jpegDecoder(t), Encoder: pngEncoder(t), Force: true, Jobs: 2, KeepGoing: true}
+
+	err = runner.Run(tempdir)
+
+	expected := "1 file(s) failed"
+	actual := err.Error()
+	if actual != expected {
+		t.Errorf(`expected="%s" actual="%s"`, expected, actual)
+	}
+
+	expectedOut := `Converted: "` + tempdir + `/jpeg/sample1.png"
+Converted: "` + tempdir + `/jpeg/sample2.png"
+Converted: "` + tempdir + `/jpeg/sample3.png"
+Failed: "` + tempdir + `/jpeg/broken.jpg" at decode: unexpected EOF
+`
+	actualOut := buf.String()
+	if actualOut != expectedOut {
+		t.Errorf(`expected="%s" actual="%s"`, expectedOut, actualOut)
+	}
+
+	if len(runner.Failures) != 1 || runner.Failures[0].Stage != "decode" {
+		t.Errorf(`unexpected failures: %v`, runner.Failures)
+	}
+}
+
+func TestCmd_Run_KeepGoing_Gather(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+
+	runner := Runner{OutStream: buf, Decoder: jpegDecoder(t), Encoder: pngEncoder(t), Force: true, KeepGoing: true}
+
+	err := runner.Run("../gathering/testdata/")
+
+	expected := "1 file(s) failed"
+	actual := err.Error()
+	if actual != expected {
+		t.Errorf(`expected="%s" actual="%s"`, expected, actual)
+	}
+
+	expectedOut := `Failed: "../gathering/testdata/empty.jpg" at gather: EOF
+`
+	actualOut := buf.String()
+	if actualOut != expectedOut {
+		t.Errorf(`expected="%s" actual="%s"`, expectedOut, actualOut)
+	}
+}
+
+func TestCmd_Run_OutDir(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+
+	tempdir, cleanFn := withTempDir(t)
+	defer cleanFn()
+
+	outDir, err := ioutil.TempDir("", "imgconv")
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	defer os.RemoveAll(outDir)
+
+	runner := Runner{OutStream: buf, Decoder: pngDecoder(t), Encoder: gifEncoder(t), OutDir: outDir}
+
+	err = runner.Run(tempdir)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	expected := `Converted: "` + outDir + `/png/sample1.gif"
+Converted: "` + outDir + `/png/sample2.gif"
+`
+	actual := buf.String()
+	if actual != expected {
+		t.Errorf(`expected="%s" actual="%s"`, expected, actual)
+	}
+}
+
+func TestCmd_Run_SharedPalette(t *testing.T) {
+	t.Parallel()
+
+	tempdir, err := ioutil.TempDir("", "imgconv")
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	red := color.RGBA{R: 0xFF, A: 0xFF}
+	blue := color.RGBA{B: 0xFF, A: 0xFF}
+	for name, c := range map[string]color.RGBA{"red": red, "blue": blue} {
+		img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+		draw.Draw(img, img.Rect, image.NewUniform(c), image.Point{}, draw.Src)
+		writePng(t, filepath.Join(tempdir, name+".png"), img)
+	}
+
+	runner := Runner{OutStream: &bytes.Buffer{}, Decoder: pngDecoder(t), Encoder: &conversion.Gif{Options: &gif.Options{NumColors: 256}}, SharedPalette: true}
+
+	err = runner.Run(tempdir)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	// Both are converted with the palette of both colors.
+	expected := color.Palette{blue, red}
+	for _, name := range []string{"red", "blue"} {
+		fp, err := os.Open(filepath.Join(tempdir, name+".gif"))
+		if err != nil {
+			t.Fatalf("err %s", err)
+		}
+		img, err := gif.Decode(fp)
+		fp.Close()
+		if err != nil {
+			t.Fatalf("err %s", err)
+		}
+
+		actual := img.(*image.Paletted).Palette
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf(`expected="%v" actual="%v"`, expected, actual)
+		}
+	}
+}
+
+func TestCmd_Run_Pages(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+
+	tempdir, err := ioutil.TempDir("", "imgconv")
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	fp, err := os.Create(tempdir + "/scan.tiff")
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	err = (&conversion.Tiff{}).EncodeAll(fp, []image.Image{image.NewGray(image.Rect(0, 0, 2, 2)), image.NewGray(image.Rect(0, 0, 3, 3))})
+	fp.Close()
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	runner := Runner{OutStream: buf, Decoder: &conversion.Tiff{}, Encoder: pngEncoder(t)}
+
+	err = runner.Run(tempdir)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	expected := `Converted: "` + tempdir + `/scan_0001.png"
+Converted: "` + tempdir + `/scan_0002.png"
+`
+	actual := buf.String()
+	if actual != expected {
+		t.Errorf(`expected="%s" actual="%s"`, expected, actual)
+	}
+}
+
+func TestCmd_Run_DryRun(t *testing.T) {
+	cases := map[string]struct {
+		force    bool
+		expected func(string) string
+	}{
+		"without -f": {force: false, expected: func(tempdir string) string {
+			return `Would be blocked: "` + tempdir + `/jpeg/sample1.jpg" -> "` + tempdir + `/jpeg/sample1.png"
+Would convert: "` + tempdir + `/jpeg/sample2.jpg" -> "` + tempdir + `/jpeg/sample2.png"
+Would convert: "` + tempdir + `/jpeg/sample3.jpeg" -> "` + tempdir + `/jpeg/sample3.png"
+Would be blocked: "` + tempdir + `/jpeg/sample3.jpg" -> "` + tempdir + `/jpeg/sample3.png"
+`
+		}},
+		"with -f": {force: true, expected: func(tempdir string) string {
+			return `Would overwrite: "` + tempdir + `/jpeg/sample1.jpg" -> "` + tempdir + `/jpeg/sample1.png"
+Would convert: "` + tempdir + `/jpeg/sample2.jpg" -> "` + tempdir + `/jpeg/sample2.png"
+Would convert: "` + tempdir + `/jpeg/sample3.jpeg" -> "` + tempdir + `/jpeg/sample3.png"
+Would be blocked: "` + tempdir + `/jpeg/sample3.jpg" -> "` + tempdir + `/jpeg/sample3.png"
+`
+		}},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			buf := &bytes.Buffer{}
+
+			tempdir, cleanFn := withTempDir(t)
+			defer cleanFn()
+
+			// sample1.png exists, and sample3.jpeg and sample3.jpg are converted to the same path.
+			copyFile(t, tempdir+"/jpeg/sample1.jpg", tempdir+"/jpeg/sample1.png")
+			copyFile(t, tempdir+"/jpeg/sample3.jpeg", tempdir+"/jpeg/sample3.jpg")
+
+			runner := Runner{OutStream: buf, Decoder: jpegDecoder(t), Encoder: pngEncoder(t), Force: c.force, DryRun: true}
+
+			err := runner.Run(tempdir)
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+
+			expected := c.expected(tempdir)
+			actual := buf.String()
+			if actual != expected {
+				t.Errorf(`expected="%s" actual="%s"`, expected, actual)
+			}
+
+			// Nothing is written.
+			for _, name := range []string{"sample2.png", "sample3.png"} {
+				if _, err := os.Stat(tempdir + "/jpeg/" + name); !os.IsNotExist(err) {
+					t.Errorf("%s is written", name)
+				}
+			}
+		})
+	}
+}
+
+func TestCmd_Run_DryRun_Pages(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+
+	tempdir, err := ioutil.TempDir("", "imgconv")
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	fp, err := os.Create(tempdir + "/scan.tiff")
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	err = (&conversion.Tiff{}).EncodeAll(fp, []image.Image{image.NewGray(image.Rect(0, 0, 2, 2)), image.NewGray(image.Rect(0, 0, 3, 3))})
+	fp.Close()
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	// Only the second page exists.
+	err = ioutil.WriteFile(tempdir+"/scan_0002.png", nil, 0644)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	runner := Runner{OutStream: buf, Decoder: &conversion.Tiff{}, Encoder: pngEncoder(t), DryRun: true}
+
+	err = runner.Run(tempdir)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	expected := `Would convert: "` + tempdir + `/scan.tiff" -> "` + tempdir + `/scan_0001.png"
+Would be blocked: "` + tempdir + `/scan.tiff" -> "` + tempdir + `/scan_0002.png"
+`
+	actual := buf.String()
+	if actual != expected {
+		t.Errorf(`expected="%s" actual="%s"`, expected, actual)
+	}
+}
+
+func TestCmd_Run_JSON(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+
+	tempdir, cleanFn := withTempDir(t)
+	defer cleanFn()
+
+	err := ioutil.WriteFile(tempdir+"/gif/broken.gif", []byte("GIF89a"), 0644)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	runner := Runner{OutStream: buf, Decoder: gifDecoder(t), Encoder: pngEncoder(t), Force: true, KeepGoing: true, ReportFormat: ReportFormatJSON}
+
+	err = runner.Run(tempdir)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	dec := json.NewDecoder(buf)
+
+	var failed fileRecord
+	if err := dec.Decode(&failed); err != nil {
+		t.Fatalf("err %s", err)
+	}
+	expectedFailed := fileRecord{Type: "file", Source: tempdir + "/gif/broken.gif", InputFormat: "gif", OutputFormat: "png", DurationSeconds: failed.DurationSeconds, Stage: "decode", Error: "gif: reading header: unexpected EOF"}
+	if !reflect.DeepEqual(failed, expectedFailed) {
+		t.Errorf(`expected="%v" actual="%v"`, expectedFailed, failed)
+	}
+
+	var converted fileRecord
+	if err := dec.Decode(&converted); err != nil {
+		t.Fatalf("err %s", err)
+	}
+	if converted.Destination != tempdir+"/gif/sample1.png" || converted.Width != 400 || converted.Height != 400 || converted.SourceBytes != 1429302 || converted.DestinationBytes == 0 {
+		t.Errorf(`unexpected record: %v`, converted)
+	}
+
+	var summary summaryRecord
+	if err := dec.Decode(&summary); err != nil {
+		t.Fatalf("err %s", err)
+	}
+	expectedSummary := summaryRecord{Type: "summary", Total: 2, Converted: 1, Failed: 1, DurationSeconds: summary.DurationSeconds}
+	if summary != expectedSummary {
+		t.Errorf(`expected="%v" actual="%v"`, expectedSummary, summary)
+	}
+
+	if dec.More() {
+		t.Error("unexpected records are written")
+	}
+}
+
+func TestCmd_Run_Incremental(t *testing.T) {
+	t.Parallel()
+
+	tempdir, cleanFn := withTempDir(t)
+	defer cleanFn()
+
+	manifestPath := tempdir + "/manifest.json"
+
+	runner := Runner{OutStream: ioutil.Discard, Decoder: pngDecoder(t), Encoder: jpegEncoder(t), Incremental: true, ManifestPath: manifestPath}
+
+	err := runner.Run(tempdir)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	buf := &bytes.Buffer{}
+	runner.OutStream = buf
+
+	err = runner.Run(tempdir)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	expected := `Skipped: "` + tempdir + `/png/sample1.jpg"
+Skipped: "` + tempdir + `/png/sample2.jpg"
+`
+	actual := buf.String()
+	if actual != expected {
+		t.Errorf(`expected="%s" actual="%s"`, expected, actual)
+	}
+
+	buf.Reset()
+	runner.DryRun = true
+
+	err = runner.Run(tempdir)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	expected = `Would skip: "` + tempdir + `/png/sample1.png" -> "` + tempdir + `/png/sample1.jpg"
+Would skip: "` + tempdir + `/png/sample2.png" -> "` + tempdir + `/png/sample2.jpg"
+`
+	actual = buf.String()
+	if actual != expected {
+		t.Errorf(`expected="%s" actual="%s"`, expected, actual)
+	}
+}
+
+func TestCmd_Run_Incremental_Stale(t *testing.T) {
+	t.Parallel()
+
+	tempdir, cleanFn := withTempDir(t)
+	defer cleanFn()
+
+	runner := Runner{OutStream: ioutil.Discard, Decoder: pngDecoder(t), Encoder: jpegEncoder(t), Incremental: true}
+
+	err := runner.Run(tempdir)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	// Only sample1.png is touched after its conversion.
+	future := time.Now().Add(time.Hour)
+	err = os.Chtimes(tempdir+"/png/sample1.png", future, future)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	buf := &bytes.Buffer{}
+	runner.OutStream = buf
+	runner.DryRun = true
+
+	err = runner.Run(tempdir)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	expected := `Would overwrite: "` + tempdir + `/png/sample1.png" -> "` + tempdir + `/png/sample1.jpg"
+Would skip: "` + tempdir + `/png/sample2.png" -> "` + tempdir + `/png/sample2.jpg"
+`
+	actual := buf.String()
+	if actual != expected {
+		t.Errorf(`expected="%s" actual="%s"`, expected, actual)
+	}
+
+	buf.Reset()
+	runner.DryRun = false
+
+	err = runner.Run(tempdir)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	expected = `Converted: "` + tempdir + `/png/sample1.jpg"
+Skipped: "` + tempdir + `/png/sample2.jpg"
+`
+	actual = buf.String()
+	if actual != expected {
+		t.Errorf(`expected="%s" actual="%s"`, expected, actual)
+	}
+}
+
 func TestCmd_Run_Nonexistence(t *testing.T) {
 	t.Parallel()
 
@@ -139,6 +796,20 @@ func withTempDir(t *testing.T) (string, func()) {
 	return tempdir, func() { os.RemoveAll(tempdir) }
 }
 
+func copyFile(t *testing.T, src string, dst string) {
+	t.Helper()
+
+	b, err := ioutil.ReadFile(src)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	err = ioutil.WriteFile(dst, b, 0644)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+}
+
 func jpegDecoder(t *testing.T) *conversion.Jpeg {
 	t.Helper()
 	var d conversion.Jpeg
@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/hioki-daichi/imgconv/conversion"
+)
+
+// Values of Runner.ReportFormat.
+const (
+	ReportFormatText = "text"
+	ReportFormatJSON = "json"
+)
+
+// Actions of the planned conversions in dry-run mode.
+const (
+	actionConvert   = "convert"
+	actionOverwrite = "overwrite"
+	actionBlocked   = "blocked"
+	actionSkip      = "skip"
+)
+
+// reporter writes the progress of Runner.Run.
+type reporter interface {
+	converted(path string, res result)
+	failed(f *Failure, res result)
+	planned(path string, dstPath string, action string)
+	finish(s *summary)
+}
+
+// summary is the counts of the files processed by Runner.Run.
+type summary struct {
+	total     int
+	converted int
+	skipped   int
+	failures  []*Failure
+	elapsed   time.Duration
+}
+
+func (r *Runner) newReporter() reporter {
+	if r.ReportFormat == ReportFormatJSON {
+		return &jsonReporter{enc: json.NewEncoder(r.OutStream), encoder: r.Encoder}
+	}
+	return &textReporter{w: r.OutStream, keepGoing: r.KeepGoing}
+}
+
+// textReporter writes human-readable lines.
+// The failures are summarized at the end in keep-going mode, otherwise the first one is returned as the error of Run.
+type textReporter struct {
+	w         io.Writer
+	keepGoing bool
+}
+
+func (t *textReporter) converted(path string, res result) {
+	if res.result.Skipped {
+		fmt.Fprintf(t.w, "Skipped: %q\n", res.result.DstPath)
+		return
+	}
+	if len(res.result.PagePaths) > 0 {
+		for _, p := range res.result.PagePaths {
+			fmt.Fprintf(t.w, "Converted: %q\n", p)
+		}
+		return
+	}
+	fmt.Fprintf(t.w, "Converted: %q\n", res.result.DstPath)
+	if n := res.result.DroppedFrames; n > 0 {
+		fmt.Fprintf(t.w, "Warning: %q is animated, but only the first of %d frames is converted since the output file format cannot hold animation\n", path, n+1)
+	}
+}
+
+func (t *textReporter) failed(f *Failure, res result) {}
+
+func (t *textReporter) planned(path string, dstPath string, action string) {
+	switch action {
+	case actionConvert:
+		fmt.Fprintf(t.w, "Would convert: %q -> %q\n", path, dstPath)
+	case actionOverwrite:
+		fmt.Fprintf(t.w, "Would overwrite: %q -> %q\n", path, dstPath)
+	case actionBlocked:
+		fmt.Fprintf(t.w, "Would be blocked: %q -> %q\n", path, dstPath)
+	case actionSkip:
+		fmt.Fprintf(t.w, "Would skip: %q -> %q\n", path, dstPath)
+	}
+}
+
+func (t *textReporter) finish(s *summary) {
+	if !t.keepGoing {
+		return
+	}
+
+	for _, f := range s.failures {
+		fmt.Fprintf(t.w, "Failed: %q at %s: %s\n", f.Path, f.Stage, f.Err)
+	}
+}
+
+// jsonReporter writes JSON Lines, one record per file and a summary record at the end.
+type jsonReporter struct {
+	enc     *json.Encoder
+	encoder conversion.Encoder
+}
+
+type fileRecord struct {
+	Type             string   `json:"type"`
+	Source           string   `json:"source"`
+	Destination      string   `json:"destination,omitempty"`
+	Pages            []string `json:"pages,omitempty"`
+	InputFormat      string   `json:"input_format,omitempty"`
+	OutputFormat     string   `json:"output_format,omitempty"`
+	SourceBytes      int64    `json:"source_bytes,omitempty"`
+	DestinationBytes int64    `json:"destination_bytes,omitempty"`
+	Width            int      `json:"width,omitempty"`
+	Height           int      `json:"height,omitempty"`
+	DroppedFrames    int      `json:"dropped_frames,omitempty"`
+	Skipped          bool     `json:"skipped,omitempty"`
+	DurationSeconds  float64  `json:"duration_seconds"`
+	Stage            string   `json:"stage,omitempty"`
+	Error            string   `json:"error,omitempty"`
+}
+
+type planRecord struct {
+	Type        string `json:"type"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Action      string `json:"action"`
+}
+
+type summaryRecord struct {
+	Type            string  `json:"type"`
+	Total           int     `json:"total"`
+	Converted       int     `json:"converted"`
+	Skipped         int     `json:"skipped"`
+	Failed          int     `json:"failed"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+func (j *jsonReporter) converted(path string, res result) {
+	rec := j.newFileRecord(path, res)
+	rec.Destination = res.result.DstPath
+	rec.Pages = res.result.PagePaths
+	rec.SourceBytes = res.result.SrcSize
+	rec.DestinationBytes = res.result.DstSize
+	rec.Width = res.result.Width
+	rec.Height = res.result.Height
+	rec.DroppedFrames = res.result.DroppedFrames
+	rec.Skipped = res.result.Skipped
+	j.enc.Encode(rec)
+}
+
+func (j *jsonReporter) failed(f *Failure, res result) {
+	rec := j.newFileRecord(f.Path, res)
+	rec.Stage = f.Stage
+	rec.Error = f.Err.Error()
+	j.enc.Encode(rec)
+}
+
+func (j *jsonReporter) newFileRecord(path string, res result) *fileRecord {
+	rec := &fileRecord{Type: "file", Source: path, DurationSeconds: res.duration.Seconds()}
+	if res.decoder != nil {
+		if f := conversion.FormatOfDecoder(res.decoder); f != nil {
+			rec.InputFormat = f.Name
+		}
+	}
+	if f := conversion.FormatOfEncoder(j.encoder); f != nil {
+		rec.OutputFormat = f.Name
+	}
+	return rec
+}
+
+func (j *jsonReporter) planned(path string, dstPath string, action string) {
+	j.enc.Encode(&planRecord{Type: "plan", Source: path, Destination: dstPath, Action: action})
+}
+
+func (j *jsonReporter) finish(s *summary) {
+	j.enc.Encode(&summaryRecord{Type: "summary", Total: s.total, Converted: s.converted, Skipped: s.skipped, Failed: len(s.failures), DurationSeconds: s.elapsed.Seconds()})
+}
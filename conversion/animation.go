@@ -0,0 +1,122 @@
+package conversion
+
+import (
+	"image"
+	"image/draw"
+	"image/gif"
+	"io"
+)
+
+// Animation is an animated image such as an animated GIF.
+type Animation struct {
+	// Frames are drawn in order onto the canvas. Each frame may cover only a part of the canvas, at its bounds.
+	Frames []image.Image
+
+	// Delays are the display times of the frames in 100ths of a second.
+	Delays []int
+
+	// Disposals tell what is done to the canvas after each frame is displayed, such as gif.DisposalBackground.
+	Disposals []byte
+
+	// Blends tell how each frame is drawn onto the canvas, BlendOver or BlendSource. nil means BlendOver for all the frames.
+	Blends []byte
+
+	// LoopCount is as of image/gif. 0 loops forever, -1 shows the frames once, and n shows them n+1 times.
+	LoopCount int
+
+	// Width and Height of the canvas.
+	Width  int
+	Height int
+}
+
+// Blends of Animation
+const (
+	// The frame is drawn over the canvas, as in GIF.
+	BlendOver = 0
+	// The frame replaces the area of the canvas including alpha, as APNG can do.
+	BlendSource = 1
+)
+
+// AnimationDecoder is implemented by the decoders of the formats which can hold animation.
+// Decode of such a decoder returns only the first frame.
+type AnimationDecoder interface {
+	DecodeAnimation(io.Reader) (*Animation, error)
+}
+
+// AnimationEncoder is implemented by the encoders of the formats which can hold animation.
+// When the encoder is not an AnimationEncoder, only the first frame of an animation is converted. See Result.DroppedFrames.
+type AnimationEncoder interface {
+	EncodeAnimation(io.Writer, *Animation) error
+}
+
+// Composite returns the frames as they are displayed, each covering the whole canvas.
+// The area of a frame disposed to the background is cleared to transparent, as browsers do.
+func (a *Animation) Composite() []image.Image {
+	canvas := image.NewRGBA(image.Rect(0, 0, a.Width, a.Height))
+
+	imgs := make([]image.Image, len(a.Frames))
+	for i, frame := range a.Frames {
+		var disposal byte
+		if i < len(a.Disposals) {
+			disposal = a.Disposals[i]
+		}
+
+		var previous *image.RGBA
+		if disposal == gif.DisposalPrevious {
+			previous = cloneRGBA(canvas)
+		}
+
+		op := draw.Over
+		if a.blend(i) == BlendSource {
+			op = draw.Src
+		}
+
+		bounds := frame.Bounds()
+		draw.Draw(canvas, bounds, frame, bounds.Min, op)
+		imgs[i] = cloneRGBA(canvas)
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, bounds, image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+
+	return imgs
+}
+
+func (a *Animation) blend(i int) byte {
+	if i < len(a.Blends) {
+		return a.Blends[i]
+	}
+	return BlendOver
+}
+
+// blendsSource returns whether any frame has to replace what the previous frames left on the canvas.
+func (a *Animation) blendsSource() bool {
+	for i, frame := range a.Frames {
+		if i > 0 && a.blend(i) == BlendSource && !isOpaque(frame) {
+			return true
+		}
+	}
+	return false
+}
+
+// flatten replaces the frames with the composited ones, which can be transformed independently of each other.
+func (a *Animation) flatten() {
+	a.Frames = a.Composite()
+	a.Blends = nil
+
+	// Each frame covers the whole canvas, so that the previous one must be cleared.
+	a.Disposals = make([]byte, len(a.Frames))
+	for i := range a.Disposals {
+		a.Disposals[i] = gif.DisposalBackground
+	}
+}
+
+func cloneRGBA(img *image.RGBA) *image.RGBA {
+	dst := image.NewRGBA(img.Rect)
+	copy(dst.Pix, img.Pix)
+	return dst
+}
@@ -0,0 +1,58 @@
+package conversion
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+)
+
+func TestConversion_Animation_Composite(t *testing.T) {
+	t.Parallel()
+
+	red := color.NRGBA{R: 0xFF, A: 0xFF}
+	green := color.NRGBA{G: 0xFF, A: 0xFF}
+	blue := color.NRGBA{B: 0xFF, A: 0xFF}
+	white := color.NRGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}
+	transparent := color.NRGBA{}
+
+	a := &Animation{
+		Frames: []image.Image{
+			uniformNRGBA(image.Rect(0, 0, 2, 1), red),
+			uniformNRGBA(image.Rect(1, 0, 2, 1), blue),
+			uniformNRGBA(image.Rect(0, 0, 1, 1), green),
+			uniformNRGBA(image.Rect(1, 0, 2, 1), white),
+		},
+		Disposals: []byte{gif.DisposalNone, gif.DisposalBackground, gif.DisposalPrevious, gif.DisposalNone},
+		Width:     2,
+		Height:    1,
+	}
+
+	expected := [][]color.NRGBA{
+		{red, red},
+		{red, blue},
+		{green, transparent},
+		{red, white},
+	}
+
+	actual := a.Composite()
+
+	for i, img := range actual {
+		if img.Bounds() != image.Rect(0, 0, 2, 1) {
+			t.Errorf(`expected="%v" actual="%v"`, image.Rect(0, 0, 2, 1), img.Bounds())
+		}
+		for x, e := range expected[i] {
+			if c := color.NRGBAModel.Convert(img.At(x, 0)); c != e {
+				t.Errorf(`frame %d (%d, 0): expected="%v" actual="%v"`, i, x, e, c)
+			}
+		}
+	}
+}
+
+func uniformNRGBA(r image.Rectangle, c color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(r)
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+	return img
+}
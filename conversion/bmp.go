@@ -0,0 +1,515 @@
+package conversion
+
+import (
+	"encoding/binary"
+	"errors"
+	"flag"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"io/ioutil"
+	"math/bits"
+	"path/filepath"
+)
+
+func init() {
+	Register(&Format{
+		Name:       "bmp",
+		Shorthand:  "b",
+		Extnames:   []string{".bmp"},
+		NewDecoder: func() Decoder { return &Bmp{} },
+		DefineEncoderFlags: func(flg *flag.FlagSet) EncoderFactory {
+			return func() (Encoder, error) {
+				return &Bmp{}, nil
+			}
+		},
+	})
+}
+
+// Bmp https://en.wikipedia.org/wiki/BMP_file_format
+type Bmp struct{}
+
+// Compression methods of BMP
+const (
+	bmpRGB            = 0
+	bmpRLE8           = 1
+	bmpRLE4           = 2
+	bmpBitFields      = 3
+	bmpAlphaBitFields = 6
+)
+
+const (
+	bmpFileHeaderLen = 14
+	bmpCoreHeaderLen = 12
+	bmpInfoHeaderLen = 40
+	bmpV4HeaderLen   = 108
+)
+
+var errBmpUnsupported = errors.New("bmp: unsupported format")
+
+// Encode encodes the specified file to BMP.
+// Paletted images are written in 8 bits, opaque images in 24 bits and the others in 32 bits with alpha.
+func (b *Bmp) Encode(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	paletted, isPaletted := img.(*image.Paletted)
+	if isPaletted && !opaquePalette(paletted.Palette) {
+		isPaletted = false
+	}
+	opaque := isOpaque(img)
+
+	var bpp, headerLen, paletteLen int
+	var compression uint32
+	switch {
+	case isPaletted:
+		bpp, headerLen, paletteLen, compression = 8, bmpInfoHeaderLen, 4*len(paletted.Palette), bmpRGB
+	case opaque:
+		bpp, headerLen, paletteLen, compression = 24, bmpInfoHeaderLen, 0, bmpRGB
+	default:
+		bpp, headerLen, paletteLen, compression = 32, bmpV4HeaderLen, 0, bmpBitFields
+	}
+
+	stride := bmpStride(width, bpp)
+	offset := bmpFileHeaderLen + headerLen + paletteLen
+	size := offset + stride*height
+
+	header := make([]byte, offset)
+	copy(header, "BM")
+	binary.LittleEndian.PutUint32(header[2:], uint32(size))
+	binary.LittleEndian.PutUint32(header[10:], uint32(offset))
+
+	dib := header[bmpFileHeaderLen:]
+	binary.LittleEndian.PutUint32(dib[0:], uint32(headerLen))
+	binary.LittleEndian.PutUint32(dib[4:], uint32(width))
+	binary.LittleEndian.PutUint32(dib[8:], uint32(height))
+	binary.LittleEndian.PutUint16(dib[12:], 1)
+	binary.LittleEndian.PutUint16(dib[14:], uint16(bpp))
+	binary.LittleEndian.PutUint32(dib[16:], compression)
+	binary.LittleEndian.PutUint32(dib[20:], uint32(stride*height))
+	// 72 DPI
+	binary.LittleEndian.PutUint32(dib[24:], 2835)
+	binary.LittleEndian.PutUint32(dib[28:], 2835)
+
+	if isPaletted {
+		binary.LittleEndian.PutUint32(dib[32:], uint32(len(paletted.Palette)))
+		for i, c := range paletted.Palette {
+			r, g, b, _ := c.RGBA()
+			copy(dib[headerLen+4*i:], []byte{byte(b >> 8), byte(g >> 8), byte(r >> 8), 0})
+		}
+	}
+
+	if compression == bmpBitFields {
+		binary.LittleEndian.PutUint32(dib[40:], 0x00FF0000)
+		binary.LittleEndian.PutUint32(dib[44:], 0x0000FF00)
+		binary.LittleEndian.PutUint32(dib[48:], 0x000000FF)
+		binary.LittleEndian.PutUint32(dib[52:], 0xFF000000)
+		// LCS_sRGB
+		copy(dib[56:], "BGRs")
+	}
+
+	_, err := w.Write(header)
+	if err != nil {
+		return err
+	}
+
+	// Rows are stored bottom-up.
+	row := make([]byte, stride)
+	for y := bounds.Max.Y - 1; y >= bounds.Min.Y; y-- {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			i := x - bounds.Min.X
+			switch bpp {
+			case 8:
+				row[i] = paletted.ColorIndexAt(x, y)
+			case 24:
+				c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+				row[3*i], row[3*i+1], row[3*i+2] = c.B, c.G, c.R
+			case 32:
+				c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+				row[4*i], row[4*i+1], row[4*i+2], row[4*i+3] = c.B, c.G, c.R, c.A
+			}
+		}
+
+		_, err := w.Write(row)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Decode decodes the specified BMP file.
+// It supports 1, 4, 8, 16, 24 and 32 bits per pixel, RLE8 and RLE4 compression and bit fields.
+func (b *Bmp) Decode(r io.Reader) (image.Image, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < bmpFileHeaderLen+4 || string(data[:2]) != "BM" {
+		return nil, errors.New("bmp: invalid format")
+	}
+	offset := int(binary.LittleEndian.Uint32(data[10:]))
+
+	return decodeBmpDIB(data[bmpFileHeaderLen:], offset-bmpFileHeaderLen, false)
+}
+
+// decodeBmpDIB decodes the DIB, which is the BMP file without the file header, whose pixels start at offset.
+// The DIB of an icon differs from that of BMP: the pixels follow the palette, the height includes the AND mask following the pixels
+// and the fourth byte of 32 bits BI_RGB is alpha. The pixels where the AND mask is set are transparent.
+func decodeBmpDIB(dib []byte, offset int, icon bool) (image.Image, error) {
+	if len(dib) < 4 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	headerLen := int(binary.LittleEndian.Uint32(dib))
+	if len(dib) < headerLen || (headerLen != bmpCoreHeaderLen && headerLen < bmpInfoHeaderLen) {
+		return nil, errors.New("bmp: invalid header")
+	}
+
+	var width, height, bpp, compression, numColors int
+	paletteEntryLen := 4
+	if headerLen == bmpCoreHeaderLen {
+		width = int(binary.LittleEndian.Uint16(dib[4:]))
+		height = int(int16(binary.LittleEndian.Uint16(dib[6:])))
+		bpp = int(binary.LittleEndian.Uint16(dib[10:]))
+		paletteEntryLen = 3
+	} else {
+		width = int(int32(binary.LittleEndian.Uint32(dib[4:])))
+		height = int(int32(binary.LittleEndian.Uint32(dib[8:])))
+		bpp = int(binary.LittleEndian.Uint16(dib[14:]))
+		compression = int(binary.LittleEndian.Uint32(dib[16:]))
+		numColors = int(binary.LittleEndian.Uint32(dib[32:]))
+	}
+	if icon {
+		height /= 2
+	}
+
+	// A negative height means top-down.
+	topDown := height < 0
+	if topDown {
+		height = -height
+	}
+	if width <= 0 || height <= 0 || width > 1<<16 || height > 1<<16 {
+		return nil, errors.New("bmp: invalid dimensions")
+	}
+
+	switch bpp {
+	case 1, 4, 8, 16, 24, 32:
+	default:
+		return nil, errBmpUnsupported
+	}
+
+	masks, err := bmpMasks(dib, headerLen, bpp, compression)
+	if err != nil {
+		return nil, err
+	}
+	if icon && bpp == 32 && compression == bmpRGB {
+		masks[3] = 0xFF000000
+	}
+
+	var palette color.Palette
+	if bpp <= 8 {
+		if numColors == 0 || numColors > 1<<uint(bpp) {
+			numColors = 1 << uint(bpp)
+		}
+		for i := 0; i < numColors; i++ {
+			p := headerLen + paletteEntryLen*i
+			if p+3 > len(dib) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			palette = append(palette, color.RGBA{R: dib[p+2], G: dib[p+1], B: dib[p], A: 0xFF})
+		}
+	}
+
+	if icon {
+		offset = headerLen + paletteEntryLen*len(palette)
+		if headerLen == bmpInfoHeaderLen && compression == bmpBitFields {
+			offset += 12
+		}
+	}
+	if offset < 0 || offset > len(dib) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	pixels := dib[offset:]
+
+	var img image.Image
+	switch {
+	case compression == bmpRLE8 && bpp == 8, compression == bmpRLE4 && bpp == 4:
+		img, err = decodeBmpRLE(pixels, width, height, bpp, palette)
+	case compression == bmpRGB && (bpp == 1 || bpp == 4 || bpp == 8):
+		img, err = decodeBmpPaletted(pixels, width, height, bpp, topDown, palette)
+	case (compression == bmpRGB || compression == bmpBitFields || compression == bmpAlphaBitFields) && (bpp == 16 || bpp == 24 || bpp == 32):
+		img, err = decodeBmpTrueColor(pixels, width, height, bpp, topDown, masks)
+	default:
+		return nil, errBmpUnsupported
+	}
+	if err != nil || !icon {
+		return img, err
+	}
+
+	var mask []byte
+	if n := bmpStride(width, bpp) * height; n <= len(pixels) {
+		mask = pixels[n:]
+	}
+	return applyBmpIconMask(img, mask, masks[3] != 0)
+}
+
+// applyBmpIconMask makes the pixels transparent where the AND mask of the icon is set.
+// The mask is ignored if the image has alpha, unless the alpha is all zero, which some writers produce.
+func applyBmpIconMask(img image.Image, mask []byte, hasAlpha bool) (image.Image, error) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	dst, ok := img.(*image.NRGBA)
+	if !ok {
+		dst = image.NewNRGBA(bounds)
+		draw.Draw(dst, bounds, img, image.Point{}, draw.Src)
+	}
+
+	if hasAlpha {
+		for i := 3; i < len(dst.Pix); i += 4 {
+			if dst.Pix[i] != 0 {
+				return dst, nil
+			}
+		}
+		for i := 3; i < len(dst.Pix); i += 4 {
+			dst.Pix[i] = 0xFF
+		}
+	}
+
+	stride := bmpStride(width, 1)
+	if len(mask) < stride*height {
+		// 32 bits icons may omit the mask.
+		if hasAlpha {
+			return dst, nil
+		}
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	// Rows are stored bottom-up.
+	for row := 0; row < height; row++ {
+		y := height - 1 - row
+		for x := 0; x < width; x++ {
+			if mask[row*stride+x/8]>>uint(7-x%8)&1 != 0 {
+				dst.Pix[y*dst.Stride+4*x+3] = 0
+			}
+		}
+	}
+
+	return dst, nil
+}
+
+// Extname returns "bmp"
+func (b *Bmp) Extname() string {
+	return "bmp"
+}
+
+// MagicBytesSlice returns the magic bytes slice of BMP
+func (b *Bmp) MagicBytesSlice() [][]byte {
+	return [][]byte{[]byte("BM")}
+}
+
+// HasProcessableExtname returns whether the specified path has ".bmp"
+func (b *Bmp) HasProcessableExtname(path string) bool {
+	return filepath.Ext(path) == ".bmp"
+}
+
+func bmpStride(width int, bpp int) int {
+	return (bpp*width + 31) / 32 * 4
+}
+
+// bmpMasks returns the red, green, blue and alpha masks of the DIB. A zero alpha mask means opaque.
+func bmpMasks(dib []byte, headerLen int, bpp int, compression int) ([4]uint32, error) {
+	switch compression {
+	case bmpBitFields, bmpAlphaBitFields:
+		n := 3
+		if compression == bmpAlphaBitFields || headerLen >= 56 {
+			n = 4
+		}
+		if len(dib) < bmpInfoHeaderLen+4*n {
+			return [4]uint32{}, io.ErrUnexpectedEOF
+		}
+		var masks [4]uint32
+		for i := 0; i < n; i++ {
+			masks[i] = binary.LittleEndian.Uint32(dib[bmpInfoHeaderLen+4*i:])
+		}
+		return masks, nil
+	case bmpRGB:
+		switch bpp {
+		case 16:
+			return [4]uint32{0x7C00, 0x03E0, 0x001F, 0}, nil
+		case 24, 32:
+			// The fourth byte of 32 bits BI_RGB is usually garbage, so it is regarded as opaque.
+			return [4]uint32{0xFF0000, 0x00FF00, 0x0000FF, 0}, nil
+		}
+	}
+
+	return [4]uint32{}, nil
+}
+
+func decodeBmpPaletted(pixels []byte, width int, height int, bpp int, topDown bool, palette color.Palette) (image.Image, error) {
+	stride := bmpStride(width, bpp)
+	if len(pixels) < stride*height {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	img := image.NewPaletted(image.Rect(0, 0, width, height), palette)
+	for row := 0; row < height; row++ {
+		y := row
+		if !topDown {
+			y = height - 1 - row
+		}
+		src := pixels[row*stride:]
+		for x := 0; x < width; x++ {
+			bit := x * bpp
+			index := src[bit/8] >> uint(8-bpp-bit%8) & (1<<uint(bpp) - 1)
+			img.Pix[y*img.Stride+x] = bmpIndex(index, palette)
+		}
+	}
+
+	return img, nil
+}
+
+// bmpIndex clamps out-of-range indexes, which some writers produce, to the palette.
+func bmpIndex(index byte, palette color.Palette) byte {
+	if int(index) >= len(palette) {
+		return 0
+	}
+	return index
+}
+
+func decodeBmpTrueColor(pixels []byte, width int, height int, bpp int, topDown bool, masks [4]uint32) (image.Image, error) {
+	stride := bmpStride(width, bpp)
+	if len(pixels) < stride*height {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	bytesPerPixel := bpp / 8
+	for row := 0; row < height; row++ {
+		y := row
+		if !topDown {
+			y = height - 1 - row
+		}
+		src := pixels[row*stride:]
+		dst := img.Pix[y*img.Stride:]
+		for x := 0; x < width; x++ {
+			var v uint32
+			for i := 0; i < bytesPerPixel; i++ {
+				v |= uint32(src[x*bytesPerPixel+i]) << uint(8*i)
+			}
+			dst[4*x] = bmpComponent(v, masks[0])
+			dst[4*x+1] = bmpComponent(v, masks[1])
+			dst[4*x+2] = bmpComponent(v, masks[2])
+			dst[4*x+3] = 0xFF
+			if masks[3] != 0 {
+				dst[4*x+3] = bmpComponent(v, masks[3])
+			}
+		}
+	}
+
+	return img, nil
+}
+
+// bmpComponent extracts the masked bits and scales them to 8 bits.
+func bmpComponent(v uint32, mask uint32) byte {
+	if mask == 0 {
+		return 0
+	}
+	shift := uint(bits.TrailingZeros32(mask))
+	n := uint(bits.OnesCount32(mask))
+	c := (v & mask) >> shift
+	if n >= 8 {
+		return byte(c >> (n - 8))
+	}
+	// Replicate the high bits into the low ones, e.g. 5 bits 0x1F becomes 0xFF.
+	return byte(c * 0xFF / (1<<n - 1))
+}
+
+// decodeBmpRLE decodes RLE8 and RLE4, which are always bottom-up. Skipped pixels are left as index 0.
+func decodeBmpRLE(pixels []byte, width int, height int, bpp int, palette color.Palette) (image.Image, error) {
+	img := image.NewPaletted(image.Rect(0, 0, width, height), palette)
+
+	x, y := 0, height-1
+	set := func(index byte) {
+		if x < width && y >= 0 {
+			img.Pix[y*img.Stride+x] = bmpIndex(index, palette)
+		}
+		x++
+	}
+
+	for i := 0; ; {
+		if i+2 > len(pixels) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		count, value := int(pixels[i]), pixels[i+1]
+		i += 2
+
+		if count > 0 {
+			// Encoded mode: count pixels of the value, whose nibbles alternate in RLE4.
+			for n := 0; n < count; n++ {
+				if bpp == 8 {
+					set(value)
+				} else if n%2 == 0 {
+					set(value >> 4)
+				} else {
+					set(value & 0x0F)
+				}
+			}
+			continue
+		}
+
+		switch value {
+		case 0: // end of line
+			x, y = 0, y-1
+		case 1: // end of bitmap
+			return img, nil
+		case 2: // delta
+			if i+2 > len(pixels) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			x, y = x+int(pixels[i]), y-int(pixels[i+1])
+			i += 2
+		default: // absolute mode: value pixels follow, padded to 16 bits
+			n := int(value)
+			length := n
+			if bpp == 4 {
+				length = (n + 1) / 2
+			}
+			if i+length > len(pixels) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			for k := 0; k < n; k++ {
+				if bpp == 8 {
+					set(pixels[i+k])
+				} else if k%2 == 0 {
+					set(pixels[i+k/2] >> 4)
+				} else {
+					set(pixels[i+k/2] & 0x0F)
+				}
+			}
+			i += length + length%2
+		}
+	}
+}
+
+func opaquePalette(palette color.Palette) bool {
+	for _, c := range palette {
+		if _, _, _, a := c.RGBA(); a != 0xFFFF {
+			return false
+		}
+	}
+	return len(palette) <= 256
+}
+
+// isOpaque reports whether the image is known to be fully opaque.
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface {
+		Opaque() bool
+	}); ok {
+		return o.Opaque()
+	}
+	return false
+}
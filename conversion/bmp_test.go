@@ -0,0 +1,257 @@
+package conversion
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func TestConversion_Bmp_MagicBytesSlice(t *testing.T) {
+	t.Parallel()
+
+	expected := [][]byte{[]byte("BM")}
+
+	b := Bmp{}
+
+	actual := b.MagicBytesSlice()
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf(`expected="%s" actual="%s"`, expected, actual)
+	}
+}
+
+func TestConversion_Bmp_HasProcessableExtname(t *testing.T) {
+	b := Bmp{}
+
+	cases := map[string]struct {
+		path     string
+		expected bool
+	}{
+		"foo.bmp": {path: "foo.bmp", expected: true},
+		"foo.jpg": {path: "foo.jpg", expected: false},
+		"foo.png": {path: "foo.png", expected: false},
+		"foo.gif": {path: "foo.gif", expected: false},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			actual := b.HasProcessableExtname(c.path)
+			if actual != c.expected {
+				t.Errorf(`expected="%t" actual="%t"`, c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestConversion_Bmp_EncodeDecode(t *testing.T) {
+	nrgba := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	rgba := image.NewRGBA(image.Rect(0, 0, 5, 3))
+	paletted := image.NewPaletted(image.Rect(0, 0, 7, 2), color.Palette{color.RGBA{A: 0xFF}, color.RGBA{R: 0xFF, A: 0xFF}, color.RGBA{B: 0xFF, A: 0xFF}})
+	for i := range nrgba.Pix {
+		nrgba.Pix[i] = byte(i * 10)
+	}
+	for i := range rgba.Pix {
+		rgba.Pix[i] = byte(i * 5)
+		if i%4 == 3 {
+			rgba.Pix[i] = 0xFF
+		}
+	}
+	for i := range paletted.Pix {
+		paletted.Pix[i] = byte(i % 3)
+	}
+
+	cases := map[string]struct {
+		img image.Image
+		bpp uint16
+	}{
+		"32 bits": {img: nrgba, bpp: 32},
+		"24 bits": {img: rgba, bpp: 24},
+		"8 bits":  {img: paletted, bpp: 8},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			b := &Bmp{}
+			buf := &bytes.Buffer{}
+
+			err := b.Encode(buf, c.img)
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+
+			if bpp := binary.LittleEndian.Uint16(buf.Bytes()[28:]); bpp != c.bpp {
+				t.Errorf(`expected=%d actual=%d`, c.bpp, bpp)
+			}
+
+			img, err := b.Decode(buf)
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+
+			assertSameImage(t, c.img, img)
+		})
+	}
+}
+
+func TestConversion_Bmp_Decode(t *testing.T) {
+	black := color.RGBA{A: 0xFF}
+	white := color.RGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}
+	red := color.RGBA{R: 0xFF, A: 0xFF}
+	blue := color.RGBA{B: 0xFF, A: 0xFF}
+	palette := [][3]byte{{0, 0, 0}, {0xFF, 0xFF, 0xFF}, {0xFF, 0, 0}, {0, 0, 0xFF}}
+
+	cases := map[string]struct {
+		data     []byte
+		expected [][]color.RGBA
+	}{
+		"1 bit, bottom-up": {
+			data:     bmpFile(bmpInfoHeaderLen, 3, 2, 1, bmpRGB, palette[:2], []byte{0xA0, 0, 0, 0, 0x40, 0, 0, 0}),
+			expected: [][]color.RGBA{{black, white, black}, {white, black, white}},
+		},
+		"4 bits, top-down": {
+			data:     bmpFile(bmpInfoHeaderLen, 3, -2, 4, bmpRGB, palette, []byte{0x01, 0x20, 0, 0, 0x32, 0x10, 0, 0}),
+			expected: [][]color.RGBA{{black, white, red}, {blue, red, white}},
+		},
+		"8 bits": {
+			data:     bmpFile(bmpInfoHeaderLen, 2, 1, 8, bmpRGB, palette, []byte{3, 2, 0, 0}),
+			expected: [][]color.RGBA{{blue, red}},
+		},
+		"16 bits, 5-6-5 bit fields": {
+			data:     bmpFile(bmpInfoHeaderLen, 2, 1, 16, bmpBitFields, nil, []byte{0x00, 0xF8, 0x00, 0xF8, 0x1F, 0x00, 0x00, 0x00}[4:], 0xF800, 0x07E0, 0x001F),
+			expected: [][]color.RGBA{{blue, black}},
+		},
+		"16 bits, 5-5-5": {
+			data:     bmpFile(bmpInfoHeaderLen, 2, 1, 16, bmpRGB, nil, []byte{0x00, 0x7C, 0xFF, 0x7F}),
+			expected: [][]color.RGBA{{red, white}},
+		},
+		"24 bits, OS/2 header": {
+			data:     bmpFile(bmpCoreHeaderLen, 1, 2, 24, bmpRGB, nil, []byte{0xFF, 0, 0, 0, 0, 0, 0xFF, 0}),
+			expected: [][]color.RGBA{{red}, {blue}},
+		},
+		"RLE8": {
+			// 2 pixels of 2, end of line, absolute 3 pixels (padded), end of bitmap
+			data:     bmpFile(bmpInfoHeaderLen, 3, 2, 8, bmpRLE8, palette, []byte{2, 2, 0, 0, 0, 3, 1, 3, 1, 0, 0, 1}),
+			expected: [][]color.RGBA{{white, blue, white}, {red, red, black}},
+		},
+		"RLE4": {
+			// 3 pixels alternating 1 and 3, end of line, delta to skip a row, end of bitmap
+			data:     bmpFile(bmpInfoHeaderLen, 3, 3, 4, bmpRLE4, palette, []byte{3, 0x13, 0, 0, 0, 2, 0, 1, 0, 1}),
+			expected: [][]color.RGBA{{black, black, black}, {black, black, black}, {white, blue, white}},
+		},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			img, err := (&Bmp{}).Decode(bytes.NewReader(c.data))
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+
+			for y, row := range c.expected {
+				for x, expected := range row {
+					actual := color.RGBAModel.Convert(img.At(x, y))
+					if actual != expected {
+						t.Errorf(`(%d, %d): expected="%v" actual="%v"`, x, y, expected, actual)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestConversion_Bmp_Decode_Failure(t *testing.T) {
+	cases := map[string]struct {
+		data     []byte
+		expected string
+	}{
+		"not BMP":         {data: []byte("GIF89a\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"), expected: "bmp: invalid format"},
+		"truncated":       {data: bmpFile(bmpInfoHeaderLen, 2, 2, 24, bmpRGB, nil, []byte{0, 0, 0}), expected: "unexpected EOF"},
+		"unsupported bpp": {data: bmpFile(bmpInfoHeaderLen, 1, 1, 2, bmpRGB, nil, []byte{0, 0, 0, 0}), expected: "bmp: unsupported format"},
+		"zero width":      {data: bmpFile(bmpInfoHeaderLen, 0, 1, 24, bmpRGB, nil, nil), expected: "bmp: invalid dimensions"},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := (&Bmp{}).Decode(bytes.NewReader(c.data))
+
+			actual := err.Error()
+			if actual != c.expected {
+				t.Errorf(`expected="%s" actual="%s"`, c.expected, actual)
+			}
+		})
+	}
+}
+
+// bmpFile builds a BMP file. masks are written after the header for bit fields.
+func bmpFile(headerLen int, width int, height int, bpp int, compression int, palette [][3]byte, pixels []byte, masks ...uint32) []byte {
+	paletteEntryLen := 4
+	if headerLen == bmpCoreHeaderLen {
+		paletteEntryLen = 3
+	}
+
+	dib := make([]byte, headerLen)
+	binary.LittleEndian.PutUint32(dib, uint32(headerLen))
+	if headerLen == bmpCoreHeaderLen {
+		binary.LittleEndian.PutUint16(dib[4:], uint16(width))
+		binary.LittleEndian.PutUint16(dib[6:], uint16(height))
+		binary.LittleEndian.PutUint16(dib[8:], 1)
+		binary.LittleEndian.PutUint16(dib[10:], uint16(bpp))
+	} else {
+		binary.LittleEndian.PutUint32(dib[4:], uint32(int32(width)))
+		binary.LittleEndian.PutUint32(dib[8:], uint32(int32(height)))
+		binary.LittleEndian.PutUint16(dib[12:], 1)
+		binary.LittleEndian.PutUint16(dib[14:], uint16(bpp))
+		binary.LittleEndian.PutUint32(dib[16:], uint32(compression))
+		binary.LittleEndian.PutUint32(dib[32:], uint32(len(palette)))
+	}
+
+	for _, mask := range masks {
+		dib = append(dib, 0, 0, 0, 0)
+		binary.LittleEndian.PutUint32(dib[len(dib)-4:], mask)
+	}
+
+	for _, c := range palette {
+		entry := []byte{c[2], c[1], c[0], 0}
+		dib = append(dib, entry[:paletteEntryLen]...)
+	}
+
+	header := make([]byte, bmpFileHeaderLen)
+	copy(header, "BM")
+	binary.LittleEndian.PutUint32(header[2:], uint32(bmpFileHeaderLen+len(dib)+len(pixels)))
+	binary.LittleEndian.PutUint32(header[10:], uint32(bmpFileHeaderLen+len(dib)))
+
+	return append(append(header, dib...), pixels...)
+}
+
+func assertSameImage(t *testing.T, expected image.Image, actual image.Image) {
+	t.Helper()
+
+	if expected.Bounds().Size() != actual.Bounds().Size() {
+		t.Fatalf(`expected="%s" actual="%s"`, expected.Bounds().Size(), actual.Bounds().Size())
+	}
+
+	eb, ab := expected.Bounds(), actual.Bounds()
+	for y := 0; y < eb.Dy(); y++ {
+		for x := 0; x < eb.Dx(); x++ {
+			e := color.NRGBAModel.Convert(expected.At(eb.Min.X+x, eb.Min.Y+y))
+			a := color.NRGBAModel.Convert(actual.At(ab.Min.X+x, ab.Min.Y+y))
+			if e != a {
+				t.Fatalf(`(%d, %d): expected="%v" actual="%v"`, x, y, e, a)
+			}
+		}
+	}
+}
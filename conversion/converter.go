@@ -7,16 +7,42 @@ package conversion
 
 import (
 	"errors"
+	"fmt"
 	"image"
+	"image/color"
+	"image/draw"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
+
+	"github.com/hioki-daichi/imgconv/fileutil"
 )
 
 // Converter represents encodable and decodable.
 type Converter struct {
 	Encoder Encoder
 	Decoder Decoder
+
+	// Applied in order between decoding and encoding.
+	Transformers []Transformer
+
+	// When OutDir is specified, the converted file is written to the same relative path from SrcDir under OutDir instead of next to the source file.
+	SrcDir string
+	OutDir string
+
+	// Skip the files whose destinations are up to date. See UpToDate.
+	Incremental bool
+
+	// When specified, the content hashes recorded in it are used to judge whether the destinations are up to date.
+	Manifest *Manifest
+
+	// Write each frame of an animation, composited as it is displayed, to its own file like the pages of a multi-page file. See PagePath.
+	ExtractFrames bool
+
+	// Images with transparency are composited onto Background before they are encoded by an OpaqueEncoder. nil means white.
+	Background color.Color
 }
 
 // Encoder configures encode-needed settings.
@@ -25,6 +51,17 @@ type Encoder interface {
 	Extname() string
 }
 
+// OpaqueEncoder is implemented by the encoders of the formats which cannot hold transparency, such as JPEG.
+// When Opaque returns true, the images with transparency are composited onto Converter.Background, instead of the black the encoder would give.
+type OpaqueEncoder interface {
+	Opaque() bool
+}
+
+// Transformer transforms the decoded image before it is encoded, e.g. resizing.
+type Transformer interface {
+	Transform(image.Image) (image.Image, error)
+}
+
 // Decoder configures decode-needed settings.
 type Decoder interface {
 	Decode(io.Reader) (image.Image, error)
@@ -32,38 +69,463 @@ type Decoder interface {
 	MagicBytesSlice() [][]byte
 }
 
-// Convert opens the file, decodes it, creates a file with a different extension, and writes the encoded result.
-func (c *Converter) Convert(path string, force bool) (*os.File, error) {
+// Validator is implemented by the decoders of the formats which have no reliable magic bytes, such as TGA.
+// The contents of a file are checked by Validate instead of MagicBytesSlice, reading from the start.
+type Validator interface {
+	Validate(io.ReadSeeker) (bool, error)
+}
+
+// Decodable returns whether the contents of rs can be decoded by the decoder, by Validate if it is a Validator and otherwise by the magic bytes.
+func Decodable(rs io.ReadSeeker, decoder Decoder) (bool, error) {
+	if v, ok := decoder.(Validator); ok {
+		_, err := rs.Seek(0, io.SeekStart)
+		if err != nil {
+			return false, err
+		}
+		return v.Validate(rs)
+	}
+
+	for _, magicBytes := range decoder.MagicBytesSlice() {
+		ok, err := fileutil.StartsContentsWith(rs, magicBytes)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Detect returns the first of the decoders which can process the extension of the path and decode the contents of rs, or nil if there is none.
+// Only the decoders matching the extension are sniffed, since the magic bytes of some formats are what files of others can start with,
+// e.g. those of CUR and an uncompressed true-color TGA.
+func Detect(rs io.ReadSeeker, path string, decoders []Decoder) (Decoder, error) {
+	for _, decoder := range decoders {
+		if !decoder.HasProcessableExtname(path) {
+			continue
+		}
+
+		ok, err := Decodable(rs, decoder)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return decoder, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// MultiDecoder is implemented by the decoders of the formats which can hold several images in a file, such as multi-page TIFF.
+type MultiDecoder interface {
+	DecodeAll(io.Reader) ([]image.Image, error)
+}
+
+// MultiEncoder is implemented by the encoders which can write several images into a file.
+// When the decoder returns several images and the encoder is not a MultiEncoder, each image is written to its own file. See PagePath.
+type MultiEncoder interface {
+	EncodeAll(io.Writer, []image.Image) error
+}
+
+// Result describes a converted file.
+type Result struct {
+	DstPath string
+
+	// When the images of a multi-page source are written to their own files, the paths of them. DstPath is the first one.
+	PagePaths []string
+
+	// Sizes of the source and the converted file in bytes. DstSize is the total of the pages.
+	SrcSize int64
+	DstSize int64
+
+	// Pixel dimensions of the converted image, or of the first page.
+	Width  int
+	Height int
+
+	// Number of the frames of an animation which were dropped since the encoder cannot hold animation.
+	DroppedFrames int
+
+	// The destination was up to date and nothing was done. Only DstPath is set.
+	Skipped bool
+}
+
+// Convert opens the file, decodes it, and writes the encoded result to a file with a different extension.
+// The returned error is an *Error telling the stage at which it occurred.
+func (c *Converter) Convert(path string, force bool) (*Result, error) {
+	dstPath, err := c.DstPath(path)
+	if err != nil {
+		return nil, &Error{Path: path, Stage: StageWrite, Err: err}
+	}
+
+	var hash string
+	if c.Incremental {
+		var ok bool
+		ok, hash, err = c.upToDate(path, dstPath)
+		if err != nil {
+			return nil, &Error{Path: path, Stage: StageDecode, Err: err}
+		}
+		if ok {
+			return &Result{DstPath: dstPath, Skipped: true}, nil
+		}
+		// The existing destinations are stale, and rebuilt.
+		force = true
+	}
+
 	fp, err := os.Open(path)
 	if err != nil {
-		return nil, err
+		return nil, &Error{Path: path, Stage: StageDecode, Err: err}
 	}
 	defer fp.Close()
 
-	img, err := c.Decoder.Decode(fp)
+	info, err := fp.Stat()
 	if err != nil {
-		return nil, err
+		return nil, &Error{Path: path, Stage: StageDecode, Err: err}
 	}
 
-	dstPath := path[:len(path)-len(filepath.Ext(path))] + "." + c.Encoder.Extname()
+	imgs, anim, droppedFrames, split, err := c.images(fp)
+	if err != nil {
+		return nil, &Error{Path: path, Stage: StageDecode, Err: err}
+	}
+
+	// The frames are transformed independently of each other.
+	if anim != nil && len(c.Transformers) > 0 {
+		anim.flatten()
+		imgs = anim.Frames
+	}
+
+	for i := range imgs {
+		for _, transformer := range c.Transformers {
+			imgs[i], err = transformer.Transform(imgs[i])
+			if err != nil {
+				return nil, &Error{Path: path, Stage: StageTransform, Err: err}
+			}
+		}
+	}
 
+	if e, ok := c.Encoder.(OpaqueEncoder); ok && e.Opaque() {
+		for i, img := range imgs {
+			if !isOpaque(img) {
+				imgs[i] = flattenAlpha(img, c.background())
+			}
+		}
+	}
+
+	err = os.MkdirAll(filepath.Dir(dstPath), 0755)
+	if err != nil {
+		return nil, &Error{Path: path, Stage: StageWrite, Err: err}
+	}
+
+	if anim != nil && len(c.Transformers) > 0 {
+		bounds := imgs[0].Bounds()
+		anim.Width, anim.Height = bounds.Max.X, bounds.Max.Y
+	}
+
+	dstPaths, pages := c.paginate(dstPath, imgs, anim, split)
+
+	// Checked before encoding to fail early. The destinations are still not replaced if they are created meanwhile. See WriteFile.
 	if !force {
-		_, err := os.OpenFile(dstPath, os.O_CREATE|os.O_EXCL, 0)
-		if os.IsExist(err) {
-			return nil, errors.New("File already exists: " + dstPath)
+		for _, p := range dstPaths {
+			_, err := os.Lstat(p)
+			if err == nil {
+				return nil, &Error{Path: path, Stage: StageWrite, Err: errors.New("File already exists: " + p)}
+			}
+			if !os.IsNotExist(err) {
+				return nil, &Error{Path: path, Stage: StageWrite, Err: err}
+			}
+		}
+	}
+
+	var dstSize int64
+	for i, p := range dstPaths {
+		size, err := c.write(path, p, force, pages[i], anim)
+		if err != nil {
+			return nil, err
 		}
-		os.Remove(dstPath)
+		dstSize += size
+	}
+
+	if c.Manifest != nil {
+		c.Manifest.record(path, hash, c.hashOptions(), dstPath)
+	}
+
+	bounds := imgs[0].Bounds()
+
+	res := &Result{DstPath: dstPaths[0], SrcSize: info.Size(), DstSize: dstSize, Width: bounds.Dx(), Height: bounds.Dy(), DroppedFrames: droppedFrames}
+	if anim != nil {
+		res.Width, res.Height = anim.Width, anim.Height
+	}
+	if len(dstPaths) > 1 {
+		res.PagePaths = dstPaths
+	}
+
+	return res, nil
+}
+
+// DstPaths returns the paths of the files written by converting the file, which are the page paths of DstPath
+// when its pages or the frames of its animation are written to their own files. The file is decoded to count them.
+// The returned error is an *Error telling the stage at which it occurred.
+func (c *Converter) DstPaths(path string) ([]string, error) {
+	dstPath, err := c.DstPath(path)
+	if err != nil {
+		return nil, &Error{Path: path, Stage: StageWrite, Err: err}
 	}
 
-	dstFile, err := os.Create(dstPath)
+	fp, err := os.Open(path)
 	if err != nil {
-		return nil, err
+		return nil, &Error{Path: path, Stage: StageDecode, Err: err}
 	}
+	defer fp.Close()
 
-	err = c.Encoder.Encode(dstFile, img)
+	imgs, anim, _, split, err := c.images(fp)
 	if err != nil {
-		return nil, err
+		return nil, &Error{Path: path, Stage: StageDecode, Err: err}
+	}
+
+	dstPaths, _ := c.paginate(dstPath, imgs, anim, split)
+	return dstPaths, nil
+}
+
+// images decodes the images to be encoded.
+// The frames of an animation are extracted with ExtractFrames, and split tells that each of them is written to its own file.
+// Otherwise, an animation is returned as it is only when the encoder can hold it, and only its first frame is when it cannot.
+func (c *Converter) images(r io.Reader) (imgs []image.Image, anim *Animation, droppedFrames int, split bool, err error) {
+	imgs, anim, err = c.decode(r)
+	if err != nil {
+		return nil, nil, 0, false, err
+	}
+
+	if anim == nil || len(anim.Frames) < 2 {
+		return imgs, nil, 0, false, nil
+	}
+
+	if c.ExtractFrames {
+		return anim.Composite(), nil, 0, true, nil
+	}
+	if _, ok := c.Encoder.(AnimationEncoder); ok {
+		return anim.Frames, anim, 0, false, nil
+	}
+	return imgs, nil, len(anim.Frames) - 1, false, nil
+}
+
+// paginate returns the paths of the files to be written and the images written to each of them.
+// Each page is written to its own file unless the encoder can hold them all.
+func (c *Converter) paginate(dstPath string, imgs []image.Image, anim *Animation, split bool) ([]string, [][]image.Image) {
+	if _, ok := c.Encoder.(MultiEncoder); !split && (ok || anim != nil || len(imgs) < 2) {
+		return []string{dstPath}, [][]image.Image{imgs}
+	}
+
+	var dstPaths []string
+	var pages [][]image.Image
+	for i, img := range imgs {
+		dstPaths = append(dstPaths, PagePath(dstPath, i+1))
+		pages = append(pages, []image.Image{img})
+	}
+	return dstPaths, pages
+}
+
+// decode decodes all the images of the file if Decoder is a MultiDecoder, otherwise the one image.
+// If Decoder is an AnimationDecoder, the animation is also returned with its first frame as the image.
+func (c *Converter) decode(r io.Reader) ([]image.Image, *Animation, error) {
+	if d, ok := c.Decoder.(AnimationDecoder); ok {
+		anim, err := d.DecodeAnimation(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return anim.Frames[:1], anim, nil
+	}
+
+	if d, ok := c.Decoder.(MultiDecoder); ok {
+		imgs, err := d.DecodeAll(r)
+		return imgs, nil, err
+	}
+
+	img, err := c.Decoder.Decode(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	return []image.Image{img}, nil, nil
+}
+
+func (c *Converter) background() color.Color {
+	if c.Background == nil {
+		return color.White
+	}
+	return c.Background
+}
+
+// flattenAlpha composites the image onto the background color. Images of 16 bits per channel are kept in 16 bits.
+func flattenAlpha(img image.Image, background color.Color) image.Image {
+	bounds := img.Bounds()
+
+	var dst draw.Image
+	if is16Bits(img) {
+		dst = image.NewRGBA64(bounds)
+	} else {
+		dst = image.NewRGBA(bounds)
+	}
+	draw.Draw(dst, bounds, image.NewUniform(background), image.Point{}, draw.Src)
+	draw.Draw(dst, bounds, img, bounds.Min, draw.Over)
+
+	return dst
+}
+
+// PagePath returns the path of the n-th page (1-based) of a multi-page file converted into dstPath, such as "scan_0002.png".
+func PagePath(dstPath string, n int) string {
+	ext := filepath.Ext(dstPath)
+	return fmt.Sprintf("%s_%04d%s", dstPath[:len(dstPath)-len(ext)], n, ext)
+}
+
+// UpToDate returns whether the destination of the file exists and is up to date.
+// With Manifest, it is up to date when the recorded hashes match the content of the file and the options of the Converter.
+// Otherwise, it is up to date when it is newer than the file.
+func (c *Converter) UpToDate(path string) (bool, error) {
+	dstPath, err := c.DstPath(path)
+	if err != nil {
+		return false, err
+	}
+
+	ok, _, err := c.upToDate(path, dstPath)
+	return ok, err
+}
+
+// upToDate also returns the hash of the file if Manifest is specified.
+func (c *Converter) upToDate(path string, dstPath string) (bool, string, error) {
+	dstInfo, err := os.Stat(dstPath)
+	if os.IsNotExist(err) {
+		// Split into pages
+		dstInfo, err = os.Stat(PagePath(dstPath, 1))
+	}
+	dstExists := err == nil
+
+	if c.Manifest != nil {
+		hash, err := hashFile(path)
+		if err != nil {
+			return false, "", err
+		}
+		return dstExists && c.Manifest.matches(path, hash, c.hashOptions(), dstPath), hash, nil
+	}
+
+	if !dstExists {
+		return false, "", nil
+	}
+
+	srcInfo, err := os.Stat(path)
+	if err != nil {
+		return false, "", err
+	}
+
+	return dstInfo.ModTime().After(srcInfo.ModTime()), "", nil
+}
+
+// write encodes the image into dstPath by WriteFile.
+// Several images are written by the MultiEncoder, and the animation by the AnimationEncoder. It returns the size of the written file.
+func (c *Converter) write(path string, dstPath string, force bool, imgs []image.Image, anim *Animation) (int64, error) {
+	size, err := WriteFile(dstPath, force, func(w io.Writer) error {
+		var err error
+		if e, ok := c.Encoder.(AnimationEncoder); ok && anim != nil {
+			err = e.EncodeAnimation(w, anim)
+		} else if e, ok := c.Encoder.(MultiEncoder); ok && len(imgs) > 1 {
+			err = e.EncodeAll(w, imgs)
+		} else {
+			err = c.Encoder.Encode(w, imgs[0])
+		}
+		if err != nil {
+			return &Error{Path: path, Stage: StageEncode, Err: err}
+		}
+		return nil
+	})
+	if _, ok := err.(*Error); err != nil && !ok {
+		return 0, &Error{Path: path, Stage: StageWrite, Err: err}
+	}
+	return size, err
+}
+
+// WriteFile writes by encode into a temporary file in the same directory and renames it to dstPath only on success,
+// so that a truncated file is never left at dstPath even if encoding fails or the process crashes.
+// Unless overwrite is set, the temporary file is linked to dstPath instead, which fails with "File already exists" if dstPath exists at that moment,
+// so that no other writer's file is replaced.
+// The error of encode is returned as it is. It returns the size of the written file.
+func WriteFile(dstPath string, overwrite bool, encode func(io.Writer) error) (size int64, err error) {
+	tmp, err := ioutil.TempFile(filepath.Dir(dstPath), "."+filepath.Base(dstPath)+".")
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	err = encode(tmp)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tmp.Sync()
+	if err != nil {
+		return 0, err
+	}
+
+	info, err := tmp.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	// ioutil.TempFile creates the file with 0600.
+	err = tmp.Chmod(0644)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	if overwrite {
+		err = os.Rename(tmp.Name(), dstPath)
+		if err != nil {
+			return 0, err
+		}
+		return info.Size(), nil
+	}
+
+	err = os.Link(tmp.Name(), dstPath)
+	if os.IsExist(err) {
+		return 0, errors.New("File already exists: " + dstPath)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	err = os.Remove(tmp.Name())
+	if err != nil {
+		return 0, err
+	}
+
+	return info.Size(), nil
+}
+
+// DstPath returns the path of the converted file, whose extension is replaced with the one of Encoder.
+func (c *Converter) DstPath(path string) (string, error) {
+	dstPath := path[:len(path)-len(filepath.Ext(path))] + "." + c.Encoder.Extname()
+
+	if c.OutDir == "" {
+		return dstPath, nil
+	}
+
+	rel, err := filepath.Rel(c.SrcDir, dstPath)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		// SrcDir is the source file itself.
+		rel = filepath.Base(dstPath)
 	}
 
-	return dstFile, nil
+	return filepath.Join(c.OutDir, rel), nil
 }
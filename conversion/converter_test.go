@@ -3,6 +3,7 @@ package conversion
 import (
 	"errors"
 	"image"
+	"image/color"
 	"image/gif"
 	"image/jpeg"
 	"image/png"
@@ -10,7 +11,10 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/hioki-daichi/imgconv/fileutil"
 )
@@ -49,6 +53,478 @@ func TestConversion_Convert(t *testing.T) {
 	}
 }
 
+func TestConversion_Convert_Result(t *testing.T) {
+	t.Parallel()
+
+	converter := &Converter{Decoder: jpegDecoder(), Encoder: pngEncoder()}
+
+	tempdir, cleanFn := withTempDir(t)
+	defer cleanFn()
+
+	path := filepath.Join(tempdir, "./jpeg/sample1.jpg")
+
+	actual, err := converter.Convert(path, false)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	srcInfo, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	dstInfo, err := os.Stat(actual.DstPath)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	expected := &Result{DstPath: filepath.Join(tempdir, "./jpeg/sample1.png"), SrcSize: srcInfo.Size(), DstSize: dstInfo.Size(), Width: 240, Height: 214}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf(`expected="%v" actual="%v"`, expected, actual)
+	}
+}
+
+func TestConversion_Convert_Transformers(t *testing.T) {
+	t.Parallel()
+
+	converter := &Converter{Decoder: jpegDecoder(), Encoder: pngEncoder(), Transformers: []Transformer{&TransformerMock{dx: 10}, &TransformerMock{dx: 5}}}
+
+	tempdir, cleanFn := withTempDir(t)
+	defer cleanFn()
+
+	result, err := converter.Convert(filepath.Join(tempdir, "./jpeg/sample1.jpg"), false)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	expected := 240 - 10 - 5
+	if actual := result.Width; actual != expected {
+		t.Errorf(`expected=%d actual=%d`, expected, actual)
+	}
+}
+
+func TestConversion_Convert_Pages(t *testing.T) {
+	cases := map[string]struct {
+		encoder   Encoder
+		dstPath   string
+		pagePaths []string
+	}{
+		"TIFF to PNG":  {encoder: pngEncoder(), dstPath: "scan_0001.png", pagePaths: []string{"scan_0001.png", "scan_0002.png", "scan_0003.png"}},
+		"TIFF to TIFF": {encoder: &Tiff{}, dstPath: "scan.tiff", pagePaths: nil},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			tempdir, cleanFn := withTempDir(t)
+			defer cleanFn()
+
+			src := filepath.Join(tempdir, "scan.tif")
+			writeTiff(t, src, image.NewGray(image.Rect(0, 0, 4, 3)), image.NewGray(image.Rect(0, 0, 5, 3)), image.NewGray(image.Rect(0, 0, 6, 3)))
+
+			converter := &Converter{Decoder: &Tiff{}, Encoder: c.encoder}
+
+			result, err := converter.Convert(src, false)
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+
+			if expected, actual := filepath.Join(tempdir, c.dstPath), result.DstPath; actual != expected {
+				t.Errorf(`expected="%s" actual="%s"`, expected, actual)
+			}
+
+			var expected []string
+			for _, p := range c.pagePaths {
+				expected = append(expected, filepath.Join(tempdir, p))
+			}
+			if actual := result.PagePaths; !reflect.DeepEqual(actual, expected) {
+				t.Errorf(`expected="%s" actual="%s"`, expected, actual)
+			}
+
+			for i, p := range expected {
+				img, err := decodeFile(p, c.encoder.(Decoder))
+				if err != nil {
+					t.Fatalf("err %s", err)
+				}
+				if actual := img.Bounds().Dx(); actual != 4+i {
+					t.Errorf(`expected=%d actual=%d`, 4+i, actual)
+				}
+			}
+
+			_, err = converter.Convert(src, false)
+			if err == nil || !strings.HasPrefix(err.Error(), "File already exists: ") {
+				t.Errorf(`expected="File already exists: ..." actual="%v"`, err)
+			}
+		})
+	}
+}
+
+func TestConversion_Convert_Animation(t *testing.T) {
+	cases := map[string]struct {
+		encoder       Encoder
+		transformers  []Transformer
+		dstPath       string
+		frames        int
+		width         int
+		droppedFrames int
+	}{
+		"GIF to GIF":             {encoder: &Gif{Options: &gif.Options{NumColors: 256}}, dstPath: "sample1.gif", frames: 44, width: 400},
+		"GIF to GIF transformed": {encoder: &Gif{Options: &gif.Options{NumColors: 16}}, transformers: []Transformer{&TransformerMock{dx: 10}}, dstPath: "sample1.gif", frames: 44, width: 390},
+		"GIF to PNG":             {encoder: pngEncoder(), dstPath: "sample1.png", frames: 44, width: 400},
+		"GIF to JPEG":            {encoder: jpegEncoder(), dstPath: "sample1.jpg", frames: 1, width: 400, droppedFrames: 43},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			tempdir, cleanFn := withTempDir(t)
+			defer cleanFn()
+
+			src := filepath.Join(tempdir, "gif", "sample1.gif")
+			expected, err := decodeAnimationFile(src, gifDecoder())
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+
+			converter := &Converter{Decoder: gifDecoder(), Encoder: c.encoder, Transformers: c.transformers}
+
+			result, err := converter.Convert(src, true)
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+
+			if actual := result.DroppedFrames; actual != c.droppedFrames {
+				t.Errorf(`expected=%d actual=%d`, c.droppedFrames, actual)
+			}
+			if actual := result.Width; actual != c.width {
+				t.Errorf(`expected=%d actual=%d`, c.width, actual)
+			}
+
+			dstPath := filepath.Join(tempdir, "gif", c.dstPath)
+			decoder, ok := c.encoder.(AnimationDecoder)
+			if !ok {
+				_, err := os.Stat(dstPath)
+				if err != nil {
+					t.Fatalf("err %s", err)
+				}
+				return
+			}
+
+			actual, err := decodeAnimationFile(dstPath, decoder)
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+
+			if len(actual.Frames) != c.frames {
+				t.Fatalf(`expected=%d actual=%d`, c.frames, len(actual.Frames))
+			}
+			if actual.Width != c.width {
+				t.Errorf(`expected=%d actual=%d`, c.width, actual.Width)
+			}
+			if !reflect.DeepEqual(actual.Delays, expected.Delays) {
+				t.Errorf(`expected="%v" actual="%v"`, expected.Delays, actual.Delays)
+			}
+			if actual.LoopCount != expected.LoopCount {
+				t.Errorf(`expected=%d actual=%d`, expected.LoopCount, actual.LoopCount)
+			}
+
+			if c.transformers == nil {
+				// The animation looks the same.
+				expectedFrames, actualFrames := expected.Composite(), actual.Composite()
+				for i := range expectedFrames {
+					assertSameImage(t, expectedFrames[i], actualFrames[i])
+				}
+			}
+		})
+	}
+}
+
+func TestConversion_Convert_ExtractFrames(t *testing.T) {
+	cases := map[string]struct {
+		encoder Encoder
+		extname string
+	}{
+		"GIF to PNG": {encoder: pngEncoder(), extname: ".png"},
+		"GIF to GIF": {encoder: &Gif{Options: &gif.Options{NumColors: 256}}, extname: ".gif"},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			tempdir, err := ioutil.TempDir("", "imgconv")
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+			defer os.RemoveAll(tempdir)
+
+			// The second frame covers only a part of the canvas.
+			pal := color.Palette{color.Black, color.White}
+			g := &gif.GIF{
+				Image: []*image.Paletted{
+					image.NewPaletted(image.Rect(0, 0, 8, 4), pal),
+					image.NewPaletted(image.Rect(2, 1, 6, 3), pal),
+					image.NewPaletted(image.Rect(0, 0, 8, 4), pal),
+				},
+				Delay: []int{10, 10, 10},
+			}
+			src := filepath.Join(tempdir, "anim.gif")
+			fp, err := os.Create(src)
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+			err = gif.EncodeAll(fp, g)
+			fp.Close()
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+
+			converter := &Converter{Decoder: gifDecoder(), Encoder: c.encoder, ExtractFrames: true}
+
+			result, err := converter.Convert(src, false)
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+
+			if len(result.PagePaths) != 3 {
+				t.Fatalf(`expected=3 actual=%d`, len(result.PagePaths))
+			}
+			if expected, actual := filepath.Join(tempdir, "anim_0003"+c.extname), result.PagePaths[2]; actual != expected {
+				t.Errorf(`expected="%s" actual="%s"`, expected, actual)
+			}
+
+			img, err := decodeFile(result.PagePaths[1], c.encoder.(Decoder))
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+			if expected, actual := image.Rect(0, 0, result.Width, result.Height), img.Bounds(); actual != expected {
+				t.Errorf(`expected="%v" actual="%v"`, expected, actual)
+			}
+
+			_, err = converter.Convert(src, false)
+			if err == nil || !strings.HasPrefix(err.Error(), "File already exists: ") {
+				t.Errorf(`expected="File already exists: ..." actual="%v"`, err)
+			}
+		})
+	}
+}
+
+func TestConversion_Convert_Background(t *testing.T) {
+	white := color.NRGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}
+	black := color.NRGBA{A: 0xFF}
+	red := color.NRGBA{R: 0xFF, A: 0xFF}
+
+	// Transparent, opaque red and half transparent black
+	src := image.NewNRGBA(image.Rect(0, 0, 3, 1))
+	src.SetNRGBA(1, 0, red)
+	src.SetNRGBA(2, 0, color.NRGBA{A: 0x80})
+
+	cases := map[string]struct {
+		encoder    Encoder
+		background color.Color
+		expected   []color.NRGBA
+	}{
+		"white by default":  {encoder: &Netpbm{}, background: nil, expected: []color.NRGBA{white, red, {R: 0x7F, G: 0x7F, B: 0x7F, A: 0xFF}}},
+		"black":             {encoder: &Netpbm{}, background: color.Black, expected: []color.NRGBA{black, red, black}},
+		"PAM holding alpha": {encoder: &Netpbm{Variant: NetpbmPAM}, background: color.Black, expected: []color.NRGBA{{}, red, {A: 0x80}}},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			tempdir, err := ioutil.TempDir("", "imgconv")
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+			defer os.RemoveAll(tempdir)
+
+			path := filepath.Join(tempdir, "alpha.png")
+			fp, err := os.Create(path)
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+			err = png.Encode(fp, src)
+			fp.Close()
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+
+			converter := &Converter{Decoder: pngDecoder(), Encoder: c.encoder, Background: c.background}
+
+			result, err := converter.Convert(path, false)
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+
+			img, err := decodeFile(result.DstPath, &Netpbm{})
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+
+			for x, expected := range c.expected {
+				actual := color.NRGBAModel.Convert(img.At(x, 0))
+				if actual != expected {
+					t.Errorf(`expected="%v" actual="%v"`, expected, actual)
+				}
+			}
+		})
+	}
+}
+
+func TestConversion_PagePath(t *testing.T) {
+	t.Parallel()
+
+	expected := filepath.Join("a", "scan_0012.png")
+
+	actual := PagePath(filepath.Join("a", "scan.png"), 12)
+	if actual != expected {
+		t.Errorf(`expected="%s" actual="%s"`, expected, actual)
+	}
+}
+
+func TestConversion_Convert_Incremental(t *testing.T) {
+	t.Parallel()
+
+	converter := &Converter{Decoder: jpegDecoder(), Encoder: pngEncoder(), Incremental: true}
+
+	tempdir, cleanFn := withTempDir(t)
+	defer cleanFn()
+
+	src := filepath.Join(tempdir, "./jpeg/sample1.jpg")
+
+	result, err := converter.Convert(src, false)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	if result.Skipped {
+		t.Error("the first conversion is skipped")
+	}
+
+	// The destination is newer than the source.
+	past := time.Now().Add(-time.Hour)
+	err = os.Chtimes(src, past, past)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	result, err = converter.Convert(src, false)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	if !result.Skipped {
+		t.Error("the up-to-date destination is converted again")
+	}
+
+	// The source is newer than the destination.
+	future := time.Now().Add(time.Hour)
+	err = os.Chtimes(src, future, future)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	// The stale destination is rebuilt without force.
+	result, err = converter.Convert(src, false)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	if result.Skipped {
+		t.Error("the stale destination is skipped")
+	}
+}
+
+func TestConversion_Convert_Manifest(t *testing.T) {
+	t.Parallel()
+
+	tempdir, cleanFn := withTempDir(t)
+	defer cleanFn()
+
+	manifestPath := filepath.Join(tempdir, "manifest.json")
+	src := filepath.Join(tempdir, "./jpeg/sample1.jpg")
+
+	convert := func(encoder Encoder) *Result {
+		t.Helper()
+
+		manifest, err := LoadManifest(manifestPath)
+		if err != nil {
+			t.Fatalf("err %s", err)
+		}
+
+		converter := &Converter{Decoder: jpegDecoder(), Encoder: encoder, Incremental: true, Manifest: manifest}
+
+		result, err := converter.Convert(src, true)
+		if err != nil {
+			t.Fatalf("err %s", err)
+		}
+
+		err = manifest.Save(manifestPath)
+		if err != nil {
+			t.Fatalf("err %s", err)
+		}
+
+		return result
+	}
+
+	if convert(pngEncoder()).Skipped {
+		t.Error("the first conversion is skipped")
+	}
+
+	// Modification times do not matter.
+	future := time.Now().Add(time.Hour)
+	err := os.Chtimes(src, future, future)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	if !convert(pngEncoder()).Skipped {
+		t.Error("the unchanged source is converted again")
+	}
+
+	// Contents do.
+	b, err := ioutil.ReadFile(filepath.Join(tempdir, "./jpeg/sample2.jpg"))
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	err = ioutil.WriteFile(src, b, 0644)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	if convert(pngEncoder()).Skipped {
+		t.Error("the changed source is skipped")
+	}
+
+	// And so do the options.
+	if convert(&Png{Encoder: &png.Encoder{CompressionLevel: png.BestSpeed}}).Skipped {
+		t.Error("the source is skipped after the options are changed")
+	}
+	if !convert(&Png{Encoder: &png.Encoder{CompressionLevel: png.BestSpeed}}).Skipped {
+		t.Error("the source is converted again with the same options")
+	}
+}
+
+func TestConversion_LoadManifest_Broken(t *testing.T) {
+	t.Parallel()
+
+	expected := "unexpected end of JSON input"
+
+	_, err := LoadManifest("./testdata/undecodable.jpg")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	_, err = LoadManifest("./testdata/empty.json")
+	actual := err.Error()
+	if actual != expected {
+		t.Errorf(`expected="%s" actual="%s"`, expected, actual)
+	}
+}
+
 func TestConversion_Convert_Conflict(t *testing.T) {
 	t.Parallel()
 
@@ -111,23 +587,55 @@ func TestConversion_Convert_CreationFailure(t *testing.T) {
 	tempdir, cleanFn := withTempDir(t)
 	defer cleanFn()
 
-	expected := "open " + tempdir + "/jpeg/sample1.png: permission denied"
+	expectedPrefix := "open " + tempdir + "/jpeg/.sample1.png."
+	expectedSuffix := ": permission denied"
 
 	src := filepath.Join(tempdir, "./jpeg/sample1.jpg")
-	dst := filepath.Join(tempdir, "./jpeg/sample1.png")
 
-	// First, create a file without permission in PATH after conversion,
-	_, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL, 0)
+	// First, make the directory of PATH after conversion unwritable,
+	err := os.Chmod(filepath.Dir(src), 0555)
 	if err != nil {
 		t.Fatalf("err %s", err)
 	}
+	defer os.Chmod(filepath.Dir(src), 0755)
 
 	// then convert.
 	_, err = converter.Convert(src, true)
 
 	actual := err.Error()
-	if actual != expected {
-		t.Errorf("expected: %s, actual: %s", expected, actual)
+	if !strings.HasPrefix(actual, expectedPrefix) || !strings.HasSuffix(actual, expectedSuffix) {
+		t.Errorf("expected: %s*%s, actual: %s", expectedPrefix, expectedSuffix, actual)
+	}
+}
+
+func TestConversion_Convert_Overwrite(t *testing.T) {
+	t.Parallel()
+
+	converter := &Converter{Decoder: jpegDecoder(), Encoder: pngEncoder()}
+
+	tempdir, cleanFn := withTempDir(t)
+	defer cleanFn()
+
+	src := filepath.Join(tempdir, "./jpeg/sample1.jpg")
+	dst := filepath.Join(tempdir, "./jpeg/sample1.png")
+
+	// Even a file without permission is replaced.
+	_, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL, 0)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	_, err = converter.Convert(src, true)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	info, err := os.Stat(dst)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	if info.Size() == 0 {
+		t.Errorf("%s is not replaced", dst)
 	}
 }
 
@@ -149,6 +657,216 @@ func TestConversion_Convert_EncodeFailure(t *testing.T) {
 	if actual != expected {
 		t.Errorf("expected: %s, actual: %s", expected, actual)
 	}
+
+	// Neither the destination nor the temporary file is left.
+	infos, err := ioutil.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	for _, info := range infos {
+		if info.Name() != "sample1.jpg" && info.Name() != "sample2.jpg" && info.Name() != "sample3.jpeg" {
+			t.Errorf("%s is left", info.Name())
+		}
+	}
+}
+
+func TestConversion_WriteFile(t *testing.T) {
+	t.Parallel()
+
+	tempdir, err := ioutil.TempDir("", "imgconv")
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	dst := filepath.Join(tempdir, "a.txt")
+
+	size, err := WriteFile(dst, true, func(w io.Writer) error {
+		_, err := io.WriteString(w, "abc")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	info, err := os.Stat(dst)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	if size != 3 || info.Size() != 3 || info.Mode().Perm() != 0644 {
+		t.Errorf(`unexpected file: size=%d %d mode=%s`, size, info.Size(), info.Mode())
+	}
+
+	// The error of encode is returned as it is, and the existing file is kept.
+	expected := errors.New("error in encode")
+	_, err = WriteFile(dst, true, func(w io.Writer) error {
+		io.WriteString(w, "d")
+		return expected
+	})
+	if err != expected {
+		t.Errorf(`expected="%s" actual="%v"`, expected, err)
+	}
+
+	b, err := ioutil.ReadFile(dst)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	if string(b) != "abc" {
+		t.Errorf(`expected="abc" actual="%s"`, b)
+	}
+
+	infos, err := ioutil.ReadDir(tempdir)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	if len(infos) != 1 {
+		t.Errorf("the temporary file is left: %d files", len(infos))
+	}
+}
+
+func TestConversion_WriteFile_NoReplace(t *testing.T) {
+	t.Parallel()
+
+	tempdir, err := ioutil.TempDir("", "imgconv")
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	dst := filepath.Join(tempdir, "a.txt")
+
+	write := func(s string) error {
+		_, err := WriteFile(dst, false, func(w io.Writer) error {
+			_, err := io.WriteString(w, s)
+			return err
+		})
+		return err
+	}
+
+	err = write("abc")
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	// The destination created by another writer is never replaced without overwrite.
+	err = write("def")
+	expected := "File already exists: " + dst
+	if err == nil || err.Error() != expected {
+		t.Errorf(`expected="%s" actual="%v"`, expected, err)
+	}
+
+	b, err := ioutil.ReadFile(dst)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	if string(b) != "abc" {
+		t.Errorf(`expected="abc" actual="%s"`, b)
+	}
+
+	infos, err := ioutil.ReadDir(tempdir)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	if len(infos) != 1 {
+		t.Errorf("the temporary file is left: %d files", len(infos))
+	}
+}
+
+func TestConversion_DstPath(t *testing.T) {
+	cases := map[string]struct {
+		srcDir   string
+		outDir   string
+		path     string
+		expected string
+	}{
+		"without OutDir":        {srcDir: "src", outDir: "", path: "src/a/b.jpg", expected: "src/a/b.png"},
+		"with OutDir":           {srcDir: "src", outDir: "out", path: "src/a/b.jpg", expected: "out/a/b.png"},
+		"with trailing slashes": {srcDir: "src/", outDir: "out/", path: "src/b.jpeg", expected: "out/b.png"},
+		"SrcDir is the file":    {srcDir: "src/a/b.jpg", outDir: "out", path: "src/a/b.jpg", expected: "out/b.png"},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			converter := &Converter{Decoder: jpegDecoder(), Encoder: pngEncoder(), SrcDir: c.srcDir, OutDir: c.outDir}
+
+			actual, err := converter.DstPath(c.path)
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+			if actual != c.expected {
+				t.Errorf(`expected="%s" actual="%s"`, c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestConversion_Convert_OutDir(t *testing.T) {
+	t.Parallel()
+
+	tempdir, cleanFn := withTempDir(t)
+	defer cleanFn()
+
+	srcDir := tempdir
+	outDir := filepath.Join(tempdir, "out")
+
+	converter := &Converter{Decoder: jpegDecoder(), Encoder: pngEncoder(), SrcDir: srcDir, OutDir: outDir}
+
+	result, err := converter.Convert(filepath.Join(srcDir, "jpeg/sample1.jpg"), false)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	expected := filepath.Join(outDir, "jpeg/sample1.png")
+	if actual := result.DstPath; actual != expected {
+		t.Errorf(`expected="%s" actual="%s"`, expected, actual)
+	}
+
+	if _, err := os.Stat(filepath.Join(srcDir, "jpeg/sample1.png")); !os.IsNotExist(err) {
+		t.Errorf("the source directory is modified: %s", err)
+	}
+}
+
+func TestConversion_Convert_Stage(t *testing.T) {
+	t.Parallel()
+
+	tempdir, cleanFn := withTempDir(t)
+	defer cleanFn()
+
+	path := filepath.Join(tempdir, "./jpeg/sample1.jpg")
+
+	cases := map[string]struct {
+		converter *Converter
+		path      string
+		force     bool
+		expected  Stage
+	}{
+		"nonexistence": {converter: &Converter{Decoder: jpegDecoder(), Encoder: pngEncoder()}, path: "./nonexistent_path", force: true, expected: StageDecode},
+		"undecodable":  {converter: &Converter{Decoder: jpegDecoder(), Encoder: pngEncoder()}, path: "./testdata/undecodable.jpg", force: true, expected: StageDecode},
+		"transform":    {converter: &Converter{Decoder: jpegDecoder(), Encoder: pngEncoder(), Transformers: []Transformer{&TransformerMock{err: errors.New("error in TransformerMock.Transform")}}}, path: path, force: true, expected: StageTransform},
+		"encoding":     {converter: &Converter{Decoder: jpegDecoder(), Encoder: mockEncoder()}, path: path, force: true, expected: StageEncode},
+		"conflict":     {converter: &Converter{Decoder: jpegDecoder(), Encoder: &Jpeg{}}, path: path, force: false, expected: StageWrite},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			_, err := c.converter.Convert(c.path, c.force)
+
+			e, ok := err.(*Error)
+			if !ok {
+				t.Fatalf(`expected *Error actual="%T"`, err)
+			}
+			if e.Stage != c.expected {
+				t.Errorf(`expected="%s" actual="%s"`, c.expected, e.Stage)
+			}
+			if e.Path != c.path {
+				t.Errorf(`expected="%s" actual="%s"`, c.path, e.Path)
+			}
+		})
+	}
 }
 
 func jpegDecoder() *Jpeg {
@@ -191,6 +909,41 @@ func withTempDir(t *testing.T) (string, func()) {
 	return tempdir, func() { os.RemoveAll(tempdir) }
 }
 
+func writeTiff(t *testing.T, path string, imgs ...image.Image) {
+	t.Helper()
+
+	fp, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	defer fp.Close()
+
+	err = (&Tiff{Compression: TiffLZW}).EncodeAll(fp, imgs)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+}
+
+func decodeAnimationFile(path string, decoder AnimationDecoder) (*Animation, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	return decoder.DecodeAnimation(fp)
+}
+
+func decodeFile(path string, decoder Decoder) (image.Image, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	return decoder.Decode(fp)
+}
+
 type EncoderMock struct {
 	Png
 }
@@ -202,3 +955,20 @@ func (m *EncoderMock) Encode(w io.Writer, img image.Image) error {
 func mockEncoder() *EncoderMock {
 	return &EncoderMock{}
 }
+
+type TransformerMock struct {
+	dx  int
+	err error
+}
+
+// Transform crops dx pixels from the right.
+func (m *TransformerMock) Transform(img image.Image) (image.Image, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	b := img.Bounds()
+	return img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}).SubImage(image.Rect(b.Min.X, b.Min.Y, b.Max.X-m.dx, b.Max.Y)), nil
+}
@@ -0,0 +1,52 @@
+package conversion
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// Bayer is a draw.Drawer which dithers by the 8x8 Bayer matrix, so called ordered dithering. https://en.wikipedia.org/wiki/Ordered_dithering
+// Unlike draw.FloydSteinberg, the pattern of a pixel depends only on its position, so that the still areas of an animation do not flicker.
+type Bayer struct{}
+
+var bayerMatrix = [8][8]int{
+	{0, 32, 8, 40, 2, 34, 10, 42},
+	{48, 16, 56, 24, 50, 18, 58, 26},
+	{12, 44, 4, 36, 14, 46, 6, 38},
+	{60, 28, 52, 20, 62, 30, 54, 22},
+	{3, 35, 11, 43, 1, 33, 9, 41},
+	{51, 19, 59, 27, 49, 17, 57, 25},
+	{15, 47, 7, 39, 13, 45, 5, 37},
+	{63, 31, 55, 23, 61, 29, 53, 21},
+}
+
+// Draw dithers src onto dst when dst is an *image.Paletted, and otherwise draws as draw.Src does.
+// The threshold is scaled by the distance between the colors of the palette assuming they are evenly distributed.
+func (Bayer) Draw(dst draw.Image, r image.Rectangle, src image.Image, sp image.Point) {
+	pm, ok := dst.(*image.Paletted)
+	if !ok || len(pm.Palette) == 0 {
+		draw.Draw(dst, r, src, sp, draw.Src)
+		return
+	}
+
+	// Clip r to dst and src as draw.Draw does.
+	delta := sp.Sub(r.Min)
+	r = r.Intersect(pm.Rect).Intersect(src.Bounds().Sub(delta))
+	spread := int(255 / math.Cbrt(float64(len(pm.Palette))))
+
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			c := color.NRGBAModel.Convert(src.At(x+delta.X, y+delta.Y)).(color.NRGBA)
+			if c.A != 0 {
+				// From -spread/2 to spread/2
+				offset := (2*bayerMatrix[y&7][x&7] + 1 - 64) * spread / 128
+				c.R = clampUint8(int(c.R) + offset)
+				c.G = clampUint8(int(c.G) + offset)
+				c.B = clampUint8(int(c.B) + offset)
+			}
+			pm.SetColorIndex(x, y, uint8(pm.Palette.Index(c)))
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package conversion
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestConversion_Bayer_Draw(t *testing.T) {
+	t.Parallel()
+
+	black := color.RGBA{A: 0xFF}
+	white := color.RGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}
+
+	// Gray of the middle, except a transparent pixel
+	src := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	for i := range src.Pix {
+		src.Pix[i] = 0x80
+	}
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			src.Pix[src.PixOffset(x, y)+3] = 0xFF
+		}
+	}
+	src.Pix[src.PixOffset(7, 7)+3] = 0
+
+	dst := image.NewPaletted(src.Rect, color.Palette{black, white, color.RGBA{}})
+	Bayer{}.Draw(dst, dst.Rect, src, image.Point{})
+
+	counts := make([]int, 3)
+	for _, i := range dst.Pix {
+		counts[i]++
+	}
+
+	// Half and half, since the threshold of each position of the matrix differs.
+	expected := []int{31, 32, 1}
+	for i := range expected {
+		if counts[i] != expected[i] {
+			t.Errorf(`expected="%v" actual="%v"`, expected, counts)
+			break
+		}
+	}
+
+	// Two of the same color are dithered in the same pattern.
+	other := image.NewPaletted(src.Rect, dst.Palette)
+	Bayer{}.Draw(other, other.Rect, src, image.Point{})
+	if string(other.Pix) != string(dst.Pix) {
+		t.Errorf(`expected="%v" actual="%v"`, dst.Pix, other.Pix)
+	}
+}
@@ -0,0 +1,24 @@
+package conversion
+
+// Stage is the step of the conversion at which an error occurred.
+type Stage string
+
+// Stages of the conversion.
+const (
+	StageDecode    Stage = "decode"
+	StageTransform Stage = "transform"
+	StageEncode    Stage = "encode"
+	StageWrite     Stage = "write"
+)
+
+// Error records the file and the stage of the conversion at which the error occurred.
+// Its message is the same as the original error.
+type Error struct {
+	Path  string
+	Stage Stage
+	Err   error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
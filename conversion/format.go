@@ -0,0 +1,140 @@
+package conversion
+
+import (
+	"flag"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Format describes a file format which can be converted from and/or to.
+// Codecs in other packages can be plugged in by calling Register in their init function.
+type Format struct {
+	// Name is the canonical name such as "jpeg".
+	Name string
+
+	// Aliases are accepted in place of Name such as "jpg".
+	Aliases []string
+
+	// Shorthand is the letter of the command line flag. Its uppercase means "from" and its lowercase means "to".
+	// It can be empty if the format is specified only by name.
+	Shorthand string
+
+	// Extnames are the extensions of the format such as ".jpg", ".jpeg".
+	Extnames []string
+
+	// NewDecoder returns a Decoder of the format, whose MagicBytesSlice or Validate recognizes its files. It is nil if the format cannot be decoded.
+	NewDecoder func() Decoder
+
+	// DefineDecoderFlags defines the decoding options of the format on the flag set and returns a DecoderFactory building a Decoder from them.
+	// It is nil if the format has no decoding options, and NewDecoder is used instead.
+	DefineDecoderFlags func(*flag.FlagSet) DecoderFactory
+
+	// DefineEncoderFlags defines the encoding options of the format on the flag set and returns an EncoderFactory building an Encoder from them.
+	// It is nil if the format cannot be encoded.
+	DefineEncoderFlags func(*flag.FlagSet) EncoderFactory
+}
+
+// DecoderFactory validates the parsed decoding options and builds a Decoder.
+type DecoderFactory func() (Decoder, error)
+
+// EncoderFactory validates the parsed encoding options and builds an Encoder.
+type EncoderFactory func() (Encoder, error)
+
+var (
+	formatsMu sync.Mutex
+	formats   []*Format
+)
+
+// Shorthands whose flags are taken by the command line, -A and -f.
+var reservedShorthands = []string{"a", "f"}
+
+// Register adds the format to the registry. It panics if the name or any of the aliases is already registered,
+// or if the shorthand is already registered or reserved, since its flags would collide.
+func Register(f *Format) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+
+	for _, name := range append([]string{f.Name}, f.Aliases...) {
+		if lookupFormat(name) != nil {
+			panic(fmt.Sprintf("conversion: Register called twice for format %q", name))
+		}
+	}
+
+	if f.Shorthand != "" {
+		for _, reserved := range reservedShorthands {
+			if strings.EqualFold(f.Shorthand, reserved) {
+				panic(fmt.Sprintf("conversion: shorthand %q of format %q is reserved", f.Shorthand, f.Name))
+			}
+		}
+		for _, other := range formats {
+			if strings.EqualFold(f.Shorthand, other.Shorthand) {
+				panic(fmt.Sprintf("conversion: Register called twice for shorthand %q", f.Shorthand))
+			}
+		}
+	}
+
+	formats = append(formats, f)
+}
+
+// Formats returns the registered formats in registration order.
+func Formats() []*Format {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+
+	return append([]*Format(nil), formats...)
+}
+
+// LookupFormat returns the format registered under the specified name or alias, or nil.
+func LookupFormat(name string) *Format {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+
+	return lookupFormat(name)
+}
+
+func lookupFormat(name string) *Format {
+	for _, f := range formats {
+		if f.Name == name {
+			return f
+		}
+		for _, alias := range f.Aliases {
+			if alias == name {
+				return f
+			}
+		}
+	}
+
+	return nil
+}
+
+// FormatOfDecoder returns the registered format whose NewDecoder returns a decoder of the same type, or nil.
+func FormatOfDecoder(d Decoder) *Format {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+
+	for _, f := range formats {
+		if f.NewDecoder != nil && reflect.TypeOf(f.NewDecoder()) == reflect.TypeOf(d) {
+			return f
+		}
+	}
+
+	return nil
+}
+
+// FormatOfEncoder returns the registered format having the extension of the encoder, or nil.
+func FormatOfEncoder(e Encoder) *Format {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+
+	for _, f := range formats {
+		for _, extname := range f.Extnames {
+			if extname == "."+e.Extname() {
+				return f
+			}
+		}
+	}
+
+	return nil
+}
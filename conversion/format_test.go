@@ -0,0 +1,233 @@
+package conversion
+
+import (
+	"flag"
+	"testing"
+)
+
+func TestConversion_Formats(t *testing.T) {
+	t.Parallel()
+
+	expected := []string{"bmp", "gif", "ico", "jpeg", "netpbm", "png", "qoi", "tga", "tiff", "webp"}
+
+	formats := Formats()
+	if len(formats) != len(expected) {
+		t.Fatalf(`expected=%d actual=%d`, len(expected), len(formats))
+	}
+
+	for i, f := range formats {
+		if f.Name != expected[i] {
+			t.Errorf(`expected="%s" actual="%s"`, expected[i], f.Name)
+		}
+	}
+}
+
+func TestConversion_LookupFormat(t *testing.T) {
+	cases := map[string]struct {
+		name     string
+		expected string
+	}{
+		"jpeg": {name: "jpeg", expected: "jpeg"},
+		"jpg":  {name: "jpg", expected: "jpeg"},
+		"png":  {name: "png", expected: "png"},
+		"gif":  {name: "gif", expected: "gif"},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			f := LookupFormat(c.name)
+			if f == nil {
+				t.Fatalf(`"%s" is not found`, c.name)
+			}
+			if f.Name != c.expected {
+				t.Errorf(`expected="%s" actual="%s"`, c.expected, f.Name)
+			}
+		})
+	}
+}
+
+func TestConversion_LookupFormat_Nonexistence(t *testing.T) {
+	t.Parallel()
+
+	if f := LookupFormat("foo"); f != nil {
+		t.Errorf(`expected=nil actual="%s"`, f.Name)
+	}
+}
+
+func TestConversion_Register_Duplication(t *testing.T) {
+	t.Parallel()
+
+	expected := `conversion: Register called twice for format "jpg"`
+
+	defer func() {
+		actual := recover()
+		if actual != expected {
+			t.Errorf(`expected="%s" actual="%s"`, expected, actual)
+		}
+	}()
+
+	Register(&Format{Name: "jpg"})
+}
+
+func TestConversion_Register_Shorthand(t *testing.T) {
+	cases := map[string]struct {
+		format   *Format
+		expected string
+	}{
+		"duplication":   {format: &Format{Name: "foo", Shorthand: "j"}, expected: `conversion: Register called twice for shorthand "j"`},
+		"case of other": {format: &Format{Name: "foo", Shorthand: "J"}, expected: `conversion: Register called twice for shorthand "J"`},
+		"-A":            {format: &Format{Name: "foo", Shorthand: "a"}, expected: `conversion: shorthand "a" of format "foo" is reserved`},
+		"-f":            {format: &Format{Name: "foo", Shorthand: "F"}, expected: `conversion: shorthand "F" of format "foo" is reserved`},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			defer func() {
+				actual := recover()
+				if actual != c.expected {
+					t.Errorf(`expected="%s" actual="%v"`, c.expected, actual)
+				}
+				if LookupFormat("foo") != nil {
+					t.Errorf(`expected=nil actual="foo"`)
+				}
+			}()
+
+			Register(c.format)
+		})
+	}
+}
+
+func TestConversion_Format_DefineEncoderFlags(t *testing.T) {
+	cases := map[string]struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		"--quality=0":             {name: "jpeg", args: []string{"--quality=0"}, expected: "--quality must be greater than or equal to 1"},
+		"--quality=101":           {name: "jpeg", args: []string{"--quality=101"}, expected: "--quality must be less than or equal to 100"},
+		"--num-colors=0":          {name: "gif", args: []string{"--num-colors=0"}, expected: "--num-colors must be greater than or equal to 1"},
+		"--num-colors=257":        {name: "gif", args: []string{"--num-colors=257"}, expected: "--num-colors must be less than or equal to 256"},
+		"--gif-quantizer=foo":     {name: "gif", args: []string{"--gif-quantizer=foo"}, expected: "--gif-quantizer is not included in the list: \"plan9\", \"median-cut\", \"octree\", \"k-means\""},
+		"--gif-dither=foo":        {name: "gif", args: []string{"--gif-dither=foo"}, expected: "--gif-dither is not included in the list: \"none\", \"floyd-steinberg\", \"bayer\""},
+		"--compression-level=foo": {name: "png", args: []string{"--compression-level=foo"}, expected: "--compression-level is not included in the list: \"default\", \"no\", \"best-speed\", \"best-compression\""},
+		"--tiff-compression=foo":  {name: "tiff", args: []string{"--tiff-compression=foo"}, expected: "--tiff-compression is not included in the list: \"none\", \"lzw\", \"packbits\", \"deflate\""},
+		"--ico-sizes=16,257":      {name: "ico", args: []string{"--ico-sizes=16,257"}, expected: "--ico-sizes must be comma-separated sizes from 1 to 256"},
+		"--ico-sizes=16,":         {name: "ico", args: []string{"--ico-sizes=16,"}, expected: "--ico-sizes must be comma-separated sizes from 1 to 256"},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			flg := flag.NewFlagSet("test", flag.ContinueOnError)
+			factory := LookupFormat(c.name).DefineEncoderFlags(flg)
+
+			err := flg.Parse(c.args)
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+
+			_, err = factory()
+
+			actual := err.Error()
+			if actual != c.expected {
+				t.Errorf(`expected="%s" actual="%s"`, c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestConversion_Format_DefineDecoderFlags(t *testing.T) {
+	cases := map[string]struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		"--ico-size=-1":  {name: "ico", args: []string{"--ico-size=-1"}, expected: "--ico-size must be from 0 to 256, where 0 means the largest entry"},
+		"--ico-size=257": {name: "ico", args: []string{"--ico-size=257"}, expected: "--ico-size must be from 0 to 256, where 0 means the largest entry"},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			flg := flag.NewFlagSet("test", flag.ContinueOnError)
+			factory := LookupFormat(c.name).DefineDecoderFlags(flg)
+
+			err := flg.Parse(c.args)
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+
+			_, err = factory()
+
+			actual := err.Error()
+			if actual != c.expected {
+				t.Errorf(`expected="%s" actual="%s"`, c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestConversion_FormatOfDecoder(t *testing.T) {
+	cases := map[string]struct {
+		decoder  Decoder
+		expected string
+	}{
+		"Jpeg":   {decoder: &Jpeg{}, expected: "jpeg"},
+		"Png":    {decoder: &Png{}, expected: "png"},
+		"Gif":    {decoder: &Gif{}, expected: "gif"},
+		"Bmp":    {decoder: &Bmp{}, expected: "bmp"},
+		"Ico":    {decoder: &Ico{Size: 32}, expected: "ico"},
+		"Netpbm": {decoder: &Netpbm{}, expected: "netpbm"},
+		"Qoi":    {decoder: &Qoi{}, expected: "qoi"},
+		"Tga":    {decoder: &Tga{}, expected: "tga"},
+		"Tiff":   {decoder: &Tiff{}, expected: "tiff"},
+		"WebP":   {decoder: &WebP{}, expected: "webp"},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			actual := FormatOfDecoder(c.decoder).Name
+			if actual != c.expected {
+				t.Errorf(`expected="%s" actual="%s"`, c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestConversion_FormatOfEncoder(t *testing.T) {
+	cases := map[string]struct {
+		encoder  Encoder
+		expected string
+	}{
+		"Jpeg": {encoder: jpegEncoder(), expected: "jpeg"},
+		"Png":  {encoder: pngEncoder(), expected: "png"},
+		"Gif":  {encoder: gifEncoder(), expected: "gif"},
+		"Bmp":  {encoder: &Bmp{}, expected: "bmp"},
+		"Tiff": {encoder: &Tiff{Compression: TiffLZW}, expected: "tiff"},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			actual := FormatOfEncoder(c.encoder).Name
+			if actual != c.expected {
+				t.Errorf(`expected="%s" actual="%s"`, c.expected, actual)
+			}
+		})
+	}
+}
@@ -1,27 +1,206 @@
 package conversion
 
 import (
+	"errors"
+	"flag"
 	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
 	"image/gif"
 	"io"
 	"path/filepath"
 )
 
+func init() {
+	Register(&Format{
+		Name:       "gif",
+		Shorthand:  "g",
+		Extnames:   []string{".gif"},
+		NewDecoder: func() Decoder { return &Gif{} },
+		DefineEncoderFlags: func(flg *flag.FlagSet) EncoderFactory {
+			numColors := flg.Int("num-colors", 256, "Maximum number of colors used in the GIF image to be used with '-g' option. You can specify 1 to 256.")
+			humanQuantizer := flg.String("gif-quantizer", "plan9", "Way of choosing the colors of GIF to be used with '-g' option. You can specify from 'plan9', 'median-cut', 'octree', 'k-means'.")
+			humanDither := flg.String("gif-dither", "floyd-steinberg", "Dithering of GIF to be used with '-g' option. You can specify from 'none', 'floyd-steinberg', 'bayer'.")
+			palettePath := flg.String("gif-palette", "", "Palette of GIF to be used with '-g' option instead of quantizing each image. You can specify a GIMP palette (.gpl), a JASC palette (.pal) or an image whose colors are used.")
+
+			return func() (Encoder, error) {
+				if *numColors < 1 {
+					return nil, errors.New("--num-colors must be greater than or equal to 1")
+				} else if *numColors > 256 {
+					return nil, errors.New("--num-colors must be less than or equal to 256")
+				}
+				quantizer, ok := GifQuantizers[*humanQuantizer]
+				if !ok {
+					return nil, errors.New("--gif-quantizer is not included in the list: \"plan9\", \"median-cut\", \"octree\", \"k-means\"")
+				}
+				drawer, ok := GifDrawers[*humanDither]
+				if !ok {
+					return nil, errors.New("--gif-dither is not included in the list: \"none\", \"floyd-steinberg\", \"bayer\"")
+				}
+				g := &Gif{Options: &gif.Options{NumColors: *numColors, Quantizer: quantizer, Drawer: drawer}}
+				if *palettePath != "" {
+					var err error
+					g.Palette, err = LoadPalette(*palettePath, *numColors, quantizer)
+					if err != nil {
+						return nil, err
+					}
+				}
+				return g, nil
+			}
+		},
+	})
+}
+
+// GifQuantizers are the quantizers of GIF by name. "plan9" is nil, which is the fixed Plan 9 palette of image/gif.
+var GifQuantizers = map[string]draw.Quantizer{
+	"plan9":      nil,
+	"median-cut": MedianCut{},
+	"octree":     Octree{},
+	"k-means":    KMeans{},
+}
+
+// GifDrawers are the dithering of GIF by name. "floyd-steinberg" is nil, which is the default of image/gif.
+var GifDrawers = map[string]draw.Drawer{
+	"none":            draw.Src,
+	"floyd-steinberg": nil,
+	"bayer":           Bayer{},
+}
+
 // Gif https://en.wikipedia.org/wiki/GIF
+// Animated GIFs are converted to GIF with their frames by DecodeAnimation and EncodeAnimation.
 type Gif struct {
 	Options *gif.Options
+
+	// Palette, when specified, is used for all the images and the frames of an animation instead of quantizing each of them,
+	// so that they share identical colors. See SharedPalette and LoadPalette.
+	Palette color.Palette
 }
 
 // Encode encodes the specified file to GIF
 func (g *Gif) Encode(w io.Writer, img image.Image) error {
+	if g.Palette != nil {
+		// gif.Encode would quantize it again if the palette has more colors than Options.NumColors.
+		return gif.EncodeAll(w, &gif.GIF{Image: []*image.Paletted{g.paletted(img)}, Delay: []int{0}})
+	}
 	return gif.Encode(w, img, g.Options)
 }
 
-// Decode decodes the specified GIF file
+// EncodeAnimation encodes the animation to GIF keeping the delays, the disposals and the loop count.
+// The frames of more colors than Options.NumColors are quantized, and their transparent pixels are kept transparent.
+// Since GIF draws every frame over the canvas, the frames are composited first if any of them replaces the canvas with transparency.
+func (g *Gif) EncodeAnimation(w io.Writer, a *Animation) error {
+	if a.blendsSource() {
+		flattened := *a
+		flattened.flatten()
+		a = &flattened
+	}
+
+	gf := &gif.GIF{
+		Image:     make([]*image.Paletted, len(a.Frames)),
+		Delay:     a.Delays,
+		Disposal:  a.Disposals,
+		LoopCount: a.LoopCount,
+		Config:    image.Config{Width: a.Width, Height: a.Height},
+	}
+	for i, frame := range a.Frames {
+		gf.Image[i] = g.paletted(frame)
+	}
+
+	return gif.EncodeAll(w, gf)
+}
+
+// paletted returns the frame drawn with Palette if it is specified.
+// Otherwise, it returns the frame as it is if it is paletted within the number of colors, or quantized in the way gif.Encode does.
+// A transparent color is added to the palette when the frame has transparent pixels and the palette has none.
+func (g *Gif) paletted(img image.Image) *image.Paletted {
+	opts := g.Options
+	if opts == nil {
+		opts = &gif.Options{}
+	}
+	numColors := opts.NumColors
+	if numColors < 1 || numColors > 256 {
+		numColors = 256
+	}
+
+	drawer := opts.Drawer
+	if drawer == nil {
+		drawer = draw.FloydSteinberg
+	}
+
+	bounds := img.Bounds()
+
+	if g.Palette != nil {
+		pal := g.Palette
+		if len(pal) < 256 && !hasTransparent(pal) && !isOpaque(img) {
+			pal = append(pal[:len(pal):len(pal)], color.RGBA{})
+		}
+		pm := image.NewPaletted(bounds, pal)
+		drawer.Draw(pm, bounds, img, bounds.Min)
+		return pm
+	}
+
+	if p, ok := img.(*image.Paletted); ok && len(p.Palette) <= numColors {
+		return p
+	}
+
+	transparent := numColors > 1 && !isOpaque(img)
+	if transparent {
+		numColors--
+	}
+
+	var pal color.Palette
+	if opts.Quantizer != nil {
+		pal = opts.Quantizer.Quantize(make(color.Palette, 0, numColors), img)
+	} else {
+		pal = append(color.Palette{}, palette.Plan9[:numColors]...)
+	}
+	if transparent {
+		pal = append(pal, color.RGBA{})
+	}
+
+	pm := image.NewPaletted(bounds, pal)
+	drawer.Draw(pm, bounds, img, bounds.Min)
+
+	return pm
+}
+
+func hasTransparent(p color.Palette) bool {
+	for _, c := range p {
+		if _, _, _, a := c.RGBA(); a == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Decode decodes the first frame of the specified GIF file
 func (g *Gif) Decode(r io.Reader) (image.Image, error) {
 	return gif.Decode(r)
 }
 
+// DecodeAnimation decodes all the frames of the specified GIF file with their delays, disposals and loop count.
+func (g *Gif) DecodeAnimation(r io.Reader) (*Animation, error) {
+	gf, err := gif.DecodeAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Animation{
+		Frames:    make([]image.Image, len(gf.Image)),
+		Delays:    gf.Delay,
+		Disposals: gf.Disposal,
+		LoopCount: gf.LoopCount,
+		Width:     gf.Config.Width,
+		Height:    gf.Config.Height,
+	}
+	for i, frame := range gf.Image {
+		a.Frames[i] = frame
+	}
+
+	return a, nil
+}
+
 // Extname returns "gif"
 func (g *Gif) Extname() string {
 	return "gif"
@@ -1,6 +1,10 @@
 package conversion
 
 import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
 	"reflect"
 	"testing"
 )
@@ -43,3 +47,151 @@ func TestConversion_Gif_HasProcessableExtname(t *testing.T) {
 		})
 	}
 }
+
+func TestConversion_Gif_Encode(t *testing.T) {
+	// From black to white with the transparent pixel at the end
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 64; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 4), G: uint8(x * 4), B: uint8(x * 4), A: 0xFF})
+		}
+	}
+
+	cases := map[string]struct {
+		quantizer string
+		dither    string
+	}{
+		"plan9 floyd-steinberg":   {quantizer: "plan9", dither: "floyd-steinberg"},
+		"median-cut none":         {quantizer: "median-cut", dither: "none"},
+		"octree bayer":            {quantizer: "octree", dither: "bayer"},
+		"k-means floyd-steinberg": {quantizer: "k-means", dither: "floyd-steinberg"},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			g := &Gif{Options: &gif.Options{NumColors: 16, Quantizer: GifQuantizers[c.quantizer], Drawer: GifDrawers[c.dither]}}
+
+			var buf bytes.Buffer
+			err := g.Encode(&buf, img)
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+
+			decoded, err := gif.Decode(&buf)
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+
+			p := decoded.(*image.Paletted)
+			if len(p.Palette) > 16 {
+				t.Errorf(`expected=%d actual=%d`, 16, len(p.Palette))
+			}
+			if p.Rect != img.Rect {
+				t.Errorf(`expected="%v" actual="%v"`, img.Rect, p.Rect)
+			}
+		})
+	}
+}
+
+func TestConversion_Gif_Encode_Palette(t *testing.T) {
+	t.Parallel()
+
+	red := color.RGBA{R: 0xFF, A: 0xFF}
+	blue := color.RGBA{B: 0xFF, A: 0xFF}
+
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{R: 0xF0, A: 0xFF})
+	img.SetNRGBA(1, 0, color.NRGBA{B: 0xF0, A: 0xFF})
+
+	// More colors than NumColors, and a transparent color is added for the transparent pixel.
+	g := &Gif{Options: &gif.Options{NumColors: 1}, Palette: color.Palette{red, blue}}
+
+	var buf bytes.Buffer
+	err := g.Encode(&buf, img)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	decoded, err := gif.Decode(&buf)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	p := decoded.(*image.Paletted)
+	expected := color.Palette{red, blue, color.RGBA{}}
+	if actual := p.Palette[:3]; !reflect.DeepEqual(actual, expected) {
+		t.Errorf(`expected="%v" actual="%v"`, expected, actual)
+	}
+	if actual := p.Pix; !bytes.Equal(actual, []byte{0, 1, 2}) {
+		t.Errorf(`expected="%v" actual="%v"`, []byte{0, 1, 2}, actual)
+	}
+}
+
+func TestConversion_Gif_EncodeDecodeAnimation(t *testing.T) {
+	t.Parallel()
+
+	pal := color.Palette{color.RGBA{A: 0xFF}, color.RGBA{R: 0xFF, A: 0xFF}}
+	first := image.NewPaletted(image.Rect(0, 0, 8, 4), pal)
+	second := image.NewPaletted(image.Rect(2, 1, 6, 3), pal)
+	second.Pix[0] = 1
+	// More colors than NumColors with a transparent pixel
+	third := image.NewNRGBA(image.Rect(0, 0, 8, 4))
+	for i := range third.Pix {
+		third.Pix[i] = byte(i * 8)
+		if i%4 == 3 {
+			third.Pix[i] = 0xFF
+		}
+	}
+	third.Pix[3] = 0
+
+	a := &Animation{
+		Frames:    []image.Image{first, second, third},
+		Delays:    []int{10, 20, 30},
+		Disposals: []byte{gif.DisposalNone, gif.DisposalPrevious, gif.DisposalBackground},
+		LoopCount: 2,
+		Width:     8,
+		Height:    4,
+	}
+
+	g := &Gif{Options: &gif.Options{NumColors: 4}}
+	buf := &bytes.Buffer{}
+
+	err := g.EncodeAnimation(buf, a)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	actual, err := g.DecodeAnimation(buf)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	if !reflect.DeepEqual(actual.Delays, a.Delays) {
+		t.Errorf(`expected="%v" actual="%v"`, a.Delays, actual.Delays)
+	}
+	if !reflect.DeepEqual(actual.Disposals, a.Disposals) {
+		t.Errorf(`expected="%v" actual="%v"`, a.Disposals, actual.Disposals)
+	}
+	if actual.LoopCount != a.LoopCount || actual.Width != a.Width || actual.Height != a.Height {
+		t.Errorf(`expected="%d %dx%d" actual="%d %dx%d"`, a.LoopCount, a.Width, a.Height, actual.LoopCount, actual.Width, actual.Height)
+	}
+
+	if len(actual.Frames) != 3 {
+		t.Fatalf(`expected=3 actual=%d`, len(actual.Frames))
+	}
+	assertSameImage(t, second, actual.Frames[1])
+
+	p := actual.Frames[2].(*image.Paletted)
+	if len(p.Palette) > 4 {
+		t.Errorf(`expected<=4 actual=%d`, len(p.Palette))
+	}
+	if _, _, _, alpha := p.At(0, 0).RGBA(); alpha != 0 {
+		t.Errorf(`expected=0 actual=%d`, alpha)
+	}
+	if _, _, _, alpha := p.At(7, 3).RGBA(); alpha != 0xFFFF {
+		t.Errorf(`expected=65535 actual=%d`, alpha)
+	}
+}
@@ -0,0 +1,280 @@
+package conversion
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/hioki-daichi/imgconv/resizing"
+)
+
+func init() {
+	Register(&Format{
+		Name:       "ico",
+		Aliases:    []string{"cur"},
+		Shorthand:  "i",
+		Extnames:   []string{".ico", ".cur"},
+		NewDecoder: func() Decoder { return &Ico{} },
+		DefineDecoderFlags: func(flg *flag.FlagSet) DecoderFactory {
+			size := flg.Int("ico-size", 0, "Size of the entry of ICO or CUR to be decoded with '-I' option. The largest entry is decoded by default.")
+
+			return func() (Decoder, error) {
+				if *size < 0 || *size > icoMaxSize {
+					return nil, errors.New("--ico-size must be from 0 to 256, where 0 means the largest entry")
+				}
+				return &Ico{Size: *size}, nil
+			}
+		},
+		DefineEncoderFlags: func(flg *flag.FlagSet) EncoderFactory {
+			humanSizes := flg.String("ico-sizes", "16,32,48,256", "Comma-separated sizes of the entries of ICO to be used with '-i' option, from 1 to 256.")
+
+			return func() (Encoder, error) {
+				var sizes []int
+				for _, s := range strings.Split(*humanSizes, ",") {
+					size, err := strconv.Atoi(strings.TrimSpace(s))
+					if err != nil || size < 1 || size > icoMaxSize {
+						return nil, errors.New("--ico-sizes must be comma-separated sizes from 1 to 256")
+					}
+					sizes = append(sizes, size)
+				}
+				return &Ico{Sizes: sizes}, nil
+			}
+		},
+	})
+}
+
+// Ico https://en.wikipedia.org/wiki/ICO_(file_format)
+// CUR is decoded in the same way, but only ICO is encoded.
+type Ico struct {
+	// Sizes are the widths and heights of the entries to encode. The zero value means 16, 32, 48 and 256.
+	Sizes []int
+
+	// Size is the width of the entry to decode. The zero value means the largest entry.
+	Size int
+}
+
+// Types of the ICO header
+const (
+	icoTypeIcon   = 1
+	icoTypeCursor = 2
+)
+
+const (
+	icoHeaderLen = 6
+	icoEntryLen  = 16
+	icoMaxSize   = 256
+)
+
+// Entries of this size or larger are embedded as PNG, as Windows does for large icons, which saves much space.
+const icoPNGMinSize = 256
+
+var icoDefaultSizes = []int{16, 32, 48, 256}
+
+var errIcoInvalid = errors.New("ico: invalid format")
+
+// Encode encodes the specified file to ICO of the sizes.
+// The image is resized to fit within each size keeping the aspect ratio, centered on the transparent square.
+// Each entry is written in 32 bits with alpha, as BMP or PNG depending on the size.
+func (ic *Ico) Encode(w io.Writer, img image.Image) error {
+	sizes := ic.Sizes
+	if len(sizes) == 0 {
+		sizes = icoDefaultSizes
+	}
+
+	entries := make([][]byte, len(sizes))
+	for i, size := range sizes {
+		if size < 1 || size > icoMaxSize {
+			return errors.New("ico: invalid size")
+		}
+
+		icon := icoIcon(img, size)
+		if size >= icoPNGMinSize {
+			buf := &bytes.Buffer{}
+			err := png.Encode(buf, icon)
+			if err != nil {
+				return err
+			}
+			entries[i] = buf.Bytes()
+		} else {
+			entries[i] = encodeIcoDIB(icon)
+		}
+	}
+
+	header := make([]byte, icoHeaderLen+icoEntryLen*len(sizes))
+	binary.LittleEndian.PutUint16(header[2:], icoTypeIcon)
+	binary.LittleEndian.PutUint16(header[4:], uint16(len(sizes)))
+
+	offset := len(header)
+	for i, size := range sizes {
+		e := header[icoHeaderLen+icoEntryLen*i:]
+		// 0 means 256.
+		e[0], e[1] = byte(size), byte(size)
+		binary.LittleEndian.PutUint16(e[4:], 1)
+		binary.LittleEndian.PutUint16(e[6:], 32)
+		binary.LittleEndian.PutUint32(e[8:], uint32(len(entries[i])))
+		binary.LittleEndian.PutUint32(e[12:], uint32(offset))
+		offset += len(entries[i])
+	}
+
+	_, err := w.Write(header)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		_, err := w.Write(entry)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// icoIcon returns the image fitted within the square of the size.
+func icoIcon(img image.Image, size int) *image.NRGBA {
+	bounds := img.Bounds()
+	width, height := size, size
+	if bounds.Dx() > bounds.Dy() {
+		height = (size*bounds.Dy() + bounds.Dx()/2) / bounds.Dx()
+	} else {
+		width = (size*bounds.Dx() + bounds.Dy()/2) / bounds.Dy()
+	}
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+
+	src := img
+	if bounds.Dx() != width || bounds.Dy() != height {
+		src = resizing.Resize(img, width, height, resizing.Lanczos)
+	}
+
+	icon := image.NewNRGBA(image.Rect(0, 0, size, size))
+	x, y := (size-width)/2, (size-height)/2
+	draw.Draw(icon, image.Rect(x, y, x+width, y+height), src, src.Bounds().Min, draw.Src)
+
+	return icon
+}
+
+// encodeIcoDIB encodes the icon to the DIB of 32 bits BI_RGB followed by the AND mask, which is set where the icon is transparent.
+func encodeIcoDIB(icon *image.NRGBA) []byte {
+	width, height := icon.Rect.Dx(), icon.Rect.Dy()
+	stride := bmpStride(width, 32)
+	maskStride := bmpStride(width, 1)
+
+	dib := make([]byte, bmpInfoHeaderLen+(stride+maskStride)*height)
+	binary.LittleEndian.PutUint32(dib[0:], bmpInfoHeaderLen)
+	binary.LittleEndian.PutUint32(dib[4:], uint32(width))
+	// The height includes the AND mask.
+	binary.LittleEndian.PutUint32(dib[8:], uint32(2*height))
+	binary.LittleEndian.PutUint16(dib[12:], 1)
+	binary.LittleEndian.PutUint16(dib[14:], 32)
+	binary.LittleEndian.PutUint32(dib[16:], bmpRGB)
+	binary.LittleEndian.PutUint32(dib[20:], uint32((stride+maskStride)*height))
+
+	// Rows are stored bottom-up.
+	pixels := dib[bmpInfoHeaderLen:]
+	mask := pixels[stride*height:]
+	for row := 0; row < height; row++ {
+		src := icon.Pix[(height-1-row)*icon.Stride:]
+		dst := pixels[row*stride:]
+		for x := 0; x < width; x++ {
+			r, g, b, a := src[4*x], src[4*x+1], src[4*x+2], src[4*x+3]
+			dst[4*x], dst[4*x+1], dst[4*x+2], dst[4*x+3] = b, g, r, a
+			if a == 0 {
+				mask[row*maskStride+x/8] |= 0x80 >> uint(x%8)
+			}
+		}
+	}
+
+	return dib
+}
+
+// Decode decodes the entry of the size, or the largest entry with the most colors, of the specified ICO or CUR file.
+// Entries of BMP are decoded to *image.NRGBA, and those of PNG as they are decoded by image/png.
+func (ic *Ico) Decode(r io.Reader) (image.Image, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < icoHeaderLen || data[0] != 0 || data[1] != 0 {
+		return nil, errIcoInvalid
+	}
+	typ := binary.LittleEndian.Uint16(data[2:])
+	count := int(binary.LittleEndian.Uint16(data[4:]))
+	if (typ != icoTypeIcon && typ != icoTypeCursor) || count == 0 {
+		return nil, errIcoInvalid
+	}
+	if len(data) < icoHeaderLen+icoEntryLen*count {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	var best []byte
+	bestArea, bestDepth := 0, 0
+	for i := 0; i < count; i++ {
+		e := data[icoHeaderLen+icoEntryLen*i:]
+		width, height := int(e[0]), int(e[1])
+		// 0 means 256.
+		if width == 0 {
+			width = icoMaxSize
+		}
+		if height == 0 {
+			height = icoMaxSize
+		}
+		// CUR has the hotspot in place of the bits per pixel.
+		depth := 0
+		if typ == icoTypeIcon {
+			depth = int(binary.LittleEndian.Uint16(e[6:]))
+		}
+
+		if ic.Size != 0 && width != ic.Size {
+			continue
+		}
+		if area := width * height; best == nil || area > bestArea || (area == bestArea && depth > bestDepth) {
+			best, bestArea, bestDepth = e, area, depth
+		}
+	}
+	if best == nil {
+		return nil, errors.New("ico: no entry of the size")
+	}
+
+	size := int64(binary.LittleEndian.Uint32(best[8:]))
+	offset := int64(binary.LittleEndian.Uint32(best[12:]))
+	if offset+size > int64(len(data)) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	entry := data[offset : offset+size]
+
+	if bytes.HasPrefix(entry, []byte("\x89PNG\r\n\x1a\n")) {
+		return png.Decode(bytes.NewReader(entry))
+	}
+	return decodeBmpDIB(entry, 0, true)
+}
+
+// Extname returns "ico"
+func (ic *Ico) Extname() string {
+	return "ico"
+}
+
+// MagicBytesSlice returns the magic bytes slice of ICO and CUR
+func (ic *Ico) MagicBytesSlice() [][]byte {
+	return [][]byte{[]byte("\x00\x00\x01\x00"), []byte("\x00\x00\x02\x00")}
+}
+
+// HasProcessableExtname returns whether the specified path has ".ico" or ".cur"
+func (ic *Ico) HasProcessableExtname(path string) bool {
+	ext := filepath.Ext(path)
+	return ext == ".ico" || ext == ".cur"
+}
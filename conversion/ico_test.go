@@ -0,0 +1,255 @@
+package conversion
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestConversion_Ico_MagicBytesSlice(t *testing.T) {
+	t.Parallel()
+
+	expected := [][]byte{[]byte("\x00\x00\x01\x00"), []byte("\x00\x00\x02\x00")}
+
+	ic := Ico{}
+
+	actual := ic.MagicBytesSlice()
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf(`expected="%s" actual="%s"`, expected, actual)
+	}
+}
+
+func TestConversion_Ico_HasProcessableExtname(t *testing.T) {
+	ic := Ico{}
+
+	cases := map[string]struct {
+		path     string
+		expected bool
+	}{
+		"foo.ico": {path: "foo.ico", expected: true},
+		"foo.cur": {path: "foo.cur", expected: true},
+		"foo.bmp": {path: "foo.bmp", expected: false},
+		"foo.png": {path: "foo.png", expected: false},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			actual := ic.HasProcessableExtname(c.path)
+			if actual != c.expected {
+				t.Errorf(`expected="%t" actual="%t"`, c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestConversion_Ico_EncodeDecode(t *testing.T) {
+	t.Parallel()
+
+	rnd := rand.New(rand.NewSource(1))
+
+	img := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	rnd.Read(img.Pix)
+	for i := 3; i < len(img.Pix); i += 4 {
+		// Fully transparent pixels lose their colors in the mask.
+		if img.Pix[i] == 0 {
+			img.Pix[i] = 1
+		}
+	}
+
+	buf := &bytes.Buffer{}
+
+	err := (&Ico{Sizes: []int{16, 32, 256}}).Encode(buf, img)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	data := buf.Bytes()
+
+	if count := binary.LittleEndian.Uint16(data[4:]); count != 3 {
+		t.Fatalf(`expected=3 actual=%d`, count)
+	}
+	// The entry of 256 is PNG.
+	offset := binary.LittleEndian.Uint32(data[icoHeaderLen+2*icoEntryLen+12:])
+	if !bytes.HasPrefix(data[offset:], []byte("\x89PNG")) {
+		t.Errorf(`expected PNG actual="%q"`, data[offset:offset+4])
+	}
+
+	for _, size := range []int{0, 16, 32, 256} {
+		actual, err := (&Ico{Size: size}).Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("err %s", err)
+		}
+
+		expected := size
+		if expected == 0 {
+			expected = 256
+		}
+		if actual.Bounds() != image.Rect(0, 0, expected, expected) {
+			t.Errorf(`expected="%d" actual="%v"`, expected, actual.Bounds())
+		}
+		if size == 32 {
+			assertSameImage(t, img, actual)
+		}
+	}
+}
+
+func TestConversion_Ico_Encode_Aspect(t *testing.T) {
+	t.Parallel()
+
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for i := range img.Pix {
+		img.Pix[i] = 0xFF
+	}
+
+	buf := &bytes.Buffer{}
+
+	err := (&Ico{Sizes: []int{4}}).Encode(buf, img)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	actual, err := (&Ico{}).Decode(buf)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	// Centered on the transparent square
+	for y := 0; y < 4; y++ {
+		expected := color.NRGBA{}
+		if y == 1 || y == 2 {
+			expected = color.NRGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}
+		}
+		if c := color.NRGBAModel.Convert(actual.At(0, y)); c != expected {
+			t.Errorf(`(0, %d): expected="%v" actual="%v"`, y, expected, c)
+		}
+	}
+}
+
+func TestConversion_Ico_Decode(t *testing.T) {
+	black := color.NRGBA{A: 0xFF}
+	white := color.NRGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}
+	transparent := color.NRGBA{}
+
+	// 1 bit of 2x2, whose top-left pixel is transparent by the AND mask
+	bilevel := icoDIB(2, 2, 1, []byte{0, 0, 0, 0, 0xFF, 0xFF, 0xFF, 0}, []byte{0x80, 0, 0, 0, 0, 0, 0, 0}, []byte{0, 0, 0, 0, 0x80, 0, 0, 0})
+	// 32 bits of 1x1, whose alpha is all zero, which means the AND mask is used
+	zeroAlpha := icoDIB(1, 1, 32, nil, []byte{0xFF, 0xFF, 0xFF, 0}, []byte{0, 0, 0, 0})
+
+	cases := map[string]struct {
+		data     []byte
+		size     int
+		expected [][]color.NRGBA
+	}{
+		"1 bit with mask": {
+			data:     icoFile(icoTypeIcon, [][]byte{bilevel}, []int{2}),
+			expected: [][]color.NRGBA{{transparent, black}, {white, black}},
+		},
+		"zero alpha": {
+			data:     icoFile(icoTypeIcon, [][]byte{zeroAlpha}, []int{1}),
+			expected: [][]color.NRGBA{{white}},
+		},
+		"largest": {
+			data:     icoFile(icoTypeIcon, [][]byte{zeroAlpha, bilevel}, []int{1, 2}),
+			expected: [][]color.NRGBA{{transparent, black}, {white, black}},
+		},
+		"chosen": {
+			data:     icoFile(icoTypeIcon, [][]byte{zeroAlpha, bilevel}, []int{1, 2}),
+			size:     1,
+			expected: [][]color.NRGBA{{white}},
+		},
+		"cursor": {
+			data:     icoFile(icoTypeCursor, [][]byte{bilevel}, []int{2}),
+			expected: [][]color.NRGBA{{transparent, black}, {white, black}},
+		},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			img, err := (&Ico{Size: c.size}).Decode(bytes.NewReader(c.data))
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+
+			if img.Bounds().Dy() != len(c.expected) {
+				t.Fatalf(`expected=%d actual=%d`, len(c.expected), img.Bounds().Dy())
+			}
+			for y, row := range c.expected {
+				for x, expected := range row {
+					actual := color.NRGBAModel.Convert(img.At(x, y))
+					if actual != expected {
+						t.Errorf(`(%d, %d): expected="%v" actual="%v"`, x, y, expected, actual)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestConversion_Ico_Decode_Failure(t *testing.T) {
+	entry := icoDIB(1, 1, 32, nil, []byte{0xFF, 0xFF, 0xFF, 0xFF}, nil)
+
+	cases := map[string]struct {
+		data     []byte
+		size     int
+		expected string
+	}{
+		"not ICO":     {data: []byte("BM\x00\x00\x00\x00"), expected: "ico: invalid format"},
+		"no entries":  {data: []byte("\x00\x00\x01\x00\x00\x00"), expected: "ico: invalid format"},
+		"no entry":    {data: icoFile(icoTypeIcon, [][]byte{entry}, []int{1}), size: 16, expected: "ico: no entry of the size"},
+		"truncated":   {data: icoFile(icoTypeIcon, [][]byte{entry}, []int{1})[:30], expected: "unexpected EOF"},
+		"directories": {data: []byte("\x00\x00\x01\x00\x02\x00"), expected: "unexpected EOF"},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := (&Ico{Size: c.size}).Decode(bytes.NewReader(c.data))
+
+			actual := err.Error()
+			if actual != c.expected {
+				t.Errorf(`expected="%s" actual="%s"`, c.expected, actual)
+			}
+		})
+	}
+}
+
+// icoDIB returns the DIB of an icon entry with the palette, the bottom-up pixels and the AND mask.
+func icoDIB(width int, height int, bpp int, palette []byte, pixels []byte, mask []byte) []byte {
+	dib := make([]byte, bmpInfoHeaderLen)
+	binary.LittleEndian.PutUint32(dib[0:], bmpInfoHeaderLen)
+	binary.LittleEndian.PutUint32(dib[4:], uint32(width))
+	binary.LittleEndian.PutUint32(dib[8:], uint32(2*height))
+	binary.LittleEndian.PutUint16(dib[12:], 1)
+	binary.LittleEndian.PutUint16(dib[14:], uint16(bpp))
+	binary.LittleEndian.PutUint32(dib[32:], uint32(len(palette)/4))
+	dib = append(dib, palette...)
+	dib = append(dib, pixels...)
+	return append(dib, mask...)
+}
+
+func icoFile(typ uint16, entries [][]byte, sizes []int) []byte {
+	header := make([]byte, icoHeaderLen+icoEntryLen*len(entries))
+	binary.LittleEndian.PutUint16(header[2:], typ)
+	binary.LittleEndian.PutUint16(header[4:], uint16(len(entries)))
+
+	offset := len(header)
+	for i, entry := range entries {
+		e := header[icoHeaderLen+icoEntryLen*i:]
+		e[0], e[1] = byte(sizes[i]), byte(sizes[i])
+		binary.LittleEndian.PutUint32(e[8:], uint32(len(entry)))
+		binary.LittleEndian.PutUint32(e[12:], uint32(offset))
+		offset += len(entry)
+	}
+	return append(header, bytes.Join(entries, nil)...)
+}
@@ -1,15 +1,51 @@
 package conversion
 
 import (
+	"bytes"
+	"errors"
+	"flag"
 	"image"
 	"image/jpeg"
 	"io"
+	"io/ioutil"
 	"path/filepath"
 )
 
+func init() {
+	Register(&Format{
+		Name:       "jpeg",
+		Aliases:    []string{"jpg"},
+		Shorthand:  "j",
+		Extnames:   []string{".jpg", ".jpeg"},
+		NewDecoder: func() Decoder { return &Jpeg{} },
+		DefineDecoderFlags: func(flg *flag.FlagSet) DecoderFactory {
+			ignoreOrientation := flg.Bool("jpeg-ignore-orientation", false, "Decode JPEG with '-J' option as it is stored, ignoring the EXIF orientation.")
+
+			return func() (Decoder, error) {
+				return &Jpeg{IgnoreOrientation: *ignoreOrientation}, nil
+			}
+		},
+		DefineEncoderFlags: func(flg *flag.FlagSet) EncoderFactory {
+			quality := flg.Int("quality", 100, "JPEG Quality to be used with '-j' option. You can specify 1 to 100.")
+
+			return func() (Encoder, error) {
+				if *quality < 1 {
+					return nil, errors.New("--quality must be greater than or equal to 1")
+				} else if *quality > 100 {
+					return nil, errors.New("--quality must be less than or equal to 100")
+				}
+				return &Jpeg{Options: &jpeg.Options{Quality: *quality}}, nil
+			}
+		},
+	})
+}
+
 // Jpeg https://en.wikipedia.org/wiki/JPEG
 type Jpeg struct {
 	Options *jpeg.Options
+
+	// By default, the image is decoded upright by the EXIF orientation, as phone cameras record it instead of rotating the pixels.
+	IgnoreOrientation bool
 }
 
 // Encode encodes the specified file to JPEG
@@ -17,9 +53,28 @@ func (j *Jpeg) Encode(w io.Writer, img image.Image) error {
 	return jpeg.Encode(w, img, j.Options)
 }
 
-// Decode decodes the specified JPEG file
+// Opaque returns true since JPEG cannot hold transparency.
+func (j *Jpeg) Opaque() bool {
+	return true
+}
+
+// Decode decodes the specified JPEG file, and rotates or flips it by the EXIF orientation unless IgnoreOrientation is set.
 func (j *Jpeg) Decode(r io.Reader) (image.Image, error) {
-	return jpeg.Decode(r)
+	if j.IgnoreOrientation {
+		return jpeg.Decode(r)
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	return orient(img, jpegOrientation(data)), nil
 }
 
 // Extname returns "jpg"
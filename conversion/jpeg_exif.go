@@ -0,0 +1,157 @@
+package conversion
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+)
+
+// EXIF orientations are from 1, as it is stored, to 8. https://www.cipa.jp/std/documents/e/DC-008-2012_E.pdf
+const (
+	orientationNormal = 1
+	orientationMax    = 8
+)
+
+const exifTagOrientation = 0x0112
+
+// jpegOrientation returns the EXIF orientation of the JPEG file from 1 to 8.
+// It returns 1, which means as it is stored, when the file has no valid orientation.
+func jpegOrientation(data []byte) int {
+	// Markers until the image data begin, each followed by the 2-byte length including itself.
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			break
+		}
+		marker := data[i+1]
+		if marker == 0xFF {
+			// Fill byte
+			i++
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			break
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+
+		i += 2 + length
+	}
+
+	return orientationNormal
+}
+
+// exifOrientation returns the orientation in IFD0 of the TIFF structure of EXIF.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return orientationNormal
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return orientationNormal
+	}
+	if order.Uint16(tiff[2:]) != 42 {
+		return orientationNormal
+	}
+
+	offset := int(order.Uint32(tiff[4:]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return orientationNormal
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < count; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		// SHORT of the count 1, whose value is in the first 2 bytes of the value field.
+		if order.Uint16(tiff[entry:]) == exifTagOrientation && order.Uint16(tiff[entry+2:]) == 3 {
+			v := int(order.Uint16(tiff[entry+8:]))
+			if v < orientationNormal || v > orientationMax {
+				return orientationNormal
+			}
+			return v
+		}
+	}
+
+	return orientationNormal
+}
+
+// orient returns the image transformed by the EXIF orientation so that it is upright.
+// Gray and CMYK images are kept in their color models, and the others are converted to RGBA.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= orientationNormal || orientation > orientationMax {
+		return img
+	}
+
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	// From 5, the width and the height are swapped.
+	dr := image.Rect(0, 0, w, h)
+	if orientation >= 5 {
+		dr = image.Rect(0, 0, h, w)
+	}
+
+	var dst image.Image
+	var srcPix, dstPix []uint8
+	var srcStride, dstStride, bpp int
+	switch m := img.(type) {
+	case *image.Gray:
+		d := image.NewGray(dr)
+		dst, dstPix, dstStride = d, d.Pix, d.Stride
+		srcPix, srcStride, bpp = m.Pix[m.PixOffset(bounds.Min.X, bounds.Min.Y):], m.Stride, 1
+	case *image.CMYK:
+		d := image.NewCMYK(dr)
+		dst, dstPix, dstStride = d, d.Pix, d.Stride
+		srcPix, srcStride, bpp = m.Pix[m.PixOffset(bounds.Min.X, bounds.Min.Y):], m.Stride, 4
+	default:
+		s := image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.Draw(s, s.Rect, img, bounds.Min, draw.Src)
+		d := image.NewRGBA(dr)
+		dst, dstPix, dstStride = d, d.Pix, d.Stride
+		srcPix, srcStride, bpp = s.Pix, s.Stride, 4
+	}
+
+	for y := 0; y < dr.Dy(); y++ {
+		for x := 0; x < dr.Dx(); x++ {
+			sx, sy := orientSource(orientation, x, y, w, h)
+			copy(dstPix[y*dstStride+x*bpp:][:bpp], srcPix[sy*srcStride+sx*bpp:][:bpp])
+		}
+	}
+
+	return dst
+}
+
+// orientSource returns the point of the stored image of w x h which is at (x, y) in the upright image.
+func orientSource(orientation int, x int, y int, w int, h int) (int, int) {
+	switch orientation {
+	case 2: // Flipped horizontally
+		return w - 1 - x, y
+	case 3: // Rotated 180
+		return w - 1 - x, h - 1 - y
+	case 4: // Flipped vertically
+		return x, h - 1 - y
+	case 5: // Transposed
+		return y, x
+	case 6: // Rotated 90 clockwise to be upright
+		return y, h - 1 - x
+	case 7: // Transversed
+		return w - 1 - y, h - 1 - x
+	default: // Rotated 90 counterclockwise to be upright
+		return w - 1 - y, x
+	}
+}
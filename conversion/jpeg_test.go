@@ -1,6 +1,11 @@
 package conversion
 
 import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
 	"reflect"
 	"testing"
 )
@@ -43,3 +48,128 @@ func TestConversion_Jpeg_HasProcessableExtname(t *testing.T) {
 		})
 	}
 }
+
+func TestConversion_Jpeg_Decode_Orientation(t *testing.T) {
+	// Stored sideways, black on the left and white on the right
+	img := image.NewGray(image.Rect(0, 0, 16, 8))
+	for y := 0; y < 8; y++ {
+		for x := 8; x < 16; x++ {
+			img.SetGray(x, y, color.Gray{Y: 0xFF})
+		}
+	}
+
+	cases := map[string]struct {
+		data     []byte
+		decoder  *Jpeg
+		bounds   image.Rectangle
+		topLeft  uint8
+		topRight uint8
+	}{
+		"no EXIF":            {data: jpegFile(t, img, nil, 0), decoder: &Jpeg{}, bounds: image.Rect(0, 0, 16, 8), topLeft: 0x00, topRight: 0xFF},
+		"rotated in II":      {data: jpegFile(t, img, binary.LittleEndian, 6), decoder: &Jpeg{}, bounds: image.Rect(0, 0, 8, 16), topLeft: 0x00, topRight: 0x00},
+		"rotated in MM":      {data: jpegFile(t, img, binary.BigEndian, 8), decoder: &Jpeg{}, bounds: image.Rect(0, 0, 8, 16), topLeft: 0xFF, topRight: 0xFF},
+		"upside down":        {data: jpegFile(t, img, binary.BigEndian, 3), decoder: &Jpeg{}, bounds: image.Rect(0, 0, 16, 8), topLeft: 0xFF, topRight: 0x00},
+		"invalid":            {data: jpegFile(t, img, binary.BigEndian, 9), decoder: &Jpeg{}, bounds: image.Rect(0, 0, 16, 8), topLeft: 0x00, topRight: 0xFF},
+		"ignore orientation": {data: jpegFile(t, img, binary.LittleEndian, 6), decoder: &Jpeg{IgnoreOrientation: true}, bounds: image.Rect(0, 0, 16, 8), topLeft: 0x00, topRight: 0xFF},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			decoded, err := c.decoder.Decode(bytes.NewReader(c.data))
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+
+			if actual := decoded.Bounds(); actual != c.bounds {
+				t.Errorf(`expected="%v" actual="%v"`, c.bounds, actual)
+			}
+
+			// JPEG is lossy, so the brightness is only told dark or bright.
+			for _, p := range []struct {
+				x, y     int
+				expected uint8
+			}{{1, 1, c.topLeft}, {c.bounds.Dx() - 2, 1, c.topRight}} {
+				actual := color.GrayModel.Convert(decoded.At(p.x, p.y)).(color.Gray).Y
+				if (actual >= 0x80) != (p.expected >= 0x80) {
+					t.Errorf(`(%d, %d): expected="%d" actual="%d"`, p.x, p.y, p.expected, actual)
+				}
+			}
+		})
+	}
+}
+
+func TestConversion_Orient(t *testing.T) {
+	// 1 2 3
+	// 4 5 6
+	img := &image.Gray{Pix: []uint8{1, 2, 3, 4, 5, 6}, Stride: 3, Rect: image.Rect(0, 0, 3, 2)}
+
+	cases := map[int]struct {
+		width    int
+		expected []uint8
+	}{
+		1: {width: 3, expected: []uint8{1, 2, 3, 4, 5, 6}},
+		2: {width: 3, expected: []uint8{3, 2, 1, 6, 5, 4}},
+		3: {width: 3, expected: []uint8{6, 5, 4, 3, 2, 1}},
+		4: {width: 3, expected: []uint8{4, 5, 6, 1, 2, 3}},
+		5: {width: 2, expected: []uint8{1, 4, 2, 5, 3, 6}},
+		6: {width: 2, expected: []uint8{4, 1, 5, 2, 6, 3}},
+		7: {width: 2, expected: []uint8{6, 3, 5, 2, 4, 1}},
+		8: {width: 2, expected: []uint8{3, 6, 2, 5, 1, 4}},
+	}
+
+	for orientation, c := range cases {
+		orientation, c := orientation, c
+		t.Run(string('0'+rune(orientation)), func(t *testing.T) {
+			t.Parallel()
+
+			actual := orient(img, orientation).(*image.Gray)
+			if actual.Rect.Dx() != c.width {
+				t.Errorf(`expected=%d actual=%d`, c.width, actual.Rect.Dx())
+			}
+			if !bytes.Equal(actual.Pix, c.expected) {
+				t.Errorf(`expected="%v" actual="%v"`, c.expected, actual.Pix)
+			}
+		})
+	}
+}
+
+// jpegFile encodes the image to JPEG with the APP1 segment of EXIF holding the orientation in the byte order, or without it if order is nil.
+func jpegFile(t *testing.T, img image.Image, order binary.ByteOrder, orientation int) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100})
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	data := buf.Bytes()
+	if order == nil {
+		return data
+	}
+
+	// The TIFF header, and IFD0 of a SHORT entry of the orientation
+	tiff := make([]byte, 8+2+12+4)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 1)
+	order.PutUint16(tiff[10:], 0x0112)
+	order.PutUint16(tiff[12:], 3)
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint16(tiff[18:], uint16(orientation))
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(2+len(segment)))
+	app1 = append(app1, segment...)
+
+	// Right after SOI
+	return append(append([]byte{0xFF, 0xD8}, app1...), data[2:]...)
+}
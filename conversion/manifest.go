@@ -0,0 +1,171 @@
+package conversion
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// Manifest records the content hashes of the converted source files and of the options they were converted with,
+// so that the unchanged ones converted with the same options can be skipped.
+// It is safe for concurrent use.
+type Manifest struct {
+	mu      sync.Mutex
+	entries map[string]*manifestEntry
+}
+
+type manifestEntry struct {
+	SHA256  string `json:"sha256"`
+	Options string `json:"options"`
+	DstPath string `json:"destination"`
+}
+
+// LoadManifest reads the manifest file. It returns an empty manifest if the file does not exist.
+func LoadManifest(path string) (*Manifest, error) {
+	m := &Manifest{entries: make(map[string]*manifestEntry)}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(b, &m.entries)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Save writes the manifest file via a temporary file in the same directory.
+func (m *Manifest) Save(path string) error {
+	m.mu.Lock()
+	b, err := json.MarshalIndent(m.entries, "", "  ")
+	m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(append(b, '\n'))
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (m *Manifest) matches(path string, hash string, options string, dstPath string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.entries[path]
+	return ok && e.SHA256 == hash && e.Options == options && e.DstPath == dstPath
+}
+
+func (m *Manifest) record(path string, hash string, options string, dstPath string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.entries[path] = &manifestEntry{SHA256: hash, Options: options, DstPath: dstPath}
+}
+
+func hashFile(path string) (string, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer fp.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, fp)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashOptions returns the hash of the options which affect the converted files: the decoder, the encoder and the transformers with all their settings,
+// whether the frames are extracted and the background.
+func (c *Converter) hashOptions() string {
+	h := sha256.New()
+	writeValue(h, reflect.ValueOf([]interface{}{c.Decoder, c.Encoder, c.Transformers, c.ExtractFrames, c.Background}))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// writeValue writes the deterministic representation of v including the dynamic types of the interfaces,
+// following pointers instead of writing their addresses as fmt does.
+func writeValue(w io.Writer, v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Invalid:
+		io.WriteString(w, "nil")
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			io.WriteString(w, "nil")
+			return
+		}
+		fmt.Fprintf(w, "%s(", v.Elem().Type())
+		writeValue(w, v.Elem())
+		io.WriteString(w, ")")
+	case reflect.Struct:
+		fmt.Fprintf(w, "%s{", v.Type())
+		for i := 0; i < v.NumField(); i++ {
+			fmt.Fprintf(w, "%s:", v.Type().Field(i).Name)
+			writeValue(w, v.Field(i))
+			io.WriteString(w, ",")
+		}
+		io.WriteString(w, "}")
+	case reflect.Slice, reflect.Array:
+		io.WriteString(w, "[")
+		for i := 0; i < v.Len(); i++ {
+			writeValue(w, v.Index(i))
+			io.WriteString(w, ",")
+		}
+		io.WriteString(w, "]")
+	case reflect.Map:
+		keys := make([]string, 0, v.Len())
+		values := make(map[string]reflect.Value, v.Len())
+		for _, k := range v.MapKeys() {
+			b := &bytes.Buffer{}
+			writeValue(b, k)
+			keys = append(keys, b.String())
+			values[b.String()] = v.MapIndex(k)
+		}
+		sort.Strings(keys)
+		io.WriteString(w, "map[")
+		for _, k := range keys {
+			fmt.Fprintf(w, "%s:", k)
+			writeValue(w, values[k])
+			io.WriteString(w, ",")
+		}
+		io.WriteString(w, "]")
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		fmt.Fprintf(w, "%s", v.Type())
+	default:
+		fmt.Fprintf(w, "%v", v)
+	}
+}
@@ -0,0 +1,604 @@
+package conversion
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	Register(&Format{
+		Name:       "netpbm",
+		Aliases:    []string{"pnm", "pbm", "pgm", "ppm", "pam"},
+		Shorthand:  "n",
+		Extnames:   []string{".pbm", ".pgm", ".ppm", ".pnm", ".pam"},
+		NewDecoder: func() Decoder { return &Netpbm{} },
+		DefineEncoderFlags: func(flg *flag.FlagSet) EncoderFactory {
+			humanVariant := flg.String("netpbm-format", "", "Format of Netpbm to be used with '-n' option. You can specify from 'pbm', 'pgm', 'ppm', 'pam'. Defaults to the one named by --to such as '--to=pgm', or 'ppm'.")
+			plain := flg.Bool("netpbm-plain", false, "Write PBM, PGM or PPM in the plain (ASCII) variant instead of the raw (binary) one with '-n' option.")
+
+			return func() (Encoder, error) {
+				// The aliases of the variants such as "pgm" choose the variant when given to --to.
+				var toVariant string
+				if to := flg.Lookup("to"); to != nil {
+					if _, ok := netpbmVariants[to.Value.String()]; ok {
+						toVariant = to.Value.String()
+					}
+				}
+
+				name := *humanVariant
+				switch {
+				case name == "" && toVariant != "":
+					name = toVariant
+				case name == "":
+					name = "ppm"
+				case toVariant != "" && name != toVariant:
+					return nil, errors.New("--netpbm-format conflicts with --to=" + toVariant)
+				}
+
+				variant, ok := netpbmVariants[name]
+				if !ok {
+					return nil, errors.New("--netpbm-format is not included in the list: \"pbm\", \"pgm\", \"ppm\", \"pam\"")
+				}
+				if *plain && variant == NetpbmPAM {
+					return nil, errors.New("--netpbm-plain cannot be used with PAM")
+				}
+				return &Netpbm{Variant: variant, Plain: *plain}, nil
+			}
+		},
+	})
+}
+
+// NetpbmVariant is the format of the Netpbm family to encode to.
+type NetpbmVariant int
+
+// Formats of the Netpbm family
+const (
+	NetpbmPPM NetpbmVariant = iota + 1
+	NetpbmPGM
+	NetpbmPBM
+	NetpbmPAM
+)
+
+var netpbmVariants = map[string]NetpbmVariant{
+	"pbm": NetpbmPBM,
+	"pgm": NetpbmPGM,
+	"ppm": NetpbmPPM,
+	"pam": NetpbmPAM,
+}
+
+// Netpbm http://netpbm.sourceforge.net/doc/
+// PBM, PGM and PPM are decoded in both the plain and the raw variants, and PAM of up to 4 channels.
+type Netpbm struct {
+	// The zero value means NetpbmPPM.
+	Variant NetpbmVariant
+
+	// Plain writes the ASCII variant. PAM has no plain variant.
+	Plain bool
+}
+
+// Images whose samples exceed this are rejected, so that a broken header does not exhaust the memory.
+const netpbmMaxSamples = 1 << 28
+
+// Lines of the plain variants should not be longer than this.
+const netpbmMaxLineLen = 70
+
+var (
+	errNetpbmInvalid     = errors.New("netpbm: invalid format")
+	errNetpbmUnsupported = errors.New("netpbm: unsupported format")
+)
+
+// Encode encodes the specified file to the variant of Netpbm.
+// The samples are written in 16 bits when the image has 16 bits per channel, and in 8 bits otherwise.
+// PAM is written in gray for gray images and in RGB for the others, with alpha unless the image is opaque.
+func (n *Netpbm) Encode(w io.Writer, img image.Image) error {
+	variant := n.variant()
+	if n.Plain && variant == NetpbmPAM {
+		return errors.New("netpbm: PAM has no plain variant")
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	maxval := 0xFF
+	switch img.(type) {
+	case *image.Gray16, *image.RGBA64, *image.NRGBA64:
+		maxval = 0xFFFF
+	}
+
+	var magic string
+	var depth int
+	switch variant {
+	case NetpbmPBM:
+		magic, depth, maxval = "P4", 1, 1
+	case NetpbmPGM:
+		magic, depth = "P5", 1
+	case NetpbmPPM:
+		magic, depth = "P6", 3
+	default:
+		magic, depth = "P7", 3
+		switch img.(type) {
+		case *image.Gray, *image.Gray16:
+			depth = 1
+		}
+		if !isOpaque(img) {
+			depth++
+		}
+	}
+	if n.Plain {
+		magic = map[string]string{"P4": "P1", "P5": "P2", "P6": "P3"}[magic]
+	}
+
+	bw := bufio.NewWriter(w)
+	switch {
+	case variant == NetpbmPAM:
+		tupleType := map[int]string{1: "GRAYSCALE", 2: "GRAYSCALE_ALPHA", 3: "RGB", 4: "RGB_ALPHA"}[depth]
+		fmt.Fprintf(bw, "P7\nWIDTH %d\nHEIGHT %d\nDEPTH %d\nMAXVAL %d\nTUPLTYPE %s\nENDHDR\n", width, height, depth, maxval, tupleType)
+	case variant == NetpbmPBM:
+		fmt.Fprintf(bw, "%s\n%d %d\n", magic, width, height)
+	default:
+		fmt.Fprintf(bw, "%s\n%d %d\n%d\n", magic, width, height, maxval)
+	}
+
+	pw := &netpbmPlainWriter{w: bw}
+	samples := make([]uint32, depth)
+	row := make([]byte, 0, width*depth*2)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row = row[:0]
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			netpbmSamples(samples, img.At(x, y), variant, maxval == 0xFFFF)
+
+			if variant == NetpbmPBM {
+				if n.Plain {
+					pw.write(int(samples[0]))
+					continue
+				}
+				if (x-bounds.Min.X)%8 == 0 {
+					row = append(row, 0)
+				}
+				row[len(row)-1] |= byte(samples[0]) << uint(7-(x-bounds.Min.X)%8)
+				continue
+			}
+
+			for _, s := range samples {
+				if maxval == 0xFF {
+					s >>= 8
+				}
+				switch {
+				case n.Plain:
+					pw.write(int(s))
+				case maxval == 0xFF:
+					row = append(row, byte(s))
+				default:
+					row = append(row, byte(s>>8), byte(s))
+				}
+			}
+		}
+
+		if n.Plain {
+			pw.endLine()
+		} else {
+			bw.Write(row)
+		}
+	}
+
+	return bw.Flush()
+}
+
+// Opaque returns whether the variant cannot hold transparency, which is true except for PAM.
+func (n *Netpbm) Opaque() bool {
+	return n.variant() != NetpbmPAM
+}
+
+func (n *Netpbm) variant() NetpbmVariant {
+	if n.Variant == 0 {
+		return NetpbmPPM
+	}
+	return n.Variant
+}
+
+// netpbmSamples puts the 16-bit samples of the color for the variant into samples.
+// The sample of PBM is 1 for black and 0 for white.
+func netpbmSamples(samples []uint32, c color.Color, variant NetpbmVariant, wide bool) {
+	switch {
+	case variant == NetpbmPBM:
+		samples[0] = 0
+		if color.Gray16Model.Convert(c).(color.Gray16).Y < 0x8000 {
+			samples[0] = 1
+		}
+	case len(samples) == 1:
+		samples[0] = uint32(color.Gray16Model.Convert(c).(color.Gray16).Y)
+	case variant == NetpbmPAM && len(samples)%2 == 0:
+		// Converted from 8 bits directly, so as not to lose the precision by premultiplying.
+		var nc color.NRGBA64
+		if wide {
+			nc = color.NRGBA64Model.Convert(c).(color.NRGBA64)
+		} else {
+			n := color.NRGBAModel.Convert(c).(color.NRGBA)
+			nc = color.NRGBA64{R: uint16(n.R) * 0x101, G: uint16(n.G) * 0x101, B: uint16(n.B) * 0x101, A: uint16(n.A) * 0x101}
+		}
+		if len(samples) == 2 {
+			samples[0] = uint32(color.Gray16Model.Convert(color.RGBA64{R: nc.R, G: nc.G, B: nc.B, A: 0xFFFF}).(color.Gray16).Y)
+			samples[1] = uint32(nc.A)
+		} else {
+			samples[0], samples[1], samples[2], samples[3] = uint32(nc.R), uint32(nc.G), uint32(nc.B), uint32(nc.A)
+		}
+	default:
+		samples[0], samples[1], samples[2], _ = c.RGBA()
+	}
+}
+
+// netpbmPlainWriter writes the samples of the plain variants separated by spaces, wrapping the lines.
+type netpbmPlainWriter struct {
+	w       *bufio.Writer
+	lineLen int
+}
+
+func (pw *netpbmPlainWriter) write(v int) {
+	s := strconv.Itoa(v)
+	if pw.lineLen > 0 {
+		if pw.lineLen+1+len(s) > netpbmMaxLineLen {
+			pw.endLine()
+		} else {
+			pw.w.WriteByte(' ')
+			pw.lineLen++
+		}
+	}
+	pw.w.WriteString(s)
+	pw.lineLen += len(s)
+}
+
+func (pw *netpbmPlainWriter) endLine() {
+	if pw.lineLen > 0 {
+		pw.w.WriteByte('\n')
+		pw.lineLen = 0
+	}
+}
+
+// netpbmHeader is the header common to the formats of the Netpbm family.
+type netpbmHeader struct {
+	magic         string
+	width, height int
+	depth         int
+	maxval        int
+}
+
+// Decode decodes the specified Netpbm file.
+// Images with a maxval greater than 255 are decoded to 16 bits per channel: gray ones to *image.Gray16, RGB ones to *image.RGBA64 and the ones with alpha to *image.NRGBA64.
+// The others are decoded to *image.Gray, *image.RGBA and *image.NRGBA likewise.
+func (n *Netpbm) Decode(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+
+	h, err := readNetpbmHeader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	img := h.newImage()
+
+	bytesPerSample := 1
+	if h.maxval > 0xFF {
+		bytesPerSample = 2
+	}
+	// Rows of the raw variants are read at once.
+	var row []byte
+	switch h.magic {
+	case "P4":
+		row = make([]byte, (h.width+7)/8)
+	case "P5", "P6", "P7":
+		row = make([]byte, h.width*h.depth*bytesPerSample)
+	}
+
+	samples := make([]uint32, h.depth)
+	for y := 0; y < h.height; y++ {
+		if row != nil {
+			if _, err := io.ReadFull(br, row); err != nil {
+				return nil, netpbmUnexpectedEOF(err)
+			}
+		}
+
+		for x := 0; x < h.width; x++ {
+			for i := range samples {
+				var v uint32
+				switch h.magic {
+				case "P1":
+					b, err := readNetpbmBit(br)
+					if err != nil {
+						return nil, err
+					}
+					v = uint32(b)
+				case "P2", "P3":
+					d, err := readNetpbmInt(br)
+					if err != nil {
+						return nil, err
+					}
+					v = uint32(d)
+				case "P4":
+					v = uint32(row[x/8]>>uint(7-x%8)) & 1
+				default:
+					j := x*h.depth + i
+					if bytesPerSample == 1 {
+						v = uint32(row[j])
+					} else {
+						v = uint32(row[2*j])<<8 | uint32(row[2*j+1])
+					}
+				}
+				if v > uint32(h.maxval) {
+					return nil, errNetpbmInvalid
+				}
+				samples[i] = v
+			}
+			h.setPixel(img, x, y, samples)
+		}
+	}
+
+	return img, nil
+}
+
+// readNetpbmHeader reads the header up to the raster.
+func readNetpbmHeader(br *bufio.Reader) (*netpbmHeader, error) {
+	magic := make([]byte, 2)
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return nil, errNetpbmInvalid
+	}
+
+	h := &netpbmHeader{magic: string(magic), depth: 1, maxval: 1}
+
+	var err error
+	switch h.magic {
+	case "P1", "P4":
+		h.width, h.height, err = readNetpbmInts2(br)
+	case "P2", "P5", "P3", "P6":
+		h.width, h.height, err = readNetpbmInts2(br)
+		if err == nil {
+			h.maxval, err = readNetpbmInt(br)
+		}
+		if h.magic == "P3" || h.magic == "P6" {
+			h.depth = 3
+		}
+	case "P7":
+		err = readPamHeader(br, h)
+	default:
+		return nil, errNetpbmInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if h.width <= 0 || h.height <= 0 || h.width > netpbmMaxSamples/h.height/h.depth {
+		return nil, errors.New("netpbm: invalid dimensions")
+	}
+	if h.maxval < 1 || h.maxval > 0xFFFF {
+		return nil, errNetpbmInvalid
+	}
+
+	return h, nil
+}
+
+func readNetpbmInts2(br *bufio.Reader) (int, int, error) {
+	a, err := readNetpbmInt(br)
+	if err != nil {
+		return 0, 0, err
+	}
+	b, err := readNetpbmInt(br)
+	if err != nil {
+		return 0, 0, err
+	}
+	return a, b, nil
+}
+
+// readPamHeader reads the lines of the PAM header up to ENDHDR.
+// The tuple type is not checked, and the channels are determined by the depth.
+func readPamHeader(br *bufio.Reader, h *netpbmHeader) error {
+	h.depth = 0
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return netpbmUnexpectedEOF(err)
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		var dst *int
+		switch fields[0] {
+		case "ENDHDR":
+			if h.depth < 1 || h.depth > 4 {
+				return errNetpbmUnsupported
+			}
+			return nil
+		case "TUPLTYPE":
+			continue
+		case "WIDTH":
+			dst = &h.width
+		case "HEIGHT":
+			dst = &h.height
+		case "DEPTH":
+			dst = &h.depth
+		case "MAXVAL":
+			dst = &h.maxval
+		default:
+			return errNetpbmInvalid
+		}
+		if len(fields) != 2 {
+			return errNetpbmInvalid
+		}
+		v, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return errNetpbmInvalid
+		}
+		*dst = v
+	}
+}
+
+// readNetpbmInt reads a decimal number skipping the whitespaces and the comments before it.
+// The whitespace just after the number is consumed, so that the raster follows the last number of the header.
+func readNetpbmInt(br *bufio.Reader) (int, error) {
+	b, err := skipNetpbmSpaces(br)
+	if err != nil {
+		return 0, err
+	}
+
+	v := 0
+	for {
+		if b < '0' || b > '9' {
+			return 0, errNetpbmInvalid
+		}
+		v = 10*v + int(b-'0')
+		if v > 0xFFFFFFF {
+			return 0, errNetpbmInvalid
+		}
+
+		b, err = br.ReadByte()
+		if err == io.EOF {
+			return v, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		if isNetpbmSpace(b) {
+			return v, nil
+		}
+		if b == '#' {
+			return v, br.UnreadByte()
+		}
+	}
+}
+
+// readNetpbmBit reads a sample of plain PBM, which need not be separated by whitespaces.
+func readNetpbmBit(br *bufio.Reader) (byte, error) {
+	b, err := skipNetpbmSpaces(br)
+	if err != nil {
+		return 0, err
+	}
+	if b != '0' && b != '1' {
+		return 0, errNetpbmInvalid
+	}
+	return b - '0', nil
+}
+
+// skipNetpbmSpaces skips the whitespaces and the comments and returns the next byte.
+func skipNetpbmSpaces(br *bufio.Reader) (byte, error) {
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return 0, netpbmUnexpectedEOF(err)
+		}
+		switch {
+		case isNetpbmSpace(b):
+		case b == '#':
+			if _, err := br.ReadString('\n'); err != nil {
+				return 0, netpbmUnexpectedEOF(err)
+			}
+		default:
+			return b, nil
+		}
+	}
+}
+
+func isNetpbmSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\v' || b == '\f' || b == '\r'
+}
+
+func netpbmUnexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (h *netpbmHeader) newImage() image.Image {
+	rect := image.Rect(0, 0, h.width, h.height)
+	wide := h.maxval > 0xFF
+	switch {
+	case h.depth == 1 && wide:
+		return image.NewGray16(rect)
+	case h.depth == 1:
+		return image.NewGray(rect)
+	case h.depth == 3 && wide:
+		return image.NewRGBA64(rect)
+	case h.depth == 3:
+		return image.NewRGBA(rect)
+	case wide:
+		return image.NewNRGBA64(rect)
+	default:
+		return image.NewNRGBA(rect)
+	}
+}
+
+// setPixel scales the samples to the bits of the image and sets them.
+// Samples of gray images are of 1 channel and those of RGB ones are of 3 channels, each followed by alpha if any.
+func (h *netpbmHeader) setPixel(img image.Image, x int, y int, samples []uint32) {
+	maxval := uint32(h.maxval)
+	scaled := func(v uint32, max uint32) uint32 {
+		if h.magic == "P1" || h.magic == "P4" {
+			// 1 is black
+			v = 1 - v
+		}
+		return (v*max + maxval/2) / maxval
+	}
+
+	switch m := img.(type) {
+	case *image.Gray:
+		m.SetGray(x, y, color.Gray{Y: uint8(scaled(samples[0], 0xFF))})
+	case *image.Gray16:
+		m.SetGray16(x, y, color.Gray16{Y: uint16(scaled(samples[0], 0xFFFF))})
+	case *image.RGBA:
+		m.SetRGBA(x, y, color.RGBA{R: uint8(scaled(samples[0], 0xFF)), G: uint8(scaled(samples[1], 0xFF)), B: uint8(scaled(samples[2], 0xFF)), A: 0xFF})
+	case *image.RGBA64:
+		m.SetRGBA64(x, y, color.RGBA64{R: uint16(scaled(samples[0], 0xFFFF)), G: uint16(scaled(samples[1], 0xFFFF)), B: uint16(scaled(samples[2], 0xFFFF)), A: 0xFFFF})
+	case *image.NRGBA:
+		c := color.NRGBA{A: uint8(scaled(samples[h.depth-1], 0xFF))}
+		c.R = uint8(scaled(samples[0], 0xFF))
+		c.G, c.B = c.R, c.R
+		if h.depth == 4 {
+			c.G, c.B = uint8(scaled(samples[1], 0xFF)), uint8(scaled(samples[2], 0xFF))
+		}
+		m.SetNRGBA(x, y, c)
+	case *image.NRGBA64:
+		c := color.NRGBA64{A: uint16(scaled(samples[h.depth-1], 0xFFFF))}
+		c.R = uint16(scaled(samples[0], 0xFFFF))
+		c.G, c.B = c.R, c.R
+		if h.depth == 4 {
+			c.G, c.B = uint16(scaled(samples[1], 0xFFFF)), uint16(scaled(samples[2], 0xFFFF))
+		}
+		m.SetNRGBA64(x, y, c)
+	}
+}
+
+// Extname returns the extension of the variant, e.g. "ppm"
+func (n *Netpbm) Extname() string {
+	switch n.variant() {
+	case NetpbmPBM:
+		return "pbm"
+	case NetpbmPGM:
+		return "pgm"
+	case NetpbmPAM:
+		return "pam"
+	default:
+		return "ppm"
+	}
+}
+
+// MagicBytesSlice returns the magic bytes slice of the Netpbm family
+func (n *Netpbm) MagicBytesSlice() [][]byte {
+	return [][]byte{[]byte("P1"), []byte("P2"), []byte("P3"), []byte("P4"), []byte("P5"), []byte("P6"), []byte("P7")}
+}
+
+// HasProcessableExtname returns whether the specified path has ".pbm", ".pgm", ".ppm", ".pnm" or ".pam"
+func (n *Netpbm) HasProcessableExtname(path string) bool {
+	switch filepath.Ext(path) {
+	case ".pbm", ".pgm", ".ppm", ".pnm", ".pam":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,277 @@
+package conversion
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConversion_Netpbm_MagicBytesSlice(t *testing.T) {
+	t.Parallel()
+
+	expected := [][]byte{[]byte("P1"), []byte("P2"), []byte("P3"), []byte("P4"), []byte("P5"), []byte("P6"), []byte("P7")}
+
+	n := Netpbm{}
+
+	actual := n.MagicBytesSlice()
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf(`expected="%s" actual="%s"`, expected, actual)
+	}
+}
+
+func TestConversion_Netpbm_HasProcessableExtname(t *testing.T) {
+	p := Netpbm{}
+
+	cases := map[string]struct {
+		path     string
+		expected bool
+	}{
+		"foo.pbm": {path: "foo.pbm", expected: true},
+		"foo.pgm": {path: "foo.pgm", expected: true},
+		"foo.ppm": {path: "foo.ppm", expected: true},
+		"foo.pnm": {path: "foo.pnm", expected: true},
+		"foo.pam": {path: "foo.pam", expected: true},
+		"foo.png": {path: "foo.png", expected: false},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			actual := p.HasProcessableExtname(c.path)
+			if actual != c.expected {
+				t.Errorf(`expected="%t" actual="%t"`, c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestConversion_Netpbm_Extname(t *testing.T) {
+	cases := map[string]struct {
+		netpbm   *Netpbm
+		expected string
+	}{
+		"zero value": {netpbm: &Netpbm{}, expected: "ppm"},
+		"PBM":        {netpbm: &Netpbm{Variant: NetpbmPBM}, expected: "pbm"},
+		"PGM":        {netpbm: &Netpbm{Variant: NetpbmPGM, Plain: true}, expected: "pgm"},
+		"PAM":        {netpbm: &Netpbm{Variant: NetpbmPAM}, expected: "pam"},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			actual := c.netpbm.Extname()
+			if actual != c.expected {
+				t.Errorf(`expected="%s" actual="%s"`, c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestConversion_Netpbm_EncodeDecode(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	bilevel := image.NewGray(image.Rect(0, 0, 11, 3))
+	for i := range bilevel.Pix {
+		bilevel.Pix[i] = byte(i%3/2) * 0xFF
+	}
+	gray := image.NewGray(image.Rect(0, 0, 33, 5))
+	rnd.Read(gray.Pix)
+	gray16 := image.NewGray16(image.Rect(0, 0, 7, 3))
+	rnd.Read(gray16.Pix)
+	rgba := image.NewRGBA(image.Rect(0, 0, 17, 9))
+	for i := range rgba.Pix {
+		rgba.Pix[i] = byte(i / 7)
+		if i%4 == 3 {
+			rgba.Pix[i] = 0xFF
+		}
+	}
+	rgba64 := image.NewRGBA64(image.Rect(0, 0, 5, 4))
+	for i := range rgba64.Pix {
+		rgba64.Pix[i] = byte(i * 13)
+		if i%8 >= 6 {
+			rgba64.Pix[i] = 0xFF
+		}
+	}
+	nrgba := image.NewNRGBA(image.Rect(0, 0, 30, 25))
+	rnd.Read(nrgba.Pix)
+	nrgba64 := image.NewNRGBA64(image.Rect(0, 0, 7, 3))
+	rnd.Read(nrgba64.Pix)
+
+	cases := map[string]struct {
+		netpbm *Netpbm
+		img    image.Image
+	}{
+		"raw PBM":     {netpbm: &Netpbm{Variant: NetpbmPBM}, img: bilevel},
+		"plain PBM":   {netpbm: &Netpbm{Variant: NetpbmPBM, Plain: true}, img: bilevel},
+		"raw PGM":     {netpbm: &Netpbm{Variant: NetpbmPGM}, img: gray},
+		"plain PGM":   {netpbm: &Netpbm{Variant: NetpbmPGM, Plain: true}, img: gray},
+		"16 bits PGM": {netpbm: &Netpbm{Variant: NetpbmPGM}, img: gray16},
+		"raw PPM":     {netpbm: &Netpbm{Variant: NetpbmPPM}, img: rgba},
+		"plain PPM":   {netpbm: &Netpbm{Variant: NetpbmPPM, Plain: true}, img: rgba},
+		"16 bits PPM": {netpbm: &Netpbm{Variant: NetpbmPPM, Plain: true}, img: rgba64},
+		"gray PAM":    {netpbm: &Netpbm{Variant: NetpbmPAM}, img: gray16},
+		"RGB PAM":     {netpbm: &Netpbm{Variant: NetpbmPAM}, img: rgba},
+		"RGBA PAM":    {netpbm: &Netpbm{Variant: NetpbmPAM}, img: nrgba},
+		"RGBA64 PAM":  {netpbm: &Netpbm{Variant: NetpbmPAM}, img: nrgba64},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			buf := &bytes.Buffer{}
+
+			err := c.netpbm.Encode(buf, c.img)
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+
+			actual, err := (&Netpbm{}).Decode(buf)
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+
+			if reflect.TypeOf(actual) != reflect.TypeOf(c.img) {
+				t.Errorf(`expected="%T" actual="%T"`, c.img, actual)
+			}
+			assertSameImage(t, c.img, actual)
+		})
+	}
+}
+
+func TestConversion_Netpbm_Encode(t *testing.T) {
+	gray := image.NewGray(image.Rect(0, 0, 10, 2))
+	for i := range gray.Pix {
+		gray.Pix[i] = byte(i * 20)
+	}
+	wide := image.NewGray(image.Rect(0, 0, 30, 1))
+	for i := range wide.Pix {
+		wide.Pix[i] = 100
+	}
+
+	cases := map[string]struct {
+		netpbm   *Netpbm
+		img      image.Image
+		expected string
+	}{
+		"raw PBM":   {netpbm: &Netpbm{Variant: NetpbmPBM}, img: gray, expected: "P4\n10 2\n\xFE\x00\x1F\xC0"},
+		"plain PBM": {netpbm: &Netpbm{Variant: NetpbmPBM, Plain: true}, img: gray, expected: "P1\n10 2\n1 1 1 1 1 1 1 0 0 0\n0 0 0 1 1 1 1 1 1 1\n"},
+		"plain PGM": {netpbm: &Netpbm{Variant: NetpbmPGM, Plain: true}, img: gray, expected: "P2\n10 2\n255\n0 20 40 60 80 100 120 140 160 180\n200 220 240 4 24 44 64 84 104 124\n"},
+		"long line": {netpbm: &Netpbm{Variant: NetpbmPGM, Plain: true}, img: wide, expected: "P2\n30 1\n255\n" + strings.Repeat("100 ", 16) + "100\n" + strings.Repeat("100 ", 12) + "100\n"},
+		"PAM":       {netpbm: &Netpbm{Variant: NetpbmPAM}, img: image.NewGray16(image.Rect(0, 0, 1, 1)), expected: "P7\nWIDTH 1\nHEIGHT 1\nDEPTH 1\nMAXVAL 65535\nTUPLTYPE GRAYSCALE\nENDHDR\n\x00\x00"},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			buf := &bytes.Buffer{}
+
+			err := c.netpbm.Encode(buf, c.img)
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+
+			actual := buf.String()
+			if actual != c.expected {
+				t.Errorf(`expected="%q" actual="%q"`, c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestConversion_Netpbm_Decode(t *testing.T) {
+	black := color.NRGBA64{A: 0xFFFF}
+	white := color.NRGBA64{R: 0xFFFF, G: 0xFFFF, B: 0xFFFF, A: 0xFFFF}
+	red := color.NRGBA64{R: 0xFFFF, A: 0xFFFF}
+
+	cases := map[string]struct {
+		data     string
+		expected [][]color.NRGBA64
+	}{
+		"plain PBM with comments": {
+			data:     "P1\n# created by hand\n3 2 # size\n010\n1 0 1\n",
+			expected: [][]color.NRGBA64{{white, black, white}, {black, white, black}},
+		},
+		"plain PGM of small maxval": {
+			data:     "P2 2 1 15 15 5",
+			expected: [][]color.NRGBA64{{white, {R: 0x5555, G: 0x5555, B: 0x5555, A: 0xFFFF}}},
+		},
+		"raw PGM of 16 bits": {
+			data:     "P5\n1 1\n65535\n\x12\x34",
+			expected: [][]color.NRGBA64{{{R: 0x1234, G: 0x1234, B: 0x1234, A: 0xFFFF}}},
+		},
+		"raw PPM": {
+			data:     "P6\n2 1\n255\n\xFF\x00\x00\x00\x00\x00",
+			expected: [][]color.NRGBA64{{red, black}},
+		},
+		"PAM of black and white": {
+			data:     "P7\nWIDTH 2\nHEIGHT 1\nDEPTH 1\nMAXVAL 1\nTUPLTYPE BLACKANDWHITE\nENDHDR\n\x01\x00",
+			expected: [][]color.NRGBA64{{white, black}},
+		},
+		"PAM of gray and alpha": {
+			data:     "P7\n# comment\nWIDTH 1\nHEIGHT 1\nDEPTH 2\nMAXVAL 255\nTUPLTYPE GRAYSCALE_ALPHA\nENDHDR\n\xFF\x80",
+			expected: [][]color.NRGBA64{{{R: 0xFFFF, G: 0xFFFF, B: 0xFFFF, A: 0x8080}}},
+		},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			img, err := (&Netpbm{}).Decode(strings.NewReader(c.data))
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+
+			for y, row := range c.expected {
+				for x, expected := range row {
+					actual := color.NRGBA64Model.Convert(img.At(x, y))
+					if actual != expected {
+						t.Errorf(`(%d, %d): expected="%v" actual="%v"`, x, y, expected, actual)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestConversion_Netpbm_Decode_Failure(t *testing.T) {
+	cases := map[string]struct {
+		data     string
+		expected string
+	}{
+		"not Netpbm":        {data: "GIF89a", expected: "netpbm: invalid format"},
+		"truncated raster":  {data: "P5\n2 2\n255\n\x00\x00\x00", expected: "unexpected EOF"},
+		"truncated header":  {data: "P6\n2 2\n", expected: "unexpected EOF"},
+		"sample over max":   {data: "P2\n1 1\n15\n16\n", expected: "netpbm: invalid format"},
+		"maxval over 65535": {data: "P2\n1 1\n65536\n0\n", expected: "netpbm: invalid format"},
+		"zero width":        {data: "P5\n0 1\n255\n", expected: "netpbm: invalid dimensions"},
+		"PAM of depth 5":    {data: "P7\nWIDTH 1\nHEIGHT 1\nDEPTH 5\nMAXVAL 255\nENDHDR\n\x00\x00\x00\x00\x00", expected: "netpbm: unsupported format"},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := (&Netpbm{}).Decode(strings.NewReader(c.data))
+
+			actual := err.Error()
+			if actual != c.expected {
+				t.Errorf(`expected="%s" actual="%s"`, c.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package conversion
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// LoadPalette reads the palette at path for Gif.Palette.
+// GIMP palettes (.gpl) and JASC palettes (.pal) are read as they are, and rejected if they have more colors than numColors.
+// Any other file is decoded as an image of the registered format of its extension, and its palette is taken as it is if it is paletted within numColors,
+// or otherwise computed by SharedPalette with the quantizer.
+func LoadPalette(path string, numColors int, q draw.Quantizer) (color.Palette, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	var p color.Palette
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gpl":
+		p, err = ReadGpl(fp)
+	case ".pal":
+		p, err = ReadJascPal(fp)
+	default:
+		var img image.Image
+		img, err = decodeAny(fp, path)
+		if err != nil {
+			break
+		}
+		if pm, ok := img.(*image.Paletted); ok && len(pm.Palette) <= numColors {
+			p = pm.Palette
+		} else {
+			p = SharedPalette([]image.Image{img}, numColors, q)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(p) == 0 {
+		return nil, errors.New("palette has no colors: " + path)
+	} else if len(p) > 256 {
+		return nil, fmt.Errorf("palette has %d colors, more than 256: %s", len(p), path)
+	} else if len(p) > numColors {
+		return nil, fmt.Errorf("palette has %d colors, more than --num-colors %d: %s", len(p), numColors, path)
+	}
+
+	return p, nil
+}
+
+// decodeAny decodes the image at path by the first registered format which can process its extension and decode it. See Detect.
+func decodeAny(rs io.ReadSeeker, path string) (image.Image, error) {
+	var decoders []Decoder
+	for _, f := range Formats() {
+		if f.NewDecoder != nil {
+			decoders = append(decoders, f.NewDecoder())
+		}
+	}
+
+	decoder, err := Detect(rs, path, decoders)
+	if err != nil {
+		return nil, err
+	}
+	if decoder == nil {
+		return nil, errors.New("image: unknown format")
+	}
+
+	_, err = rs.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	return decoder.Decode(rs)
+}
+
+// ReadGpl reads a GIMP palette. https://developer.gimp.org/core/standards/gpl/
+// The name of each color is ignored.
+func ReadGpl(r io.Reader) (color.Palette, error) {
+	sc := bufio.NewScanner(r)
+
+	if !sc.Scan() || strings.TrimSpace(sc.Text()) != "GIMP Palette" {
+		return nil, errors.New("gpl: invalid format")
+	}
+
+	var p color.Palette
+	for n := 2; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "Name:") || strings.HasPrefix(line, "Columns:") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("gpl: invalid color at line %d", n)
+		}
+		c, err := parseRGB(fields[:3])
+		if err != nil {
+			return nil, fmt.Errorf("gpl: invalid color at line %d", n)
+		}
+		p = append(p, c)
+	}
+
+	return p, sc.Err()
+}
+
+// ReadJascPal reads a JASC palette of Paint Shop Pro, which consists of "JASC-PAL", the version "0100", the number of colors and the colors.
+func ReadJascPal(r io.Reader) (color.Palette, error) {
+	sc := bufio.NewScanner(r)
+
+	var lines []string
+	for sc.Scan() {
+		if line := strings.TrimSpace(sc.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(lines) < 3 || lines[0] != "JASC-PAL" || lines[1] != "0100" {
+		return nil, errors.New("pal: invalid format")
+	}
+	n, err := strconv.Atoi(lines[2])
+	if err != nil || n != len(lines)-3 {
+		return nil, errors.New("pal: invalid number of colors")
+	}
+
+	p := make(color.Palette, n)
+	for i, line := range lines[3:] {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("pal: invalid color %d", i+1)
+		}
+		p[i], err = parseRGB(fields)
+		if err != nil {
+			return nil, fmt.Errorf("pal: invalid color %d", i+1)
+		}
+	}
+
+	return p, nil
+}
+
+// parseRGB parses the decimal red, green and blue from 0 to 255.
+func parseRGB(fields []string) (color.Color, error) {
+	var rgb [3]uint8
+	for i, field := range fields {
+		v, err := strconv.ParseUint(field, 10, 8)
+		if err != nil {
+			return nil, err
+		}
+		rgb[i] = uint8(v)
+	}
+	return color.RGBA{R: rgb[0], G: rgb[1], B: rgb[2], A: 0xFF}, nil
+}
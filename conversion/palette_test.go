@@ -0,0 +1,173 @@
+package conversion
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConversion_ReadGpl(t *testing.T) {
+	t.Parallel()
+
+	gpl := "GIMP Palette\nName: Brand\nColumns: 2\n#\n255   0   0\tRed\n  0   0 255\tBlue\n\n# comment\n 16  32  48\n"
+
+	expected := color.Palette{color.RGBA{R: 0xFF, A: 0xFF}, color.RGBA{B: 0xFF, A: 0xFF}, color.RGBA{R: 16, G: 32, B: 48, A: 0xFF}}
+
+	actual, err := ReadGpl(strings.NewReader(gpl))
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf(`expected="%v" actual="%v"`, expected, actual)
+	}
+}
+
+func TestConversion_ReadGpl_Failure(t *testing.T) {
+	cases := map[string]struct {
+		gpl      string
+		expected string
+	}{
+		"no header":    {gpl: "255 0 0\n", expected: "gpl: invalid format"},
+		"out of range": {gpl: "GIMP Palette\n255 0 256\n", expected: "gpl: invalid color at line 2"},
+		"too short":    {gpl: "GIMP Palette\nName: Brand\n255 0\n", expected: "gpl: invalid color at line 3"},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := ReadGpl(strings.NewReader(c.gpl))
+			if err == nil || err.Error() != c.expected {
+				t.Errorf(`expected="%s" actual="%v"`, c.expected, err)
+			}
+		})
+	}
+}
+
+func TestConversion_ReadJascPal(t *testing.T) {
+	t.Parallel()
+
+	pal := "JASC-PAL\r\n0100\r\n2\r\n255 0 0\r\n0 0 255\r\n"
+
+	expected := color.Palette{color.RGBA{R: 0xFF, A: 0xFF}, color.RGBA{B: 0xFF, A: 0xFF}}
+
+	actual, err := ReadJascPal(strings.NewReader(pal))
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf(`expected="%v" actual="%v"`, expected, actual)
+	}
+}
+
+func TestConversion_ReadJascPal_Failure(t *testing.T) {
+	cases := map[string]struct {
+		pal      string
+		expected string
+	}{
+		"no header":     {pal: "GIMP Palette\n", expected: "pal: invalid format"},
+		"wrong version": {pal: "JASC-PAL\n0200\n1\n0 0 0\n", expected: "pal: invalid format"},
+		"wrong number":  {pal: "JASC-PAL\n0100\n2\n0 0 0\n", expected: "pal: invalid number of colors"},
+		"invalid color": {pal: "JASC-PAL\n0100\n2\n0 0 0\n0 0 x\n", expected: "pal: invalid color 2"},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := ReadJascPal(strings.NewReader(c.pal))
+			if err == nil || err.Error() != c.expected {
+				t.Errorf(`expected="%s" actual="%v"`, c.expected, err)
+			}
+		})
+	}
+}
+
+func TestConversion_LoadPalette(t *testing.T) {
+	t.Parallel()
+
+	tempdir, err := ioutil.TempDir("", "imgconv")
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	red := color.RGBA{R: 0xFF, A: 0xFF}
+	blue := color.RGBA{B: 0xFF, A: 0xFF}
+
+	err = ioutil.WriteFile(filepath.Join(tempdir, "brand.gpl"), []byte("GIMP Palette\n255 0 0\n0 0 255\n"), 0644)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	err = ioutil.WriteFile(filepath.Join(tempdir, "brand.pal"), []byte("JASC-PAL\n0100\n2\n255 0 0\n0 0 255\n"), 0644)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	var lines []string
+	for i := 0; i < 257; i++ {
+		lines = append(lines, "0 0 0")
+	}
+	err = ioutil.WriteFile(filepath.Join(tempdir, "large.gpl"), []byte("GIMP Palette\n"+strings.Join(lines, "\n")), 0644)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	// The colors of the reference images, decoded by the formats of their extensions.
+	// An uncompressed true-color TGA starts with the magic bytes of CUR.
+	img := image.NewRGBA(image.Rect(0, 0, 3, 1))
+	img.SetRGBA(0, 0, red)
+	img.SetRGBA(1, 0, blue)
+	img.SetRGBA(2, 0, blue)
+	for name, encoder := range map[string]Encoder{"reference.png": &Png{Encoder: &png.Encoder{}}, "reference.tga": &Tga{}, "reference.dat": &Png{Encoder: &png.Encoder{}}} {
+		fp, err := os.Create(filepath.Join(tempdir, name))
+		if err != nil {
+			t.Fatalf("err %s", err)
+		}
+		err = encoder.Encode(fp, img)
+		fp.Close()
+		if err != nil {
+			t.Fatalf("err %s", err)
+		}
+	}
+
+	cases := map[string]struct {
+		name      string
+		numColors int
+		expected  color.Palette
+		err       string
+	}{
+		"GIMP":              {name: "brand.gpl", numColors: 256, expected: color.Palette{red, blue}},
+		"JASC":              {name: "brand.pal", numColors: 256, expected: color.Palette{red, blue}},
+		"PNG":               {name: "reference.png", numColors: 256, expected: color.Palette{blue, red}},
+		"TGA":               {name: "reference.tga", numColors: 256, expected: color.Palette{blue, red}},
+		"unknown extension": {name: "reference.dat", numColors: 256, err: "image: unknown format"},
+		"too large":         {name: "large.gpl", numColors: 256, err: "palette has 257 colors, more than 256: " + filepath.Join(tempdir, "large.gpl")},
+		"over --num-colors": {name: "brand.gpl", numColors: 1, err: "palette has 2 colors, more than --num-colors 1: " + filepath.Join(tempdir, "brand.gpl")},
+	}
+
+	for n, c := range cases {
+		path := filepath.Join(tempdir, c.name)
+
+		actual, err := LoadPalette(path, c.numColors, nil)
+		if c.err != "" {
+			if err == nil || err.Error() != c.err {
+				t.Errorf(`%s: expected="%s" actual="%v"`, n, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("err %s", err)
+		}
+		if !reflect.DeepEqual(actual, c.expected) {
+			t.Errorf(`%s: expected="%v" actual="%v"`, n, c.expected, actual)
+		}
+	}
+}
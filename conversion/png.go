@@ -1,13 +1,43 @@
 package conversion
 
 import (
+	"errors"
+	"flag"
 	"image"
 	"image/png"
 	"io"
 	"path/filepath"
 )
 
+func init() {
+	Register(&Format{
+		Name:       "png",
+		Shorthand:  "p",
+		Extnames:   []string{".png"},
+		NewDecoder: func() Decoder { return &Png{} },
+		DefineEncoderFlags: func(flg *flag.FlagSet) EncoderFactory {
+			humanCompressionLevel := flg.String("compression-level", "default", "Options to specify the compression level of PNG to be used with '-p' option. You can specify from 'default', 'no', 'best-speed', 'best-compression'.")
+
+			return func() (Encoder, error) {
+				compressionLevel, ok := compressionLevels[*humanCompressionLevel]
+				if !ok {
+					return nil, errors.New("--compression-level is not included in the list: \"default\", \"no\", \"best-speed\", \"best-compression\"")
+				}
+				return &Png{Encoder: &png.Encoder{CompressionLevel: compressionLevel}}, nil
+			}
+		},
+	})
+}
+
+var compressionLevels = map[string]png.CompressionLevel{
+	"default":          png.DefaultCompression,
+	"no":               png.NoCompression,
+	"best-speed":       png.BestSpeed,
+	"best-compression": png.BestCompression,
+}
+
 // Png https://en.wikipedia.org/wiki/Portable_Network_Graphics
+// Animated PNG (APNG) is converted with its frames by DecodeAnimation and EncodeAnimation. See png_apng.go.
 type Png struct {
 	Encoder *png.Encoder
 }
@@ -0,0 +1,624 @@
+package conversion
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"io"
+	"io/ioutil"
+)
+
+// APNG https://wiki.mozilla.org/APNG_Specification
+// Its frames are stored in the fcTL and fdAT chunks which PNG decoders ignore, following the default image in IDAT.
+
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+// dispose_op of fcTL
+const (
+	apngDisposeNone       = 0
+	apngDisposeBackground = 1
+	apngDisposePrevious   = 2
+)
+
+// blend_op of fcTL
+const (
+	apngBlendSource = 0
+	apngBlendOver   = 1
+)
+
+// Color types of IHDR
+const (
+	pngTrueColor      = 2
+	pngPaletted       = 3
+	pngTrueColorAlpha = 6
+)
+
+const apngFcTLLen = 26
+
+var errApngInvalid = errors.New("png: invalid animation")
+
+type pngChunk struct {
+	typ  string
+	data []byte
+}
+
+// readPngChunks splits the PNG file into its chunks up to IEND, verifying their checksums.
+func readPngChunks(data []byte) ([]pngChunk, error) {
+	if !bytes.HasPrefix(data, []byte(pngSignature)) {
+		return nil, errors.New("png: invalid format")
+	}
+	data = data[len(pngSignature):]
+
+	var chunks []pngChunk
+	for len(data) > 0 {
+		if len(data) < 12 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		n := binary.BigEndian.Uint32(data)
+		if uint64(n) > uint64(len(data)-12) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		typ, body := data[4:8], data[8:8+n]
+		if crc32.ChecksumIEEE(data[4:8+n]) != binary.BigEndian.Uint32(data[8+n:]) {
+			return nil, errors.New("png: invalid checksum")
+		}
+		chunks = append(chunks, pngChunk{typ: string(typ), data: body})
+		data = data[12+n:]
+
+		if string(typ) == "IEND" {
+			break
+		}
+	}
+
+	return chunks, nil
+}
+
+func writePngChunk(w io.Writer, typ string, data []byte) error {
+	buf := make([]byte, 8+len(data)+4)
+	binary.BigEndian.PutUint32(buf, uint32(len(data)))
+	copy(buf[4:], typ)
+	copy(buf[8:], data)
+	binary.BigEndian.PutUint32(buf[8+len(data):], crc32.ChecksumIEEE(buf[4:8+len(data)]))
+	_, err := w.Write(buf)
+	return err
+}
+
+// apngFrame is a frame of APNG with its fcTL and its image data from IDAT or fdAT.
+type apngFrame struct {
+	fctl []byte
+	data [][]byte
+}
+
+// DecodeAnimation decodes all the frames of the specified APNG file with their delays, disposals, blends and the number of plays.
+// A PNG file which is not animated is decoded to an animation of one frame.
+// The delays are rounded to 100ths of a second.
+func (p *Png) DecodeAnimation(r io.Reader) (*Animation, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	chunks, err := readPngChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var ihdr []byte
+	var actl []byte
+	// PLTE and tRNS are shared by all the frames.
+	var shared []pngChunk
+	var frames []*apngFrame
+	for _, c := range chunks {
+		switch c.typ {
+		case "IHDR":
+			ihdr = c.data
+		case "PLTE", "tRNS":
+			shared = append(shared, c)
+		case "acTL":
+			actl = c.data
+		case "fcTL":
+			if len(c.data) != apngFcTLLen {
+				return nil, errApngInvalid
+			}
+			frames = append(frames, &apngFrame{fctl: c.data})
+		case "IDAT":
+			// The default image is the first frame only when fcTL precedes it.
+			if len(frames) == 1 {
+				frames[0].data = append(frames[0].data, c.data)
+			}
+		case "fdAT":
+			if len(frames) == 0 || len(c.data) < 4 {
+				return nil, errApngInvalid
+			}
+			f := frames[len(frames)-1]
+			f.data = append(f.data, c.data[4:])
+		}
+	}
+
+	if actl == nil || len(frames) == 0 {
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		bounds := img.Bounds()
+		return &Animation{Frames: []image.Image{img}, Delays: []int{0}, Disposals: []byte{0}, Width: bounds.Dx(), Height: bounds.Dy()}, nil
+	}
+	if len(ihdr) < 8 || len(actl) != 8 {
+		return nil, errApngInvalid
+	}
+
+	a := &Animation{
+		Width:  int(binary.BigEndian.Uint32(ihdr[0:])),
+		Height: int(binary.BigEndian.Uint32(ihdr[4:])),
+	}
+	// 0 plays infinitely.
+	if plays := int(binary.BigEndian.Uint32(actl[4:])); plays > 0 {
+		a.LoopCount = plays - 1
+		if plays == 1 {
+			a.LoopCount = -1
+		}
+	}
+
+	canvas := image.Rect(0, 0, a.Width, a.Height)
+	for i, f := range frames {
+		width := binary.BigEndian.Uint32(f.fctl[4:])
+		height := binary.BigEndian.Uint32(f.fctl[8:])
+		x := binary.BigEndian.Uint32(f.fctl[12:])
+		y := binary.BigEndian.Uint32(f.fctl[16:])
+		delayNum := int(binary.BigEndian.Uint16(f.fctl[20:]))
+		delayDen := int(binary.BigEndian.Uint16(f.fctl[22:]))
+		disposeOp, blendOp := f.fctl[24], f.fctl[25]
+
+		bounds := image.Rect(int(x), int(y), int(x)+int(width), int(y)+int(height))
+		if width == 0 || height == 0 || uint64(x)+uint64(width) > uint64(a.Width) || uint64(y)+uint64(height) > uint64(a.Height) || !bounds.In(canvas) {
+			return nil, errApngInvalid
+		}
+		if len(f.data) == 0 {
+			return nil, errApngInvalid
+		}
+
+		img, err := decodeApngFrame(ihdr, shared, f, width, height)
+		if err != nil {
+			return nil, err
+		}
+		a.Frames = append(a.Frames, translateImage(img, bounds.Min))
+
+		// 0 means 100.
+		if delayDen == 0 {
+			delayDen = 100
+		}
+		a.Delays = append(a.Delays, (delayNum*100+delayDen/2)/delayDen)
+
+		disposal := byte(gif.DisposalNone)
+		switch disposeOp {
+		case apngDisposeBackground:
+			disposal = gif.DisposalBackground
+		case apngDisposePrevious:
+			// As the first frame, the canvas is cleared to the background.
+			disposal = gif.DisposalPrevious
+			if i == 0 {
+				disposal = gif.DisposalBackground
+			}
+		}
+		a.Disposals = append(a.Disposals, disposal)
+
+		blend := byte(BlendOver)
+		if blendOp == apngBlendSource {
+			blend = BlendSource
+		}
+		a.Blends = append(a.Blends, blend)
+	}
+
+	return a, nil
+}
+
+// decodeApngFrame decodes the frame as a PNG file of the size with the header and the palette of the APNG file.
+func decodeApngFrame(ihdr []byte, shared []pngChunk, f *apngFrame, width uint32, height uint32) (image.Image, error) {
+	header := append([]byte{}, ihdr...)
+	binary.BigEndian.PutUint32(header[0:], width)
+	binary.BigEndian.PutUint32(header[4:], height)
+
+	buf := &bytes.Buffer{}
+	buf.WriteString(pngSignature)
+	writePngChunk(buf, "IHDR", header)
+	for _, c := range shared {
+		writePngChunk(buf, c.typ, c.data)
+	}
+	writePngChunk(buf, "IDAT", bytes.Join(f.data, nil))
+	writePngChunk(buf, "IEND", nil)
+
+	return png.Decode(buf)
+}
+
+// translateImage returns the image moved by p, sharing the pixels if possible.
+func translateImage(img image.Image, p image.Point) image.Image {
+	if p == (image.Point{}) {
+		return img
+	}
+
+	switch m := img.(type) {
+	case *image.NRGBA:
+		c := *m
+		c.Rect = c.Rect.Add(p)
+		return &c
+	case *image.RGBA:
+		c := *m
+		c.Rect = c.Rect.Add(p)
+		return &c
+	case *image.NRGBA64:
+		c := *m
+		c.Rect = c.Rect.Add(p)
+		return &c
+	case *image.RGBA64:
+		c := *m
+		c.Rect = c.Rect.Add(p)
+		return &c
+	case *image.Gray:
+		c := *m
+		c.Rect = c.Rect.Add(p)
+		return &c
+	case *image.Gray16:
+		c := *m
+		c.Rect = c.Rect.Add(p)
+		return &c
+	case *image.Paletted:
+		c := *m
+		c.Rect = c.Rect.Add(p)
+		return &c
+	}
+
+	bounds := img.Bounds()
+	dst := image.NewNRGBA64(bounds.Add(p))
+	draw.Draw(dst, dst.Rect, img, bounds.Min, draw.Src)
+	return dst
+}
+
+// EncodeAnimation encodes the animation to APNG losslessly, keeping the delays, the disposals, the blends and the loop count.
+// All the frames share one color type, which is paletted when they have the same palette,
+// 16 bits when any of them has 16 bits, and otherwise 8 bits with alpha unless all of them are opaque.
+func (p *Png) EncodeAnimation(w io.Writer, a *Animation) error {
+	frames := make([]image.Image, len(a.Frames))
+	copy(frames, a.Frames)
+
+	// The first frame is the default image, which must cover the canvas.
+	canvas := image.Rect(0, 0, a.Width, a.Height)
+	if first := frames[0]; first.Bounds() != canvas {
+		var dst draw.Image = image.NewNRGBA(canvas)
+		if is16Bits(first) {
+			dst = image.NewNRGBA64(canvas)
+		}
+		draw.Draw(dst, first.Bounds(), first, first.Bounds().Min, draw.Src)
+		frames[0] = dst
+	}
+
+	colorType, depth, pal := apngColorType(frames)
+
+	level := zlib.DefaultCompression
+	if p.Encoder != nil {
+		switch p.Encoder.CompressionLevel {
+		case png.NoCompression:
+			level = zlib.NoCompression
+		case png.BestSpeed:
+			level = zlib.BestSpeed
+		case png.BestCompression:
+			level = zlib.BestCompression
+		}
+	}
+
+	_, err := io.WriteString(w, pngSignature)
+	if err != nil {
+		return err
+	}
+
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], uint32(a.Width))
+	binary.BigEndian.PutUint32(ihdr[4:], uint32(a.Height))
+	ihdr[8], ihdr[9] = depth, colorType
+	err = writePngChunk(w, "IHDR", ihdr)
+	if err != nil {
+		return err
+	}
+
+	actl := make([]byte, 8)
+	binary.BigEndian.PutUint32(actl[0:], uint32(len(frames)))
+	// 0 plays infinitely.
+	switch {
+	case a.LoopCount < 0:
+		binary.BigEndian.PutUint32(actl[4:], 1)
+	case a.LoopCount > 0:
+		binary.BigEndian.PutUint32(actl[4:], uint32(a.LoopCount+1))
+	}
+	err = writePngChunk(w, "acTL", actl)
+	if err != nil {
+		return err
+	}
+
+	if colorType == pngPaletted {
+		plte := make([]byte, 3*len(pal))
+		trns := make([]byte, len(pal))
+		last := -1
+		for i, c := range pal {
+			n := color.NRGBAModel.Convert(c).(color.NRGBA)
+			plte[3*i], plte[3*i+1], plte[3*i+2], trns[i] = n.R, n.G, n.B, n.A
+			if n.A != 0xFF {
+				last = i
+			}
+		}
+		err = writePngChunk(w, "PLTE", plte)
+		if err != nil {
+			return err
+		}
+		if last >= 0 {
+			err = writePngChunk(w, "tRNS", trns[:last+1])
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	seq := uint32(0)
+	for i, frame := range frames {
+		bounds := frame.Bounds()
+		if !bounds.In(canvas) || bounds.Empty() {
+			return errors.New("png: frame is out of the canvas")
+		}
+
+		fctl := make([]byte, apngFcTLLen)
+		binary.BigEndian.PutUint32(fctl[0:], seq)
+		binary.BigEndian.PutUint32(fctl[4:], uint32(bounds.Dx()))
+		binary.BigEndian.PutUint32(fctl[8:], uint32(bounds.Dy()))
+		binary.BigEndian.PutUint32(fctl[12:], uint32(bounds.Min.X))
+		binary.BigEndian.PutUint32(fctl[16:], uint32(bounds.Min.Y))
+		if i < len(a.Delays) && a.Delays[i] > 0 {
+			delay := a.Delays[i]
+			if delay > 0xFFFF {
+				delay = 0xFFFF
+			}
+			binary.BigEndian.PutUint16(fctl[20:], uint16(delay))
+		}
+		binary.BigEndian.PutUint16(fctl[22:], 100)
+		fctl[24] = apngDisposeNone
+		if i < len(a.Disposals) {
+			switch a.Disposals[i] {
+			case gif.DisposalBackground:
+				fctl[24] = apngDisposeBackground
+			case gif.DisposalPrevious:
+				fctl[24] = apngDisposePrevious
+			}
+		}
+		fctl[25] = apngBlendOver
+		if a.blend(i) == BlendSource {
+			fctl[25] = apngBlendSource
+		}
+		err = writePngChunk(w, "fcTL", fctl)
+		if err != nil {
+			return err
+		}
+		seq++
+
+		data, err := apngFrameData(frame, colorType, depth, level)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			err = writePngChunk(w, "IDAT", data)
+		} else {
+			fdat := make([]byte, 4+len(data))
+			binary.BigEndian.PutUint32(fdat, seq)
+			copy(fdat[4:], data)
+			err = writePngChunk(w, "fdAT", fdat)
+			seq++
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return writePngChunk(w, "IEND", nil)
+}
+
+// apngColorType returns the color type and the bit depth shared by the frames, and the palette if paletted.
+func apngColorType(frames []image.Image) (byte, byte, color.Palette) {
+	var pal color.Palette
+	for _, frame := range frames {
+		p, ok := frame.(*image.Paletted)
+		if !ok || (pal != nil && !samePalette(pal, p.Palette)) {
+			pal = nil
+			break
+		}
+		pal = p.Palette
+	}
+	if pal != nil && len(pal) > 0 && len(pal) <= 256 {
+		return pngPaletted, 8, pal
+	}
+
+	opaque := true
+	for _, frame := range frames {
+		if is16Bits(frame) {
+			return pngTrueColorAlpha, 16, nil
+		}
+		if !isOpaque(frame) {
+			opaque = false
+		}
+	}
+	if opaque {
+		return pngTrueColor, 8, nil
+	}
+	return pngTrueColorAlpha, 8, nil
+}
+
+func samePalette(a color.Palette, b color.Palette) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		r0, g0, b0, a0 := a[i].RGBA()
+		r1, g1, b1, a1 := b[i].RGBA()
+		if r0 != r1 || g0 != g1 || b0 != b1 || a0 != a1 {
+			return false
+		}
+	}
+	return true
+}
+
+func is16Bits(img image.Image) bool {
+	switch img.ColorModel() {
+	case color.RGBA64Model, color.NRGBA64Model, color.Gray16Model:
+		return true
+	}
+	return false
+}
+
+// apngFrameData returns the compressed image data of the frame in the color type, whose rows are filtered in the way image/png does.
+func apngFrameData(img image.Image, colorType byte, depth byte, level int) ([]byte, error) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	bpp := 1
+	var nrgba *image.NRGBA
+	var nrgba64 *image.NRGBA64
+	switch {
+	case colorType == pngPaletted:
+	case depth == 16:
+		bpp = 8
+		nrgba64 = toNRGBA64(img)
+	default:
+		bpp = 3
+		if colorType == pngTrueColorAlpha {
+			bpp = 4
+		}
+		nrgba = image.NewNRGBA(image.Rect(0, 0, width, height))
+		draw.Draw(nrgba, nrgba.Rect, img, bounds.Min, draw.Src)
+	}
+
+	buf := &bytes.Buffer{}
+	zw, err := zlib.NewWriterLevel(buf, level)
+	if err != nil {
+		return nil, err
+	}
+
+	stride := bpp * width
+	prev := make([]byte, stride)
+	row := make([]byte, stride)
+	filtered := make([]byte, 1+stride)
+	for y := 0; y < height; y++ {
+		switch {
+		case colorType == pngPaletted:
+			p := img.(*image.Paletted)
+			copy(row, p.Pix[p.PixOffset(bounds.Min.X, bounds.Min.Y+y):])
+		case depth == 16:
+			copy(row, nrgba64.Pix[y*nrgba64.Stride:])
+		case colorType == pngTrueColorAlpha:
+			copy(row, nrgba.Pix[y*nrgba.Stride:])
+		default:
+			src := nrgba.Pix[y*nrgba.Stride:]
+			for x := 0; x < width; x++ {
+				copy(row[3*x:3*x+3], src[4*x:4*x+3])
+			}
+		}
+
+		// image/png does not filter paletted images.
+		if colorType == pngPaletted {
+			filtered[0] = 0
+			copy(filtered[1:], row)
+		} else {
+			pngFilter(filtered, row, prev, bpp)
+		}
+
+		_, err := zw.Write(filtered)
+		if err != nil {
+			return nil, err
+		}
+		prev, row = row, prev
+	}
+
+	err = zw.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// toNRGBA64 returns the image moved to (0, 0) in 16 bits.
+// Non-premultiplied colors are widened as they are, which drawing would premultiply and lose.
+func toNRGBA64(img image.Image) *image.NRGBA64 {
+	bounds := img.Bounds()
+	dst := image.NewNRGBA64(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+
+	src, ok := img.(*image.NRGBA)
+	if !ok {
+		draw.Draw(dst, dst.Rect, img, bounds.Min, draw.Src)
+		return dst
+	}
+	for y := 0; y < bounds.Dy(); y++ {
+		s := src.Pix[src.PixOffset(bounds.Min.X, bounds.Min.Y+y):]
+		d := dst.Pix[y*dst.Stride:]
+		for i := 0; i < 4*bounds.Dx(); i++ {
+			d[2*i], d[2*i+1] = s[i], s[i]
+		}
+	}
+	return dst
+}
+
+// pngFilter writes the filter type and the row filtered by the one whose sum of the absolute values is the smallest,
+// the heuristic recommended by the PNG specification.
+func pngFilter(dst []byte, row []byte, prev []byte, bpp int) {
+	bestSum := -1
+	candidate := make([]byte, len(row))
+	for ft := 0; ft < 5; ft++ {
+		for i := range row {
+			var a, b, c byte
+			if i >= bpp {
+				a, c = row[i-bpp], prev[i-bpp]
+			}
+			b = prev[i]
+
+			switch ft {
+			case 0:
+				candidate[i] = row[i]
+			case 1:
+				candidate[i] = row[i] - a
+			case 2:
+				candidate[i] = row[i] - b
+			case 3:
+				candidate[i] = row[i] - byte((int(a)+int(b))/2)
+			case 4:
+				candidate[i] = row[i] - paeth(a, b, c)
+			}
+		}
+
+		sum := 0
+		for _, v := range candidate {
+			if v < 0x80 {
+				sum += int(v)
+			} else {
+				sum += 0x100 - int(v)
+			}
+		}
+		if bestSum < 0 || sum < bestSum {
+			bestSum = sum
+			dst[0] = byte(ft)
+			copy(dst[1:], candidate)
+		}
+	}
+}
+
+func paeth(a byte, b byte, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := absInt(p-int(a)), absInt(p-int(b)), absInt(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
@@ -1,6 +1,14 @@
 package conversion
 
 import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"math/rand"
 	"reflect"
 	"testing"
 )
@@ -43,3 +51,218 @@ func TestConversion_Png_HasProcessableExtname(t *testing.T) {
 		})
 	}
 }
+
+func TestConversion_Png_EncodeDecodeAnimation(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	nrgba := image.NewNRGBA(image.Rect(0, 0, 30, 20))
+	rnd.Read(nrgba.Pix)
+	part := image.NewNRGBA(image.Rect(5, 4, 15, 9))
+	rnd.Read(part.Pix)
+	opaque := image.NewRGBA(image.Rect(0, 0, 30, 20))
+	for i := range opaque.Pix {
+		opaque.Pix[i] = byte(i / 7)
+		if i%4 == 3 {
+			opaque.Pix[i] = 0xFF
+		}
+	}
+	wide := image.NewNRGBA64(image.Rect(0, 0, 30, 20))
+	rnd.Read(wide.Pix)
+	pal := color.Palette{color.RGBA{A: 0xFF}, color.RGBA{R: 0xFF, A: 0xFF}, color.RGBA{}}
+	paletted := image.NewPaletted(image.Rect(0, 0, 30, 20), pal)
+	partPaletted := image.NewPaletted(image.Rect(1, 2, 4, 5), pal)
+	for i := range paletted.Pix {
+		paletted.Pix[i] = byte(i % 3)
+	}
+	partPaletted.Pix[0] = 1
+
+	cases := map[string]struct {
+		frames    []image.Image
+		colorType byte
+		depth     byte
+	}{
+		"RGBA":     {frames: []image.Image{nrgba, part, opaque}, colorType: pngTrueColorAlpha, depth: 8},
+		"RGB":      {frames: []image.Image{opaque, opaque}, colorType: pngTrueColor, depth: 8},
+		"16 bits":  {frames: []image.Image{wide, part}, colorType: pngTrueColorAlpha, depth: 16},
+		"paletted": {frames: []image.Image{paletted, partPaletted}, colorType: pngPaletted, depth: 8},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			a := &Animation{
+				Frames:    c.frames,
+				Delays:    make([]int, len(c.frames)),
+				Disposals: make([]byte, len(c.frames)),
+				Blends:    make([]byte, len(c.frames)),
+				LoopCount: 3,
+				Width:     30,
+				Height:    20,
+			}
+			for i := range c.frames {
+				a.Delays[i] = 10 * (i + 1)
+				a.Disposals[i] = []byte{gif.DisposalNone, gif.DisposalBackground, gif.DisposalPrevious}[i%3]
+				a.Blends[i] = byte(i % 2)
+			}
+
+			p := &Png{Encoder: &png.Encoder{}}
+			buf := &bytes.Buffer{}
+
+			err := p.EncodeAnimation(buf, a)
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+			data := buf.Bytes()
+
+			if actual := data[24:26]; actual[0] != c.depth || actual[1] != c.colorType {
+				t.Errorf(`expected="%d %d" actual="%d %d"`, c.depth, c.colorType, actual[0], actual[1])
+			}
+
+			// The default image is the first frame.
+			img, err := p.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+			assertSameImage(t, c.frames[0], img)
+
+			actual, err := p.DecodeAnimation(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+
+			if !reflect.DeepEqual(actual.Delays, a.Delays) {
+				t.Errorf(`expected="%v" actual="%v"`, a.Delays, actual.Delays)
+			}
+			if !reflect.DeepEqual(actual.Disposals, a.Disposals) {
+				t.Errorf(`expected="%v" actual="%v"`, a.Disposals, actual.Disposals)
+			}
+			if !reflect.DeepEqual(actual.Blends, a.Blends) {
+				t.Errorf(`expected="%v" actual="%v"`, a.Blends, actual.Blends)
+			}
+			if actual.LoopCount != a.LoopCount || actual.Width != a.Width || actual.Height != a.Height {
+				t.Errorf(`expected="%d %dx%d" actual="%d %dx%d"`, a.LoopCount, a.Width, a.Height, actual.LoopCount, actual.Width, actual.Height)
+			}
+
+			for i, frame := range actual.Frames {
+				if frame.Bounds() != c.frames[i].Bounds() {
+					t.Errorf(`expected="%v" actual="%v"`, c.frames[i].Bounds(), frame.Bounds())
+				}
+				assertSameImage(t, c.frames[i], frame)
+			}
+			if c.depth == 16 {
+				if expected, actual := wide.At(3, 4), color.NRGBA64Model.Convert(actual.Frames[0].At(3, 4)); actual != expected {
+					t.Errorf(`expected="%v" actual="%v"`, expected, actual)
+				}
+			}
+		})
+	}
+}
+
+func TestConversion_Png_DecodeAnimation(t *testing.T) {
+	t.Parallel()
+
+	red := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	copy(red.Pix, []byte{0xFF, 0, 0, 0xFF, 0xFF, 0, 0, 0xFF})
+	data, err := apngFrameData(red, pngTrueColorAlpha, 8, -1)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	// The default image in IDAT precedes fcTL, which is not a frame. Delays of 1/50 second, and the playing once.
+	buf := &bytes.Buffer{}
+	buf.WriteString(pngSignature)
+	writePngChunk(buf, "IHDR", []byte{0, 0, 0, 2, 0, 0, 0, 1, 8, 6, 0, 0, 0})
+	writePngChunk(buf, "acTL", []byte{0, 0, 0, 2, 0, 0, 0, 1})
+	writePngChunk(buf, "IDAT", data)
+	writePngChunk(buf, "fcTL", []byte{0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 50, apngDisposePrevious, apngBlendSource})
+	writePngChunk(buf, "fdAT", append([]byte{0, 0, 0, 1}, data...))
+	writePngChunk(buf, "fcTL", []byte{0, 0, 0, 2, 0, 0, 0, 2, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, apngDisposeNone, apngBlendOver})
+	writePngChunk(buf, "fdAT", append([]byte{0, 0, 0, 3}, data...))
+	writePngChunk(buf, "IEND", nil)
+
+	actual, err := (&Png{}).DecodeAnimation(buf)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	if len(actual.Frames) != 2 {
+		t.Fatalf(`expected=2 actual=%d`, len(actual.Frames))
+	}
+	if expected := []int{2, 1}; !reflect.DeepEqual(actual.Delays, expected) {
+		t.Errorf(`expected="%v" actual="%v"`, expected, actual.Delays)
+	}
+	// The disposal to the previous of the first frame is regarded as the one to the background.
+	if expected := []byte{gif.DisposalBackground, gif.DisposalNone}; !reflect.DeepEqual(actual.Disposals, expected) {
+		t.Errorf(`expected="%v" actual="%v"`, expected, actual.Disposals)
+	}
+	if expected := []byte{BlendSource, BlendOver}; !reflect.DeepEqual(actual.Blends, expected) {
+		t.Errorf(`expected="%v" actual="%v"`, expected, actual.Blends)
+	}
+	if actual.LoopCount != -1 {
+		t.Errorf(`expected=-1 actual=%d`, actual.LoopCount)
+	}
+}
+
+func TestConversion_Png_DecodeAnimation_NotAnimated(t *testing.T) {
+	t.Parallel()
+
+	img := image.NewGray(image.Rect(0, 0, 3, 2))
+	buf := &bytes.Buffer{}
+	err := png.Encode(buf, img)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	actual, err := (&Png{}).DecodeAnimation(buf)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	if len(actual.Frames) != 1 || actual.Width != 3 || actual.Height != 2 {
+		t.Errorf(`expected="1 3x2" actual="%d %dx%d"`, len(actual.Frames), actual.Width, actual.Height)
+	}
+}
+
+func TestConversion_Png_DecodeAnimation_Failure(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	a := &Animation{Frames: []image.Image{img}, Delays: []int{0}, Width: 2, Height: 2}
+	buf := &bytes.Buffer{}
+	err := (&Png{}).EncodeAnimation(buf, a)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	valid := buf.Bytes()
+
+	// The chunks are IHDR at 8, acTL at 33 and fcTL at 53.
+	outside := append([]byte{}, valid...)
+	binary.BigEndian.PutUint32(outside[53+8+12:], 1)
+	binary.BigEndian.PutUint32(outside[53+8+26:], crc32.ChecksumIEEE(outside[53+4:53+8+26]))
+	checksum := append([]byte{}, valid...)
+	checksum[53+8+25] ^= 1
+
+	cases := map[string]struct {
+		data     []byte
+		expected string
+	}{
+		"not PNG":   {data: []byte("GIF89a"), expected: "png: invalid format"},
+		"outside":   {data: outside, expected: "png: invalid animation"},
+		"checksum":  {data: checksum, expected: "png: invalid checksum"},
+		"truncated": {data: valid[:60], expected: "unexpected EOF"},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := (&Png{}).DecodeAnimation(bytes.NewReader(c.data))
+
+			actual := err.Error()
+			if actual != c.expected {
+				t.Errorf(`expected="%s" actual="%s"`, c.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package conversion
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+)
+
+func init() {
+	Register(&Format{
+		Name:       "qoi",
+		Shorthand:  "q",
+		Extnames:   []string{".qoi"},
+		NewDecoder: func() Decoder { return &Qoi{} },
+		DefineEncoderFlags: func(flg *flag.FlagSet) EncoderFactory {
+			return func() (Encoder, error) {
+				return &Qoi{}, nil
+			}
+		},
+	})
+}
+
+// Qoi https://qoiformat.org/qoi-specification.pdf
+type Qoi struct{}
+
+// Chunk tags of QOI. The 8-bit tags take precedence over the 2-bit ones.
+const (
+	qoiOpIndex = 0x00
+	qoiOpDiff  = 0x40
+	qoiOpLuma  = 0x80
+	qoiOpRun   = 0xC0
+	qoiOpRGB   = 0xFE
+	qoiOpRGBA  = 0xFF
+
+	qoiMask2 = 0xC0
+)
+
+const (
+	qoiHeaderLen = 14
+	qoiMaxRun    = 62
+)
+
+// The specification limits the pixels so that a broken header does not exhaust the memory.
+const qoiMaxPixels = 400000000
+
+var qoiEndMarker = []byte{0, 0, 0, 0, 0, 0, 0, 1}
+
+var errQoiInvalid = errors.New("qoi: invalid format")
+
+// Encode encodes the specified file to QOI.
+// Opaque images are written in 3 channels and the others in 4 channels.
+func (q *Qoi) Encode(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	channels := byte(4)
+	if isOpaque(img) {
+		channels = 3
+	}
+
+	header := make([]byte, qoiHeaderLen)
+	copy(header, "qoif")
+	binary.BigEndian.PutUint32(header[4:], uint32(width))
+	binary.BigEndian.PutUint32(header[8:], uint32(height))
+	// sRGB with linear alpha
+	header[12], header[13] = channels, 0
+
+	bw := bufio.NewWriter(w)
+	bw.Write(header)
+
+	var index [64]color.NRGBA
+	prev := color.NRGBA{A: 0xFF}
+	run := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			px := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+
+			if px == prev {
+				run++
+				if run == qoiMaxRun {
+					bw.WriteByte(qoiOpRun | byte(run-1))
+					run = 0
+				}
+				continue
+			}
+			if run > 0 {
+				bw.WriteByte(qoiOpRun | byte(run-1))
+				run = 0
+			}
+
+			h := qoiHash(px)
+			switch {
+			case index[h] == px:
+				bw.WriteByte(qoiOpIndex | h)
+			case px.A != prev.A:
+				bw.Write([]byte{qoiOpRGBA, px.R, px.G, px.B, px.A})
+			default:
+				dr, dg, db := int8(px.R-prev.R), int8(px.G-prev.G), int8(px.B-prev.B)
+				drg, dbg := dr-dg, db-dg
+				switch {
+				case dr >= -2 && dr <= 1 && dg >= -2 && dg <= 1 && db >= -2 && db <= 1:
+					bw.WriteByte(qoiOpDiff | byte(dr+2)<<4 | byte(dg+2)<<2 | byte(db+2))
+				case dg >= -32 && dg <= 31 && drg >= -8 && drg <= 7 && dbg >= -8 && dbg <= 7:
+					bw.Write([]byte{qoiOpLuma | byte(dg+32), byte(drg+8)<<4 | byte(dbg+8)})
+				default:
+					bw.Write([]byte{qoiOpRGB, px.R, px.G, px.B})
+				}
+			}
+			index[h] = px
+			prev = px
+		}
+	}
+	if run > 0 {
+		bw.WriteByte(qoiOpRun | byte(run-1))
+	}
+	bw.Write(qoiEndMarker)
+
+	return bw.Flush()
+}
+
+// Decode decodes the specified QOI file to *image.NRGBA.
+func (q *Qoi) Decode(r io.Reader) (image.Image, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < qoiHeaderLen || string(data[:4]) != "qoif" {
+		return nil, errQoiInvalid
+	}
+	width := int(binary.BigEndian.Uint32(data[4:]))
+	height := int(binary.BigEndian.Uint32(data[8:]))
+	channels := data[12]
+	if width <= 0 || height <= 0 || width > qoiMaxPixels/height {
+		return nil, errors.New("qoi: invalid dimensions")
+	}
+	if channels != 3 && channels != 4 {
+		return nil, errQoiInvalid
+	}
+
+	pix := make([]byte, 4*width*height)
+
+	var index [64]color.NRGBA
+	px := color.NRGBA{A: 0xFF}
+	p := qoiHeaderLen
+	for i := 0; i < len(pix); i += 4 {
+		if p >= len(data) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		b := data[p]
+		p++
+
+		switch {
+		case b == qoiOpRGB, b == qoiOpRGBA:
+			n := 3
+			if b == qoiOpRGBA {
+				n = 4
+			}
+			if p+n > len(data) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			px.R, px.G, px.B = data[p], data[p+1], data[p+2]
+			if b == qoiOpRGBA {
+				px.A = data[p+3]
+			}
+			p += n
+		case b&qoiMask2 == qoiOpIndex:
+			px = index[b]
+		case b&qoiMask2 == qoiOpDiff:
+			px.R += b>>4&0x03 - 2
+			px.G += b>>2&0x03 - 2
+			px.B += b&0x03 - 2
+		case b&qoiMask2 == qoiOpLuma:
+			if p >= len(data) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			dg := b&0x3F - 32
+			px.R += dg + data[p]>>4 - 8
+			px.G += dg
+			px.B += dg + data[p]&0x0F - 8
+			p++
+		default:
+			// The run includes this pixel.
+			for n := int(b & 0x3F); n > 0 && i < len(pix); n-- {
+				copy(pix[i:], []byte{px.R, px.G, px.B, px.A})
+				i += 4
+			}
+		}
+
+		index[qoiHash(px)] = px
+		copy(pix[i:], []byte{px.R, px.G, px.B, px.A})
+	}
+
+	return &image.NRGBA{Pix: pix, Stride: 4 * width, Rect: image.Rect(0, 0, width, height)}, nil
+}
+
+func qoiHash(c color.NRGBA) byte {
+	return (c.R*3 + c.G*5 + c.B*7 + c.A*11) % 64
+}
+
+// Extname returns "qoi"
+func (q *Qoi) Extname() string {
+	return "qoi"
+}
+
+// MagicBytesSlice returns the magic bytes slice of QOI
+func (q *Qoi) MagicBytesSlice() [][]byte {
+	return [][]byte{[]byte("qoif")}
+}
+
+// HasProcessableExtname returns whether the specified path has ".qoi"
+func (q *Qoi) HasProcessableExtname(path string) bool {
+	return filepath.Ext(path) == ".qoi"
+}
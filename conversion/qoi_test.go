@@ -0,0 +1,161 @@
+package conversion
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestConversion_Qoi_MagicBytesSlice(t *testing.T) {
+	t.Parallel()
+
+	expected := [][]byte{[]byte("qoif")}
+
+	q := Qoi{}
+
+	actual := q.MagicBytesSlice()
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf(`expected="%s" actual="%s"`, expected, actual)
+	}
+}
+
+func TestConversion_Qoi_HasProcessableExtname(t *testing.T) {
+	q := Qoi{}
+
+	cases := map[string]struct {
+		path     string
+		expected bool
+	}{
+		"foo.qoi": {path: "foo.qoi", expected: true},
+		"foo.jpg": {path: "foo.jpg", expected: false},
+		"foo.png": {path: "foo.png", expected: false},
+		"foo.gif": {path: "foo.gif", expected: false},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			actual := q.HasProcessableExtname(c.path)
+			if actual != c.expected {
+				t.Errorf(`expected="%t" actual="%t"`, c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestConversion_Qoi_EncodeDecode(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	noise := image.NewNRGBA(image.Rect(0, 0, 300, 250))
+	rnd.Read(noise.Pix)
+	// Small differences for QOI_OP_DIFF and QOI_OP_LUMA, and runs longer than 62 pixels
+	gradient := image.NewNRGBA(image.Rect(0, 0, 100, 20))
+	for i := range gradient.Pix {
+		gradient.Pix[i] = byte(i / 4 * (i%4 + 1) / 5)
+		if i%4 == 3 {
+			gradient.Pix[i] = 0xFF
+		}
+		if i >= 4*300 {
+			gradient.Pix[i] = 0x80
+		}
+	}
+	gray := image.NewGray(image.Rect(0, 0, 33, 5))
+	rnd.Read(gray.Pix)
+	paletted := image.NewPaletted(image.Rect(0, 0, 7, 2), color.Palette{color.RGBA{A: 0xFF}, color.RGBA{R: 0xFF, A: 0xFF}, color.RGBA{}})
+	for i := range paletted.Pix {
+		paletted.Pix[i] = byte(i % 3)
+	}
+
+	imgs := map[string]image.Image{"noise": noise, "gradient": gradient, "Gray": gray, "Paletted": paletted}
+
+	for n, img := range imgs {
+		img := img
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			q := &Qoi{}
+			buf := &bytes.Buffer{}
+
+			err := q.Encode(buf, img)
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+
+			actual, err := q.Decode(buf)
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+
+			assertSameImage(t, img, actual)
+		})
+	}
+}
+
+func TestConversion_Qoi_Encode(t *testing.T) {
+	t.Parallel()
+
+	img := image.NewNRGBA(image.Rect(0, 0, 6, 1))
+	copy(img.Pix, []byte{
+		0, 0, 0, 0xFF, // run from the initial pixel
+		1, 0, 0xFF, 0xFF, // QOI_OP_DIFF
+		11, 10, 9, 0xFF, // QOI_OP_LUMA
+		1, 0, 0xFF, 0xFF, // QOI_OP_INDEX
+		0xFF, 0, 0, 0x80, // QOI_OP_RGBA
+		0xFF, 0, 0x80, 0x80, // QOI_OP_RGB
+	})
+
+	expected := []byte{
+		'q', 'o', 'i', 'f', 0, 0, 0, 6, 0, 0, 0, 1, 4, 0,
+		0xC0,
+		0x40 | 3<<4 | 2<<2 | 1,
+		0x80 | 42, 8<<4 | 8,
+		(1*3 + 0*5 + 0xFF*7 + 0xFF*11) % 64,
+		0xFF, 0xFF, 0, 0, 0x80,
+		0xFE, 0xFF, 0, 0x80,
+		0, 0, 0, 0, 0, 0, 0, 1,
+	}
+
+	buf := &bytes.Buffer{}
+
+	err := (&Qoi{}).Encode(buf, img)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	actual := buf.Bytes()
+	if !bytes.Equal(actual, expected) {
+		t.Errorf(`expected="%v" actual="%v"`, expected, actual)
+	}
+}
+
+func TestConversion_Qoi_Decode_Failure(t *testing.T) {
+	cases := map[string]struct {
+		data     []byte
+		expected string
+	}{
+		"not QOI":        {data: []byte("GIF89a\x00\x00\x00\x00\x00\x00\x00\x00"), expected: "qoi: invalid format"},
+		"zero width":     {data: []byte("qoif\x00\x00\x00\x00\x00\x00\x00\x01\x03\x00"), expected: "qoi: invalid dimensions"},
+		"channels":       {data: []byte("qoif\x00\x00\x00\x01\x00\x00\x00\x01\x02\x00"), expected: "qoi: invalid format"},
+		"truncated":      {data: []byte("qoif\x00\x00\x00\x02\x00\x00\x00\x01\x03\x00\xC0"), expected: "unexpected EOF"},
+		"truncated RGBA": {data: []byte("qoif\x00\x00\x00\x01\x00\x00\x00\x01\x04\x00\xFF\x00"), expected: "unexpected EOF"},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := (&Qoi{}).Decode(bytes.NewReader(c.data))
+
+			actual := err.Error()
+			if actual != c.expected {
+				t.Errorf(`expected="%s" actual="%s"`, c.expected, actual)
+			}
+		})
+	}
+}
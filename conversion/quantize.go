@@ -0,0 +1,485 @@
+package conversion
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"sort"
+)
+
+// MedianCut is a draw.Quantizer which divides the colors of the image into boxes by the median of their widest channel,
+// and makes the palette of the average colors of the boxes. https://en.wikipedia.org/wiki/Median_cut
+// Fully transparent pixels are ignored.
+type MedianCut struct{}
+
+// Quantize appends up to cap(p) - len(p) colors to p.
+func (q MedianCut) Quantize(p color.Palette, m image.Image) color.Palette {
+	if cap(p)-len(p) < 1 {
+		return p
+	}
+	return q.quantizeColors(p, colorHistogram(m))
+}
+
+func (MedianCut) quantizeColors(p color.Palette, entries []colorCount) color.Palette {
+	n := cap(p) - len(p)
+	if n < 1 || len(entries) == 0 {
+		return p
+	}
+
+	return append(p, medianCut(entries, n)...)
+}
+
+// medianCut returns up to n colors of the entries, which are reordered.
+func medianCut(entries []colorCount, n int) color.Palette {
+	boxes := []medianCutBox{newMedianCutBox(entries)}
+	for len(boxes) < n {
+		// Split the box with the widest range, preferring the one of more pixels.
+		i := -1
+		for j, b := range boxes {
+			if len(b.entries) < 2 {
+				continue
+			}
+			if i < 0 || b.width > boxes[i].width || (b.width == boxes[i].width && b.count > boxes[i].count) {
+				i = j
+			}
+		}
+		if i < 0 {
+			break
+		}
+
+		lo, hi := boxes[i].split()
+		boxes[i] = lo
+		boxes = append(boxes, hi)
+	}
+
+	p := make(color.Palette, len(boxes))
+	for i, b := range boxes {
+		p[i] = b.average()
+	}
+	return p
+}
+
+// colorCount is a color of an image and the number of its pixels.
+type colorCount struct {
+	c     [3]uint8
+	count int
+}
+
+// colorQuantizer is implemented by the quantizers of this package, which quantize the colors counted by colorHistogram or Histogram.
+type colorQuantizer interface {
+	// quantizeColors appends up to cap(p) - len(p) colors to p. The entries may be reordered.
+	quantizeColors(p color.Palette, entries []colorCount) color.Palette
+}
+
+// colorHistogram returns the colors of the image ignoring alpha, sorted so that quantization is deterministic.
+// Fully transparent pixels are ignored.
+func colorHistogram(m image.Image) []colorCount {
+	counts := make(map[[3]uint8]int)
+	bounds := m.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(m.At(x, y)).(color.NRGBA)
+			if c.A == 0 {
+				continue
+			}
+			counts[[3]uint8{c.R, c.G, c.B}]++
+		}
+	}
+
+	return sortedColorCounts(counts)
+}
+
+func sortedColorCounts(counts map[[3]uint8]int) []colorCount {
+	entries := make([]colorCount, 0, len(counts))
+	for c, count := range counts {
+		entries = append(entries, colorCount{c: c, count: count})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i].c, entries[j].c
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		if a[1] != b[1] {
+			return a[1] < b[1]
+		}
+		return a[2] < b[2]
+	})
+
+	return entries
+}
+
+type medianCutBox struct {
+	entries []colorCount
+	count   int
+
+	// The channel of the widest range and the range.
+	channel int
+	width   int
+}
+
+func newMedianCutBox(entries []colorCount) medianCutBox {
+	b := medianCutBox{entries: entries}
+
+	min, max := [3]int{255, 255, 255}, [3]int{}
+	for _, e := range entries {
+		b.count += e.count
+		for ch := 0; ch < 3; ch++ {
+			v := int(e.c[ch])
+			if v < min[ch] {
+				min[ch] = v
+			}
+			if v > max[ch] {
+				max[ch] = v
+			}
+		}
+	}
+	for ch := 0; ch < 3; ch++ {
+		if w := max[ch] - min[ch]; w > b.width {
+			b.channel, b.width = ch, w
+		}
+	}
+
+	return b
+}
+
+// split divides the box at the median, weighted by the number of pixels, of the widest channel.
+func (b medianCutBox) split() (medianCutBox, medianCutBox) {
+	ch := b.channel
+	sort.SliceStable(b.entries, func(i, j int) bool {
+		return b.entries[i].c[ch] < b.entries[j].c[ch]
+	})
+
+	i, sum := 0, 0
+	for i < len(b.entries)-1 {
+		sum += b.entries[i].count
+		i++
+		if 2*sum >= b.count {
+			break
+		}
+	}
+
+	return newMedianCutBox(b.entries[:i]), newMedianCutBox(b.entries[i:])
+}
+
+func (b medianCutBox) average() color.Color {
+	var sum [3]int
+	for _, e := range b.entries {
+		for ch := 0; ch < 3; ch++ {
+			sum[ch] += int(e.c[ch]) * e.count
+		}
+	}
+	return averageColor(sum, b.count)
+}
+
+// Octree is a draw.Quantizer which puts the colors of the image into the tree branching by a bit of each channel from the top,
+// and merges the leaves of fewer pixels into their parent, deepest first, until they fit in the palette. https://en.wikipedia.org/wiki/Octree
+// Fully transparent pixels are ignored.
+type Octree struct{}
+
+// Quantize appends up to cap(p) - len(p) colors to p.
+func (q Octree) Quantize(p color.Palette, m image.Image) color.Palette {
+	if cap(p)-len(p) < 1 {
+		return p
+	}
+	return q.quantizeColors(p, colorHistogram(m))
+}
+
+func (Octree) quantizeColors(p color.Palette, entries []colorCount) color.Palette {
+	n := cap(p) - len(p)
+	if n < 1 || len(entries) == 0 {
+		return p
+	}
+
+	// The nodes which have children, by depth. Each color is a leaf of depth 8.
+	root := &octreeNode{}
+	levels := [8][]*octreeNode{{root}}
+	for _, e := range entries {
+		node := root
+		for depth := 0; depth < 8; depth++ {
+			node.add(e)
+			i := octreeIndex(e.c, depth)
+			if node.children[i] == nil {
+				node.children[i] = &octreeNode{}
+				if depth < 7 {
+					levels[depth+1] = append(levels[depth+1], node.children[i])
+				}
+			}
+			node = node.children[i]
+		}
+		node.add(e)
+	}
+
+	leaves := len(entries)
+	for depth := 7; depth >= 0 && leaves > n; depth-- {
+		nodes := levels[depth]
+		sort.SliceStable(nodes, func(i, j int) bool {
+			return nodes[i].count < nodes[j].count
+		})
+		for _, node := range nodes {
+			if leaves <= n {
+				break
+			}
+			leaves -= node.merge() - 1
+		}
+	}
+
+	return root.appendLeaves(p)
+}
+
+type octreeNode struct {
+	children [8]*octreeNode
+
+	// Of all the colors under the node
+	sum   [3]int
+	count int
+}
+
+// octreeIndex returns the index of the child of the node at the depth which the color belongs to.
+func octreeIndex(c [3]uint8, depth int) int {
+	shift := uint(7 - depth)
+	return int(c[0]>>shift&1)<<2 | int(c[1]>>shift&1)<<1 | int(c[2]>>shift&1)
+}
+
+func (node *octreeNode) add(e colorCount) {
+	for ch := 0; ch < 3; ch++ {
+		node.sum[ch] += int(e.c[ch]) * e.count
+	}
+	node.count += e.count
+}
+
+// merge makes the node a leaf and returns the number of the leaves it had as its children.
+func (node *octreeNode) merge() int {
+	n := 0
+	for i, child := range node.children {
+		if child != nil {
+			n++
+			node.children[i] = nil
+		}
+	}
+	return n
+}
+
+func (node *octreeNode) appendLeaves(p color.Palette) color.Palette {
+	leaf := true
+	for _, child := range node.children {
+		if child != nil {
+			leaf = false
+			p = child.appendLeaves(p)
+		}
+	}
+	if leaf {
+		p = append(p, averageColor(node.sum, node.count))
+	}
+	return p
+}
+
+// KMeans is a draw.Quantizer which refines the palette of MedianCut by k-means clustering,
+// assigning each color to the nearest one of the palette and moving it to the average of its colors. https://en.wikipedia.org/wiki/K-means_clustering
+// Fully transparent pixels are ignored.
+type KMeans struct{}
+
+// Iterations of KMeans at most. It usually converges earlier.
+const kMeansIterations = 10
+
+// Quantize appends up to cap(p) - len(p) colors to p.
+func (q KMeans) Quantize(p color.Palette, m image.Image) color.Palette {
+	if cap(p)-len(p) < 1 {
+		return p
+	}
+	return q.quantizeColors(p, colorHistogram(m))
+}
+
+func (KMeans) quantizeColors(p color.Palette, entries []colorCount) color.Palette {
+	n := cap(p) - len(p)
+	if n < 1 || len(entries) == 0 {
+		return p
+	}
+
+	initial := medianCut(entries, n)
+	centers := make([][3]uint8, len(initial))
+	for i, c := range initial {
+		rgba := c.(color.RGBA)
+		centers[i] = [3]uint8{rgba.R, rgba.G, rgba.B}
+	}
+
+	for iteration := 0; iteration < kMeansIterations; iteration++ {
+		sums := make([][3]int, len(centers))
+		counts := make([]int, len(centers))
+		for _, e := range entries {
+			i := nearestCenter(centers, e.c)
+			for ch := 0; ch < 3; ch++ {
+				sums[i][ch] += int(e.c[ch]) * e.count
+			}
+			counts[i] += e.count
+		}
+
+		moved := false
+		for i := range centers {
+			// No color is the nearest to it. Leave it as it is.
+			if counts[i] == 0 {
+				continue
+			}
+			avg := averageColor(sums[i], counts[i]).(color.RGBA)
+			if c := [3]uint8{avg.R, avg.G, avg.B}; c != centers[i] {
+				centers[i], moved = c, true
+			}
+		}
+		if !moved {
+			break
+		}
+	}
+
+	for _, c := range centers {
+		p = append(p, color.RGBA{R: c[0], G: c[1], B: c[2], A: 0xFF})
+	}
+	return p
+}
+
+// nearestCenter returns the index of the nearest center to the color in the RGB space.
+func nearestCenter(centers [][3]uint8, c [3]uint8) int {
+	best, bestDist := 0, -1
+	for i, center := range centers {
+		dist := 0
+		for ch := 0; ch < 3; ch++ {
+			d := int(center[ch]) - int(c[ch])
+			dist += d * d
+		}
+		if bestDist < 0 || dist < bestDist {
+			best, bestDist = i, dist
+		}
+	}
+	return best
+}
+
+// averageColor returns the opaque color of the sums of the channels divided by the count, rounded.
+func averageColor(sum [3]int, count int) color.Color {
+	return color.RGBA{
+		R: uint8((sum[0] + count/2) / count),
+		G: uint8((sum[1] + count/2) / count),
+		B: uint8((sum[2] + count/2) / count),
+		A: 0xFF,
+	}
+}
+
+// SharedPalette returns the palette of up to numColors colors computed across all the images by the quantizer, MedianCut by default.
+// A transparent color is included when any of the images has transparent pixels. See Histogram.
+func SharedPalette(imgs []image.Image, numColors int, q draw.Quantizer) color.Palette {
+	h := &Histogram{}
+	for _, img := range imgs {
+		h.Add(img)
+	}
+	return h.Palette(numColors, q)
+}
+
+// Histogram counts the colors of images added one by one, so that a palette is computed across them without holding them.
+// Its size is bounded: when the number of the colors exceeds maxHistogramColors, the similar colors are merged into their average.
+// The zero value is an empty histogram.
+type Histogram struct {
+	// The number of the low bits of each channel ignored to tell the colors apart
+	shift uint
+
+	buckets     map[[3]uint8]*colorSum
+	transparent bool
+}
+
+const maxHistogramColors = 1 << 16
+
+// colorSum is the sums of the channels of the colors merged into a bucket and the number of their pixels.
+type colorSum struct {
+	sum   [3]int
+	count int
+}
+
+// Add counts the colors of the image. Fully transparent pixels are ignored.
+func (h *Histogram) Add(img image.Image) {
+	if h.buckets == nil {
+		h.buckets = make(map[[3]uint8]*colorSum)
+	}
+	if !isOpaque(img) {
+		h.transparent = true
+	}
+
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if c.A == 0 {
+				continue
+			}
+
+			key := [3]uint8{c.R >> h.shift, c.G >> h.shift, c.B >> h.shift}
+			b, ok := h.buckets[key]
+			if !ok {
+				b = &colorSum{}
+				h.buckets[key] = b
+			}
+			b.sum[0] += int(c.R)
+			b.sum[1] += int(c.G)
+			b.sum[2] += int(c.B)
+			b.count++
+
+			for len(h.buckets) > maxHistogramColors {
+				h.coarsen()
+			}
+		}
+	}
+}
+
+// coarsen merges the buckets ignoring one more bit of each channel.
+func (h *Histogram) coarsen() {
+	h.shift++
+	buckets := make(map[[3]uint8]*colorSum, len(h.buckets)/2)
+	for key, b := range h.buckets {
+		key = [3]uint8{key[0] >> 1, key[1] >> 1, key[2] >> 1}
+		merged, ok := buckets[key]
+		if !ok {
+			buckets[key] = b
+			continue
+		}
+		for ch := 0; ch < 3; ch++ {
+			merged.sum[ch] += b.sum[ch]
+		}
+		merged.count += b.count
+	}
+	h.buckets = buckets
+}
+
+// Palette returns the palette of up to numColors colors of the counted colors by the quantizer, MedianCut by default.
+// A transparent color is included when any of the images has transparent pixels.
+// The quantizers of this package use the number of the pixels of each color. Other quantizers are given an image having each color once.
+func (h *Histogram) Palette(numColors int, q draw.Quantizer) color.Palette {
+	if q == nil {
+		q = MedianCut{}
+	}
+
+	transparent := h.transparent
+	if transparent && numColors > 1 {
+		numColors--
+	} else {
+		transparent = false
+	}
+
+	// Each bucket is represented by the average of its colors.
+	counts := make(map[[3]uint8]int, len(h.buckets))
+	for _, b := range h.buckets {
+		c := averageColor(b.sum, b.count).(color.RGBA)
+		counts[[3]uint8{c.R, c.G, c.B}] += b.count
+	}
+	entries := sortedColorCounts(counts)
+
+	pal := make(color.Palette, 0, numColors)
+	if cq, ok := q.(colorQuantizer); ok {
+		pal = cq.quantizeColors(pal, entries)
+	} else {
+		img := image.NewNRGBA(image.Rect(0, 0, len(entries), 1))
+		for i, e := range entries {
+			img.SetNRGBA(i, 0, color.NRGBA{R: e.c[0], G: e.c[1], B: e.c[2], A: 0xFF})
+		}
+		pal = q.Quantize(pal, img)
+	}
+	if transparent {
+		pal = append(pal, color.RGBA{})
+	}
+
+	return pal
+}
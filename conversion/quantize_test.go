@@ -0,0 +1,133 @@
+package conversion
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestConversion_Quantizer_Quantize(t *testing.T) {
+	red := color.RGBA{R: 0xFF, A: 0xFF}
+	green := color.RGBA{G: 0xFF, A: 0xFF}
+	blue := color.RGBA{B: 0xFF, A: 0xFF}
+	white := color.RGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}
+
+	cases := map[string]struct {
+		colors    []color.RGBA
+		numColors int
+		expected  color.Palette
+	}{
+		"enough colors": {colors: []color.RGBA{red, green, blue, red}, numColors: 4, expected: color.Palette{blue, green, red}},
+		"averaged":      {colors: []color.RGBA{{R: 10, A: 0xFF}, {R: 20, A: 0xFF}, {R: 200, A: 0xFF}, {R: 210, A: 0xFF}}, numColors: 2, expected: color.Palette{color.RGBA{R: 15, A: 0xFF}, color.RGBA{R: 205, A: 0xFF}}},
+		"weighted":      {colors: []color.RGBA{white, white, white, {A: 0xFF}}, numColors: 1, expected: color.Palette{color.RGBA{R: 0xBF, G: 0xBF, B: 0xBF, A: 0xFF}}},
+		"transparent":   {colors: []color.RGBA{red, {}}, numColors: 2, expected: color.Palette{red}},
+	}
+
+	quantizers := map[string]draw.Quantizer{"MedianCut": MedianCut{}, "Octree": Octree{}, "KMeans": KMeans{}}
+
+	for qn, q := range quantizers {
+		for n, c := range cases {
+			q, c := q, c
+			t.Run(qn+" "+n, func(t *testing.T) {
+				t.Parallel()
+
+				img := image.NewRGBA(image.Rect(0, 0, len(c.colors), 1))
+				for x, col := range c.colors {
+					img.SetRGBA(x, 0, col)
+				}
+
+				actual := q.Quantize(make(color.Palette, 0, c.numColors), img)
+				sortPalette(actual)
+				if !reflect.DeepEqual(actual, c.expected) {
+					t.Errorf(`expected="%v" actual="%v"`, c.expected, actual)
+				}
+			})
+		}
+	}
+}
+
+func TestConversion_KMeans_Quantize(t *testing.T) {
+	t.Parallel()
+
+	// Median cut splits at the median of the pixels into 0 and 173, and k-means moves 80 and 101 to the nearer one step by step.
+	img := image.NewGray(image.Rect(0, 0, 8, 1))
+	copy(img.Pix, []uint8{0, 0, 0, 0, 80, 101, 255, 255})
+
+	expected := color.Palette{color.RGBA{R: 30, G: 30, B: 30, A: 0xFF}, color.RGBA{R: 255, G: 255, B: 255, A: 0xFF}}
+
+	actual := KMeans{}.Quantize(make(color.Palette, 0, 2), img)
+	sortPalette(actual)
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf(`expected="%v" actual="%v"`, expected, actual)
+	}
+}
+
+func TestConversion_SharedPalette(t *testing.T) {
+	t.Parallel()
+
+	red := color.RGBA{R: 0xFF, A: 0xFF}
+	blue := color.RGBA{B: 0xFF, A: 0xFF}
+
+	first := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	first.SetRGBA(0, 0, red)
+	first.SetRGBA(1, 0, red)
+	second := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	second.SetRGBA(0, 0, blue)
+
+	expected := color.Palette{blue, red, color.RGBA{}}
+
+	actual := SharedPalette([]image.Image{first, second}, 3, nil)
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf(`expected="%v" actual="%v"`, expected, actual)
+	}
+}
+
+func TestConversion_Histogram(t *testing.T) {
+	t.Parallel()
+
+	// Twice as many colors as maxHistogramColors in halves of black and white
+	img := image.NewRGBA(image.Rect(0, 0, 512, 256))
+	for y := 0; y < 256; y++ {
+		for x := 0; x < 512; x++ {
+			v := uint8(x/4) & 0x3F
+			if x >= 256 {
+				v |= 0xC0
+			}
+			img.SetRGBA(x, y, color.RGBA{R: v, G: uint8(y), B: uint8(x % 4), A: 0xFF})
+		}
+	}
+
+	h := &Histogram{}
+	h.Add(img)
+	h.Add(img)
+
+	if len(h.buckets) > maxHistogramColors {
+		t.Errorf(`expected<=%d actual=%d`, maxHistogramColors, len(h.buckets))
+	}
+	count := 0
+	for _, b := range h.buckets {
+		count += b.count
+	}
+	if expected := 2 * 512 * 256; count != expected {
+		t.Errorf(`expected=%d actual=%d`, expected, count)
+	}
+
+	// The averages of the halves are kept precisely.
+	expected := color.Palette{color.RGBA{R: 0x20, G: 0x80, B: 0x02, A: 0xFF}, color.RGBA{R: 0xE0, G: 0x80, B: 0x02, A: 0xFF}}
+
+	actual := h.Palette(2, nil)
+	sortPalette(actual)
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf(`expected="%v" actual="%v"`, expected, actual)
+	}
+}
+
+func sortPalette(p color.Palette) {
+	sort.Slice(p, func(i, j int) bool {
+		a, b := p[i].(color.RGBA), p[j].(color.RGBA)
+		return uint32(a.R)<<16|uint32(a.G)<<8|uint32(a.B) < uint32(b.R)<<16|uint32(b.G)<<8|uint32(b.B)
+	})
+}
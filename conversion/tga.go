@@ -0,0 +1,454 @@
+package conversion
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+)
+
+func init() {
+	Register(&Format{
+		Name:       "tga",
+		Aliases:    []string{"targa"},
+		Extnames:   []string{".tga"},
+		NewDecoder: func() Decoder { return &Tga{} },
+		DefineEncoderFlags: func(flg *flag.FlagSet) EncoderFactory {
+			rle := flg.Bool("tga-rle", false, "Compress TGA with RLE to be used with '--to=tga' option.")
+
+			return func() (Encoder, error) {
+				return &Tga{RLE: *rle}, nil
+			}
+		},
+	})
+}
+
+// Tga https://en.wikipedia.org/wiki/Truevision_TGA
+// TGA has no magic bytes, so files are checked by Validate instead.
+type Tga struct {
+	RLE bool
+}
+
+// Image types of TGA. The RLE compressed ones are these plus tgaRLE.
+const (
+	tgaColorMapped = 1
+	tgaTrueColor   = 2
+	tgaGray        = 3
+
+	tgaRLE = 8
+)
+
+// Bits of the image descriptor
+const (
+	tgaAlphaBits   = 0x0F
+	tgaRightToLeft = 0x10
+	tgaTopToBottom = 0x20
+	tgaInterleave  = 0xC0
+)
+
+const tgaHeaderLen = 18
+
+// Written at the end of the file by TGA 2.0, in which the offsets of the extension and developer areas are 0.
+var tgaFooter = []byte("\x00\x00\x00\x00\x00\x00\x00\x00TRUEVISION-XFILE.\x00")
+
+// Images whose pixels exceed this are rejected, so that a broken header does not exhaust the memory.
+const tgaMaxPixels = 1 << 28
+
+var (
+	errTgaInvalid     = errors.New("tga: invalid format")
+	errTgaUnsupported = errors.New("tga: unsupported format")
+)
+
+// Encode encodes the specified file to TGA.
+// Paletted images are written with the color map, gray ones in gray, opaque ones in 24 bits and the others in 32 bits with alpha.
+func (t *Tga) Encode(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > 0xFFFF || height > 0xFFFF {
+		return errors.New("tga: image is too large")
+	}
+
+	paletted, isPaletted := img.(*image.Paletted)
+	if isPaletted && !opaquePalette(paletted.Palette) {
+		isPaletted = false
+	}
+	gray, isGray := img.(*image.Gray)
+
+	header := make([]byte, tgaHeaderLen)
+	var colorMap []byte
+	switch {
+	case isPaletted:
+		header[1], header[2], header[16] = 1, tgaColorMapped, 8
+		binary.LittleEndian.PutUint16(header[5:], uint16(len(paletted.Palette)))
+		header[7] = 24
+		for _, c := range paletted.Palette {
+			r, g, b, _ := c.RGBA()
+			colorMap = append(colorMap, byte(b>>8), byte(g>>8), byte(r>>8))
+		}
+	case isGray:
+		header[2], header[16] = tgaGray, 8
+	case isOpaque(img):
+		header[2], header[16] = tgaTrueColor, 24
+	default:
+		header[2], header[16], header[17] = tgaTrueColor, 32, 8
+	}
+	if t.RLE {
+		header[2] += tgaRLE
+	}
+	binary.LittleEndian.PutUint16(header[12:], uint16(width))
+	binary.LittleEndian.PutUint16(header[14:], uint16(height))
+
+	_, err := w.Write(append(header, colorMap...))
+	if err != nil {
+		return err
+	}
+
+	// Rows are stored bottom-up.
+	bytesPerPixel := int(header[16]) / 8
+	row := make([]byte, width*bytesPerPixel)
+	for y := bounds.Max.Y - 1; y >= bounds.Min.Y; y-- {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			px := row[(x-bounds.Min.X)*bytesPerPixel:]
+			switch {
+			case isPaletted:
+				px[0] = paletted.ColorIndexAt(x, y)
+			case isGray:
+				px[0] = gray.GrayAt(x, y).Y
+			default:
+				c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+				px[0], px[1], px[2] = c.B, c.G, c.R
+				if bytesPerPixel == 4 {
+					px[3] = c.A
+				}
+			}
+		}
+
+		data := row
+		if t.RLE {
+			data = tgaEncodeRLE(row, bytesPerPixel)
+		}
+		_, err := w.Write(data)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = w.Write(tgaFooter)
+	return err
+}
+
+// tgaEncodeRLE compresses a row into packets of up to 128 pixels, which are either a run of the same pixel or raw pixels.
+func tgaEncodeRLE(row []byte, bytesPerPixel int) []byte {
+	n := len(row) / bytesPerPixel
+	same := func(i int, j int) bool {
+		return bytes.Equal(row[i*bytesPerPixel:(i+1)*bytesPerPixel], row[j*bytesPerPixel:(j+1)*bytesPerPixel])
+	}
+
+	var dst []byte
+	for i := 0; i < n; {
+		run := 1
+		for i+run < n && run < 128 && same(i, i+run) {
+			run++
+		}
+		if run > 1 {
+			dst = append(dst, 0x80|byte(run-1))
+			dst = append(dst, row[i*bytesPerPixel:(i+1)*bytesPerPixel]...)
+			i += run
+			continue
+		}
+
+		// Raw pixels continue until a run starts.
+		raw := 1
+		for i+raw < n && raw < 128 && !(i+raw+1 < n && same(i+raw, i+raw+1)) {
+			raw++
+		}
+		dst = append(dst, byte(raw-1))
+		dst = append(dst, row[i*bytesPerPixel:(i+raw)*bytesPerPixel]...)
+		i += raw
+	}
+
+	return dst
+}
+
+// tgaHeader is the header of TGA, which precedes the image ID, the color map and the pixels in this order.
+type tgaHeader struct {
+	idLen         int
+	colorMapType  int
+	imageType     int
+	colorMapFirst int
+	colorMapLen   int
+	colorMapDepth int
+	width, height int
+	depth         int
+	descriptor    byte
+}
+
+// parseTgaHeader returns errTgaInvalid if the header is broken, and errTgaUnsupported if it is valid but cannot be decoded.
+func parseTgaHeader(b []byte) (*tgaHeader, error) {
+	if len(b) < tgaHeaderLen {
+		return nil, errTgaInvalid
+	}
+
+	h := &tgaHeader{
+		idLen:         int(b[0]),
+		colorMapType:  int(b[1]),
+		imageType:     int(b[2]),
+		colorMapFirst: int(binary.LittleEndian.Uint16(b[3:])),
+		colorMapLen:   int(binary.LittleEndian.Uint16(b[5:])),
+		colorMapDepth: int(b[7]),
+		width:         int(binary.LittleEndian.Uint16(b[12:])),
+		height:        int(binary.LittleEndian.Uint16(b[14:])),
+		depth:         int(b[16]),
+		descriptor:    b[17],
+	}
+
+	validDepth := func(depth int) bool {
+		return depth == 8 || depth == 15 || depth == 16 || depth == 24 || depth == 32
+	}
+	switch {
+	case h.colorMapType > 1:
+		return nil, errTgaInvalid
+	case h.colorMapType == 1 && !validDepth(h.colorMapDepth):
+		return nil, errTgaInvalid
+	case h.imageType&^tgaRLE < tgaColorMapped || h.imageType&^tgaRLE > tgaGray:
+		return nil, errTgaInvalid
+	case h.width == 0 || h.height == 0 || !validDepth(h.depth):
+		return nil, errTgaInvalid
+	case h.descriptor&tgaInterleave != 0:
+		return nil, errTgaInvalid
+	}
+
+	switch h.imageType &^ tgaRLE {
+	case tgaColorMapped:
+		if h.colorMapType != 1 || h.depth != 8 || h.colorMapLen == 0 || h.colorMapLen > 256 {
+			return nil, errTgaUnsupported
+		}
+	case tgaGray:
+		if h.depth != 8 && h.depth != 16 {
+			return nil, errTgaUnsupported
+		}
+	case tgaTrueColor:
+		if h.depth == 8 {
+			return nil, errTgaUnsupported
+		}
+	}
+
+	return h, nil
+}
+
+func (h *tgaHeader) bytesPerPixel() int {
+	return (h.depth + 7) / 8
+}
+
+func (h *tgaHeader) colorMapBytes() int {
+	if h.colorMapType == 0 {
+		return 0
+	}
+	return h.colorMapLen * ((h.colorMapDepth + 7) / 8)
+}
+
+func (h *tgaHeader) hasAlpha() bool {
+	return h.descriptor&tgaAlphaBits != 0
+}
+
+// Validate returns whether the header of the specified file is valid and the file is long enough for it.
+// Files which are valid but cannot be decoded are regarded as valid, so that their decoding fails instead of being skipped.
+func (t *Tga) Validate(rs io.ReadSeeker) (bool, error) {
+	size, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return false, err
+	}
+	_, err = rs.Seek(0, io.SeekStart)
+	if err != nil {
+		return false, err
+	}
+
+	header := make([]byte, tgaHeaderLen)
+	_, err = io.ReadFull(rs, header)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	h, err := parseTgaHeader(header)
+	if err == errTgaInvalid {
+		return false, nil
+	}
+	if err != nil {
+		return true, nil
+	}
+
+	minSize := tgaHeaderLen + h.idLen + h.colorMapBytes()
+	if h.imageType&tgaRLE == 0 {
+		minSize += h.width * h.height * h.bytesPerPixel()
+	}
+	return size >= int64(minSize), nil
+}
+
+// Decode decodes the specified TGA file.
+// Color-mapped images are decoded to *image.Paletted, 8 bits gray ones to *image.Gray and the others to *image.NRGBA.
+// Alpha is used only when the image descriptor has the attribute bits.
+func (t *Tga) Decode(r io.Reader) (image.Image, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := parseTgaHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	if h.width > tgaMaxPixels/h.height {
+		return nil, errors.New("tga: invalid dimensions")
+	}
+
+	p := tgaHeaderLen + h.idLen
+	if p+h.colorMapBytes() > len(data) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	var palette color.Palette
+	if h.colorMapType == 1 {
+		entryLen := (h.colorMapDepth + 7) / 8
+		for i := 0; i < h.colorMapLen; i++ {
+			palette = append(palette, tgaColor(data[p+entryLen*i:], h.colorMapDepth, h.hasAlpha()))
+		}
+		p += h.colorMapBytes()
+	}
+
+	bytesPerPixel := h.bytesPerPixel()
+	n := h.width * h.height * bytesPerPixel
+	var pixels []byte
+	if h.imageType&tgaRLE != 0 {
+		pixels, err = tgaDecodeRLE(data[p:], n, bytesPerPixel)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if p+n > len(data) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		pixels = data[p : p+n]
+	}
+
+	rect := image.Rect(0, 0, h.width, h.height)
+	var img image.Image
+	switch {
+	case h.imageType&^tgaRLE == tgaColorMapped:
+		img = image.NewPaletted(rect, palette)
+	case h.imageType&^tgaRLE == tgaGray && h.depth == 8:
+		img = image.NewGray(rect)
+	default:
+		img = image.NewNRGBA(rect)
+	}
+
+	for i := 0; i < h.width*h.height; i++ {
+		x, y := i%h.width, i/h.width
+		if h.descriptor&tgaRightToLeft != 0 {
+			x = h.width - 1 - x
+		}
+		if h.descriptor&tgaTopToBottom == 0 {
+			y = h.height - 1 - y
+		}
+		px := pixels[i*bytesPerPixel:]
+
+		switch m := img.(type) {
+		case *image.Paletted:
+			// Indexes are offset by the first entry of the color map.
+			index := int(px[0]) - h.colorMapFirst
+			if index < 0 || index >= len(palette) {
+				index = 0
+			}
+			m.SetColorIndex(x, y, uint8(index))
+		case *image.Gray:
+			m.SetGray(x, y, color.Gray{Y: px[0]})
+		case *image.NRGBA:
+			if h.imageType&^tgaRLE == tgaGray {
+				c := color.NRGBA{R: px[0], G: px[0], B: px[0], A: 0xFF}
+				if h.hasAlpha() {
+					c.A = px[1]
+				}
+				m.SetNRGBA(x, y, c)
+				continue
+			}
+			m.SetNRGBA(x, y, tgaColor(px, h.depth, h.hasAlpha()))
+		}
+	}
+
+	return img, nil
+}
+
+// tgaColor returns the color of the pixel or the color map entry, which is little-endian ARGB.
+func tgaColor(b []byte, depth int, hasAlpha bool) color.NRGBA {
+	switch depth {
+	case 15, 16:
+		v := uint16(b[0]) | uint16(b[1])<<8
+		r, g, bl := byte(v>>10&0x1F), byte(v>>5&0x1F), byte(v&0x1F)
+		c := color.NRGBA{R: r<<3 | r>>2, G: g<<3 | g>>2, B: bl<<3 | bl>>2, A: 0xFF}
+		if depth == 16 && hasAlpha && v&0x8000 == 0 {
+			c.A = 0
+		}
+		return c
+	case 24:
+		return color.NRGBA{R: b[2], G: b[1], B: b[0], A: 0xFF}
+	default:
+		c := color.NRGBA{R: b[2], G: b[1], B: b[0], A: 0xFF}
+		if hasAlpha {
+			c.A = b[3]
+		}
+		return c
+	}
+}
+
+// tgaDecodeRLE decompresses the packets into n bytes. Packets may cross rows.
+func tgaDecodeRLE(src []byte, n int, bytesPerPixel int) ([]byte, error) {
+	dst := make([]byte, 0, n)
+	for i := 0; len(dst) < n; {
+		if i >= len(src) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		b := src[i]
+		i++
+		count := int(b&0x7F) + 1
+
+		if b&0x80 != 0 {
+			if i+bytesPerPixel > len(src) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			for k := 0; k < count; k++ {
+				dst = append(dst, src[i:i+bytesPerPixel]...)
+			}
+			i += bytesPerPixel
+		} else {
+			if i+count*bytesPerPixel > len(src) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			dst = append(dst, src[i:i+count*bytesPerPixel]...)
+			i += count * bytesPerPixel
+		}
+	}
+
+	return dst[:n], nil
+}
+
+// Extname returns "tga"
+func (t *Tga) Extname() string {
+	return "tga"
+}
+
+// MagicBytesSlice returns nil since TGA has no magic bytes. See Validate.
+func (t *Tga) MagicBytesSlice() [][]byte {
+	return nil
+}
+
+// HasProcessableExtname returns whether the specified path has ".tga"
+func (t *Tga) HasProcessableExtname(path string) bool {
+	return filepath.Ext(path) == ".tga"
+}
@@ -0,0 +1,267 @@
+package conversion
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+func TestConversion_Tga_MagicBytesSlice(t *testing.T) {
+	t.Parallel()
+
+	tg := Tga{}
+
+	actual := tg.MagicBytesSlice()
+	if actual != nil {
+		t.Errorf(`expected=nil actual="%s"`, actual)
+	}
+}
+
+func TestConversion_Tga_HasProcessableExtname(t *testing.T) {
+	tg := Tga{}
+
+	cases := map[string]struct {
+		path     string
+		expected bool
+	}{
+		"foo.tga": {path: "foo.tga", expected: true},
+		"foo.bmp": {path: "foo.bmp", expected: false},
+		"foo.png": {path: "foo.png", expected: false},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			actual := tg.HasProcessableExtname(c.path)
+			if actual != c.expected {
+				t.Errorf(`expected="%t" actual="%t"`, c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestConversion_Tga_EncodeDecode(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	nrgba := image.NewNRGBA(image.Rect(0, 0, 300, 250))
+	rnd.Read(nrgba.Pix)
+	rgba := image.NewRGBA(image.Rect(0, 0, 170, 9))
+	for i := range rgba.Pix {
+		rgba.Pix[i] = byte(i / 70)
+		if i%4 == 3 {
+			rgba.Pix[i] = 0xFF
+		}
+	}
+	gray := image.NewGray(image.Rect(0, 0, 33, 5))
+	rnd.Read(gray.Pix)
+	paletted := image.NewPaletted(image.Rect(0, 0, 7, 2), color.Palette{color.RGBA{A: 0xFF}, color.RGBA{R: 0xFF, A: 0xFF}, color.RGBA{B: 0xFF, A: 0xFF}})
+	for i := range paletted.Pix {
+		paletted.Pix[i] = byte(i % 3)
+	}
+
+	imgs := map[string]image.Image{"NRGBA": nrgba, "RGBA": rgba, "Gray": gray, "Paletted": paletted}
+
+	for _, rle := range []bool{false, true} {
+		for n, img := range imgs {
+			rle, img := rle, img
+			name := n
+			if rle {
+				name += " RLE"
+			}
+			t.Run(name, func(t *testing.T) {
+				t.Parallel()
+
+				tg := &Tga{RLE: rle}
+				buf := &bytes.Buffer{}
+
+				err := tg.Encode(buf, img)
+				if err != nil {
+					t.Fatalf("err %s", err)
+				}
+
+				ok, err := tg.Validate(bytes.NewReader(buf.Bytes()))
+				if err != nil {
+					t.Fatalf("err %s", err)
+				}
+				if !ok {
+					t.Errorf("expected valid")
+				}
+
+				actual, err := tg.Decode(buf)
+				if err != nil {
+					t.Fatalf("err %s", err)
+				}
+
+				assertSameImage(t, img, actual)
+			})
+		}
+	}
+}
+
+func TestConversion_Tga_Decode(t *testing.T) {
+	black := color.NRGBA{A: 0xFF}
+	white := color.NRGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}
+	red := color.NRGBA{R: 0xFF, A: 0xFF}
+	blue := color.NRGBA{B: 0xFF, A: 0xFF}
+
+	cases := map[string]struct {
+		data     []byte
+		expected [][]color.NRGBA
+	}{
+		"24 bits bottom-up": {
+			data:     tgaFile(tgaTrueColor, 2, 2, 24, 0, nil, []byte{0, 0, 0xFF, 0xFF, 0, 0, 0, 0, 0, 0xFF, 0xFF, 0xFF}),
+			expected: [][]color.NRGBA{{black, white}, {red, blue}},
+		},
+		"24 bits top-down right-to-left": {
+			data:     tgaFile(tgaTrueColor, 2, 2, 24, tgaTopToBottom|tgaRightToLeft, nil, []byte{0, 0, 0xFF, 0xFF, 0, 0, 0, 0, 0, 0xFF, 0xFF, 0xFF}),
+			expected: [][]color.NRGBA{{blue, red}, {white, black}},
+		},
+		"32 bits without attribute bits": {
+			data:     tgaFile(tgaTrueColor, 1, 1, 32, tgaTopToBottom, nil, []byte{0xFF, 0, 0, 0}),
+			expected: [][]color.NRGBA{{blue}},
+		},
+		"16 bits with alpha": {
+			data:     tgaFile(tgaTrueColor, 2, 1, 16, tgaTopToBottom|1, nil, []byte{0x00, 0xFC, 0x1F, 0x00}),
+			expected: [][]color.NRGBA{{red, {B: 0xFF}}},
+		},
+		"RLE across rows": {
+			// A run of 3 white pixels and a raw black pixel
+			data:     tgaFile(tgaTrueColor+tgaRLE, 2, 2, 24, tgaTopToBottom, nil, []byte{0x82, 0xFF, 0xFF, 0xFF, 0x00, 0, 0, 0}),
+			expected: [][]color.NRGBA{{white, white}, {white, black}},
+		},
+		"color-mapped from the first entry": {
+			data:     tgaFile(tgaColorMapped, 3, 1, 8, tgaTopToBottom, []byte{0xFF, 0, 0, 0, 0, 0xFF}, []byte{2, 3, 9}),
+			expected: [][]color.NRGBA{{blue, red, blue}},
+		},
+		"gray with alpha": {
+			data:     tgaFile(tgaGray, 1, 1, 16, 8, nil, []byte{0xFF, 0x80}),
+			expected: [][]color.NRGBA{{{R: 0xFF, G: 0xFF, B: 0xFF, A: 0x80}}},
+		},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			img, err := (&Tga{}).Decode(bytes.NewReader(c.data))
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+
+			for y, row := range c.expected {
+				for x, expected := range row {
+					actual := color.NRGBAModel.Convert(img.At(x, y))
+					if actual != expected {
+						t.Errorf(`(%d, %d): expected="%v" actual="%v"`, x, y, expected, actual)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestConversion_Tga_Decode_Failure(t *testing.T) {
+	cases := map[string]struct {
+		data     []byte
+		expected string
+	}{
+		"too short":        {data: []byte("\x00\x00\x02"), expected: "tga: invalid format"},
+		"image type":       {data: tgaFile(4, 1, 1, 24, 0, nil, []byte{0, 0, 0}), expected: "tga: invalid format"},
+		"zero width":       {data: tgaFile(tgaTrueColor, 0, 1, 24, 0, nil, nil), expected: "tga: invalid format"},
+		"no color map":     {data: tgaFile(tgaColorMapped, 1, 1, 8, 0, nil, []byte{0}), expected: "tga: unsupported format"},
+		"truncated pixels": {data: tgaFile(tgaTrueColor, 2, 1, 24, 0, nil, []byte{0, 0, 0})[:21], expected: "unexpected EOF"},
+		"truncated RLE":    {data: tgaFile(tgaTrueColor+tgaRLE, 2, 1, 24, 0, nil, []byte{0x80, 0, 0, 0})[:22], expected: "unexpected EOF"},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := (&Tga{}).Decode(bytes.NewReader(c.data))
+
+			actual := err.Error()
+			if actual != c.expected {
+				t.Errorf(`expected="%s" actual="%s"`, c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestConversion_Tga_Validate(t *testing.T) {
+	cases := map[string]struct {
+		data     []byte
+		expected bool
+	}{
+		"valid":           {data: tgaFile(tgaTrueColor, 1, 1, 24, 0, nil, []byte{0, 0, 0}), expected: true},
+		"unsupported":     {data: tgaFile(tgaGray, 1, 1, 24, 0, nil, []byte{0, 0, 0}), expected: true},
+		"RLE":             {data: tgaFile(tgaTrueColor+tgaRLE, 100, 100, 24, 0, nil, []byte{0xFF, 0, 0, 0}), expected: true},
+		"short":           {data: []byte("\x00\x00\x02"), expected: false},
+		"text":            {data: []byte("This is not an image but a text."), expected: false},
+		"truncated":       {data: tgaFile(tgaTrueColor, 100, 100, 24, 0, nil, []byte{0, 0, 0}), expected: false},
+		"interleaved":     {data: tgaFile(tgaTrueColor, 1, 1, 24, 0x40, nil, []byte{0, 0, 0}), expected: false},
+		"color map depth": {data: append([]byte{0, 1, tgaColorMapped, 0, 0, 1, 0, 7}, make([]byte, 20)...), expected: false},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			actual, err := (&Tga{}).Validate(bytes.NewReader(c.data))
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+			if actual != c.expected {
+				t.Errorf(`expected="%t" actual="%t"`, c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestConversion_tgaEncodeRLE(t *testing.T) {
+	cases := map[string]struct {
+		row      []byte
+		expected []byte
+	}{
+		"run":         {row: []byte{1, 1, 1}, expected: []byte{0x82, 1}},
+		"raw":         {row: []byte{1, 2, 3}, expected: []byte{0x02, 1, 2, 3}},
+		"raw and run": {row: []byte{1, 2, 3, 3, 4}, expected: []byte{0x01, 1, 2, 0x81, 3, 0x00, 4}},
+		"long run":    {row: bytes.Repeat([]byte{5}, 130), expected: []byte{0xFF, 5, 0x81, 5}},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			actual := tgaEncodeRLE(c.row, 1)
+			if !bytes.Equal(actual, c.expected) {
+				t.Errorf(`expected="%v" actual="%v"`, c.expected, actual)
+			}
+		})
+	}
+}
+
+// tgaFile returns a TGA file whose color map of 24 bits, if any, starts from the entry 2.
+func tgaFile(imageType byte, width int, height int, depth byte, descriptor byte, colorMap []byte, pixels []byte) []byte {
+	header := make([]byte, tgaHeaderLen)
+	header[2] = imageType
+	if colorMap != nil {
+		header[1] = 1
+		binary.LittleEndian.PutUint16(header[3:], 2)
+		binary.LittleEndian.PutUint16(header[5:], uint16(len(colorMap)/3))
+		header[7] = 24
+	}
+	binary.LittleEndian.PutUint16(header[12:], uint16(width))
+	binary.LittleEndian.PutUint16(header[14:], uint16(height))
+	header[16], header[17] = depth, descriptor
+
+	return append(append(header, colorMap...), pixels...)
+}
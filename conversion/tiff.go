@@ -0,0 +1,822 @@
+package conversion
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+)
+
+func init() {
+	Register(&Format{
+		Name:       "tiff",
+		Aliases:    []string{"tif"},
+		Shorthand:  "t",
+		Extnames:   []string{".tif", ".tiff"},
+		NewDecoder: func() Decoder { return &Tiff{} },
+		DefineEncoderFlags: func(flg *flag.FlagSet) EncoderFactory {
+			humanCompression := flg.String("tiff-compression", "lzw", "Compression of TIFF to be used with '-t' option. You can specify from 'none', 'lzw', 'packbits', 'deflate'.")
+
+			return func() (Encoder, error) {
+				compression, ok := tiffCompressions[*humanCompression]
+				if !ok {
+					return nil, errors.New("--tiff-compression is not included in the list: \"none\", \"lzw\", \"packbits\", \"deflate\"")
+				}
+				return &Tiff{Compression: compression}, nil
+			}
+		},
+	})
+}
+
+// TiffCompression is the compression scheme of TIFF.
+type TiffCompression uint16
+
+// Compression schemes of TIFF
+const (
+	TiffUncompressed TiffCompression = 1
+	TiffLZW          TiffCompression = 5
+	TiffDeflate      TiffCompression = 8
+	TiffPackBits     TiffCompression = 32773
+
+	// Deflate before it was registered as 8.
+	tiffOldDeflate TiffCompression = 32946
+)
+
+var tiffCompressions = map[string]TiffCompression{
+	"none":     TiffUncompressed,
+	"lzw":      TiffLZW,
+	"packbits": TiffPackBits,
+	"deflate":  TiffDeflate,
+}
+
+// Tiff https://en.wikipedia.org/wiki/TIFF
+// Each page of a multi-page file is an image of DecodeAll and EncodeAll.
+type Tiff struct {
+	// The zero value means TiffUncompressed.
+	Compression TiffCompression
+}
+
+// Tags of TIFF
+const (
+	tiffNewSubfileType   = 254
+	tiffImageWidth       = 256
+	tiffImageLength      = 257
+	tiffBitsPerSample    = 258
+	tiffCompressionTag   = 259
+	tiffPhotometric      = 262
+	tiffStripOffsets     = 273
+	tiffSamplesPerPixel  = 277
+	tiffRowsPerStrip     = 278
+	tiffStripByteCounts  = 279
+	tiffXResolution      = 282
+	tiffYResolution      = 283
+	tiffPlanarConfig     = 284
+	tiffResolutionUnit   = 296
+	tiffPageNumber       = 297
+	tiffPredictor        = 317
+	tiffColorMap         = 320
+	tiffTileWidth        = 322
+	tiffTileLength       = 323
+	tiffTileOffsets      = 324
+	tiffTileByteCounts   = 325
+	tiffExtraSamples     = 338
+	tiffSampleFormatTags = 339
+)
+
+// Photometric interpretations of TIFF
+const (
+	tiffWhiteIsZero = 0
+	tiffBlackIsZero = 1
+	tiffRGB         = 2
+	tiffPaletted    = 3
+	tiffCMYK        = 5
+)
+
+// Field types of TIFF
+const (
+	tiffByte     = 1
+	tiffShort    = 3
+	tiffLong     = 4
+	tiffRational = 5
+)
+
+var tiffFieldTypeLens = map[uint16]int{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+// Pages whose bytes exceed this are rejected, so that a broken header does not exhaust the memory.
+const tiffMaxPixels = 1 << 28
+
+var errTiffUnsupported = errors.New("tiff: unsupported format")
+
+// Encode encodes the specified file to TIFF
+func (t *Tiff) Encode(w io.Writer, img image.Image) error {
+	return t.EncodeAll(w, []image.Image{img})
+}
+
+// EncodeAll encodes the images to a TIFF file, one page for each.
+// Paletted images are written with the color map, gray ones in gray, opaque ones in RGB and the others in RGBA.
+func (t *Tiff) EncodeAll(w io.Writer, imgs []image.Image) error {
+	if len(imgs) == 0 {
+		return errors.New("tiff: no image to encode")
+	}
+
+	compression := t.Compression
+	if compression == 0 {
+		compression = TiffUncompressed
+	}
+	if _, ok := tiffCompressors[compression]; !ok {
+		return errTiffUnsupported
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("II\x2A\x00\x00\x00\x00\x00")
+	// Position of the offset to the next IFD.
+	next := 4
+
+	for i, img := range imgs {
+		page := newTiffPage(img)
+
+		var offsets, byteCounts []uint32
+		for _, strip := range page.strips(compression) {
+			offsets = append(offsets, uint32(buf.Len()))
+			byteCounts = append(byteCounts, uint32(len(strip)))
+			buf.Write(strip)
+		}
+
+		entries := []tiffEntry{
+			{tag: tiffImageWidth, typ: tiffLong, values: []uint32{uint32(page.width)}},
+			{tag: tiffImageLength, typ: tiffLong, values: []uint32{uint32(page.height)}},
+			{tag: tiffBitsPerSample, typ: tiffShort, values: repeatUint32(uint32(page.bitsPerSample), page.samplesPerPixel)},
+			{tag: tiffCompressionTag, typ: tiffShort, values: []uint32{uint32(compression)}},
+			{tag: tiffPhotometric, typ: tiffShort, values: []uint32{uint32(page.photometric)}},
+			{tag: tiffStripOffsets, typ: tiffLong, values: offsets},
+			{tag: tiffSamplesPerPixel, typ: tiffShort, values: []uint32{uint32(page.samplesPerPixel)}},
+			{tag: tiffRowsPerStrip, typ: tiffLong, values: []uint32{uint32(page.rowsPerStrip)}},
+			{tag: tiffStripByteCounts, typ: tiffLong, values: byteCounts},
+			// 72 DPI
+			{tag: tiffXResolution, typ: tiffRational, values: []uint32{72, 1}},
+			{tag: tiffYResolution, typ: tiffRational, values: []uint32{72, 1}},
+			{tag: tiffPlanarConfig, typ: tiffShort, values: []uint32{1}},
+			{tag: tiffResolutionUnit, typ: tiffShort, values: []uint32{2}},
+		}
+		if len(imgs) > 1 {
+			entries = append(entries, tiffEntry{tag: tiffPageNumber, typ: tiffShort, values: []uint32{uint32(i), uint32(len(imgs))}})
+		}
+		if page.predictor(compression) {
+			entries = append(entries, tiffEntry{tag: tiffPredictor, typ: tiffShort, values: []uint32{2}})
+		}
+		if page.photometric == tiffPaletted {
+			entries = append(entries, tiffEntry{tag: tiffColorMap, typ: tiffShort, values: page.colorMap()})
+		}
+		if page.extraSample {
+			// Unassociated alpha
+			entries = append(entries, tiffEntry{tag: tiffExtraSamples, typ: tiffShort, values: []uint32{2}})
+		}
+
+		if buf.Len()%2 == 1 {
+			buf.WriteByte(0)
+		}
+		binary.LittleEndian.PutUint32(buf.Bytes()[next:], uint32(buf.Len()))
+		next = writeTiffIFD(buf, entries)
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+type tiffEntry struct {
+	tag    uint16
+	typ    uint16
+	values []uint32
+}
+
+// writeTiffIFD writes the entries sorted by tag and the values which do not fit in them, and returns the position of the offset to the next IFD.
+func writeTiffIFD(buf *bytes.Buffer, entries []tiffEntry) int {
+	start := buf.Len()
+	ifd := make([]byte, 2+12*len(entries)+4)
+	binary.LittleEndian.PutUint16(ifd, uint16(len(entries)))
+
+	var extra []byte
+	extraStart := start + len(ifd)
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].tag < entries[j].tag })
+
+	for i, e := range entries {
+		value := make([]byte, 0, 4)
+		for _, v := range e.values {
+			switch e.typ {
+			case tiffShort:
+				value = append(value, byte(v), byte(v>>8))
+			default:
+				value = append(value, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+			}
+		}
+
+		count := len(e.values)
+		if e.typ == tiffRational {
+			count /= 2
+		}
+
+		p := ifd[2+12*i:]
+		binary.LittleEndian.PutUint16(p[0:], e.tag)
+		binary.LittleEndian.PutUint16(p[2:], e.typ)
+		binary.LittleEndian.PutUint32(p[4:], uint32(count))
+		if len(value) <= 4 {
+			copy(p[8:], value)
+			continue
+		}
+		binary.LittleEndian.PutUint32(p[8:], uint32(extraStart+len(extra)))
+		extra = append(extra, value...)
+		if len(extra)%2 == 1 {
+			extra = append(extra, 0)
+		}
+	}
+
+	buf.Write(ifd)
+	buf.Write(extra)
+
+	return start + len(ifd) - 4
+}
+
+func repeatUint32(v uint32, n int) []uint32 {
+	values := make([]uint32, n)
+	for i := range values {
+		values[i] = v
+	}
+	return values
+}
+
+// tiffPage is an image prepared for encoding.
+type tiffPage struct {
+	img             image.Image
+	width, height   int
+	photometric     int
+	samplesPerPixel int
+	bitsPerSample   int
+	extraSample     bool
+	palette         color.Palette
+	rowsPerStrip    int
+}
+
+func newTiffPage(img image.Image) *tiffPage {
+	bounds := img.Bounds()
+	p := &tiffPage{img: img, width: bounds.Dx(), height: bounds.Dy(), bitsPerSample: 8}
+
+	switch m := img.(type) {
+	case *image.Paletted:
+		if len(m.Palette) <= 256 && opaquePalette(m.Palette) {
+			p.photometric, p.samplesPerPixel, p.palette = tiffPaletted, 1, m.Palette
+		}
+	case *image.Gray:
+		p.photometric, p.samplesPerPixel = tiffBlackIsZero, 1
+	case *image.Gray16:
+		p.photometric, p.samplesPerPixel, p.bitsPerSample = tiffBlackIsZero, 1, 16
+	case *image.RGBA64, *image.NRGBA64:
+		p.photometric, p.samplesPerPixel, p.bitsPerSample = tiffRGB, 3, 16
+	}
+	if p.samplesPerPixel == 0 {
+		p.photometric, p.samplesPerPixel = tiffRGB, 3
+	}
+	if p.photometric == tiffRGB && !isOpaque(img) {
+		p.samplesPerPixel, p.extraSample = 4, true
+	}
+
+	// Strips of about 64KB
+	rowLen := p.rowLen()
+	p.rowsPerStrip = 1
+	if rowLen > 0 && rowLen < 1<<16 {
+		p.rowsPerStrip = 1 << 16 / rowLen
+	}
+	if p.rowsPerStrip > p.height {
+		p.rowsPerStrip = p.height
+	}
+	if p.rowsPerStrip < 1 {
+		p.rowsPerStrip = 1
+	}
+
+	return p
+}
+
+func (p *tiffPage) rowLen() int {
+	return p.width * p.samplesPerPixel * p.bitsPerSample / 8
+}
+
+// predictor returns whether the horizontal differencing is applied, which makes the compression of continuous-tone images better.
+func (p *tiffPage) predictor(compression TiffCompression) bool {
+	return (compression == TiffLZW || compression == TiffDeflate) && p.photometric != tiffPaletted
+}
+
+func (p *tiffPage) colorMap() []uint32 {
+	values := make([]uint32, 3*256)
+	for i, c := range p.palette {
+		r, g, b, _ := c.RGBA()
+		values[i], values[256+i], values[512+i] = r, g, b
+	}
+	return values
+}
+
+func (p *tiffPage) strips(compression TiffCompression) [][]byte {
+	bounds := p.img.Bounds()
+	rowLen := p.rowLen()
+	bytesPerSample := p.bitsPerSample / 8
+
+	var strips [][]byte
+	for y0 := 0; y0 < p.height; y0 += p.rowsPerStrip {
+		y1 := y0 + p.rowsPerStrip
+		if y1 > p.height {
+			y1 = p.height
+		}
+
+		raw := make([]byte, rowLen*(y1-y0))
+		for y := y0; y < y1; y++ {
+			row := raw[rowLen*(y-y0) : rowLen*(y-y0+1)]
+			for x := 0; x < p.width; x++ {
+				p.putPixel(row[x*p.samplesPerPixel*bytesPerSample:], bounds.Min.X+x, bounds.Min.Y+y)
+			}
+			if p.predictor(compression) {
+				tiffDifferentiate(row, p.samplesPerPixel, bytesPerSample, binary.LittleEndian)
+			}
+		}
+
+		strips = append(strips, tiffCompressors[compression](raw))
+	}
+
+	return strips
+}
+
+func (p *tiffPage) putPixel(b []byte, x int, y int) {
+	c := p.img.At(x, y)
+
+	switch {
+	case p.photometric == tiffPaletted:
+		b[0] = p.img.(*image.Paletted).ColorIndexAt(x, y)
+	case p.photometric == tiffBlackIsZero && p.bitsPerSample == 8:
+		b[0] = color.GrayModel.Convert(c).(color.Gray).Y
+	case p.photometric == tiffBlackIsZero:
+		binary.LittleEndian.PutUint16(b, color.Gray16Model.Convert(c).(color.Gray16).Y)
+	case p.bitsPerSample == 8:
+		n := color.NRGBAModel.Convert(c).(color.NRGBA)
+		copy(b, []byte{n.R, n.G, n.B, n.A}[:p.samplesPerPixel])
+	default:
+		n := color.NRGBA64Model.Convert(c).(color.NRGBA64)
+		for i, v := range []uint16{n.R, n.G, n.B, n.A}[:p.samplesPerPixel] {
+			binary.LittleEndian.PutUint16(b[2*i:], v)
+		}
+	}
+}
+
+// tiffDifferentiate replaces each sample with the difference from the same sample of the previous pixel.
+func tiffDifferentiate(row []byte, samplesPerPixel int, bytesPerSample int, order binary.ByteOrder) {
+	if bytesPerSample == 1 {
+		for i := len(row) - 1; i >= samplesPerPixel; i-- {
+			row[i] -= row[i-samplesPerPixel]
+		}
+		return
+	}
+
+	stride := 2 * samplesPerPixel
+	for i := len(row) - 2; i >= stride; i -= 2 {
+		order.PutUint16(row[i:], order.Uint16(row[i:])-order.Uint16(row[i-stride:]))
+	}
+}
+
+// tiffIntegrate reverses tiffDifferentiate.
+func tiffIntegrate(row []byte, samplesPerPixel int, bytesPerSample int, order binary.ByteOrder) {
+	if bytesPerSample == 1 {
+		for i := samplesPerPixel; i < len(row); i++ {
+			row[i] += row[i-samplesPerPixel]
+		}
+		return
+	}
+
+	stride := 2 * samplesPerPixel
+	for i := stride; i+2 <= len(row); i += 2 {
+		order.PutUint16(row[i:], order.Uint16(row[i:])+order.Uint16(row[i-stride:]))
+	}
+}
+
+var tiffCompressors = map[TiffCompression]func([]byte) []byte{
+	TiffUncompressed: func(b []byte) []byte { return b },
+	TiffLZW:          tiffLZWEncode,
+	TiffPackBits:     packBitsEncode,
+	TiffDeflate: func(b []byte) []byte {
+		buf := &bytes.Buffer{}
+		zw := zlib.NewWriter(buf)
+		zw.Write(b)
+		zw.Close()
+		return buf.Bytes()
+	},
+}
+
+var tiffDecompressors = map[TiffCompression]func([]byte) ([]byte, error){
+	TiffUncompressed: func(b []byte) ([]byte, error) { return b, nil },
+	TiffLZW:          tiffLZWDecode,
+	TiffPackBits:     packBitsDecode,
+	TiffDeflate:      tiffInflate,
+	tiffOldDeflate:   tiffInflate,
+}
+
+func tiffInflate(b []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	return ioutil.ReadAll(zr)
+}
+
+// Decode decodes the first page of the specified TIFF file
+func (t *Tiff) Decode(r io.Reader) (image.Image, error) {
+	imgs, err := t.decode(r, true)
+	if err != nil {
+		return nil, err
+	}
+	return imgs[0], nil
+}
+
+// DecodeAll decodes all the pages of the specified TIFF file. Reduced-resolution images such as thumbnails are skipped.
+// It supports bilevel, gray, paletted, RGB and CMYK images of up to 16 bits per sample, in strips or tiles,
+// uncompressed or compressed with LZW, PackBits or Deflate.
+func (t *Tiff) DecodeAll(r io.Reader) ([]image.Image, error) {
+	return t.decode(r, false)
+}
+
+func (t *Tiff) decode(r io.Reader, firstOnly bool) ([]image.Image, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var order binary.ByteOrder
+	switch {
+	case len(data) >= 8 && string(data[:4]) == "II\x2A\x00":
+		order = binary.LittleEndian
+	case len(data) >= 8 && string(data[:4]) == "MM\x00\x2A":
+		order = binary.BigEndian
+	default:
+		return nil, errors.New("tiff: invalid format")
+	}
+
+	var imgs []image.Image
+	visited := make(map[uint32]bool)
+
+	for offset := order.Uint32(data[4:]); offset != 0; {
+		if visited[offset] {
+			return nil, errors.New("tiff: invalid IFD chain")
+		}
+		visited[offset] = true
+
+		ifd, next, err := readTiffIFD(data, offset, order)
+		if err != nil {
+			return nil, err
+		}
+		offset = next
+
+		// Reduced-resolution version of another page
+		if ifd.first(tiffNewSubfileType, 0)&1 != 0 {
+			continue
+		}
+
+		img, err := decodeTiffPage(data, ifd, order)
+		if err != nil {
+			return nil, err
+		}
+		imgs = append(imgs, img)
+
+		if firstOnly {
+			break
+		}
+	}
+
+	if len(imgs) == 0 {
+		return nil, errors.New("tiff: no image")
+	}
+
+	return imgs, nil
+}
+
+// tiffIFD maps tags to their values.
+type tiffIFD map[uint16][]uint32
+
+func (ifd tiffIFD) first(tag uint16, def uint32) uint32 {
+	if values := ifd[tag]; len(values) > 0 {
+		return values[0]
+	}
+	return def
+}
+
+func readTiffIFD(data []byte, offset uint32, order binary.ByteOrder) (tiffIFD, uint32, error) {
+	if uint64(offset)+2 > uint64(len(data)) {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	n := int(order.Uint16(data[offset:]))
+	start := int(offset) + 2
+	if start+12*n+4 > len(data) {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+
+	ifd := make(tiffIFD)
+	for i := 0; i < n; i++ {
+		e := data[start+12*i:]
+		tag, typ, count := order.Uint16(e), order.Uint16(e[2:]), order.Uint32(e[4:])
+
+		typeLen, ok := tiffFieldTypeLens[typ]
+		if !ok || (typ != tiffByte && typ != tiffShort && typ != tiffLong) {
+			// Only integer values are used.
+			continue
+		}
+
+		size := uint64(typeLen) * uint64(count)
+		value := e[8:12]
+		if size > 4 {
+			p := uint64(order.Uint32(e[8:]))
+			if p+size > uint64(len(data)) {
+				return nil, 0, io.ErrUnexpectedEOF
+			}
+			value = data[p : p+size]
+		}
+
+		values := make([]uint32, count)
+		for j := range values {
+			switch typ {
+			case tiffByte:
+				values[j] = uint32(value[j])
+			case tiffShort:
+				values[j] = uint32(order.Uint16(value[2*j:]))
+			case tiffLong:
+				values[j] = order.Uint32(value[4*j:])
+			}
+		}
+		ifd[tag] = values
+	}
+
+	return ifd, order.Uint32(data[start+12*n:]), nil
+}
+
+func decodeTiffPage(data []byte, ifd tiffIFD, order binary.ByteOrder) (image.Image, error) {
+	width := int(ifd.first(tiffImageWidth, 0))
+	height := int(ifd.first(tiffImageLength, 0))
+	if width <= 0 || height <= 0 || width > tiffMaxPixels/height {
+		return nil, errors.New("tiff: invalid dimensions")
+	}
+
+	samplesPerPixel := int(ifd.first(tiffSamplesPerPixel, 1))
+	bitsPerSample := int(ifd.first(tiffBitsPerSample, 1))
+	for _, b := range ifd[tiffBitsPerSample] {
+		if int(b) != bitsPerSample {
+			return nil, errTiffUnsupported
+		}
+	}
+	if ifd.first(tiffPlanarConfig, 1) != 1 || ifd.first(tiffSampleFormatTags, 1) != 1 {
+		return nil, errTiffUnsupported
+	}
+
+	dec := &tiffPageDecoder{
+		width:           width,
+		height:          height,
+		photometric:     int(ifd.first(tiffPhotometric, tiffBlackIsZero)),
+		samplesPerPixel: samplesPerPixel,
+		bitsPerSample:   bitsPerSample,
+		associated:      ifd.first(tiffExtraSamples, 0) == 1,
+		order:           order,
+	}
+
+	colorSamples := map[int]int{tiffWhiteIsZero: 1, tiffBlackIsZero: 1, tiffPaletted: 1, tiffRGB: 3, tiffCMYK: 4}[dec.photometric]
+	switch {
+	case colorSamples == 0, samplesPerPixel < colorSamples, samplesPerPixel > colorSamples+1:
+		return nil, errTiffUnsupported
+	case dec.photometric == tiffPaletted && bitsPerSample > 8:
+		return nil, errTiffUnsupported
+	case dec.photometric == tiffCMYK && (bitsPerSample != 8 || samplesPerPixel != 4):
+		return nil, errTiffUnsupported
+	case colorSamples > 1 && bitsPerSample != 8 && bitsPerSample != 16:
+		return nil, errTiffUnsupported
+	}
+	switch bitsPerSample {
+	case 1, 2, 4, 8, 16:
+	default:
+		return nil, errTiffUnsupported
+	}
+	dec.alpha = samplesPerPixel > colorSamples
+
+	if dec.photometric == tiffPaletted {
+		colorMap := ifd[tiffColorMap]
+		n := 1 << uint(bitsPerSample)
+		if len(colorMap) != 3*n {
+			return nil, errors.New("tiff: invalid color map")
+		}
+		for i := 0; i < n; i++ {
+			dec.palette = append(dec.palette, color.RGBA64{R: uint16(colorMap[i]), G: uint16(colorMap[n+i]), B: uint16(colorMap[2*n+i]), A: 0xFFFF})
+		}
+	}
+
+	compression := TiffCompression(ifd.first(tiffCompressionTag, uint32(TiffUncompressed)))
+	decompress, ok := tiffDecompressors[compression]
+	if !ok {
+		return nil, errTiffUnsupported
+	}
+
+	predictor := ifd.first(tiffPredictor, 1)
+	if predictor != 1 && (predictor != 2 || bitsPerSample < 8) {
+		return nil, errTiffUnsupported
+	}
+
+	// Strips are tiles as wide as the image.
+	blockWidth, blockHeight := width, int(ifd.first(tiffRowsPerStrip, uint32(height)))
+	offsets, byteCounts := ifd[tiffStripOffsets], ifd[tiffStripByteCounts]
+	if _, ok := ifd[tiffTileWidth]; ok {
+		blockWidth, blockHeight = int(ifd.first(tiffTileWidth, 0)), int(ifd.first(tiffTileLength, 0))
+		offsets, byteCounts = ifd[tiffTileOffsets], ifd[tiffTileByteCounts]
+	}
+	if blockWidth <= 0 || blockHeight <= 0 {
+		return nil, errors.New("tiff: invalid strips or tiles")
+	}
+	if blockHeight > height {
+		blockHeight = height
+	}
+
+	across := (width + blockWidth - 1) / blockWidth
+	down := (height + blockHeight - 1) / blockHeight
+	if len(offsets) < across*down || len(byteCounts) < across*down {
+		return nil, errors.New("tiff: invalid strips or tiles")
+	}
+
+	dec.newImage()
+
+	rowLen := (blockWidth*samplesPerPixel*bitsPerSample + 7) / 8
+	for i := 0; i < across*down; i++ {
+		x0, y0 := i%across*blockWidth, i/across*blockHeight
+
+		start, size := uint64(offsets[i]), uint64(byteCounts[i])
+		if start+size > uint64(len(data)) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		block, err := decompress(data[start : start+size])
+		if err != nil {
+			return nil, err
+		}
+
+		rows := blockHeight
+		if y0+rows > height {
+			rows = height - y0
+		}
+		if len(block) < rowLen*rows {
+			return nil, io.ErrUnexpectedEOF
+		}
+
+		for y := 0; y < rows; y++ {
+			row := block[rowLen*y : rowLen*(y+1)]
+			if predictor == 2 {
+				tiffIntegrate(row, samplesPerPixel, bitsPerSample/8, order)
+			}
+			dec.putRow(row, x0, y0+y, blockWidth)
+		}
+	}
+
+	return dec.img, nil
+}
+
+// tiffPageDecoder puts the decompressed rows into the image of the type suitable for the samples.
+type tiffPageDecoder struct {
+	width, height   int
+	photometric     int
+	samplesPerPixel int
+	bitsPerSample   int
+	alpha           bool
+	associated      bool
+	palette         color.Palette
+	order           binary.ByteOrder
+
+	img image.Image
+}
+
+func (d *tiffPageDecoder) newImage() {
+	rect := image.Rect(0, 0, d.width, d.height)
+	deep := d.bitsPerSample == 16
+
+	switch {
+	case d.photometric == tiffPaletted:
+		d.img = image.NewPaletted(rect, d.palette)
+	case d.photometric == tiffCMYK:
+		d.img = image.NewCMYK(rect)
+	case d.alpha && d.associated && deep:
+		d.img = image.NewRGBA64(rect)
+	case d.alpha && d.associated:
+		d.img = image.NewRGBA(rect)
+	case d.alpha && deep:
+		d.img = image.NewNRGBA64(rect)
+	case d.alpha:
+		d.img = image.NewNRGBA(rect)
+	case d.photometric == tiffRGB && deep:
+		d.img = image.NewRGBA64(rect)
+	case d.photometric == tiffRGB:
+		d.img = image.NewRGBA(rect)
+	case deep:
+		d.img = image.NewGray16(rect)
+	default:
+		d.img = image.NewGray(rect)
+	}
+}
+
+// putRow puts the pixels of the row in the block starting at (x0, y). The pixels outside the image are ignored.
+func (d *tiffPageDecoder) putRow(row []byte, x0 int, y int, blockWidth int) {
+	samples := make([]uint32, d.samplesPerPixel)
+	maxValue := uint32(1)<<uint(d.bitsPerSample) - 1
+
+	for bx := 0; bx < blockWidth && x0+bx < d.width; bx++ {
+		x := x0 + bx
+		for s := range samples {
+			samples[s] = d.sample(row, bx*d.samplesPerPixel+s)
+		}
+
+		switch img := d.img.(type) {
+		case *image.Paletted:
+			img.SetColorIndex(x, y, uint8(samples[0]))
+		case *image.CMYK:
+			img.SetCMYK(x, y, color.CMYK{C: uint8(samples[0]), M: uint8(samples[1]), Y: uint8(samples[2]), K: uint8(samples[3])})
+		case *image.Gray:
+			v := samples[0] * 0xFF / maxValue
+			if d.photometric == tiffWhiteIsZero {
+				v = 0xFF - v
+			}
+			img.SetGray(x, y, color.Gray{Y: uint8(v)})
+		case *image.Gray16:
+			v := samples[0]
+			if d.photometric == tiffWhiteIsZero {
+				v = 0xFFFF - v
+			}
+			img.SetGray16(x, y, color.Gray16{Y: uint16(v)})
+		default:
+			d.setColor(x, y, samples, maxValue)
+		}
+	}
+}
+
+// setColor sets the pixel of the RGB or the gray image with alpha without going through color.Color, which would lose the precision of unassociated alpha.
+func (d *tiffPageDecoder) setColor(x int, y int, samples []uint32, maxValue uint32) {
+	scale := func(v uint32) uint16 { return uint16(v * 0xFFFF / maxValue) }
+
+	var r, g, b uint16
+	if d.photometric == tiffRGB {
+		r, g, b = scale(samples[0]), scale(samples[1]), scale(samples[2])
+	} else {
+		r = scale(samples[0])
+		if d.photometric == tiffWhiteIsZero {
+			r = 0xFFFF - r
+		}
+		g, b = r, r
+	}
+
+	a := uint16(0xFFFF)
+	if d.alpha {
+		a = scale(samples[len(samples)-1])
+	}
+
+	switch img := d.img.(type) {
+	case *image.RGBA:
+		img.SetRGBA(x, y, color.RGBA{R: uint8(r >> 8), G: uint8(g >> 8), B: uint8(b >> 8), A: uint8(a >> 8)})
+	case *image.RGBA64:
+		img.SetRGBA64(x, y, color.RGBA64{R: r, G: g, B: b, A: a})
+	case *image.NRGBA:
+		img.SetNRGBA(x, y, color.NRGBA{R: uint8(r >> 8), G: uint8(g >> 8), B: uint8(b >> 8), A: uint8(a >> 8)})
+	case *image.NRGBA64:
+		img.SetNRGBA64(x, y, color.NRGBA64{R: r, G: g, B: b, A: a})
+	}
+}
+
+// sample returns the i-th sample of the row.
+func (d *tiffPageDecoder) sample(row []byte, i int) uint32 {
+	switch d.bitsPerSample {
+	case 8:
+		return uint32(row[i])
+	case 16:
+		return uint32(d.order.Uint16(row[2*i:]))
+	default:
+		bit := i * d.bitsPerSample
+		shift := uint(8 - d.bitsPerSample - bit%8)
+		return uint32(row[bit/8]>>shift) & (1<<uint(d.bitsPerSample) - 1)
+	}
+}
+
+// Extname returns "tiff"
+func (t *Tiff) Extname() string {
+	return "tiff"
+}
+
+// MagicBytesSlice returns the magic bytes slice of TIFF
+func (t *Tiff) MagicBytesSlice() [][]byte {
+	return [][]byte{[]byte("II\x2A\x00"), []byte("MM\x00\x2A")}
+}
+
+// HasProcessableExtname returns whether the specified path has ".tif" or ".tiff"
+func (t *Tiff) HasProcessableExtname(path string) bool {
+	ext := filepath.Ext(path)
+	return ext == ".tif" || ext == ".tiff"
+}
@@ -0,0 +1,227 @@
+package conversion
+
+import (
+	"errors"
+	"io"
+)
+
+// Compression schemes of TIFF which the standard library does not have.
+//
+// LZW of TIFF differs from compress/lzw in that the codes are packed MSB first
+// and the code width grows one code earlier ("early change").
+
+const (
+	tiffLZWClear    = 256
+	tiffLZWEOI      = 257
+	tiffLZWFirst    = 258
+	tiffLZWMaxWidth = 12
+)
+
+var errTiffLZW = errors.New("tiff: invalid LZW data")
+
+// tiffLZWDecode decompresses the LZW compressed strip or tile.
+func tiffLZWDecode(src []byte) ([]byte, error) {
+	var (
+		prefix [1 << tiffLZWMaxWidth]uint16
+		suffix [1 << tiffLZWMaxWidth]byte
+		first  [1 << tiffLZWMaxWidth]byte
+		length [1 << tiffLZWMaxWidth]int
+	)
+	for i := 0; i < 256; i++ {
+		suffix[i], first[i], length[i] = byte(i), byte(i), 1
+	}
+
+	out := make([]byte, 0, 2*len(src))
+
+	// emit appends the string of the code by following its prefixes backwards.
+	emit := func(code int) {
+		n := length[code]
+		out = append(out, make([]byte, n)...)
+		for i := len(out) - 1; i >= len(out)-n; i-- {
+			out[i] = suffix[code]
+			code = int(prefix[code])
+		}
+	}
+
+	var bits uint32
+	var nBits uint
+	pos := 0
+
+	width := uint(9)
+	next := tiffLZWFirst
+	prev := -1
+
+	for {
+		for nBits < width {
+			if pos == len(src) {
+				// Some writers omit EOI.
+				return out, nil
+			}
+			bits = bits<<8 | uint32(src[pos])
+			pos++
+			nBits += 8
+		}
+		code := int(bits>>(nBits-width)) & (1<<width - 1)
+		nBits -= width
+
+		switch {
+		case code == tiffLZWClear:
+			width, next, prev = 9, tiffLZWFirst, -1
+			continue
+		case code == tiffLZWEOI:
+			return out, nil
+		case prev == -1:
+			if code > 0xFF {
+				return nil, errTiffLZW
+			}
+			emit(code)
+			prev = code
+			continue
+		}
+
+		var c byte
+		switch {
+		case code < next:
+			emit(code)
+			c = first[code]
+		case code == next:
+			// The string of the previous code followed by its own first byte.
+			emit(prev)
+			c = first[prev]
+			out = append(out, c)
+		default:
+			return nil, errTiffLZW
+		}
+
+		if next < 1<<tiffLZWMaxWidth {
+			prefix[next], suffix[next], first[next], length[next] = uint16(prev), c, first[prev], length[prev]+1
+			next++
+		}
+		prev = code
+
+		if next == 1<<width-1 && width < tiffLZWMaxWidth {
+			width++
+		}
+	}
+}
+
+// tiffLZWEncode compresses the strip with LZW.
+func tiffLZWEncode(src []byte) []byte {
+	var out []byte
+	var bits uint32
+	var nBits uint
+
+	write := func(code int, width uint) {
+		bits = bits<<width | uint32(code)
+		nBits += width
+		for nBits >= 8 {
+			out = append(out, byte(bits>>(nBits-8)))
+			nBits -= 8
+		}
+	}
+
+	width := uint(9)
+	next := tiffLZWFirst
+	table := make(map[int]int)
+
+	write(tiffLZWClear, width)
+
+	if len(src) > 0 {
+		code := int(src[0])
+		for _, c := range src[1:] {
+			key := code<<8 | int(c)
+			if k, ok := table[key]; ok {
+				code = k
+				continue
+			}
+
+			write(code, width)
+			table[key] = next
+			next++
+			code = int(c)
+
+			switch {
+			case next == 1<<tiffLZWMaxWidth-2:
+				// The decoder would grow the width beyond the maximum with the next code.
+				write(tiffLZWClear, width)
+				width, next, table = 9, tiffLZWFirst, make(map[int]int)
+			case next == 1<<width:
+				width++
+			}
+		}
+		write(code, width)
+
+		// The decoder adds an entry for the last code before reading EOI.
+		next++
+		if next == 1<<width && width < tiffLZWMaxWidth {
+			width++
+		}
+	}
+
+	write(tiffLZWEOI, width)
+	if nBits > 0 {
+		out = append(out, byte(bits<<(8-nBits)))
+	}
+
+	return out
+}
+
+// packBitsDecode decompresses the PackBits compressed strip or tile.
+func packBitsDecode(src []byte) ([]byte, error) {
+	var out []byte
+
+	for i := 0; i < len(src); {
+		n := int(int8(src[i]))
+		i++
+
+		switch {
+		case n >= 0:
+			if i+n+1 > len(src) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			out = append(out, src[i:i+n+1]...)
+			i += n + 1
+		case n != -128:
+			if i >= len(src) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			for j := 0; j < 1-n; j++ {
+				out = append(out, src[i])
+			}
+			i++
+		}
+	}
+
+	return out, nil
+}
+
+// packBitsEncode compresses the strip with PackBits. Runs of three or more bytes are replicated, and the others are copied literally.
+func packBitsEncode(src []byte) []byte {
+	var out []byte
+
+	for i := 0; i < len(src); {
+		run := 1
+		for i+run < len(src) && run < 128 && src[i+run] == src[i] {
+			run++
+		}
+		if run >= 3 {
+			out = append(out, byte(1-run), src[i])
+			i += run
+			continue
+		}
+
+		// Literal bytes until the next run of three
+		j := i
+		for j < len(src) && j-i < 128 {
+			if j+2 < len(src) && src[j] == src[j+1] && src[j] == src[j+2] {
+				break
+			}
+			j++
+		}
+		out = append(out, byte(j-i-1))
+		out = append(out, src[i:j]...)
+		i = j
+	}
+
+	return out
+}
@@ -0,0 +1,377 @@
+package conversion
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestConversion_Tiff_MagicBytesSlice(t *testing.T) {
+	t.Parallel()
+
+	expected := [][]byte{[]byte("II\x2A\x00"), []byte("MM\x00\x2A")}
+
+	tf := Tiff{}
+
+	actual := tf.MagicBytesSlice()
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf(`expected="%s" actual="%s"`, expected, actual)
+	}
+}
+
+func TestConversion_Tiff_HasProcessableExtname(t *testing.T) {
+	tf := Tiff{}
+
+	cases := map[string]struct {
+		path     string
+		expected bool
+	}{
+		"foo.tif":  {path: "foo.tif", expected: true},
+		"foo.tiff": {path: "foo.tiff", expected: true},
+		"foo.jpg":  {path: "foo.jpg", expected: false},
+		"foo.png":  {path: "foo.png", expected: false},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			actual := tf.HasProcessableExtname(c.path)
+			if actual != c.expected {
+				t.Errorf(`expected="%t" actual="%t"`, c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestConversion_Tiff_EncodeDecode(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	nrgba := image.NewNRGBA(image.Rect(0, 0, 300, 250))
+	rnd.Read(nrgba.Pix)
+	rgba := image.NewRGBA(image.Rect(0, 0, 17, 9))
+	for i := range rgba.Pix {
+		rgba.Pix[i] = byte(i / 7)
+		if i%4 == 3 {
+			rgba.Pix[i] = 0xFF
+		}
+	}
+	gray := image.NewGray(image.Rect(0, 0, 33, 5))
+	rnd.Read(gray.Pix)
+	gray16 := image.NewGray16(image.Rect(0, 0, 7, 3))
+	rnd.Read(gray16.Pix)
+	nrgba64 := image.NewNRGBA64(image.Rect(0, 0, 7, 3))
+	rnd.Read(nrgba64.Pix)
+	paletted := image.NewPaletted(image.Rect(0, 0, 7, 2), color.Palette{color.RGBA{A: 0xFF}, color.RGBA{R: 0xFF, A: 0xFF}, color.RGBA{B: 0xFF, A: 0xFF}})
+	for i := range paletted.Pix {
+		paletted.Pix[i] = byte(i % 3)
+	}
+
+	imgs := map[string]image.Image{"NRGBA": nrgba, "RGBA": rgba, "Gray": gray, "Gray16": gray16, "NRGBA64": nrgba64, "Paletted": paletted}
+
+	for name, compression := range tiffCompressions {
+		for n, img := range imgs {
+			compression, img := compression, img
+			t.Run(name+" "+n, func(t *testing.T) {
+				t.Parallel()
+
+				tf := &Tiff{Compression: compression}
+				buf := &bytes.Buffer{}
+
+				err := tf.Encode(buf, img)
+				if err != nil {
+					t.Fatalf("err %s", err)
+				}
+
+				actual, err := tf.Decode(buf)
+				if err != nil {
+					t.Fatalf("err %s", err)
+				}
+
+				if reflect.TypeOf(actual) != reflect.TypeOf(img) {
+					t.Errorf(`expected="%T" actual="%T"`, img, actual)
+				}
+				assertSameImage(t, img, actual)
+			})
+		}
+	}
+}
+
+func TestConversion_Tiff_EncodeAllDecodeAll(t *testing.T) {
+	t.Parallel()
+
+	imgs := []image.Image{
+		image.NewGray(image.Rect(0, 0, 4, 3)),
+		image.NewRGBA(image.Rect(0, 0, 5, 3)),
+		image.NewNRGBA(image.Rect(0, 0, 6, 3)),
+	}
+
+	tf := &Tiff{Compression: TiffLZW}
+	buf := &bytes.Buffer{}
+
+	err := tf.EncodeAll(buf, imgs)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	actual, err := tf.DecodeAll(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	if len(actual) != len(imgs) {
+		t.Fatalf(`expected=%d actual=%d`, len(imgs), len(actual))
+	}
+	for i := range imgs {
+		assertSameImage(t, imgs[i], actual[i])
+	}
+
+	first, err := tf.Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	assertSameImage(t, imgs[0], first)
+}
+
+func TestConversion_Tiff_Decode(t *testing.T) {
+	black := color.RGBA{A: 0xFF}
+	white := color.RGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}
+	red := color.RGBA{R: 0xFF, A: 0xFF}
+	blue := color.RGBA{B: 0xFF, A: 0xFF}
+
+	// Reds, greens and blues of black, white, red and blue
+	colorMap := make([]uint32, 3*16)
+	copy(colorMap, []uint32{0, 0xFFFF, 0xFFFF, 0})
+	copy(colorMap[16:], []uint32{0, 0xFFFF, 0, 0})
+	copy(colorMap[32:], []uint32{0, 0xFFFF, 0, 0xFFFF})
+
+	cases := map[string]struct {
+		data     []byte
+		expected [][]color.RGBA
+	}{
+		"big endian, WhiteIsZero bilevel": {
+			data: tiffFile(binary.BigEndian, []byte{0x40, 0xA0}, map[uint16][]uint32{
+				tiffImageWidth: {3}, tiffImageLength: {2}, tiffPhotometric: {tiffWhiteIsZero},
+			}),
+			expected: [][]color.RGBA{{white, black, white}, {black, white, black}},
+		},
+		"4 bits paletted": {
+			data: tiffFile(binary.LittleEndian, []byte{0x01, 0x20, 0x32, 0x10}, map[uint16][]uint32{
+				tiffImageWidth: {3}, tiffImageLength: {2}, tiffBitsPerSample: {4}, tiffPhotometric: {tiffPaletted},
+				tiffColorMap: colorMap,
+			}),
+			expected: [][]color.RGBA{{black, white, red}, {blue, red, white}},
+		},
+		"RGB with horizontal differencing": {
+			data: tiffFile(binary.LittleEndian, []byte{0xFF, 0, 0, 0x01, 0, 0xFF}, map[uint16][]uint32{
+				tiffImageWidth: {2}, tiffImageLength: {1}, tiffBitsPerSample: {8, 8, 8}, tiffSamplesPerPixel: {3}, tiffPhotometric: {tiffRGB}, tiffPredictor: {2},
+			}),
+			expected: [][]color.RGBA{{red, blue}},
+		},
+		"PackBits": {
+			data: tiffFile(binary.LittleEndian, []byte{0xFD, 0xFF, 0x01, 0x00, 0x00}, map[uint16][]uint32{
+				tiffImageWidth: {3}, tiffImageLength: {2}, tiffBitsPerSample: {8}, tiffCompressionTag: {uint32(TiffPackBits)},
+			}),
+			expected: [][]color.RGBA{{white, white, white}, {white, black, black}},
+		},
+		"tiles": {
+			// 2 tiles of 16x16 for the image of 20x1
+			data: tiffFile(binary.LittleEndian, append(bytes.Repeat([]byte{0xFF}, 256), make([]byte, 256)...), map[uint16][]uint32{
+				tiffImageWidth: {20}, tiffImageLength: {1}, tiffBitsPerSample: {8}, tiffTileWidth: {16}, tiffTileLength: {16},
+			}),
+			expected: [][]color.RGBA{{white, white, white, white, white, white, white, white, white, white, white, white, white, white, white, white, black, black, black, black}},
+		},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			img, err := (&Tiff{}).Decode(bytes.NewReader(c.data))
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+
+			for y, row := range c.expected {
+				for x, expected := range row {
+					actual := color.RGBAModel.Convert(img.At(x, y))
+					if actual != expected {
+						t.Errorf(`(%d, %d): expected="%v" actual="%v"`, x, y, expected, actual)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestConversion_Tiff_Decode_Failure(t *testing.T) {
+	cases := map[string]struct {
+		data     []byte
+		expected string
+	}{
+		"not TIFF":  {data: []byte("GIF89a\x00\x00\x00\x00"), expected: "tiff: invalid format"},
+		"truncated": {data: []byte("II\x2A\x00\x08\x00\x00\x00\x0A\x00"), expected: "unexpected EOF"},
+		"JPEG compression": {data: tiffFile(binary.LittleEndian, []byte{0}, map[uint16][]uint32{
+			tiffImageWidth: {1}, tiffImageLength: {1}, tiffBitsPerSample: {8}, tiffCompressionTag: {7},
+		}), expected: "tiff: unsupported format"},
+		"zero width": {data: tiffFile(binary.LittleEndian, []byte{0}, map[uint16][]uint32{
+			tiffImageWidth: {0}, tiffImageLength: {1},
+		}), expected: "tiff: invalid dimensions"},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := (&Tiff{}).Decode(bytes.NewReader(c.data))
+
+			actual := err.Error()
+			if actual != c.expected {
+				t.Errorf(`expected="%s" actual="%s"`, c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestConversion_TiffLZW(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	random := make([]byte, 100000)
+	rnd.Read(random)
+	// Few symbols make long strings, which fill the table with fewer codes.
+	skewed := make([]byte, 100000)
+	for i := range skewed {
+		skewed[i] = byte(rnd.Intn(3))
+	}
+
+	cases := map[string]struct {
+		data []byte
+	}{
+		"empty":    {data: []byte{}},
+		"one byte": {data: []byte{42}},
+		"KwKwK":    {data: []byte("aaaaaaaaaaaaaaaaaaaa")},
+		"random":   {data: random},
+		"skewed":   {data: skewed},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			actual, err := tiffLZWDecode(tiffLZWEncode(c.data))
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+			if !bytes.Equal(actual, c.data) {
+				t.Errorf(`expected=%d bytes actual=%d bytes`, len(c.data), len(actual))
+			}
+		})
+	}
+}
+
+func TestConversion_TiffLZW_Decode(t *testing.T) {
+	t.Parallel()
+
+	// Clear, 'A', 'B', 258 ("AB"), EOI in 9 bits
+	data := []byte{0x80, 0x10, 0x48, 0x50, 0x28, 0x08}
+	expected := []byte("ABAB")
+
+	actual, err := tiffLZWDecode(data)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	if !bytes.Equal(actual, expected) {
+		t.Errorf(`expected="%s" actual="%s"`, expected, actual)
+	}
+}
+
+func TestConversion_PackBits(t *testing.T) {
+	t.Parallel()
+
+	// The example in TIFF 6.0 specification
+	packed := []byte{0xFE, 0xAA, 0x02, 0x80, 0x00, 0x2A, 0xFD, 0xAA, 0x03, 0x80, 0x00, 0x2A, 0x22, 0xF7, 0xAA}
+	expected := []byte{0xAA, 0xAA, 0xAA, 0x80, 0x00, 0x2A, 0xAA, 0xAA, 0xAA, 0xAA, 0x80, 0x00, 0x2A, 0x22, 0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xAA}
+
+	actual, err := packBitsDecode(packed)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	if !bytes.Equal(actual, expected) {
+		t.Errorf(`expected="%x" actual="%x"`, expected, actual)
+	}
+
+	actual, err = packBitsDecode(packBitsEncode(expected))
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	if !bytes.Equal(actual, expected) {
+		t.Errorf(`expected="%x" actual="%x"`, expected, actual)
+	}
+}
+
+// tiffFile builds a TIFF file of a page whose pixels are in a strip, or in tiles of the same size.
+func tiffFile(order binary.ByteOrder, pixels []byte, tags map[uint16][]uint32) []byte {
+	header := make([]byte, 8)
+	if order == binary.BigEndian {
+		copy(header, "MM\x00\x2A")
+	} else {
+		copy(header, "II\x2A\x00")
+	}
+
+	offsetsTag, countsTag := uint16(tiffStripOffsets), uint16(tiffStripByteCounts)
+	n := 1
+	if _, ok := tags[tiffTileWidth]; ok {
+		offsetsTag, countsTag = tiffTileOffsets, tiffTileByteCounts
+		n = 2
+	}
+	for i := 0; i < n; i++ {
+		tags[offsetsTag] = append(tags[offsetsTag], uint32(8+len(pixels)/n*i))
+		tags[countsTag] = append(tags[countsTag], uint32(len(pixels)/n))
+	}
+
+	data := append(header, pixels...)
+	if len(data)%2 == 1 {
+		data = append(data, 0)
+	}
+	order.PutUint32(data[4:], uint32(len(data)))
+
+	var sorted []uint16
+	for tag := range tags {
+		sorted = append(sorted, tag)
+	}
+	for i := 1; i < len(sorted); i++ {
+		for j := i; j > 0 && sorted[j] < sorted[j-1]; j-- {
+			sorted[j], sorted[j-1] = sorted[j-1], sorted[j]
+		}
+	}
+
+	ifd := make([]byte, 2+12*len(sorted)+4)
+	order.PutUint16(ifd, uint16(len(sorted)))
+	extraStart := len(data) + len(ifd)
+	var extra []byte
+	for i, tag := range sorted {
+		e := ifd[2+12*i:]
+		order.PutUint16(e, tag)
+		order.PutUint16(e[2:], tiffLong)
+		order.PutUint32(e[4:], uint32(len(tags[tag])))
+		if len(tags[tag]) == 1 {
+			order.PutUint32(e[8:], tags[tag][0])
+			continue
+		}
+		order.PutUint32(e[8:], uint32(extraStart+len(extra)))
+		for _, v := range tags[tag] {
+			extra = append(extra, 0, 0, 0, 0)
+			order.PutUint32(extra[len(extra)-4:], v)
+		}
+	}
+
+	return append(append(data, ifd...), extra...)
+}
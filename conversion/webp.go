@@ -0,0 +1,211 @@
+package conversion
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+)
+
+func init() {
+	Register(&Format{
+		Name:       "webp",
+		Shorthand:  "w",
+		Extnames:   []string{".webp"},
+		NewDecoder: func() Decoder { return &WebP{} },
+	})
+}
+
+// WebP https://developers.google.com/speed/webp/docs/riff_container
+// Only decoding is supported. Animated images are not supported.
+type WebP struct{}
+
+// Flags of the VP8X chunk
+const (
+	webpAnimationFlag = 0x02
+)
+
+var (
+	errWebPInvalid     = errors.New("webp: invalid format")
+	errWebPUnsupported = errors.New("webp: unsupported format")
+)
+
+// Decode decodes WebP to image.Image.
+// Lossy images are decoded to *image.YCbCr, or *image.NYCbCrA when they have an alpha chunk, and lossless images to *image.NRGBA.
+func (wp *WebP) Decode(r io.Reader) (image.Image, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errWebPInvalid
+	}
+	if riffLen := int64(binary.LittleEndian.Uint32(data[4:])) + 8; riffLen < int64(len(data)) {
+		data = data[:riffLen]
+	}
+
+	var alpha []byte
+	var canvasWidth, canvasHeight int
+
+	for p := 12; ; {
+		if len(data)-p < 8 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		fourCC := string(data[p : p+4])
+		size := int64(binary.LittleEndian.Uint32(data[p+4:]))
+		p += 8
+		if size > int64(len(data)-p) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		chunk := data[p : p+int(size)]
+		p += int(size + size&1)
+
+		var img image.Image
+		switch fourCC {
+		case "VP8X":
+			if len(chunk) < 10 {
+				return nil, errWebPInvalid
+			}
+			if chunk[0]&webpAnimationFlag != 0 {
+				return nil, errWebPUnsupported
+			}
+			canvasWidth = 1 + (int(chunk[4]) | int(chunk[5])<<8 | int(chunk[6])<<16)
+			canvasHeight = 1 + (int(chunk[7]) | int(chunk[8])<<8 | int(chunk[9])<<16)
+			continue
+		case "ALPH":
+			alpha = chunk
+			continue
+		case "ANIM", "ANMF":
+			return nil, errWebPUnsupported
+		case "VP8 ":
+			img, err = decodeWebPLossy(chunk, alpha)
+		case "VP8L":
+			img, err = decodeVP8L(chunk)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		bounds := img.Bounds()
+		if canvasWidth != 0 && (bounds.Dx() != canvasWidth || bounds.Dy() != canvasHeight) {
+			return nil, errWebPInvalid
+		}
+		return img, nil
+	}
+}
+
+// decodeWebPLossy decodes the VP8 bitstream and combines it with the alpha chunk, if any.
+func decodeWebPLossy(data []byte, alphaChunk []byte) (image.Image, error) {
+	ycbcr, err := decodeVP8(data)
+	if err != nil {
+		return nil, err
+	}
+	if alphaChunk == nil {
+		return ycbcr, nil
+	}
+
+	width, height := ycbcr.Rect.Dx(), ycbcr.Rect.Dy()
+	alpha, err := decodeWebPAlpha(alphaChunk, width, height)
+	if err != nil {
+		return nil, err
+	}
+	return &image.NYCbCrA{YCbCr: *ycbcr, A: alpha, AStride: width}, nil
+}
+
+// Compression methods and filtering methods of the ALPH chunk
+const (
+	webpAlphaRaw      = 0
+	webpAlphaLossless = 1
+
+	webpAlphaHorizontal = 1
+	webpAlphaVertical   = 2
+	webpAlphaGradient   = 3
+)
+
+// decodeWebPAlpha decodes the ALPH chunk to alpha values of width*height.
+func decodeWebPAlpha(data []byte, width int, height int) ([]uint8, error) {
+	if len(data) < 1 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	compression, filter := data[0]&0x03, data[0]>>2&0x03
+	data = data[1:]
+
+	alpha := make([]uint8, width*height)
+	switch compression {
+	case webpAlphaRaw:
+		if len(data) < len(alpha) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		copy(alpha, data)
+	case webpAlphaLossless:
+		d := &vp8lDecoder{br: vp8lBitReader{data: data}}
+		pix, err := d.decodeImageStream(width, height, true)
+		if err != nil {
+			return nil, err
+		}
+		for i, p := range pix {
+			alpha[i] = uint8(p >> 8)
+		}
+	default:
+		return nil, errWebPInvalid
+	}
+
+	if filter != 0 {
+		webpUnfilterAlpha(alpha, width, height, filter)
+	}
+	return alpha, nil
+}
+
+// webpUnfilterAlpha restores the alpha values filtered by the specified method.
+// The top row is predicted by the left values and the left column by the above values whatever the method is.
+func webpUnfilterAlpha(alpha []uint8, width int, height int, filter uint8) {
+	for x := 1; x < width; x++ {
+		alpha[x] += alpha[x-1]
+	}
+	for y := 1; y < height; y++ {
+		row := y * width
+		alpha[row] += alpha[row-width]
+		for x := 1; x < width; x++ {
+			i := row + x
+			left, above, aboveLeft := alpha[i-1], alpha[i-width], alpha[i-width-1]
+			switch filter {
+			case webpAlphaHorizontal:
+				alpha[i] += left
+			case webpAlphaVertical:
+				alpha[i] += above
+			case webpAlphaGradient:
+				alpha[i] += clampUint8(int(left) + int(above) - int(aboveLeft))
+			}
+		}
+	}
+}
+
+// MagicBytesSlice returns the magic bytes slice of WebP.
+// It is shared with the other RIFF formats such as WAVE, which are told apart by Validate.
+func (wp *WebP) MagicBytesSlice() [][]byte {
+	return [][]byte{[]byte("RIFF")}
+}
+
+// Validate returns whether the file is a RIFF container of the form type "WEBP", which follows the length of the RIFF chunk.
+func (wp *WebP) Validate(rs io.ReadSeeker) (bool, error) {
+	header := make([]byte, 12)
+	_, err := io.ReadFull(rs, header)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return string(header[:4]) == "RIFF" && string(header[8:]) == "WEBP", nil
+}
+
+// HasProcessableExtname returns whether the specified path has ".webp"
+func (wp *WebP) HasProcessableExtname(path string) bool {
+	return filepath.Ext(path) == ".webp"
+}
@@ -0,0 +1,437 @@
+package conversion
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func TestConversion_WebP_MagicBytesSlice(t *testing.T) {
+	t.Parallel()
+
+	expected := [][]byte{[]byte("RIFF")}
+
+	wp := WebP{}
+
+	actual := wp.MagicBytesSlice()
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf(`expected="%s" actual="%s"`, expected, actual)
+	}
+}
+
+func TestConversion_WebP_Validate(t *testing.T) {
+	cases := map[string]struct {
+		data     []byte
+		expected bool
+	}{
+		"WebP":  {data: []byte("RIFF\x04\x01\x00\x00WEBPVP8L"), expected: true},
+		"WAVE":  {data: []byte("RIFF\x04\x01\x00\x00WAVEfmt "), expected: false},
+		"short": {data: []byte("RIFF\x04\x01"), expected: false},
+		"?":     {data: []byte("????????WEBP"), expected: false},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			actual, err := (&WebP{}).Validate(bytes.NewReader(c.data))
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+			if actual != c.expected {
+				t.Errorf(`expected="%t" actual="%t"`, c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestConversion_WebP_HasProcessableExtname(t *testing.T) {
+	wp := WebP{}
+
+	cases := map[string]struct {
+		path     string
+		expected bool
+	}{
+		"foo.webp": {path: "foo.webp", expected: true},
+		"foo.jpg":  {path: "foo.jpg", expected: false},
+		"foo.png":  {path: "foo.png", expected: false},
+		"foo.gif":  {path: "foo.gif", expected: false},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			actual := wp.HasProcessableExtname(c.path)
+			if actual != c.expected {
+				t.Errorf(`expected="%t" actual="%t"`, c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestConversion_WebP_Decode_Lossless(t *testing.T) {
+	red := color.NRGBA{R: 0xFF, A: 0xFF}
+	blue := color.NRGBA{B: 0xFF, A: 0xFF}
+
+	cases := map[string]struct {
+		bits     []byte
+		expected [][]color.NRGBA
+	}{
+		"simple codes and subtract green": {
+			bits: vp8lBits(
+				1, 14, 0, 14, 1, 1, 0, 3, // 2x1 with alpha
+				1, 1, vp8lSubtractGreenTransform, 2, 0, 1, // subtract green transform
+				0, 1, 0, 1, // no color cache and no meta prefix codes
+				1, 1, 1, 1, 1, 1, 0x40, 8, 0x80, 8, // green: 0x40 or 0x80
+				1, 1, 1, 1, 1, 1, 0x10, 8, 0x20, 8, // red: 0x10 or 0x20
+				1, 1, 0, 1, 1, 1, 0x30, 8, // blue: 0x30
+				1, 1, 0, 1, 1, 1, 0xFF, 8, // alpha: 0xFF
+				1, 1, 0, 1, 0, 1, 0, 1, // distance: 0
+				0, 1, 1, 1, // 0x40, 0x20
+				1, 1, 0, 1, // 0x80, 0x10
+			),
+			expected: [][]color.NRGBA{{{R: 0x60, G: 0x40, B: 0x70, A: 0xFF}, {R: 0x90, G: 0x80, B: 0xB0, A: 0xFF}}},
+		},
+		"backward reference": {
+			bits: vp8lBits(
+				3, 14, 0, 14, 0, 1, 0, 3, // 4x1
+				0, 1, 0, 1, 0, 1, // no transform, no color cache and no meta prefix codes
+				// green: 0x40 or length code 258 by code lengths, which are coded by the code lengths of 1 and 18
+				0, 1, 0, 4, 0, 3, 1, 3, 0, 3, 1, 3, 0, 1,
+				1, 1, 53, 7, 0, 1, 1, 1, 127, 7, 1, 1, 44, 7, 0, 1, 1, 1, 10, 7,
+				1, 1, 0, 1, 1, 1, 0x11, 8, // red: 0x11
+				1, 1, 0, 1, 1, 1, 0x22, 8, // blue: 0x22
+				1, 1, 0, 1, 1, 1, 0xFF, 8, // alpha: 0xFF
+				1, 1, 0, 1, 0, 1, 1, 1, // distance: 1, which is the left pixel
+				0, 1, // 0x40
+				1, 1, // copy 3 pixels
+			),
+			expected: [][]color.NRGBA{{{R: 0x11, G: 0x40, B: 0x22, A: 0xFF}, {R: 0x11, G: 0x40, B: 0x22, A: 0xFF}, {R: 0x11, G: 0x40, B: 0x22, A: 0xFF}, {R: 0x11, G: 0x40, B: 0x22, A: 0xFF}}},
+		},
+		"color indexing": {
+			bits: vp8lBits(
+				2, 14, 0, 14, 0, 1, 0, 3, // 3x1
+				1, 1, vp8lColorIndexingTransform, 2, 1, 8, // 2 colors, so 8 pixels are bundled in one
+				// palette of red and blue, the latter coded as the difference from the former
+				0, 1,
+				1, 1, 0, 1, 0, 1, 0, 1, // green: 0
+				1, 1, 1, 1, 1, 1, 0x01, 8, 0xFF, 8, // red: 0x01 or 0xFF
+				1, 1, 1, 1, 1, 1, 0x00, 8, 0xFF, 8, // blue: 0x00 or 0xFF
+				1, 1, 1, 1, 1, 1, 0x00, 8, 0xFF, 8, // alpha: 0x00 or 0xFF
+				1, 1, 0, 1, 0, 1, 0, 1, // distance: 0
+				1, 1, 0, 1, 1, 1, // 0xFFFF0000
+				0, 1, 1, 1, 0, 1, // 0x000100FF
+				0, 1, 0, 1, 0, 1, // no more transform, no color cache and no meta prefix codes
+				1, 1, 0, 1, 1, 1, 5, 8, // green: indexes 1, 0 and 1
+				1, 1, 0, 1, 0, 1, 0, 1, // red: 0
+				1, 1, 0, 1, 0, 1, 0, 1, // blue: 0
+				1, 1, 0, 1, 0, 1, 0, 1, // alpha: 0
+				1, 1, 0, 1, 0, 1, 0, 1, // distance: 0
+			),
+			expected: [][]color.NRGBA{{blue, red, blue}},
+		},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			data := webpFile(webpChunk("VP8L", append([]byte{0x2F}, c.bits...)))
+
+			img, err := (&WebP{}).Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+
+			for y, row := range c.expected {
+				for x, expected := range row {
+					actual := img.At(x, y)
+					if actual != expected {
+						t.Errorf(`(%d, %d): expected="%v" actual="%v"`, x, y, expected, actual)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestConversion_WebP_Decode_Extended(t *testing.T) {
+	cases := map[string]struct {
+		width  int
+		height int
+	}{
+		"1x1":      {width: 1, height: 1},
+		"512x512":  {width: 512, height: 512},
+		"1024x256": {width: 1024, height: 256},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			// A single color image, whose prefix codes have only one symbol each so that no bits are read for the pixels
+			bits := vp8lBits(
+				c.width-1, 14, c.height-1, 14, 0, 1, 0, 3,
+				0, 1, 0, 1, 0, 1, // no transform, no color cache and no meta prefix codes
+				1, 1, 0, 1, 1, 1, 0x40, 8, // green: 0x40
+				1, 1, 0, 1, 1, 1, 0x11, 8, // red: 0x11
+				1, 1, 0, 1, 1, 1, 0x22, 8, // blue: 0x22
+				1, 1, 0, 1, 1, 1, 0xFF, 8, // alpha: 0xFF
+				1, 1, 0, 1, 0, 1, 0, 1, // distance: 0
+			)
+			w, h := c.width-1, c.height-1
+			vp8x := []byte{0, 0, 0, 0, byte(w), byte(w >> 8), byte(w >> 16), byte(h), byte(h >> 8), byte(h >> 16)}
+			data := webpFile(webpChunk("VP8X", vp8x), webpChunk("VP8L", append([]byte{0x2F}, bits...)))
+
+			img, err := (&WebP{}).Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+
+			expected := image.Rect(0, 0, c.width, c.height)
+			if img.Bounds() != expected {
+				t.Errorf(`expected="%s" actual="%s"`, expected, img.Bounds())
+			}
+		})
+	}
+}
+
+func TestConversion_WebP_Decode_Lossy(t *testing.T) {
+	gray := vp8GrayFrame(2, 2)
+	vp8x := []byte{0x10, 0, 0, 0, 1, 0, 0, 1, 0, 0}
+
+	cases := map[string]struct {
+		data     []byte
+		expected []uint8
+	}{
+		"without alpha": {
+			data:     webpFile(webpChunk("VP8 ", gray)),
+			expected: nil,
+		},
+		"with alpha filtered horizontally": {
+			data:     webpFile(webpChunk("VP8X", vp8x), webpChunk("ALPH", []byte{webpAlphaHorizontal << 2, 10, 5, 20, 1}), webpChunk("VP8 ", gray)),
+			expected: []uint8{10, 15, 30, 31},
+		},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			img, err := (&WebP{}).Decode(bytes.NewReader(c.data))
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+
+			var ycbcr *image.YCbCr
+			switch img := img.(type) {
+			case *image.YCbCr:
+				ycbcr = img
+			case *image.NYCbCrA:
+				ycbcr = &img.YCbCr
+				if !reflect.DeepEqual(img.A, c.expected) {
+					t.Errorf(`expected="%v" actual="%v"`, c.expected, img.A)
+				}
+			}
+
+			if ycbcr.Rect != image.Rect(0, 0, 2, 2) {
+				t.Fatalf(`expected="%s" actual="%s"`, image.Rect(0, 0, 2, 2), ycbcr.Rect)
+			}
+			for y := 0; y < 2; y++ {
+				for x := 0; x < 2; x++ {
+					expected := color.YCbCr{Y: 128, Cb: 128, Cr: 128}
+					actual := ycbcr.YCbCrAt(x, y)
+					if actual != expected {
+						t.Errorf(`(%d, %d): expected="%v" actual="%v"`, x, y, expected, actual)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestConversion_WebP_Decode_Failure(t *testing.T) {
+	cases := map[string]struct {
+		data     []byte
+		expected string
+	}{
+		"not WebP":          {data: []byte("RIFF\x04\x00\x00\x00WAVE"), expected: "webp: invalid format"},
+		"no image":          {data: webpFile(webpChunk("EXIF", []byte{0})), expected: "unexpected EOF"},
+		"truncated chunk":   {data: webpFile(webpChunk("VP8 ", vp8GrayFrame(2, 2)))[:20], expected: "unexpected EOF"},
+		"animated":          {data: webpFile(webpChunk("VP8X", []byte{webpAnimationFlag, 0, 0, 0, 0, 0, 0, 0, 0, 0})), expected: "webp: unsupported format"},
+		"inter frame":       {data: webpFile(webpChunk("VP8 ", []byte{1, 0, 0, 0x9D, 0x01, 0x2A, 1, 0, 1, 0})), expected: "webp: invalid format"},
+		"canvas size":       {data: webpFile(webpChunk("VP8X", []byte{0, 0, 0, 0, 2, 0, 0, 2, 0, 0}), webpChunk("VP8 ", vp8GrayFrame(2, 2))), expected: "webp: invalid format"},
+		"lossless version":  {data: webpFile(webpChunk("VP8L", append([]byte{0x2F}, vp8lBits(0, 14, 0, 14, 0, 1, 1, 3)...))), expected: "webp: unsupported format"},
+		"empty prefix code": {data: webpFile(webpChunk("VP8L", append([]byte{0x2F}, vp8lBits(0, 14, 0, 14, 0, 1, 0, 3, 0, 1, 0, 1, 0, 1, 0, 1, 0, 4, 0, 12)...))), expected: "webp: invalid format"},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := (&WebP{}).Decode(bytes.NewReader(c.data))
+
+			actual := err.Error()
+			if actual != c.expected {
+				t.Errorf(`expected="%s" actual="%s"`, c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestConversion_webpUnfilterAlpha(t *testing.T) {
+	filtered := []uint8{10, 5, 1, 20, 3, 255}
+
+	cases := map[string]struct {
+		filter   uint8
+		expected []uint8
+	}{
+		"horizontal": {filter: webpAlphaHorizontal, expected: []uint8{10, 15, 16, 30, 33, 32}},
+		"vertical":   {filter: webpAlphaVertical, expected: []uint8{10, 15, 16, 30, 18, 15}},
+		"gradient":   {filter: webpAlphaGradient, expected: []uint8{10, 15, 16, 30, 38, 38}},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			actual := append([]uint8{}, filtered...)
+			webpUnfilterAlpha(actual, 3, 2, c.filter)
+			if !reflect.DeepEqual(actual, c.expected) {
+				t.Errorf(`expected="%v" actual="%v"`, c.expected, actual)
+			}
+		})
+	}
+}
+
+func webpFile(chunks ...[]byte) []byte {
+	data := []byte("RIFF\x00\x00\x00\x00WEBP")
+	for _, chunk := range chunks {
+		data = append(data, chunk...)
+	}
+	binary.LittleEndian.PutUint32(data[4:], uint32(len(data)-8))
+	return data
+}
+
+func webpChunk(fourCC string, payload []byte) []byte {
+	chunk := make([]byte, 8, 8+len(payload)+1)
+	copy(chunk, fourCC)
+	binary.LittleEndian.PutUint32(chunk[4:], uint32(len(payload)))
+	chunk = append(chunk, payload...)
+	if len(payload)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+// vp8lBits packs pairs of a value and its number of bits from the least significant bit.
+func vp8lBits(pairs ...int) []byte {
+	var data []byte
+	n := 0
+	for i := 0; i < len(pairs); i += 2 {
+		for b := 0; b < pairs[i+1]; b++ {
+			if n%8 == 0 {
+				data = append(data, 0)
+			}
+			data[n/8] |= byte(pairs[i]>>uint(b)&1) << uint(n%8)
+			n++
+		}
+	}
+	return data
+}
+
+// vp8GrayFrame builds a key frame whose macroblocks are skipped and predicted by DC, which is 128 without neighbors.
+// Only the first macroblock is coded, so it must be within 16x16.
+func vp8GrayFrame(width int, height int) []byte {
+	e := &vp8BoolEncoder{rng: 255, bitCount: 24}
+	e.writeLiteral(0, 2)   // color space and clamping type
+	e.writeLiteral(0, 1)   // no segmentation
+	e.writeLiteral(0, 10)  // normal loop filter of level 0 and sharpness 0
+	e.writeLiteral(0, 1)   // no loop filter deltas
+	e.writeLiteral(0, 2)   // 1 token partition
+	e.writeLiteral(0, 7+5) // quantizer index 0 without deltas
+	e.writeLiteral(0, 1)   // refresh entropy probs
+	for i := range vp8CoeffUpdateProbs {
+		for j := range vp8CoeffUpdateProbs[i] {
+			for k := range vp8CoeffUpdateProbs[i][j] {
+				for _, p := range vp8CoeffUpdateProbs[i][j][k] {
+					e.writeBool(p, false)
+				}
+			}
+		}
+	}
+	e.writeLiteral(1, 1)   // skip enabled
+	e.writeLiteral(128, 8) // skip probability
+	e.writeBool(128, true) // skip
+	e.writeBool(vp8KeyFrameYModeProbs[0], true)
+	e.writeBool(vp8KeyFrameYModeProbs[1], false)
+	e.writeBool(vp8KeyFrameYModeProbs[2], false)  // DC_PRED
+	e.writeBool(vp8KeyFrameUVModeProbs[0], false) // DC_PRED
+	first := e.flush()
+
+	tag := len(first)<<5 | 1<<4
+	data := []byte{byte(tag), byte(tag >> 8), byte(tag >> 16), 0x9D, 0x01, 0x2A, 0, 0, 0, 0}
+	binary.LittleEndian.PutUint16(data[6:], uint16(width))
+	binary.LittleEndian.PutUint16(data[8:], uint16(height))
+	return append(data, first...)
+}
+
+// vp8BoolEncoder is the boolean entropy encoder of RFC 6386 section 7.3.
+type vp8BoolEncoder struct {
+	out      []byte
+	rng      uint32
+	bottom   uint32
+	bitCount int
+}
+
+func (e *vp8BoolEncoder) writeBool(prob uint8, b bool) {
+	split := 1 + (e.rng-1)*uint32(prob)>>8
+	if b {
+		e.bottom += split
+		e.rng -= split
+	} else {
+		e.rng = split
+	}
+
+	for e.rng < 128 {
+		e.rng <<= 1
+		if e.bottom&(1<<31) != 0 {
+			i := len(e.out) - 1
+			for ; e.out[i] == 0xFF; i-- {
+				e.out[i] = 0
+			}
+			e.out[i]++
+		}
+		e.bottom <<= 1
+		e.bitCount--
+		if e.bitCount == 0 {
+			e.out = append(e.out, byte(e.bottom>>24))
+			e.bottom &= 1<<24 - 1
+			e.bitCount = 8
+		}
+	}
+}
+
+func (e *vp8BoolEncoder) writeLiteral(v int, n int) {
+	for i := n - 1; i >= 0; i-- {
+		e.writeBool(128, v>>uint(i)&1 == 1)
+	}
+}
+
+func (e *vp8BoolEncoder) flush() []byte {
+	for i := 0; i < 32; i++ {
+		e.writeBool(128, false)
+	}
+	return e.out
+}
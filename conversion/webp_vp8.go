@@ -0,0 +1,1140 @@
+package conversion
+
+import (
+	"image"
+	"io"
+)
+
+// VP8 is the lossy bitstream of WebP, decoded as a key frame of RFC 6386.
+
+// vp8BoolDecoder is the boolean entropy decoder of RFC 6386 section 7.
+type vp8BoolDecoder struct {
+	data     []byte
+	pos      int
+	value    uint32
+	rng      uint32
+	bitCount int
+}
+
+func newVP8BoolDecoder(data []byte) *vp8BoolDecoder {
+	d := &vp8BoolDecoder{data: data, rng: 255}
+	d.value = uint32(d.nextByte())<<8 | uint32(d.nextByte())
+	return d
+}
+
+// nextByte returns the next byte, or 0 past the end of the data.
+func (d *vp8BoolDecoder) nextByte() byte {
+	d.pos++
+	if d.pos > len(d.data) {
+		return 0
+	}
+	return d.data[d.pos-1]
+}
+
+// overrun returns whether bits past the end of the data have been consumed.
+// The decoder always holds two bytes ahead.
+func (d *vp8BoolDecoder) overrun() bool {
+	return d.pos > len(d.data)+2
+}
+
+func (d *vp8BoolDecoder) readBool(prob uint8) bool {
+	split := 1 + (d.rng-1)*uint32(prob)>>8
+	bigSplit := split << 8
+
+	var b bool
+	if d.value >= bigSplit {
+		b = true
+		d.rng -= split
+		d.value -= bigSplit
+	} else {
+		d.rng = split
+	}
+
+	for d.rng < 128 {
+		d.value <<= 1
+		d.rng <<= 1
+		d.bitCount++
+		if d.bitCount == 8 {
+			d.bitCount = 0
+			d.value |= uint32(d.nextByte())
+		}
+	}
+	return b
+}
+
+func (d *vp8BoolDecoder) readBit(prob uint8) int {
+	if d.readBool(prob) {
+		return 1
+	}
+	return 0
+}
+
+func (d *vp8BoolDecoder) readFlag() bool {
+	return d.readBool(128)
+}
+
+func (d *vp8BoolDecoder) readLiteral(n int) int {
+	v := 0
+	for i := 0; i < n; i++ {
+		v = v<<1 | d.readBit(128)
+	}
+	return v
+}
+
+// readDelta reads an optional signed value of n bits, which is 0 when absent.
+func (d *vp8BoolDecoder) readDelta(n int) int {
+	if !d.readFlag() {
+		return 0
+	}
+	v := d.readLiteral(n)
+	if d.readFlag() {
+		return -v
+	}
+	return v
+}
+
+func (d *vp8BoolDecoder) readTree(tree []int8, probs []uint8) int {
+	i := 0
+	for {
+		i = int(tree[i+d.readBit(probs[i>>1])])
+		if i <= 0 {
+			return -i
+		}
+	}
+}
+
+// readCoefficients reads the coefficients of a 4x4 block from the position n into out in raster order, dequantizing them.
+// It returns the position following the last non-zero coefficient.
+func (d *vp8BoolDecoder) readCoefficients(probs *[8][3][11]uint8, ctx int, n int, dq [2]int32, out []int32) int {
+	p := &probs[vp8CoeffBands[n]][ctx]
+	for ; n < 16; n++ {
+		if !d.readBool(p[0]) {
+			return n
+		}
+		for !d.readBool(p[1]) {
+			n++
+			if n == 16 {
+				return 16
+			}
+			p = &probs[vp8CoeffBands[n]][0]
+		}
+
+		var v int32
+		if !d.readBool(p[2]) {
+			v = 1
+			p = &probs[vp8CoeffBands[n+1]][1]
+		} else {
+			v = d.readLargeValue(p)
+			p = &probs[vp8CoeffBands[n+1]][2]
+		}
+		if d.readFlag() {
+			v = -v
+		}
+
+		q := dq[1]
+		if n == 0 {
+			q = dq[0]
+		}
+		out[vp8Zigzag[n]] = v * q
+	}
+	return 16
+}
+
+// readLargeValue reads the coefficient greater than 1 following the token tree of RFC 6386 section 13.2.
+func (d *vp8BoolDecoder) readLargeValue(p *[11]uint8) int32 {
+	if !d.readBool(p[3]) {
+		if !d.readBool(p[4]) {
+			return 2
+		}
+		return 3 + int32(d.readBit(p[5]))
+	}
+	if !d.readBool(p[6]) {
+		if !d.readBool(p[7]) {
+			return 5 + int32(d.readBit(159))
+		}
+		return 7 + 2*int32(d.readBit(165)) + int32(d.readBit(145))
+	}
+
+	var probs []uint8
+	var base int32
+	b1 := d.readBit(p[8])
+	b0 := d.readBit(p[9+b1])
+	switch 2*b1 + b0 {
+	case 0:
+		probs, base = vp8Cat3Probs, 11
+	case 1:
+		probs, base = vp8Cat4Probs, 19
+	case 2:
+		probs, base = vp8Cat5Probs, 35
+	default:
+		probs, base = vp8Cat6Probs, 67
+	}
+	var v int32
+	for _, prob := range probs {
+		v = v<<1 | int32(d.readBit(prob))
+	}
+	return base + v
+}
+
+// vp8Quant has the dequantization factors of DC and AC.
+type vp8Quant struct {
+	y1, y2, uv [2]int32
+}
+
+// vp8Filter is the loop filter parameters of a macroblock.
+type vp8Filter struct {
+	limit     int // 0 means no filtering
+	ilimit    int
+	hevThresh int
+	inner     bool
+}
+
+type vp8Decoder struct {
+	width, height int
+	mbw, mbh      int
+
+	first  *vp8BoolDecoder
+	tokens []*vp8BoolDecoder
+
+	segmentEnabled  bool
+	updateMap       bool
+	segmentAbsolute bool
+	segmentQuant    [4]int
+	segmentFilter   [4]int
+	segmentProbs    [3]uint8
+
+	filterSimple  bool
+	filterLevel   int
+	sharpness     int
+	deltaEnabled  bool
+	refDelta      int // the delta of the intra frame
+	bPredDelta    int // the delta of the B_PRED mode
+	quants        [4]vp8Quant
+	coeffProbs    [4][8][3][11]uint8
+	skipEnabled   bool
+	skipProb      uint8
+	filterOfModes [4][2]vp8Filter // by segment and whether the mode is B_PRED
+
+	// Contexts of the subblock modes and the non-zero flags of the neighbors.
+	// The flags are 4 of Y, 2 of U, 2 of V and 1 of Y2.
+	aboveBModes []uint8
+	leftBModes  [4]uint8
+	aboveNz     []uint8
+	leftNz      [9]uint8
+
+	y, cb, cr        []uint8
+	yStride, cStride int
+	filters          []vp8Filter
+}
+
+// decodeVP8 decodes the VP8 bitstream to *image.YCbCr.
+func decodeVP8(data []byte) (*image.YCbCr, error) {
+	if len(data) < 10 {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	tag := int(data[0]) | int(data[1])<<8 | int(data[2])<<16
+	if tag&1 != 0 {
+		// Only key frames are valid in WebP.
+		return nil, errWebPInvalid
+	}
+	if data[3] != 0x9d || data[4] != 0x01 || data[5] != 0x2a {
+		return nil, errWebPInvalid
+	}
+	firstLen := tag >> 5
+
+	d := &vp8Decoder{
+		width:  int(data[6]) | int(data[7]&0x3f)<<8,
+		height: int(data[8]) | int(data[9]&0x3f)<<8,
+	}
+	if d.width == 0 || d.height == 0 {
+		return nil, errWebPInvalid
+	}
+	d.mbw, d.mbh = (d.width+15)/16, (d.height+15)/16
+
+	data = data[10:]
+	if len(data) < firstLen {
+		return nil, io.ErrUnexpectedEOF
+	}
+	d.first = newVP8BoolDecoder(data[:firstLen])
+
+	if err := d.readHeader(data[firstLen:]); err != nil {
+		return nil, err
+	}
+
+	d.yStride, d.cStride = 16*d.mbw, 8*d.mbw
+	d.y = make([]uint8, d.yStride*16*d.mbh)
+	d.cb = make([]uint8, d.cStride*8*d.mbh)
+	d.cr = make([]uint8, d.cStride*8*d.mbh)
+	d.filters = make([]vp8Filter, d.mbw*d.mbh)
+	d.aboveBModes = make([]uint8, 4*d.mbw)
+	d.aboveNz = make([]uint8, 9*d.mbw)
+
+	for mby := 0; mby < d.mbh; mby++ {
+		d.leftBModes = [4]uint8{}
+		d.leftNz = [9]uint8{}
+		tokens := d.tokens[mby%len(d.tokens)]
+		for mbx := 0; mbx < d.mbw; mbx++ {
+			d.decodeMacroblock(mbx, mby, tokens)
+		}
+	}
+
+	if d.first.overrun() {
+		return nil, io.ErrUnexpectedEOF
+	}
+	for _, t := range d.tokens {
+		if t.overrun() {
+			return nil, io.ErrUnexpectedEOF
+		}
+	}
+
+	if d.filterLevel != 0 {
+		d.loopFilter()
+	}
+
+	return &image.YCbCr{
+		Y:              d.y,
+		Cb:             d.cb,
+		Cr:             d.cr,
+		YStride:        d.yStride,
+		CStride:        d.cStride,
+		SubsampleRatio: image.YCbCrSubsampleRatio420,
+		Rect:           image.Rect(0, 0, d.width, d.height),
+	}, nil
+}
+
+// readHeader reads the frame header in the first partition and sets up the token partitions following it.
+func (d *vp8Decoder) readHeader(rest []byte) error {
+	br := d.first
+
+	br.readLiteral(2) // color space and clamping type
+
+	d.segmentEnabled = br.readFlag()
+	if d.segmentEnabled {
+		d.updateMap = br.readFlag()
+		if br.readFlag() {
+			d.segmentAbsolute = br.readFlag()
+			for i := range d.segmentQuant {
+				d.segmentQuant[i] = br.readDelta(7)
+			}
+			for i := range d.segmentFilter {
+				d.segmentFilter[i] = br.readDelta(6)
+			}
+		}
+		if d.updateMap {
+			for i := range d.segmentProbs {
+				d.segmentProbs[i] = 255
+				if br.readFlag() {
+					d.segmentProbs[i] = uint8(br.readLiteral(8))
+				}
+			}
+		}
+	}
+
+	d.filterSimple = br.readFlag()
+	d.filterLevel = br.readLiteral(6)
+	d.sharpness = br.readLiteral(3)
+	d.deltaEnabled = br.readFlag()
+	if d.deltaEnabled && br.readFlag() {
+		var refDeltas, modeDeltas [4]int
+		for i := range refDeltas {
+			refDeltas[i] = br.readDelta(6)
+		}
+		for i := range modeDeltas {
+			modeDeltas[i] = br.readDelta(6)
+		}
+		d.refDelta, d.bPredDelta = refDeltas[0], modeDeltas[0]
+	}
+
+	numPartitions := 1 << uint(br.readLiteral(2))
+	sizesLen := 3 * (numPartitions - 1)
+	if len(rest) < sizesLen {
+		return io.ErrUnexpectedEOF
+	}
+	partitions := rest[sizesLen:]
+	d.tokens = make([]*vp8BoolDecoder, numPartitions)
+	for i := 0; i < numPartitions-1; i++ {
+		size := int(rest[3*i]) | int(rest[3*i+1])<<8 | int(rest[3*i+2])<<16
+		if len(partitions) < size {
+			return io.ErrUnexpectedEOF
+		}
+		d.tokens[i] = newVP8BoolDecoder(partitions[:size])
+		partitions = partitions[size:]
+	}
+	d.tokens[numPartitions-1] = newVP8BoolDecoder(partitions)
+
+	base := br.readLiteral(7)
+	ydc, y2dc, y2ac, uvdc, uvac := br.readDelta(4), br.readDelta(4), br.readDelta(4), br.readDelta(4), br.readDelta(4)
+	for s := range d.quants {
+		q := base
+		if d.segmentEnabled {
+			if d.segmentAbsolute {
+				q = d.segmentQuant[s]
+			} else {
+				q += d.segmentQuant[s]
+			}
+		}
+
+		quant := &d.quants[s]
+		quant.y1 = [2]int32{vp8DCQuant[clampQuantIndex(q+ydc)], vp8ACQuant[clampQuantIndex(q)]}
+		quant.y2 = [2]int32{2 * vp8DCQuant[clampQuantIndex(q+y2dc)], vp8ACQuant[clampQuantIndex(q+y2ac)] * 155 / 100}
+		if quant.y2[1] < 8 {
+			quant.y2[1] = 8
+		}
+		quant.uv = [2]int32{vp8DCQuant[clampQuantIndex(q+uvdc)], vp8ACQuant[clampQuantIndex(q+uvac)]}
+		if quant.uv[0] > 132 {
+			quant.uv[0] = 132
+		}
+	}
+
+	br.readFlag() // refresh entropy probs
+
+	d.coeffProbs = vp8DefaultCoeffProbs
+	for i := range d.coeffProbs {
+		for j := range d.coeffProbs[i] {
+			for k := range d.coeffProbs[i][j] {
+				for l := range d.coeffProbs[i][j][k] {
+					if br.readBool(vp8CoeffUpdateProbs[i][j][k][l]) {
+						d.coeffProbs[i][j][k][l] = uint8(br.readLiteral(8))
+					}
+				}
+			}
+		}
+	}
+
+	d.skipEnabled = br.readFlag()
+	if d.skipEnabled {
+		d.skipProb = uint8(br.readLiteral(8))
+	}
+
+	d.setUpFilters()
+
+	return nil
+}
+
+func clampQuantIndex(q int) int {
+	switch {
+	case q < 0:
+		return 0
+	case q > 127:
+		return 127
+	}
+	return q
+}
+
+// setUpFilters computes the loop filter parameters of each segment and mode following RFC 6386 section 15.
+func (d *vp8Decoder) setUpFilters() {
+	for s := range d.filterOfModes {
+		base := d.filterLevel
+		if d.segmentEnabled {
+			if d.segmentAbsolute {
+				base = d.segmentFilter[s]
+			} else {
+				base += d.segmentFilter[s]
+			}
+		}
+
+		for bPred := 0; bPred < 2; bPred++ {
+			level := base
+			if d.deltaEnabled {
+				level += d.refDelta
+				if bPred == 1 {
+					level += d.bPredDelta
+				}
+			}
+			switch {
+			case level < 0:
+				level = 0
+			case level > 63:
+				level = 63
+			}
+
+			f := &d.filterOfModes[s][bPred]
+			f.inner = bPred == 1
+			if level == 0 {
+				continue
+			}
+
+			ilimit := level
+			if d.sharpness > 0 {
+				if d.sharpness > 4 {
+					ilimit >>= 2
+				} else {
+					ilimit >>= 1
+				}
+				if ilimit > 9-d.sharpness {
+					ilimit = 9 - d.sharpness
+				}
+			}
+			if ilimit < 1 {
+				ilimit = 1
+			}
+
+			f.ilimit = ilimit
+			f.limit = 2*level + ilimit
+			switch {
+			case level >= 40:
+				f.hevThresh = 2
+			case level >= 15:
+				f.hevThresh = 1
+			}
+		}
+	}
+}
+
+func (d *vp8Decoder) decodeMacroblock(mbx int, mby int, tokens *vp8BoolDecoder) {
+	br := d.first
+
+	segment := 0
+	if d.updateMap {
+		segment = br.readTree(vp8SegmentTree, d.segmentProbs[:])
+	}
+	skip := d.skipEnabled && br.readBool(d.skipProb)
+
+	var bmodes [16]uint8
+	ymode := br.readTree(vp8KeyFrameYModeTree, vp8KeyFrameYModeProbs)
+	if ymode == vp8BPred {
+		for y := 0; y < 4; y++ {
+			left := d.leftBModes[y]
+			for x := 0; x < 4; x++ {
+				above := d.aboveBModes[4*mbx+x]
+				m := uint8(br.readTree(vp8BModeTree, vp8KeyFrameBModeProbs[above][left][:]))
+				bmodes[4*y+x] = m
+				d.aboveBModes[4*mbx+x] = m
+				left = m
+			}
+			d.leftBModes[y] = left
+		}
+	} else {
+		implied := vp8ImpliedBModes[ymode]
+		for i := 0; i < 4; i++ {
+			d.aboveBModes[4*mbx+i] = implied
+			d.leftBModes[i] = implied
+		}
+	}
+	uvmode := br.readTree(vp8UVModeTree, vp8KeyFrameUVModeProbs)
+
+	// Coefficients of 16 Y, 4 U, 4 V and Y2 blocks
+	var coeffs [25 * 16]int32
+	hasY2 := ymode != vp8BPred
+	nonZero := false
+	if skip {
+		above := d.aboveNz[9*mbx : 9*mbx+9]
+		for i := 0; i < 8; i++ {
+			above[i], d.leftNz[i] = 0, 0
+		}
+		if hasY2 {
+			above[8], d.leftNz[8] = 0, 0
+		}
+	} else {
+		nonZero = d.readResiduals(tokens, mbx, hasY2, &d.quants[segment], &coeffs)
+	}
+
+	d.reconstruct(mbx, mby, ymode, &bmodes, uvmode, &coeffs)
+
+	f := d.filterOfModes[segment][0]
+	if !hasY2 {
+		f = d.filterOfModes[segment][1]
+	}
+	f.inner = f.inner || nonZero
+	d.filters[mby*d.mbw+mbx] = f
+}
+
+// readResiduals reads the coefficients of the macroblock and returns whether any of them is non-zero.
+func (d *vp8Decoder) readResiduals(br *vp8BoolDecoder, mbx int, hasY2 bool, q *vp8Quant, coeffs *[25 * 16]int32) bool {
+	above := d.aboveNz[9*mbx : 9*mbx+9]
+	left := &d.leftNz
+	nonZero := false
+
+	first, ytype := 0, vp8TypeYWithDC
+	if hasY2 {
+		n := br.readCoefficients(&d.coeffProbs[vp8TypeY2], int(above[8]+left[8]), 0, q.y2, coeffs[24*16:])
+		nz := boolToUint8(n > 0)
+		above[8], left[8] = nz, nz
+		nonZero = n > 0
+		vp8InverseWHT(coeffs[24*16:], coeffs[:])
+		first, ytype = 1, vp8TypeYAfterY2
+	}
+
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			n := br.readCoefficients(&d.coeffProbs[ytype], int(above[x]+left[y]), first, q.y1, coeffs[16*(4*y+x):])
+			nz := boolToUint8(n > first)
+			above[x], left[y] = nz, nz
+			nonZero = nonZero || n > first
+		}
+	}
+
+	// U blocks follow Y blocks and V blocks follow U blocks.
+	for c := 0; c < 2; c++ {
+		for y := 0; y < 2; y++ {
+			for x := 0; x < 2; x++ {
+				a, l := 4+2*c+x, 4+2*c+y
+				n := br.readCoefficients(&d.coeffProbs[vp8TypeChroma], int(above[a]+left[l]), 0, q.uv, coeffs[16*(16+4*c+2*y+x):])
+				nz := boolToUint8(n > 0)
+				above[a], left[l] = nz, nz
+				nonZero = nonZero || n > 0
+			}
+		}
+	}
+
+	return nonZero
+}
+
+func boolToUint8(b bool) uint8 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// vp8InverseWHT transforms the Y2 block in and sets the DC coefficients of the 16 Y blocks in out.
+func vp8InverseWHT(in []int32, out []int32) {
+	var tmp [16]int32
+	for i := 0; i < 4; i++ {
+		a1 := in[i] + in[12+i]
+		b1 := in[4+i] + in[8+i]
+		c1 := in[4+i] - in[8+i]
+		d1 := in[i] - in[12+i]
+		tmp[i] = a1 + b1
+		tmp[4+i] = c1 + d1
+		tmp[8+i] = a1 - b1
+		tmp[12+i] = d1 - c1
+	}
+	for i := 0; i < 4; i++ {
+		a1 := tmp[4*i] + tmp[4*i+3]
+		b1 := tmp[4*i+1] + tmp[4*i+2]
+		c1 := tmp[4*i+1] - tmp[4*i+2]
+		d1 := tmp[4*i] - tmp[4*i+3]
+		out[16*(4*i)] = (a1 + b1 + 3) >> 3
+		out[16*(4*i+1)] = (c1 + d1 + 3) >> 3
+		out[16*(4*i+2)] = (a1 - b1 + 3) >> 3
+		out[16*(4*i+3)] = (d1 - c1 + 3) >> 3
+	}
+}
+
+// vp8InverseDCT transforms the block in and adds it to the 4x4 pixels at dst.
+func vp8InverseDCT(in []int32, dst []uint8, stride int) {
+	const (
+		c1 = 20091 // cos(pi/8)*sqrt(2)-1
+		s1 = 35468 // sin(pi/8)*sqrt(2)
+	)
+
+	var tmp [16]int32
+	for i := 0; i < 4; i++ {
+		a := in[i] + in[8+i]
+		b := in[i] - in[8+i]
+		c := (in[4+i] * s1 >> 16) - (in[12+i] + (in[12+i] * c1 >> 16))
+		d := (in[4+i] + (in[4+i] * c1 >> 16)) + (in[12+i] * s1 >> 16)
+		tmp[i] = a + d
+		tmp[12+i] = a - d
+		tmp[4+i] = b + c
+		tmp[8+i] = b - c
+	}
+	for i := 0; i < 4; i++ {
+		t := tmp[4*i : 4*i+4]
+		a := t[0] + t[2]
+		b := t[0] - t[2]
+		c := (t[1] * s1 >> 16) - (t[3] + (t[3] * c1 >> 16))
+		d := (t[1] + (t[1] * c1 >> 16)) + (t[3] * s1 >> 16)
+		row := dst[i*stride : i*stride+4]
+		row[0] = clampUint8(int(row[0]) + int((a+d+4)>>3))
+		row[3] = clampUint8(int(row[3]) + int((a-d+4)>>3))
+		row[1] = clampUint8(int(row[1]) + int((b+c+4)>>3))
+		row[2] = clampUint8(int(row[2]) + int((b-c+4)>>3))
+	}
+}
+
+func clampUint8(v int) uint8 {
+	switch {
+	case v < 0:
+		return 0
+	case v > 255:
+		return 255
+	}
+	return uint8(v)
+}
+
+// Strides of the workspaces of a macroblock, which have the left column, the above row and, for Y, the above right pixels.
+const (
+	vp8YWorkStride = 1 + 16 + 4
+	vp8CWorkStride = 1 + 8
+)
+
+// reconstruct predicts the macroblock and adds the residuals to it.
+func (d *vp8Decoder) reconstruct(mbx int, mby int, ymode int, bmodes *[16]uint8, uvmode int, coeffs *[25 * 16]int32) {
+	var yws [vp8YWorkStride * 17]uint8
+	d.loadWorkspace(yws[:], vp8YWorkStride, d.y, d.yStride, 16, mbx, mby)
+
+	// Above right pixels of the rightmost subblocks below the top row are the same as the top row's.
+	aboveRight := yws[1+16 : 1+16+4]
+	switch {
+	case mby == 0:
+		aboveRight[0], aboveRight[1], aboveRight[2], aboveRight[3] = 127, 127, 127, 127
+	case mbx == d.mbw-1:
+		v := d.y[(16*mby-1)*d.yStride+16*mbx+15]
+		aboveRight[0], aboveRight[1], aboveRight[2], aboveRight[3] = v, v, v, v
+	default:
+		copy(aboveRight, d.y[(16*mby-1)*d.yStride+16*mbx+16:])
+	}
+	for y := 4; y < 16; y += 4 {
+		copy(yws[y*vp8YWorkStride+1+16:], aboveRight)
+	}
+
+	if ymode == vp8BPred {
+		for i := 0; i < 16; i++ {
+			origin := (1+4*(i/4))*vp8YWorkStride + 1 + 4*(i%4)
+			vp8PredictSubblock(yws[:], origin, vp8YWorkStride, bmodes[i])
+			vp8InverseDCT(coeffs[16*i:], yws[origin:], vp8YWorkStride)
+		}
+	} else {
+		vp8PredictBlock(yws[:], vp8YWorkStride, 16, ymode, mbx, mby)
+		for i := 0; i < 16; i++ {
+			origin := (1+4*(i/4))*vp8YWorkStride + 1 + 4*(i%4)
+			vp8InverseDCT(coeffs[16*i:], yws[origin:], vp8YWorkStride)
+		}
+	}
+	d.storeWorkspace(yws[:], vp8YWorkStride, d.y, d.yStride, 16, mbx, mby)
+
+	for c, plane := range [][]uint8{d.cb, d.cr} {
+		var cws [vp8CWorkStride * 9]uint8
+		d.loadWorkspace(cws[:], vp8CWorkStride, plane, d.cStride, 8, mbx, mby)
+		vp8PredictBlock(cws[:], vp8CWorkStride, 8, uvmode, mbx, mby)
+		for i := 0; i < 4; i++ {
+			origin := (1+4*(i/2))*vp8CWorkStride + 1 + 4*(i%2)
+			vp8InverseDCT(coeffs[16*(16+4*c+i):], cws[origin:], vp8CWorkStride)
+		}
+		d.storeWorkspace(cws[:], vp8CWorkStride, plane, d.cStride, 8, mbx, mby)
+	}
+}
+
+// loadWorkspace copies the pixels surrounding the block of size n into the workspace.
+// Outside of the frame, the above row is 127 and the left column is 129.
+func (d *vp8Decoder) loadWorkspace(ws []uint8, wsStride int, plane []uint8, stride int, n int, mbx int, mby int) {
+	x0, y0 := n*mbx, n*mby
+
+	switch {
+	case mby == 0:
+		ws[0] = 127
+	case mbx == 0:
+		ws[0] = 129
+	default:
+		ws[0] = plane[(y0-1)*stride+x0-1]
+	}
+
+	for i := 0; i < n; i++ {
+		if mby == 0 {
+			ws[1+i] = 127
+		} else {
+			ws[1+i] = plane[(y0-1)*stride+x0+i]
+		}
+		if mbx == 0 {
+			ws[(1+i)*wsStride] = 129
+		} else {
+			ws[(1+i)*wsStride] = plane[(y0+i)*stride+x0-1]
+		}
+	}
+}
+
+func (d *vp8Decoder) storeWorkspace(ws []uint8, wsStride int, plane []uint8, stride int, n int, mbx int, mby int) {
+	for i := 0; i < n; i++ {
+		copy(plane[(n*mby+i)*stride+n*mbx:], ws[(1+i)*wsStride+1:(1+i)*wsStride+1+n])
+	}
+}
+
+// vp8PredictBlock predicts the whole block of size n in the workspace.
+// DC prediction uses only the neighbors inside the frame.
+func vp8PredictBlock(ws []uint8, stride int, n int, mode int, mbx int, mby int) {
+	origin := stride + 1
+	switch mode {
+	case vp8DCPred:
+		sum, count := 0, 0
+		if mby > 0 {
+			for i := 0; i < n; i++ {
+				sum += int(ws[1+i])
+			}
+			count += n
+		}
+		if mbx > 0 {
+			for i := 0; i < n; i++ {
+				sum += int(ws[(1+i)*stride])
+			}
+			count += n
+		}
+		dc := uint8(128)
+		if count > 0 {
+			dc = uint8((sum + count/2) / count)
+		}
+		for y := 0; y < n; y++ {
+			for x := 0; x < n; x++ {
+				ws[origin+y*stride+x] = dc
+			}
+		}
+	case vp8VPred:
+		for y := 0; y < n; y++ {
+			copy(ws[origin+y*stride:origin+y*stride+n], ws[1:1+n])
+		}
+	case vp8HPred:
+		for y := 0; y < n; y++ {
+			left := ws[(1+y)*stride]
+			for x := 0; x < n; x++ {
+				ws[origin+y*stride+x] = left
+			}
+		}
+	case vp8TMPred:
+		vp8PredictTrueMotion(ws, origin, stride, n)
+	}
+}
+
+func vp8PredictTrueMotion(ws []uint8, origin int, stride int, n int) {
+	aboveLeft := int(ws[origin-stride-1])
+	for y := 0; y < n; y++ {
+		left := int(ws[origin+y*stride-1])
+		for x := 0; x < n; x++ {
+			ws[origin+y*stride+x] = clampUint8(left + int(ws[origin-stride+x]) - aboveLeft)
+		}
+	}
+}
+
+func avg2(a, b uint8) uint8 {
+	return uint8((int(a) + int(b) + 1) >> 1)
+}
+
+func avg3(a, b, c uint8) uint8 {
+	return uint8((int(a) + 2*int(b) + int(c) + 2) >> 2)
+}
+
+// vp8PredictSubblock predicts the 4x4 subblock at origin following RFC 6386 section 12.3.
+func vp8PredictSubblock(ws []uint8, origin int, stride int, mode uint8) {
+	top := ws[origin-stride : origin-stride+8]
+	tl := ws[origin-stride-1]
+	l0, l1, l2, l3 := ws[origin-1], ws[origin+stride-1], ws[origin+2*stride-1], ws[origin+3*stride-1]
+	set := func(x, y int, v uint8) {
+		ws[origin+y*stride+x] = v
+	}
+
+	switch mode {
+	case vp8BDCPred:
+		sum := 4
+		for i := 0; i < 4; i++ {
+			sum += int(top[i])
+		}
+		sum += int(l0) + int(l1) + int(l2) + int(l3)
+		for y := 0; y < 4; y++ {
+			for x := 0; x < 4; x++ {
+				set(x, y, uint8(sum>>3))
+			}
+		}
+	case vp8BTMPred:
+		vp8PredictTrueMotion(ws, origin, stride, 4)
+	case vp8BVEPred:
+		for x := 0; x < 4; x++ {
+			prev := tl
+			if x > 0 {
+				prev = top[x-1]
+			}
+			v := avg3(prev, top[x], top[x+1])
+			for y := 0; y < 4; y++ {
+				set(x, y, v)
+			}
+		}
+	case vp8BHEPred:
+		rows := [4]uint8{avg3(tl, l0, l1), avg3(l0, l1, l2), avg3(l1, l2, l3), avg3(l2, l3, l3)}
+		for y := 0; y < 4; y++ {
+			for x := 0; x < 4; x++ {
+				set(x, y, rows[y])
+			}
+		}
+	case vp8BLDPred:
+		for y := 0; y < 4; y++ {
+			for x := 0; x < 4; x++ {
+				i := x + y
+				if i == 6 {
+					set(x, y, avg3(top[6], top[7], top[7]))
+				} else {
+					set(x, y, avg3(top[i], top[i+1], top[i+2]))
+				}
+			}
+		}
+	case vp8BRDPred:
+		edge := [9]uint8{l3, l2, l1, l0, tl, top[0], top[1], top[2], top[3]}
+		for y := 0; y < 4; y++ {
+			for x := 0; x < 4; x++ {
+				i := 4 - y + x
+				set(x, y, avg3(edge[i-1], edge[i], edge[i+1]))
+			}
+		}
+	case vp8BVRPred:
+		a, b, c, dd := top[0], top[1], top[2], top[3]
+		set(0, 0, avg2(tl, a))
+		set(1, 2, avg2(tl, a))
+		set(1, 0, avg2(a, b))
+		set(2, 2, avg2(a, b))
+		set(2, 0, avg2(b, c))
+		set(3, 2, avg2(b, c))
+		set(3, 0, avg2(c, dd))
+		set(0, 3, avg3(l2, l1, l0))
+		set(0, 2, avg3(l1, l0, tl))
+		set(0, 1, avg3(l0, tl, a))
+		set(1, 3, avg3(l0, tl, a))
+		set(1, 1, avg3(tl, a, b))
+		set(2, 3, avg3(tl, a, b))
+		set(2, 1, avg3(a, b, c))
+		set(3, 3, avg3(a, b, c))
+		set(3, 1, avg3(b, c, dd))
+	case vp8BVLPred:
+		set(0, 0, avg2(top[0], top[1]))
+		set(1, 0, avg2(top[1], top[2]))
+		set(0, 2, avg2(top[1], top[2]))
+		set(2, 0, avg2(top[2], top[3]))
+		set(1, 2, avg2(top[2], top[3]))
+		set(3, 0, avg2(top[3], top[4]))
+		set(2, 2, avg2(top[3], top[4]))
+		set(0, 1, avg3(top[0], top[1], top[2]))
+		set(1, 1, avg3(top[1], top[2], top[3]))
+		set(0, 3, avg3(top[1], top[2], top[3]))
+		set(2, 1, avg3(top[2], top[3], top[4]))
+		set(1, 3, avg3(top[2], top[3], top[4]))
+		set(3, 1, avg3(top[3], top[4], top[5]))
+		set(2, 3, avg3(top[3], top[4], top[5]))
+		set(3, 2, avg3(top[4], top[5], top[6]))
+		set(3, 3, avg3(top[5], top[6], top[7]))
+	case vp8BHDPred:
+		a, b, c := top[0], top[1], top[2]
+		set(0, 0, avg2(l0, tl))
+		set(2, 1, avg2(l0, tl))
+		set(0, 1, avg2(l1, l0))
+		set(2, 2, avg2(l1, l0))
+		set(0, 2, avg2(l2, l1))
+		set(2, 3, avg2(l2, l1))
+		set(0, 3, avg2(l3, l2))
+		set(3, 0, avg3(a, b, c))
+		set(2, 0, avg3(tl, a, b))
+		set(1, 0, avg3(l0, tl, a))
+		set(3, 1, avg3(l0, tl, a))
+		set(1, 1, avg3(l1, l0, tl))
+		set(3, 2, avg3(l1, l0, tl))
+		set(1, 2, avg3(l2, l1, l0))
+		set(3, 3, avg3(l2, l1, l0))
+		set(1, 3, avg3(l3, l2, l1))
+	case vp8BHUPred:
+		set(0, 0, avg2(l0, l1))
+		set(2, 0, avg2(l1, l2))
+		set(0, 1, avg2(l1, l2))
+		set(2, 1, avg2(l2, l3))
+		set(0, 2, avg2(l2, l3))
+		set(1, 0, avg3(l0, l1, l2))
+		set(3, 0, avg3(l1, l2, l3))
+		set(1, 1, avg3(l1, l2, l3))
+		set(3, 1, avg3(l2, l3, l3))
+		set(1, 2, avg3(l2, l3, l3))
+		set(3, 2, l3)
+		set(2, 2, l3)
+		set(0, 3, l3)
+		set(1, 3, l3)
+		set(2, 3, l3)
+		set(3, 3, l3)
+	}
+}
+
+// loopFilter filters the edges of the macroblocks in raster order after the whole frame is reconstructed.
+func (d *vp8Decoder) loopFilter() {
+	for mby := 0; mby < d.mbh; mby++ {
+		for mbx := 0; mbx < d.mbw; mbx++ {
+			f := d.filters[mby*d.mbw+mbx]
+			if f.limit == 0 {
+				continue
+			}
+			if d.filterSimple {
+				d.filterSimpleMacroblock(mbx, mby, f)
+			} else {
+				d.filterNormalMacroblock(mbx, mby, f)
+			}
+		}
+	}
+}
+
+func (d *vp8Decoder) filterSimpleMacroblock(mbx int, mby int, f vp8Filter) {
+	origin := 16*mby*d.yStride + 16*mbx
+	if mbx > 0 {
+		for i := 0; i < 16; i++ {
+			vp8SimpleFilter(d.y, origin+i*d.yStride, 1, f.limit+4)
+		}
+	}
+	if f.inner {
+		for x := 4; x < 16; x += 4 {
+			for i := 0; i < 16; i++ {
+				vp8SimpleFilter(d.y, origin+i*d.yStride+x, 1, f.limit)
+			}
+		}
+	}
+	if mby > 0 {
+		for i := 0; i < 16; i++ {
+			vp8SimpleFilter(d.y, origin+i, d.yStride, f.limit+4)
+		}
+	}
+	if f.inner {
+		for y := 4; y < 16; y += 4 {
+			for i := 0; i < 16; i++ {
+				vp8SimpleFilter(d.y, origin+y*d.yStride+i, d.yStride, f.limit)
+			}
+		}
+	}
+}
+
+func (d *vp8Decoder) filterNormalMacroblock(mbx int, mby int, f vp8Filter) {
+	type plane struct {
+		pix    []uint8
+		stride int
+		n      int
+	}
+	planes := []plane{{d.y, d.yStride, 16}, {d.cb, d.cStride, 8}, {d.cr, d.cStride, 8}}
+
+	// Left edges and the inner vertical edges, then top edges and the inner horizontal edges
+	for _, p := range planes {
+		origin := p.n*mby*p.stride + p.n*mbx
+		if mbx > 0 {
+			for i := 0; i < p.n; i++ {
+				vp8MacroblockFilter(p.pix, origin+i*p.stride, 1, f)
+			}
+		}
+	}
+	if f.inner {
+		for _, p := range planes {
+			origin := p.n*mby*p.stride + p.n*mbx
+			for x := 4; x < p.n; x += 4 {
+				for i := 0; i < p.n; i++ {
+					vp8SubblockFilter(p.pix, origin+i*p.stride+x, 1, f)
+				}
+			}
+		}
+	}
+	for _, p := range planes {
+		origin := p.n*mby*p.stride + p.n*mbx
+		if mby > 0 {
+			for i := 0; i < p.n; i++ {
+				vp8MacroblockFilter(p.pix, origin+i, p.stride, f)
+			}
+		}
+	}
+	if f.inner {
+		for _, p := range planes {
+			origin := p.n*mby*p.stride + p.n*mbx
+			for y := 4; y < p.n; y += 4 {
+				for i := 0; i < p.n; i++ {
+					vp8SubblockFilter(p.pix, origin+y*p.stride+i, p.stride, f)
+				}
+			}
+		}
+	}
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// clampInt8 clamps v to the range of int8.
+func clampInt8(v int) int {
+	switch {
+	case v < -128:
+		return -128
+	case v > 127:
+		return 127
+	}
+	return v
+}
+
+// vp8Signed returns the pixel at i as a signed value.
+func vp8Signed(pix []uint8, i int) int {
+	return int(pix[i]) - 128
+}
+
+func vp8SetSigned(pix []uint8, i int, v int) {
+	pix[i] = uint8(clampInt8(v) + 128)
+}
+
+// vp8CommonAdjust adjusts p0 and q0, the pixels next to the edge between pix[i-step] and pix[i], and returns the adjustment of q0.
+func vp8CommonAdjust(pix []uint8, i int, step int, useOuterTaps bool) int {
+	p1, p0, q0, q1 := vp8Signed(pix, i-2*step), vp8Signed(pix, i-step), vp8Signed(pix, i), vp8Signed(pix, i+step)
+
+	a := 3 * (q0 - p0)
+	if useOuterTaps {
+		a += clampInt8(p1 - q1)
+	}
+	a = clampInt8(a)
+
+	b := clampInt8(a+3) >> 3
+	a = clampInt8(a+4) >> 3
+	vp8SetSigned(pix, i, q0-a)
+	vp8SetSigned(pix, i-step, p0+b)
+	return a
+}
+
+func vp8EdgeVariance(pix []uint8, i int, step int) int {
+	return absInt(int(pix[i-step])-int(pix[i]))*2 + absInt(int(pix[i-2*step])-int(pix[i+step]))>>1
+}
+
+func vp8SimpleFilter(pix []uint8, i int, step int, limit int) {
+	if vp8EdgeVariance(pix, i, step) <= limit {
+		vp8CommonAdjust(pix, i, step, true)
+	}
+}
+
+// vp8NeedsFilter returns whether the edge is filtered, and whether its variance is high.
+func vp8NeedsFilter(pix []uint8, i int, step int, limit int, f vp8Filter) (bool, bool) {
+	if vp8EdgeVariance(pix, i, step) > limit {
+		return false, false
+	}
+	var px [8]int
+	for k := range px {
+		px[k] = int(pix[i+(k-4)*step])
+	}
+	for k := 0; k < 3; k++ {
+		if absInt(px[k+1]-px[k]) > f.ilimit || absInt(px[k+5]-px[k+4]) > f.ilimit {
+			return false, false
+		}
+	}
+	hev := absInt(px[2]-px[3]) > f.hevThresh || absInt(px[5]-px[4]) > f.hevThresh
+	return true, hev
+}
+
+func vp8SubblockFilter(pix []uint8, i int, step int, f vp8Filter) {
+	ok, hev := vp8NeedsFilter(pix, i, step, f.limit, f)
+	if !ok {
+		return
+	}
+	p1, q1 := vp8Signed(pix, i-2*step), vp8Signed(pix, i+step)
+	a := (vp8CommonAdjust(pix, i, step, hev) + 1) >> 1
+	if !hev {
+		vp8SetSigned(pix, i+step, q1-a)
+		vp8SetSigned(pix, i-2*step, p1+a)
+	}
+}
+
+func vp8MacroblockFilter(pix []uint8, i int, step int, f vp8Filter) {
+	ok, hev := vp8NeedsFilter(pix, i, step, f.limit+4, f)
+	if !ok {
+		return
+	}
+	if hev {
+		vp8CommonAdjust(pix, i, step, true)
+		return
+	}
+
+	p2, p1, p0 := vp8Signed(pix, i-3*step), vp8Signed(pix, i-2*step), vp8Signed(pix, i-step)
+	q0, q1, q2 := vp8Signed(pix, i), vp8Signed(pix, i+step), vp8Signed(pix, i+2*step)
+	w := clampInt8(clampInt8(p1-q1) + 3*(q0-p0))
+
+	a := clampInt8((27*w + 63) >> 7)
+	vp8SetSigned(pix, i, q0-a)
+	vp8SetSigned(pix, i-step, p0+a)
+	a = clampInt8((18*w + 63) >> 7)
+	vp8SetSigned(pix, i+step, q1-a)
+	vp8SetSigned(pix, i-2*step, p1+a)
+	a = clampInt8((9*w + 63) >> 7)
+	vp8SetSigned(pix, i+2*step, q2-a)
+	vp8SetSigned(pix, i-3*step, p2+a)
+}
@@ -0,0 +1,646 @@
+package conversion
+
+import (
+	"image"
+	"io"
+)
+
+// VP8L is the lossless bitstream of WebP.
+// See https://developers.google.com/speed/webp/docs/webp_lossless_bitstream_specification
+
+// vp8lBitReader reads bits from the least significant bit of each byte.
+type vp8lBitReader struct {
+	data  []byte
+	pos   int
+	val   uint64
+	nbits uint
+	read  int // number of the consumed bits
+}
+
+func (br *vp8lBitReader) fill() {
+	for br.nbits <= 56 {
+		if br.pos < len(br.data) {
+			br.val |= uint64(br.data[br.pos]) << br.nbits
+		}
+		br.pos++
+		br.nbits += 8
+	}
+}
+
+func (br *vp8lBitReader) peekBits(n uint) uint32 {
+	if br.nbits < n {
+		br.fill()
+	}
+	return uint32(br.val & (1<<n - 1))
+}
+
+func (br *vp8lBitReader) skipBits(n uint) {
+	br.val >>= n
+	br.nbits -= n
+	br.read += int(n)
+}
+
+func (br *vp8lBitReader) readBits(n uint) uint32 {
+	v := br.peekBits(n)
+	br.skipBits(n)
+	return v
+}
+
+// overrun returns whether bits past the end of the data have been consumed.
+func (br *vp8lBitReader) overrun() bool {
+	return br.read > 8*len(br.data)
+}
+
+// vp8lHuffman is a canonical prefix code.
+// Codes up to 8 bits are looked up in table, and the longer ones are decoded bit by bit.
+type vp8lHuffman struct {
+	table   [256]uint16 // symbol<<4 | length, where the length 0 means a longer code
+	counts  [16]int
+	symbols []uint16 // in the canonical order
+	single  bool     // whether there is only one symbol, which is read with 0 bits
+}
+
+const vp8lHuffmanTableBits = 8
+
+func (h *vp8lHuffman) build(lengths []uint8) error {
+	*h = vp8lHuffman{}
+
+	n := 0
+	for _, l := range lengths {
+		h.counts[l]++
+		if l != 0 {
+			n++
+		}
+	}
+	h.counts[0] = 0
+	switch n {
+	case 0:
+		return errWebPInvalid
+	case 1:
+		for s, l := range lengths {
+			if l != 0 {
+				h.single = true
+				h.symbols = []uint16{uint16(s)}
+			}
+		}
+		return nil
+	}
+
+	// The code must be complete.
+	left := 1
+	for l := 1; l < len(h.counts); l++ {
+		left = left<<1 - h.counts[l]
+		if left < 0 {
+			return errWebPInvalid
+		}
+	}
+	if left != 0 {
+		return errWebPInvalid
+	}
+
+	var offsets [16]int
+	for l := 1; l < len(offsets)-1; l++ {
+		offsets[l+1] = offsets[l] + h.counts[l]
+	}
+	h.symbols = make([]uint16, n)
+	for s, l := range lengths {
+		if l != 0 {
+			h.symbols[offsets[l]] = uint16(s)
+			offsets[l]++
+		}
+	}
+
+	code, i := 0, 0
+	for l := 1; l <= vp8lHuffmanTableBits; l++ {
+		for k := 0; k < h.counts[l]; k++ {
+			entry := h.symbols[i]<<4 | uint16(l)
+			for r := reverseBits(code, l); r < len(h.table); r += 1 << uint(l) {
+				h.table[r] = entry
+			}
+			code++
+			i++
+		}
+		code <<= 1
+	}
+	return nil
+}
+
+// reverseBits reverses the lower n bits of v.
+func reverseBits(v int, n int) int {
+	r := 0
+	for i := 0; i < n; i++ {
+		r = r<<1 | v>>uint(i)&1
+	}
+	return r
+}
+
+func (h *vp8lHuffman) read(br *vp8lBitReader) int {
+	if h.single {
+		return int(h.symbols[0])
+	}
+
+	if entry := h.table[br.peekBits(vp8lHuffmanTableBits)]; entry&0xf != 0 {
+		br.skipBits(uint(entry & 0xf))
+		return int(entry >> 4)
+	}
+
+	code, first, index := 0, 0, 0
+	for l := 1; l < len(h.counts); l++ {
+		code |= int(br.readBits(1))
+		if code-first < h.counts[l] {
+			return int(h.symbols[index+code-first])
+		}
+		index += h.counts[l]
+		first = (first + h.counts[l]) << 1
+		code <<= 1
+	}
+	return 0
+}
+
+// vp8lGroup is the prefix codes of green with length and color cache codes, red, blue, alpha and distance.
+type vp8lGroup [5]vp8lHuffman
+
+// Types of transforms
+const (
+	vp8lPredictorTransform     = 0
+	vp8lCrossColorTransform    = 1
+	vp8lSubtractGreenTransform = 2
+	vp8lColorIndexingTransform = 3
+)
+
+type vp8lTransform struct {
+	kind  uint32
+	width int // width of the image before the transform
+	bits  uint
+	data  []uint32
+}
+
+var vp8lCodeLengthCodeOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// vp8lDistanceOffsets is the (x, y) offsets of the 120 smallest distance codes.
+var vp8lDistanceOffsets = [120][2]int8{
+	{0, 1}, {1, 0}, {1, 1}, {-1, 1}, {0, 2}, {2, 0}, {1, 2}, {-1, 2},
+	{2, 1}, {-2, 1}, {2, 2}, {-2, 2}, {0, 3}, {3, 0}, {1, 3}, {-1, 3},
+	{3, 1}, {-3, 1}, {2, 3}, {-2, 3}, {3, 2}, {-3, 2}, {0, 4}, {4, 0},
+	{1, 4}, {-1, 4}, {4, 1}, {-4, 1}, {3, 3}, {-3, 3}, {2, 4}, {-2, 4},
+	{4, 2}, {-4, 2}, {0, 5}, {3, 4}, {-3, 4}, {4, 3}, {-4, 3}, {5, 0},
+	{1, 5}, {-1, 5}, {5, 1}, {-5, 1}, {2, 5}, {-2, 5}, {5, 2}, {-5, 2},
+	{4, 4}, {-4, 4}, {3, 5}, {-3, 5}, {5, 3}, {-5, 3}, {0, 6}, {6, 0},
+	{1, 6}, {-1, 6}, {6, 1}, {-6, 1}, {2, 6}, {-2, 6}, {6, 2}, {-6, 2},
+	{4, 5}, {-4, 5}, {5, 4}, {-5, 4}, {3, 6}, {-3, 6}, {6, 3}, {-6, 3},
+	{0, 7}, {7, 0}, {1, 7}, {-1, 7}, {5, 5}, {-5, 5}, {7, 1}, {-7, 1},
+	{4, 6}, {-4, 6}, {6, 4}, {-6, 4}, {2, 7}, {-2, 7}, {7, 2}, {-7, 2},
+	{3, 7}, {-3, 7}, {7, 3}, {-7, 3}, {5, 6}, {-5, 6}, {6, 5}, {-6, 5},
+	{8, 0}, {4, 7}, {-4, 7}, {7, 4}, {-7, 4}, {8, 1}, {8, 2}, {6, 6},
+	{-6, 6}, {8, 3}, {5, 7}, {-5, 7}, {7, 5}, {-7, 5}, {8, 4}, {6, 7},
+	{-6, 7}, {7, 6}, {-7, 6}, {8, 5}, {7, 7}, {-7, 7}, {8, 6}, {8, 7},
+}
+
+type vp8lDecoder struct {
+	br vp8lBitReader
+}
+
+// decodeVP8L decodes the VP8L bitstream to *image.NRGBA.
+func decodeVP8L(data []byte) (*image.NRGBA, error) {
+	if len(data) < 5 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if data[0] != 0x2f {
+		return nil, errWebPInvalid
+	}
+
+	d := &vp8lDecoder{br: vp8lBitReader{data: data[1:]}}
+	width := int(d.br.readBits(14)) + 1
+	height := int(d.br.readBits(14)) + 1
+	d.br.readBits(1) // whether alpha is used
+	if d.br.readBits(3) != 0 {
+		return nil, errWebPUnsupported
+	}
+
+	pix, err := d.decodeImageStream(width, height, true)
+	if err != nil {
+		return nil, err
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for i, p := range pix {
+		img.Pix[4*i+0] = uint8(p >> 16)
+		img.Pix[4*i+1] = uint8(p >> 8)
+		img.Pix[4*i+2] = uint8(p)
+		img.Pix[4*i+3] = uint8(p >> 24)
+	}
+	return img, nil
+}
+
+func vp8lSubSampleSize(size int, bits uint) int {
+	return (size + 1<<bits - 1) >> bits
+}
+
+// decodeImageStream decodes ARGB pixels of the specified size.
+// Only the main image, not the images of the transforms and entropy image, has transforms and meta prefix codes.
+func (d *vp8lDecoder) decodeImageStream(width int, height int, isMain bool) ([]uint32, error) {
+	var transforms []vp8lTransform
+	if isMain {
+		var seen [4]bool
+		for d.br.readBits(1) == 1 {
+			t, err := d.readTransform(width, height)
+			if err != nil {
+				return nil, err
+			}
+			if seen[t.kind] {
+				return nil, errWebPInvalid
+			}
+			seen[t.kind] = true
+			transforms = append(transforms, t)
+			if t.kind == vp8lColorIndexingTransform {
+				width = vp8lSubSampleSize(width, t.bits)
+			}
+		}
+	}
+
+	var cacheBits uint
+	if d.br.readBits(1) == 1 {
+		cacheBits = uint(d.br.readBits(4))
+		if cacheBits < 1 || cacheBits > 11 {
+			return nil, errWebPInvalid
+		}
+	}
+
+	var huffBits uint
+	var entropy []uint32
+	numGroups := 1
+	if isMain && d.br.readBits(1) == 1 {
+		huffBits = uint(d.br.readBits(3)) + 2
+		var err error
+		entropy, err = d.decodeImageStream(vp8lSubSampleSize(width, huffBits), vp8lSubSampleSize(height, huffBits), false)
+		if err != nil {
+			return nil, err
+		}
+		for i, p := range entropy {
+			entropy[i] = p >> 8 & 0xffff
+			if int(entropy[i]) >= numGroups {
+				numGroups = int(entropy[i]) + 1
+			}
+		}
+	}
+
+	groups := make([]vp8lGroup, numGroups)
+	for i := range groups {
+		for j := range groups[i] {
+			alphabetSize := 256
+			switch j {
+			case 0:
+				alphabetSize = 256 + 24
+				if cacheBits > 0 {
+					alphabetSize += 1 << cacheBits
+				}
+			case 4:
+				alphabetSize = 40
+			}
+			if err := d.readHuffmanCode(alphabetSize, &groups[i][j]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	pix, err := d.decodePixels(width, height, groups, cacheBits, huffBits, entropy)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(transforms) - 1; i >= 0; i-- {
+		pix = transforms[i].inverse(pix, height)
+	}
+	return pix, nil
+}
+
+func (d *vp8lDecoder) readTransform(width int, height int) (vp8lTransform, error) {
+	t := vp8lTransform{kind: d.br.readBits(2), width: width}
+
+	var err error
+	switch t.kind {
+	case vp8lPredictorTransform, vp8lCrossColorTransform:
+		t.bits = uint(d.br.readBits(3)) + 2
+		t.data, err = d.decodeImageStream(vp8lSubSampleSize(width, t.bits), vp8lSubSampleSize(height, t.bits), false)
+	case vp8lColorIndexingTransform:
+		numColors := int(d.br.readBits(8)) + 1
+		switch {
+		case numColors > 16:
+			t.bits = 0
+		case numColors > 4:
+			t.bits = 1
+		case numColors > 2:
+			t.bits = 2
+		default:
+			t.bits = 3
+		}
+		t.data, err = d.decodeImageStream(numColors, 1, false)
+		for i := 1; i < len(t.data); i++ {
+			t.data[i] = vp8lAddPixels(t.data[i], t.data[i-1])
+		}
+	}
+	return t, err
+}
+
+func (d *vp8lDecoder) readHuffmanCode(alphabetSize int, h *vp8lHuffman) error {
+	lengths := make([]uint8, alphabetSize)
+
+	if d.br.readBits(1) == 1 {
+		// Simple code of 1 or 2 symbols
+		numSymbols := d.br.readBits(1) + 1
+		firstBits := uint(1)
+		if d.br.readBits(1) == 1 {
+			firstBits = 8
+		}
+		symbols := []int{int(d.br.readBits(firstBits))}
+		if numSymbols == 2 {
+			symbols = append(symbols, int(d.br.readBits(8)))
+		}
+		for _, s := range symbols {
+			if s >= alphabetSize {
+				return errWebPInvalid
+			}
+			lengths[s] = 1
+		}
+	} else {
+		var codeLengthLengths [19]uint8
+		numCodes := int(d.br.readBits(4)) + 4
+		for i := 0; i < numCodes; i++ {
+			codeLengthLengths[vp8lCodeLengthCodeOrder[i]] = uint8(d.br.readBits(3))
+		}
+		var codeLengthCode vp8lHuffman
+		if err := codeLengthCode.build(codeLengthLengths[:]); err != nil {
+			return err
+		}
+
+		maxSymbols := alphabetSize
+		if d.br.readBits(1) == 1 {
+			n := 2 + 2*uint(d.br.readBits(3))
+			maxSymbols = 2 + int(d.br.readBits(n))
+			if maxSymbols > alphabetSize {
+				return errWebPInvalid
+			}
+		}
+
+		prev := uint8(8)
+		for s := 0; s < alphabetSize && maxSymbols > 0; maxSymbols-- {
+			c := codeLengthCode.read(&d.br)
+			if c < 16 {
+				lengths[s] = uint8(c)
+				s++
+				if c != 0 {
+					prev = uint8(c)
+				}
+				continue
+			}
+
+			var repeat int
+			var l uint8
+			switch c {
+			case 16:
+				repeat, l = 3+int(d.br.readBits(2)), prev
+			case 17:
+				repeat = 3 + int(d.br.readBits(3))
+			default:
+				repeat = 11 + int(d.br.readBits(7))
+			}
+			if s+repeat > alphabetSize {
+				return errWebPInvalid
+			}
+			for ; repeat > 0; repeat-- {
+				lengths[s] = l
+				s++
+			}
+		}
+	}
+
+	if d.br.overrun() {
+		return io.ErrUnexpectedEOF
+	}
+	return h.build(lengths)
+}
+
+// decodePixels decodes the entropy-coded pixels, which are literals, backward references and color cache indexes.
+func (d *vp8lDecoder) decodePixels(width int, height int, groups []vp8lGroup, cacheBits uint, huffBits uint, entropy []uint32) ([]uint32, error) {
+	pix := make([]uint32, width*height)
+
+	var cache []uint32
+	if cacheBits > 0 {
+		cache = make([]uint32, 1<<cacheBits)
+	}
+	cached := 0
+
+	entropyWidth := vp8lSubSampleSize(width, huffBits)
+	for pos := 0; pos < len(pix); {
+		g := &groups[0]
+		if entropy != nil {
+			x, y := pos%width, pos/width
+			g = &groups[entropy[(y>>huffBits)*entropyWidth+x>>huffBits]]
+		}
+
+		code := g[0].read(&d.br)
+		switch {
+		case code < 256:
+			r, b, a := g[1].read(&d.br), g[2].read(&d.br), g[3].read(&d.br)
+			pix[pos] = uint32(a)<<24 | uint32(r)<<16 | uint32(code)<<8 | uint32(b)
+			pos++
+		case code < 256+24:
+			length := d.readPrefixValue(code - 256)
+			dist := vp8lDistance(width, d.readPrefixValue(g[4].read(&d.br)))
+			if dist > pos || length > len(pix)-pos {
+				return nil, errWebPInvalid
+			}
+			for ; length > 0; length-- {
+				pix[pos] = pix[pos-dist]
+				pos++
+			}
+		default:
+			for ; cached < pos; cached++ {
+				cache[(pix[cached]*0x1e35a7bd)>>(32-cacheBits)] = pix[cached]
+			}
+			pix[pos] = cache[code-256-24]
+			pos++
+		}
+
+		if d.br.overrun() {
+			return nil, io.ErrUnexpectedEOF
+		}
+	}
+	return pix, nil
+}
+
+// readPrefixValue reads the length or the distance code of the specified prefix symbol.
+func (d *vp8lDecoder) readPrefixValue(symbol int) int {
+	if symbol < 4 {
+		return symbol + 1
+	}
+	extraBits := uint(symbol-2) >> 1
+	offset := (2 + symbol&1) << extraBits
+	return offset + int(d.br.readBits(extraBits)) + 1
+}
+
+// vp8lDistance maps the distance code to the distance in pixels.
+func vp8lDistance(width int, code int) int {
+	if code > len(vp8lDistanceOffsets) {
+		return code - len(vp8lDistanceOffsets)
+	}
+	offset := vp8lDistanceOffsets[code-1]
+	dist := int(offset[0]) + int(offset[1])*width
+	if dist < 1 {
+		return 1
+	}
+	return dist
+}
+
+// inverse reverts the transform of pix whose height is the specified one.
+func (t *vp8lTransform) inverse(pix []uint32, height int) []uint32 {
+	switch t.kind {
+	case vp8lPredictorTransform:
+		t.inversePredictor(pix, height)
+	case vp8lCrossColorTransform:
+		t.inverseCrossColor(pix, height)
+	case vp8lSubtractGreenTransform:
+		for i, p := range pix {
+			green := p >> 8 & 0xff
+			pix[i] = p&0xff00ff00 | (p+green<<16)&0x00ff0000 | (p+green)&0x000000ff
+		}
+	case vp8lColorIndexingTransform:
+		return t.inverseColorIndexing(pix, height)
+	}
+	return pix
+}
+
+func (t *vp8lTransform) inversePredictor(pix []uint32, height int) {
+	width := t.width
+	blockWidth := vp8lSubSampleSize(width, t.bits)
+
+	pix[0] = vp8lAddPixels(pix[0], 0xff000000)
+	for x := 1; x < width; x++ {
+		pix[x] = vp8lAddPixels(pix[x], pix[x-1])
+	}
+
+	for y := 1; y < height; y++ {
+		row := y * width
+		pix[row] = vp8lAddPixels(pix[row], pix[row-width])
+		modes := t.data[(y>>t.bits)*blockWidth:]
+		for x := 1; x < width; x++ {
+			i := row + x
+			// The top right of the rightmost pixel is the leftmost pixel of the current row.
+			l, tp, tl, tr := pix[i-1], pix[i-width], pix[i-width-1], pix[i-width+1]
+			pix[i] = vp8lAddPixels(pix[i], vp8lPredict(modes[x>>t.bits]>>8&0xf, l, tp, tl, tr))
+		}
+	}
+}
+
+func vp8lPredict(mode uint32, l, t, tl, tr uint32) uint32 {
+	switch mode {
+	case 1:
+		return l
+	case 2:
+		return t
+	case 3:
+		return tr
+	case 4:
+		return tl
+	case 5:
+		return vp8lAverage2(vp8lAverage2(l, tr), t)
+	case 6:
+		return vp8lAverage2(l, tl)
+	case 7:
+		return vp8lAverage2(l, t)
+	case 8:
+		return vp8lAverage2(tl, t)
+	case 9:
+		return vp8lAverage2(t, tr)
+	case 10:
+		return vp8lAverage2(vp8lAverage2(l, tl), vp8lAverage2(t, tr))
+	case 11:
+		return vp8lSelect(l, t, tl)
+	case 12:
+		return vp8lMapChannels(func(c int) int { return int(l>>uint(c)&0xff) + int(t>>uint(c)&0xff) - int(tl>>uint(c)&0xff) })
+	case 13:
+		avg := vp8lAverage2(l, t)
+		return vp8lMapChannels(func(c int) int {
+			a := int(avg >> uint(c) & 0xff)
+			return a + (a-int(tl>>uint(c)&0xff))/2
+		})
+	}
+	return 0xff000000
+}
+
+// vp8lMapChannels computes each channel at the shift of 0, 8, 16 and 24, clamping it to 0..255.
+func vp8lMapChannels(f func(shift int) int) uint32 {
+	var p uint32
+	for c := 0; c < 32; c += 8 {
+		p |= uint32(clampUint8(f(c))) << uint(c)
+	}
+	return p
+}
+
+// vp8lSelect returns the one of l and t closer to the gradient prediction l+t-tl.
+func vp8lSelect(l, t, tl uint32) uint32 {
+	pl, pt := 0, 0
+	for c := uint(0); c < 32; c += 8 {
+		tlc := int(tl >> c & 0xff)
+		pl += absInt(int(t>>c&0xff) - tlc)
+		pt += absInt(int(l>>c&0xff) - tlc)
+	}
+	if pl < pt {
+		return l
+	}
+	return t
+}
+
+func vp8lAverage2(a, b uint32) uint32 {
+	return ((a^b)&0xfefefefe)>>1 + a&b
+}
+
+// vp8lAddPixels adds each channel modulo 256.
+func vp8lAddPixels(a, b uint32) uint32 {
+	alphaGreen := (a & 0xff00ff00) + (b & 0xff00ff00)
+	redBlue := (a & 0x00ff00ff) + (b & 0x00ff00ff)
+	return alphaGreen&0xff00ff00 | redBlue&0x00ff00ff
+}
+
+func (t *vp8lTransform) inverseCrossColor(pix []uint32, height int) {
+	width := t.width
+	blockWidth := vp8lSubSampleSize(width, t.bits)
+	delta := func(t int8, c int8) int {
+		return int(t) * int(c) >> 5
+	}
+
+	for y := 0; y < height; y++ {
+		elements := t.data[(y>>t.bits)*blockWidth:]
+		for x := 0; x < width; x++ {
+			e := elements[x>>t.bits]
+			greenToRed, greenToBlue, redToBlue := int8(e), int8(e>>8), int8(e>>16)
+
+			i := y*width + x
+			p := pix[i]
+			green := int8(p >> 8)
+			red := (int(p>>16&0xff) + delta(greenToRed, green)) & 0xff
+			blue := (int(p&0xff) + delta(greenToBlue, green) + delta(redToBlue, int8(red))) & 0xff
+			pix[i] = p&0xff00ff00 | uint32(red)<<16 | uint32(blue)
+		}
+	}
+}
+
+func (t *vp8lTransform) inverseColorIndexing(pix []uint32, height int) []uint32 {
+	width := t.width
+	packedWidth := vp8lSubSampleSize(width, t.bits)
+	bitsPerPixel := uint(8 >> t.bits)
+	mask := uint32(1)<<bitsPerPixel - 1
+
+	out := make([]uint32, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			packed := pix[y*packedWidth+x>>t.bits] >> 8
+			index := packed >> (uint(x&(1<<t.bits-1)) * bitsPerPixel) & mask
+			// Indexes out of the palette are transparent black.
+			if int(index) < len(t.data) {
+				out[y*width+x] = t.data[index]
+			}
+		}
+	}
+	return out
+}
@@ -4,28 +4,81 @@ Package gathering is a package that summarizes the processing necessary for coll
 package gathering
 
 import (
-	"io"
+	"image"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/hioki-daichi/imgconv/conversion"
-	"github.com/hioki-daichi/imgconv/fileutil"
 )
 
 // Gatherer represents decodable.
 type Gatherer struct {
-	Decoder   conversion.Decoder
+	// Decoder is used for all files when the input file format is fixed.
+	Decoder conversion.Decoder
+
+	// Candidates are used when Decoder is nil.
+	// A file having an extension processable by any of them is sniffed, and the first one of them whose magic bytes match, or which validates the file, is adopted.
+	// A file none of them recognizes, such as PNG named ".jpg", fails at the decode stage with image.ErrFormat. See conversion.Detect.
+	Candidates []conversion.Decoder
+
 	Pathnames []string
+
+	// Decoders holds the decoder adopted for each of Pathnames.
+	Decoders map[string]conversion.Decoder
+
+	// NoRecursion makes Gather collect only the files directly under the directory, not in its subdirectories.
+	NoRecursion bool
+
+	// NaturalOrder makes Gather sort Pathnames by naturalLess instead of the lexical order in which they are walked.
+	NaturalOrder bool
+
+	// KeepGoing makes Gather record the files which cannot be gathered in Errors and continue instead of stopping.
+	KeepGoing bool
+	Errors    []*Error
+}
+
+// Error records the file which cannot be gathered.
+// Its message is the same as the original error.
+type Error struct {
+	Path string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
 }
 
 // Gather searches under the specified directory and collects files to be decoded.
 func (g *Gatherer) Gather(dirname string) ([]string, error) {
-	err := filepath.Walk(dirname, g.walkFn)
+	err := filepath.Walk(dirname, func(path string, info os.FileInfo, err error) error {
+		if g.NoRecursion && err == nil && info.IsDir() && path != dirname {
+			return filepath.SkipDir
+		}
+		return g.walkFn(path, info, err)
+	})
+
+	if g.NaturalOrder {
+		sort.SliceStable(g.Pathnames, func(i, j int) bool {
+			return naturalLess(g.Pathnames[i], g.Pathnames[j])
+		})
+	}
 
 	return g.Pathnames, err
 }
 
 func (g *Gatherer) walkFn(path string, info os.FileInfo, err error) error {
+	err = g.gather(path, info, err)
+	if err != nil && g.KeepGoing {
+		g.Errors = append(g.Errors, &Error{Path: path, Err: err})
+		return nil
+	}
+
+	return err
+}
+
+func (g *Gatherer) gather(path string, info os.FileInfo, err error) error {
 	if err != nil {
 		return err
 	}
@@ -34,7 +87,7 @@ func (g *Gatherer) walkFn(path string, info os.FileInfo, err error) error {
 		return nil
 	}
 
-	if !g.Decoder.HasProcessableExtname(path) {
+	if !g.hasProcessableExtname(path) {
 		return nil
 	}
 
@@ -44,29 +97,81 @@ func (g *Gatherer) walkFn(path string, info os.FileInfo, err error) error {
 	}
 	defer fp.Close()
 
-	ok, err := g.checkDecodable(fp)
+	decoder, err := conversion.Detect(fp, path, g.decoders())
 	if err != nil {
 		return err
 	}
-	if !ok {
-		return nil
+	if decoder == nil {
+		// With the fixed Decoder, the files of other formats sharing the extension are not the target, such as WAVE named ".webp".
+		if g.Decoder != nil {
+			return nil
+		}
+		return &conversion.Error{Path: path, Stage: conversion.StageDecode, Err: image.ErrFormat}
 	}
 
+	if g.Decoders == nil {
+		g.Decoders = make(map[string]conversion.Decoder)
+	}
+	g.Decoders[path] = decoder
 	g.Pathnames = append(g.Pathnames, path)
 
 	return nil
 }
 
-func (g *Gatherer) checkDecodable(rs io.ReadSeeker) (bool, error) {
-	for _, magicBytes := range g.Decoder.MagicBytesSlice() {
-		ok, err := fileutil.StartsContentsWith(rs, magicBytes)
-		if err != nil {
-			return false, err
+func (g *Gatherer) decoders() []conversion.Decoder {
+	if g.Decoder != nil {
+		return []conversion.Decoder{g.Decoder}
+	}
+
+	return g.Candidates
+}
+
+func (g *Gatherer) hasProcessableExtname(path string) bool {
+	for _, decoder := range g.decoders() {
+		if decoder.HasProcessableExtname(path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// naturalLess compares the names in the natural order, in which the runs of digits are compared as numbers,
+// so that "frame_2.png" precedes "frame_10.png". Names equal as numbers such as "1" and "01" are compared as they are.
+func naturalLess(a string, b string) bool {
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if !isDigit(a[i]) || !isDigit(b[j]) {
+			if a[i] != b[j] {
+				return a[i] < b[j]
+			}
+			i++
+			j++
+			continue
+		}
+
+		// Compare the runs of digits without their leading zeros by their lengths, then by their digits.
+		si, sj := i, j
+		for i < len(a) && isDigit(a[i]) {
+			i++
 		}
-		if ok {
-			return true, nil
+		for j < len(b) && isDigit(b[j]) {
+			j++
+		}
+		x, y := strings.TrimLeft(a[si:i], "0"), strings.TrimLeft(b[sj:j], "0")
+		if len(x) != len(y) {
+			return len(x) < len(y)
+		}
+		if x != y {
+			return x < y
 		}
 	}
+	if len(a)-i != len(b)-j {
+		return len(a)-i < len(b)-j
+	}
+	return a < b
+}
 
-	return false, nil
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
 }
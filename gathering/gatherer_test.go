@@ -1,6 +1,7 @@
 package gathering
 
 import (
+	"image"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -38,6 +39,184 @@ func TestGathering_Gather(t *testing.T) {
 	}
 }
 
+func TestGathering_Gather_Candidates(t *testing.T) {
+	t.Parallel()
+
+	g := Gatherer{Candidates: []conversion.Decoder{jpegDecoder(t), gifDecoder(t)}}
+
+	actual, err := g.Gather("../testdata/")
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	expected := []string{"../testdata/gif/sample1.gif", "../testdata/jpeg/sample1.jpg", "../testdata/jpeg/sample2.jpg", "../testdata/jpeg/sample3.jpeg"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf(`expected="%s" actual="%s"`, expected, actual)
+	}
+
+	for _, path := range actual {
+		decoder := g.Decoders[path]
+		if !decoder.HasProcessableExtname(path) {
+			t.Errorf(`unexpected decoder for "%s": %T`, path, decoder)
+		}
+	}
+}
+
+func TestGathering_Gather_RIFF(t *testing.T) {
+	t.Parallel()
+
+	tempdir, err := ioutil.TempDir("", "imgconv")
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	files := map[string]string{
+		"image.webp": "RIFF\x04\x01\x00\x00WEBPVP8L",
+		"sound.webp": "RIFF\x04\x01\x00\x00WAVEfmt ",
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(tempdir, name), []byte(contents), 0644); err != nil {
+			t.Fatalf("err %s", err)
+		}
+	}
+
+	g := Gatherer{Decoder: &conversion.WebP{}}
+
+	actual, err := g.Gather(tempdir)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	expected := []string{filepath.Join(tempdir, "image.webp")}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf(`expected="%s" actual="%s"`, expected, actual)
+	}
+}
+
+func TestGathering_Gather_Validator(t *testing.T) {
+	t.Parallel()
+
+	tempdir, err := ioutil.TempDir("", "imgconv")
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	files := map[string]string{
+		// Gray 1x1 followed by the pixel
+		"image.tga": "\x00\x00\x03\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01\x00\x01\x00\x08\x00\xFF",
+		"text.tga":  "This is not an image but a text.",
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(tempdir, name), []byte(contents), 0644); err != nil {
+			t.Fatalf("err %s", err)
+		}
+	}
+
+	g := Gatherer{Candidates: []conversion.Decoder{&conversion.Png{}, &conversion.Tga{}}, KeepGoing: true}
+
+	actual, err := g.Gather(tempdir)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	expected := []string{filepath.Join(tempdir, "image.tga")}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf(`expected="%s" actual="%s"`, expected, actual)
+	}
+
+	// Not recognized by any of the candidates
+	if len(g.Errors) != 1 || g.Errors[0].Path != filepath.Join(tempdir, "text.tga") {
+		t.Errorf(`unexpected errors: %v`, g.Errors)
+	}
+}
+
+func TestGathering_Gather_Unrecognized(t *testing.T) {
+	t.Parallel()
+
+	tempdir, err := ioutil.TempDir("", "imgconv")
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	// PNG named ".jpg"
+	path := filepath.Join(tempdir, "misnamed.jpg")
+	if err := ioutil.WriteFile(path, []byte("\x89PNG\r\n\x1a\n"), 0644); err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	g := Gatherer{Candidates: []conversion.Decoder{jpegDecoder(t), gifDecoder(t)}}
+
+	_, err = g.Gather(tempdir)
+
+	e, ok := err.(*conversion.Error)
+	if !ok || e.Path != path || e.Stage != conversion.StageDecode || e.Err != image.ErrFormat {
+		t.Errorf(`unexpected error: %#v`, err)
+	}
+}
+
+func TestGathering_Gather_NoRecursion_NaturalOrder(t *testing.T) {
+	t.Parallel()
+
+	tempdir, err := ioutil.TempDir("", "imgconv")
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	if err := os.Mkdir(filepath.Join(tempdir, "sub"), 0755); err != nil {
+		t.Fatalf("err %s", err)
+	}
+	for _, name := range []string{"frame_10.png", "frame_2.png", "frame_1.png", "sub/frame_3.png"} {
+		if err := ioutil.WriteFile(filepath.Join(tempdir, name), []byte("\x89PNG\r\n\x1a\n"), 0644); err != nil {
+			t.Fatalf("err %s", err)
+		}
+	}
+
+	g := Gatherer{Decoder: pngDecoder(t), NoRecursion: true, NaturalOrder: true}
+
+	actual, err := g.Gather(tempdir)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	expected := []string{filepath.Join(tempdir, "frame_1.png"), filepath.Join(tempdir, "frame_2.png"), filepath.Join(tempdir, "frame_10.png")}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf(`expected="%s" actual="%s"`, expected, actual)
+	}
+}
+
+func TestGathering_naturalLess(t *testing.T) {
+	cases := map[string]struct {
+		a        string
+		b        string
+		expected bool
+	}{
+		"2 < 10":           {a: "frame_2.png", b: "frame_10.png", expected: true},
+		"10 > 2":           {a: "frame_10.png", b: "frame_2.png", expected: false},
+		"padded":           {a: "frame_0002.png", b: "frame_0010.png", expected: true},
+		"leading zeros":    {a: "frame_02.png", b: "frame_10.png", expected: true},
+		"equal as numbers": {a: "frame_01.png", b: "frame_1.png", expected: true},
+		"letters":          {a: "a10.png", b: "b2.png", expected: true},
+		"prefix":           {a: "frame.png", b: "frame_1.png", expected: true},
+		"same":             {a: "frame_1.png", b: "frame_1.png", expected: false},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			actual := naturalLess(c.a, c.b)
+			if actual != c.expected {
+				t.Errorf(`expected="%t" actual="%t"`, c.expected, actual)
+			}
+		})
+	}
+}
+
 func TestGathering_Gather_Nonexistence(t *testing.T) {
 	t.Parallel()
 
@@ -94,6 +273,27 @@ func TestGathering_Gather_FailedToCheckDecodable(t *testing.T) {
 	}
 }
 
+func TestGathering_Gather_KeepGoing(t *testing.T) {
+	t.Parallel()
+
+	g := Gatherer{Decoder: jpegDecoder(t), KeepGoing: true}
+
+	actual, err := g.Gather("./testdata/")
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	if len(actual) != 0 {
+		t.Errorf(`expected=[] actual="%s"`, actual)
+	}
+
+	if len(g.Errors) != 1 {
+		t.Fatalf(`expected=1 actual=%d`, len(g.Errors))
+	}
+	if g.Errors[0].Path != "testdata/empty.jpg" || g.Errors[0].Error() != "EOF" {
+		t.Errorf(`unexpected error: path="%s" err="%s"`, g.Errors[0].Path, g.Errors[0])
+	}
+}
+
 func TestGathering_Gather_Undecodable(t *testing.T) {
 	t.Parallel()
 
@@ -18,16 +18,32 @@ func main() {
 }
 
 func execute() error {
+	if len(os.Args) > 1 && os.Args[1] == "assemble" {
+		return assemble()
+	}
+
 	dirname, options, err := opt.Parse(os.Args[1:]...)
 	if err != nil {
 		return err
 	}
 
 	runner := &cmd.Runner{
-		OutStream: os.Stdout,
-		Decoder:   options.Decoder,
-		Encoder:   options.Encoder,
-		Force:     options.Force,
+		OutStream:     os.Stdout,
+		Decoder:       options.Decoder,
+		Encoder:       options.Encoder,
+		Candidates:    options.Candidates,
+		Transformers:  options.Transformers,
+		Force:         options.Force,
+		OutDir:        options.OutDir,
+		Incremental:   options.Incremental,
+		ManifestPath:  options.ManifestPath,
+		Jobs:          options.Jobs,
+		KeepGoing:     options.KeepGoing,
+		DryRun:        options.DryRun,
+		ReportFormat:  options.ReportFormat,
+		ExtractFrames: options.ExtractFrames,
+		SharedPalette: options.SharedPalette,
+		Background:    options.Background,
 	}
 	err = runner.Run(dirname)
 	if err != nil {
@@ -36,3 +52,21 @@ func execute() error {
 
 	return nil
 }
+
+func assemble() error {
+	dirname, options, err := opt.ParseAssemble(os.Args[2:]...)
+	if err != nil {
+		return err
+	}
+
+	assembler := &cmd.Assembler{
+		OutStream:  os.Stdout,
+		Candidates: options.Candidates,
+		Encoder:    options.Encoder,
+		Delay:      options.Delay,
+		LoopCount:  options.LoopCount,
+		Force:      options.Force,
+	}
+
+	return assembler.Run(dirname, options.Output)
+}
@@ -0,0 +1,85 @@
+package opt
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+
+	"github.com/hioki-daichi/imgconv/conversion"
+)
+
+// AssembleOptions sets Candidates, Encoder, Delay, LoopCount, Output and Force of the assemble command.
+type AssembleOptions struct {
+	Candidates []conversion.Decoder
+	Encoder    *conversion.Gif
+	Delay      int
+	LoopCount  int
+	Output     string
+	Force      bool
+}
+
+// ParseAssemble parses the command line option of "imgconv assemble", which assembles the frames under a directory into an animated GIF.
+// The frames are detected among all the registered file formats by magic bytes.
+func ParseAssemble(args ...string) (string, *AssembleOptions, error) {
+	flg := flag.NewFlagSet(os.Args[0]+" assemble", flag.ExitOnError)
+
+	delay := flg.Int("delay", 10, "Delay of each frame in 100ths of a second.")
+	loopCount := flg.Int("loop", 0, "Number of times the animation is repeated. 0 loops forever, and -1 shows the frames once.")
+	output := flg.String("o", "", "Path of the animated GIF. By default, the directory name with \".gif\" next to the directory.")
+	force := flg.Bool("f", false, "Overwrite when the animated GIF exists.")
+
+	// The encoding options are those of GIF, except that the fixed Plan 9 palette is not computed across the frames.
+	newEncoder := conversion.LookupFormat("gif").DefineEncoderFlags(flg)
+	quantizerFlag := flg.Lookup("gif-quantizer")
+	quantizerFlag.Value.Set("median-cut")
+	quantizerFlag.DefValue = "median-cut"
+
+	flg.Parse(args)
+
+	if *delay < 0 {
+		return "", nil, errors.New("--delay must be greater than or equal to 0")
+	}
+	if *loopCount < -1 {
+		return "", nil, errors.New("--loop must be greater than or equal to -1")
+	}
+
+	encoder, err := newEncoder()
+	if err != nil {
+		return "", nil, err
+	}
+	g := encoder.(*conversion.Gif)
+	// The quantizer computes the shared palette unless it is given by --gif-palette.
+	if g.Palette == nil && g.Options.Quantizer == nil {
+		return "", nil, errors.New("--gif-quantizer must not be \"plan9\" since the palette is shared across the frames")
+	}
+
+	dirnames := flg.Args()
+	if len(dirnames) == 0 {
+		return "", nil, errors.New("you must specify a directory")
+	}
+
+	candidates, err := deriveCandidates(conversion.Formats(), nil, nil)
+	if err != nil {
+		return "", nil, err
+	}
+
+	options := &AssembleOptions{
+		Candidates: candidates,
+		Encoder:    g,
+		Delay:      *delay,
+		LoopCount:  *loopCount,
+		Output:     *output,
+		Force:      *force,
+	}
+	if options.Output == "" {
+		// Next to the directory, also when it is specified as "." or "..".
+		abs, err := filepath.Abs(dirnames[0])
+		if err != nil {
+			return "", nil, err
+		}
+		options.Output = filepath.Join(dirnames[0], "..", filepath.Base(abs)+".gif")
+	}
+
+	return dirnames[0], options, nil
+}
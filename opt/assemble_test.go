@@ -0,0 +1,105 @@
+package opt
+
+import (
+	"errors"
+	"image/color"
+	"image/gif"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hioki-daichi/imgconv/conversion"
+)
+
+func TestOpt_ParseAssemble(t *testing.T) {
+	cases := map[string]struct {
+		args    []string
+		dirname string
+		options *AssembleOptions
+		err     error
+	}{
+		"no argument": {args: []string{}, dirname: "", options: nil, err: errors.New("you must specify a directory")},
+
+		"dirname only": {args: []string{"./frames/"}, dirname: "./frames/", options: &AssembleOptions{Encoder: &conversion.Gif{Options: &gif.Options{NumColors: 256, Quantizer: conversion.MedianCut{}}}, Delay: 10, Output: "frames.gif"}, err: nil},
+
+		"current directory": {args: []string{"."}, dirname: ".", options: &AssembleOptions{Encoder: &conversion.Gif{Options: &gif.Options{NumColors: 256, Quantizer: conversion.MedianCut{}}}, Delay: 10, Output: "../opt.gif"}, err: nil},
+
+		"with options": {args: []string{"--delay=5", "--loop=-1", "--num-colors=16", "-o", "out.gif", "-f", "./frames/"}, dirname: "./frames/", options: &AssembleOptions{Encoder: &conversion.Gif{Options: &gif.Options{NumColors: 16, Quantizer: conversion.MedianCut{}}}, Delay: 5, LoopCount: -1, Output: "out.gif", Force: true}, err: nil},
+
+		"--gif-quantizer=octree --gif-dither=bayer": {args: []string{"--gif-quantizer=octree", "--gif-dither=bayer", "./frames/"}, dirname: "./frames/", options: &AssembleOptions{Encoder: &conversion.Gif{Options: &gif.Options{NumColors: 256, Quantizer: conversion.Octree{}, Drawer: conversion.Bayer{}}}, Delay: 10, Output: "frames.gif"}, err: nil},
+
+		"--delay=-1":            {args: []string{"--delay=-1", "./frames/"}, dirname: "", options: nil, err: errors.New("--delay must be greater than or equal to 0")},
+		"--loop=-2":             {args: []string{"--loop=-2", "./frames/"}, dirname: "", options: nil, err: errors.New("--loop must be greater than or equal to -1")},
+		"--num-colors=0":        {args: []string{"--num-colors=0", "./frames/"}, dirname: "", options: nil, err: errors.New("--num-colors must be greater than or equal to 1")},
+		"--gif-quantizer=plan9": {args: []string{"--gif-quantizer=plan9", "./frames/"}, dirname: "", options: nil, err: errors.New("--gif-quantizer must not be \"plan9\" since the palette is shared across the frames")},
+		"--gif-quantizer=foo":   {args: []string{"--gif-quantizer=foo", "./frames/"}, dirname: "", options: nil, err: errors.New("--gif-quantizer is not included in the list: \"plan9\", \"median-cut\", \"octree\", \"k-means\"")},
+		"--gif-dither=foo":      {args: []string{"--gif-dither=foo", "./frames/"}, dirname: "", options: nil, err: errors.New("--gif-dither is not included in the list: \"none\", \"floyd-steinberg\", \"bayer\"")},
+		"--num-colors=257":      {args: []string{"--num-colors=257", "./frames/"}, dirname: "", options: nil, err: errors.New("--num-colors must be less than or equal to 256")},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			dirname, options, err := ParseAssemble(c.args...)
+
+			if c.err == nil { // If it is expected that no error will occur
+				if err != nil {
+					t.Fatalf("err %s", err)
+				}
+			} else {
+				expected := c.err.Error()
+				actual := err.Error()
+				if actual != expected {
+					t.Errorf(`expected="%s" actual="%s"`, expected, actual)
+				}
+			}
+
+			if dirname != c.dirname {
+				t.Errorf(`expected="%s" actual="%s"`, c.dirname, dirname)
+			}
+
+			if options != c.options {
+				// All the formats which can be decoded
+				if len(options.Candidates) != len(conversion.Formats()) {
+					t.Errorf(`expected=%d actual=%d`, len(conversion.Formats()), len(options.Candidates))
+				}
+
+				options.Candidates = nil
+				if !reflect.DeepEqual(options, c.options) {
+					t.Errorf(`expected="%v" actual="%v"`, c.options, options)
+				}
+			}
+		})
+	}
+}
+
+func TestOpt_ParseAssemble_Palette(t *testing.T) {
+	t.Parallel()
+
+	tempdir, err := ioutil.TempDir("", "imgconv")
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	path := filepath.Join(tempdir, "brand.gpl")
+	err = ioutil.WriteFile(path, []byte("GIMP Palette\n255 0 0\n0 0 255\n"), 0644)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	// plan9 is allowed since the quantizer is not used with the palette.
+	_, options, err := ParseAssemble("--gif-quantizer=plan9", "--gif-palette="+path, "./frames/")
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+
+	expected := color.Palette{color.RGBA{R: 0xFF, A: 0xFF}, color.RGBA{B: 0xFF, A: 0xFF}}
+	if !reflect.DeepEqual(options.Encoder.Palette, expected) {
+		t.Errorf(`expected="%v" actual="%v"`, expected, options.Encoder.Palette)
+	}
+}
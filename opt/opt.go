@@ -1,65 +1,155 @@
 /*
 Package opt is a package for parsing the command line option and building necessary information.
+
+The flags for the file formats and their encoding options are built from the formats registered in package conversion.
 */
 package opt
 
 import (
 	"errors"
 	"flag"
-	"image/gif"
-	"image/jpeg"
-	"image/png"
+	"image/color"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/hioki-daichi/imgconv/conversion"
+	"github.com/hioki-daichi/imgconv/resizing"
+)
+
+const (
+	defaultFrom = "jpeg"
+	defaultTo   = "png"
 )
 
-// Options sets Decoder, Encoder and Force.
+var filters = map[string]*resizing.Filter{
+	"nearest":     nil,
+	"bilinear":    resizing.Bilinear,
+	"catmull-rom": resizing.CatmullRom,
+	"lanczos":     resizing.Lanczos,
+}
+
+// Options sets Decoder, Encoder, Candidates, Transformers, Force, OutDir, Incremental, ManifestPath, Jobs, KeepGoing, DryRun, ReportFormat, ExtractFrames, SharedPalette and Background.
 type Options struct {
-	Decoder conversion.Decoder
-	Encoder conversion.Encoder
-	Force   bool
+	Decoder       conversion.Decoder
+	Encoder       conversion.Encoder
+	Candidates    []conversion.Decoder
+	Transformers  []conversion.Transformer
+	Force         bool
+	OutDir        string
+	Incremental   bool
+	ManifestPath  string
+	Jobs          int
+	KeepGoing     bool
+	DryRun        bool
+	ReportFormat  string
+	ExtractFrames bool
+	SharedPalette bool
+	Background    color.Color
 }
 
 // Parse parses the command line option, validates it, constructs the necessary information for the later conversion process and return it.
 func Parse(args ...string) (string, *Options, error) {
 	flg := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
 
-	fromJpeg := flg.Bool("J", false, "Convert from JPEG")
-	fromPng := flg.Bool("P", false, "Convert from PNG")
-	fromGif := flg.Bool("G", false, "Convert from GIF")
-	toJpeg := flg.Bool("j", false, "Convert to JPEG")
-	toPng := flg.Bool("p", false, "Convert to PNG")
-	toGif := flg.Bool("g", false, "Convert to GIF")
-	force := flg.Bool("f", false, "Overwrite when the converted file name duplicates.")
-	quality := flg.Int("quality", 100, "JPEG Quality to be used with '-j' option. You can specify 1 to 100.")
-	numColors := flg.Int("num-colors", 256, "Maximum number of colors used in the GIF image to be used with '-g' option. You can specify 1 to 256.")
-	humanCompressionLevel := flg.String("compression-level", "default", "Options to specify the compression level of PNG to be used with '-p' option. You can specify from 'default', 'no', 'best-speed', 'best-compression'.")
+	formats := conversion.Formats()
 
-	flg.Parse(args)
+	fromFlags := make(map[*conversion.Format]*bool)
+	toFlags := make(map[*conversion.Format]*bool)
+	decoderFactories := make(map[*conversion.Format]conversion.DecoderFactory)
+	encoderFactories := make(map[*conversion.Format]conversion.EncoderFactory)
 
-	if *toJpeg {
-		if *quality < 1 {
-			return "", nil, errors.New("--quality must be greater than or equal to 1")
-		} else if *quality > 100 {
-			return "", nil, errors.New("--quality must be less than or equal to 100")
+	for _, f := range formats {
+		if f.Shorthand != "" && f.NewDecoder != nil {
+			fromFlags[f] = flg.Bool(strings.ToUpper(f.Shorthand), false, "Convert from "+strings.ToUpper(f.Name))
+		}
+		if f.Shorthand != "" && f.DefineEncoderFlags != nil {
+			toFlags[f] = flg.Bool(strings.ToLower(f.Shorthand), false, "Convert to "+strings.ToUpper(f.Name))
 		}
 	}
 
-	if *toGif {
-		if *numColors < 1 {
-			return "", nil, errors.New("--num-colors must be greater than or equal to 1")
-		} else if *numColors > 256 {
-			return "", nil, errors.New("--num-colors must be less than or equal to 256")
+	fromAny := flg.Bool("A", false, "Convert from any registered file format except the output file format, detected by magic bytes")
+	fromName := flg.String("from", "", "Name of the input file format. You can specify instead of the uppercase flag, e.g. 'jpeg'.")
+	toName := flg.String("to", "", "Name of the output file format. You can specify instead of the lowercase flag, e.g. 'png'.")
+	width := flg.Int("width", 0, "Width to resize to. The height follows the aspect ratio unless --height is specified.")
+	height := flg.Int("height", 0, "Height to resize to. The width follows the aspect ratio unless --width is specified.")
+	maxDimension := flg.Int("max-dimension", 0, "Maximum length of the longer side. Larger images are shrunk keeping the aspect ratio.")
+	resample := flg.String("resample", "lanczos", "Resampling filter used for resizing. You can specify from 'nearest', 'bilinear', 'catmull-rom', 'lanczos'.")
+	force := flg.Bool("f", false, "Overwrite when the converted file name duplicates.")
+	outDir := flg.String("out-dir", "", "Directory to write the converted files into, recreating the directory structure under the specified directory. By default, they are written next to the source files.")
+	incremental := flg.Bool("incremental", false, "Skip the files whose converted files exist and are newer than them, and overwrite the stale ones.")
+	manifestPath := flg.String("manifest", "", "Manifest file recording the content hashes of the converted files and of the options. Implies --incremental, and the files whose hashes are unchanged are skipped instead of comparing modification times.")
+	jobs := flg.Int("jobs", 1, "Number of files converted concurrently.")
+	dryRun := flg.Bool("dry-run", false, "Show the planned conversions and the files which would be overwritten or blocked without -f, without writing anything.")
+	reportFormat := flg.String("format", "text", "Format of the output. You can specify from 'text', 'json'. 'json' writes a JSON record per line for each file and a summary record at the end.")
+	keepGoing := flg.Bool("keep-going", false, "Continue converting the other files when some fail, and summarize the failures at the end.")
+	sharedPalette := flg.Bool("gif-shared-palette", false, "Compute one palette across all the files and convert all of them to GIF with it, so that they share identical colors.")
+	background := flg.String("background", "#ffffff", "Color onto which images with transparency are composited for the output file formats which cannot hold transparency, such as JPEG. You can specify a hex color like '#ffffff' or '#fff'.")
+	extractFrames := flg.Bool("extract-frames", false, "Write each frame of animated files, composited as displayed, to its own file numbered like 'name_0001.png'.")
+
+	for _, f := range formats {
+		if f.DefineDecoderFlags != nil {
+			decoderFactories[f] = f.DefineDecoderFlags(flg)
+		}
+		if f.DefineEncoderFlags != nil {
+			encoderFactories[f] = f.DefineEncoderFlags(flg)
 		}
 	}
 
-	if *toPng {
-		switch *humanCompressionLevel {
-		case "default", "no", "best-speed", "best-compression":
-		default:
-			return "", nil, errors.New("--compression-level is not included in the list: \"default\", \"no\", \"best-speed\", \"best-compression\"")
-		}
+	flg.Parse(args)
+
+	if *jobs < 1 {
+		return "", nil, errors.New("--jobs must be greater than or equal to 1")
+	}
+
+	if *width < 0 {
+		return "", nil, errors.New("--width must be greater than or equal to 0")
+	}
+	if *height < 0 {
+		return "", nil, errors.New("--height must be greater than or equal to 0")
+	}
+	if *maxDimension < 0 {
+		return "", nil, errors.New("--max-dimension must be greater than or equal to 0")
+	}
+	filter, ok := filters[*resample]
+	if !ok {
+		return "", nil, errors.New("--resample is not included in the list: \"nearest\", \"bilinear\", \"catmull-rom\", \"lanczos\"")
+	}
+
+	backgroundColor, err := parseHexColor(*background)
+	if err != nil {
+		return "", nil, errors.New("--background must be a hex color such as \"#ffffff\"")
+	}
+
+	switch *reportFormat {
+	case "text", "json":
+	default:
+		return "", nil, errors.New("--format is not included in the list: \"text\", \"json\"")
+	}
+
+	from, err := deriveFormat("--from", *fromName, formats, fromFlags, defaultFrom)
+	if err != nil {
+		return "", nil, err
+	}
+	if from.NewDecoder == nil {
+		return "", nil, errors.New("--from cannot be decoded: " + from.Name)
+	}
+
+	to, err := deriveFormat("--to", *toName, formats, toFlags, defaultTo)
+	if err != nil {
+		return "", nil, err
+	}
+	if to.DefineEncoderFlags == nil {
+		return "", nil, errors.New("--to cannot be encoded: " + to.Name)
+	}
+
+	encoder, err := encoderFactories[to]()
+	if err != nil {
+		return "", nil, err
+	}
+
+	if _, ok := encoder.(*conversion.Gif); *sharedPalette && !ok {
+		return "", nil, errors.New("--gif-shared-palette can be specified only when converting to GIF")
 	}
 
 	dirnames := flg.Args()
@@ -68,51 +158,93 @@ func Parse(args ...string) (string, *Options, error) {
 	}
 
 	options := &Options{
-		Decoder: deriveDecoder(fromJpeg, fromPng, fromGif),
-		Encoder: deriveEncoder(toJpeg, toPng, toGif, quality, numColors, humanCompressionLevel),
-		Force:   *force,
+		Encoder:       encoder,
+		Force:         *force,
+		OutDir:        *outDir,
+		Incremental:   *incremental || *manifestPath != "",
+		ManifestPath:  *manifestPath,
+		Jobs:          *jobs,
+		KeepGoing:     *keepGoing,
+		DryRun:        *dryRun,
+		ReportFormat:  *reportFormat,
+		ExtractFrames: *extractFrames,
+		SharedPalette: *sharedPalette,
+		Background:    backgroundColor,
+	}
+
+	if *width > 0 || *height > 0 || *maxDimension > 0 {
+		options.Transformers = append(options.Transformers, &resizing.Resizer{Width: *width, Height: *height, MaxDimension: *maxDimension, Filter: filter})
+	}
+
+	if *fromAny {
+		options.Candidates, err = deriveCandidates(formats, to, decoderFactories)
+	} else {
+		options.Decoder, err = newDecoder(from, decoderFactories)
+	}
+	if err != nil {
+		return "", nil, err
 	}
 
 	return dirnames[0], options, nil
 }
 
-func deriveDecoder(fromJpeg *bool, fromPng *bool, fromGif *bool) conversion.Decoder {
-	switch {
-	case *fromPng:
-		return &conversion.Png{}
-	case *fromGif:
-		return &conversion.Gif{}
-	case *fromJpeg:
-		fallthrough
-	default:
-		return &conversion.Jpeg{}
+// deriveFormat returns the format specified by name, by the first set shorthand flag, or by default in this order.
+func deriveFormat(flagName string, name string, formats []*conversion.Format, shorthandFlags map[*conversion.Format]*bool, defaultName string) (*conversion.Format, error) {
+	if name != "" {
+		f := conversion.LookupFormat(name)
+		if f == nil {
+			return nil, errors.New(flagName + " is not a registered format: " + name)
+		}
+		return f, nil
+	}
+
+	for _, f := range formats {
+		if b, ok := shorthandFlags[f]; ok && *b {
+			return f, nil
+		}
 	}
+
+	return conversion.LookupFormat(defaultName), nil
 }
 
-func deriveEncoder(toJpeg *bool, toPng *bool, toGif *bool, quality *int, numColors *int, humanCompressionLevel *string) conversion.Encoder {
-	switch {
-	case *toJpeg:
-		return &conversion.Jpeg{Options: &jpeg.Options{Quality: *quality}}
-	case *toGif:
-		return &conversion.Gif{Options: &gif.Options{NumColors: *numColors}}
-	case *toPng:
-		fallthrough
-	default:
-		return &conversion.Png{Encoder: &png.Encoder{CompressionLevel: toCompressionLevel(humanCompressionLevel)}}
+func deriveCandidates(formats []*conversion.Format, to *conversion.Format, decoderFactories map[*conversion.Format]conversion.DecoderFactory) ([]conversion.Decoder, error) {
+	var candidates []conversion.Decoder
+	for _, f := range formats {
+		// Files already in the output file format need not be converted.
+		if f == to || f.NewDecoder == nil {
+			continue
+		}
+		decoder, err := newDecoder(f, decoderFactories)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, decoder)
 	}
+	return candidates, nil
 }
 
-func toCompressionLevel(humanCompressionLevel *string) png.CompressionLevel {
-	switch *humanCompressionLevel {
-	case "no":
-		return png.NoCompression
-	case "best-speed":
-		return png.BestSpeed
-	case "best-compression":
-		return png.BestCompression
-	case "default":
-		fallthrough
-	default:
-		return png.DefaultCompression
+// newDecoder builds the decoder of the format from its decoding options, if any.
+func newDecoder(f *conversion.Format, decoderFactories map[*conversion.Format]conversion.DecoderFactory) (conversion.Decoder, error) {
+	if factory, ok := decoderFactories[f]; ok {
+		return factory()
 	}
+	return f.NewDecoder(), nil
+}
+
+// parseHexColor parses an opaque color of "#rrggbb" or "#rgb", where "#" can be omitted.
+func parseHexColor(s string) (color.Color, error) {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) == 3 {
+		s = string([]byte{s[0], s[0], s[1], s[1], s[2], s[2]})
+	}
+	if len(s) != 6 {
+		return nil, errors.New("invalid hex color")
+	}
+
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xFF}, nil
 }
@@ -1,14 +1,20 @@
 package opt
 
 import (
+	"bytes"
 	"errors"
+	"image"
+	"image/color"
+	"image/draw"
 	"image/gif"
 	"image/jpeg"
 	"image/png"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/hioki-daichi/imgconv/conversion"
+	"github.com/hioki-daichi/imgconv/resizing"
 )
 
 func TestOpt_Parse(t *testing.T) {
@@ -20,35 +26,99 @@ func TestOpt_Parse(t *testing.T) {
 	}{
 		"no argument": {args: []string{}, dirname: "", options: nil, err: errors.New("you must specify a directory")},
 
-		"dirname only": {args: []string{"./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: jpegDecoder(t), Encoder: pngEncoder(t), Force: false}, err: nil},
+		"dirname only": {args: []string{"./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: jpegDecoder(t), Encoder: pngEncoder(t), Force: false, Jobs: 1, ReportFormat: "text"}, err: nil},
 
-		"with -f option": {args: []string{"-f", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: jpegDecoder(t), Encoder: pngEncoder(t), Force: true}, err: nil},
+		"with -f option": {args: []string{"-f", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: jpegDecoder(t), Encoder: pngEncoder(t), Force: true, Jobs: 1, ReportFormat: "text"}, err: nil},
+
+		"--jobs=0": {args: []string{"--jobs=0", "./testdata/"}, dirname: "", options: nil, err: errors.New("--jobs must be greater than or equal to 1")},
+		"--jobs=4": {args: []string{"--jobs=4", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: jpegDecoder(t), Encoder: pngEncoder(t), Force: false, Jobs: 4, ReportFormat: "text"}, err: nil},
+
+		"--out-dir": {args: []string{"--out-dir=./out/", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: jpegDecoder(t), Encoder: pngEncoder(t), Force: false, OutDir: "./out/", Jobs: 1, ReportFormat: "text"}, err: nil},
+
+		"--incremental": {args: []string{"--incremental", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: jpegDecoder(t), Encoder: pngEncoder(t), Force: false, Incremental: true, Jobs: 1, ReportFormat: "text"}, err: nil},
+		"--manifest":    {args: []string{"--manifest=./manifest.json", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: jpegDecoder(t), Encoder: pngEncoder(t), Force: false, Incremental: true, ManifestPath: "./manifest.json", Jobs: 1, ReportFormat: "text"}, err: nil},
+
+		"--keep-going": {args: []string{"--keep-going", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: jpegDecoder(t), Encoder: pngEncoder(t), Force: false, Jobs: 1, KeepGoing: true, ReportFormat: "text"}, err: nil},
+
+		"--background=#123":    {args: []string{"--background=#123", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: jpegDecoder(t), Encoder: pngEncoder(t), Force: false, Jobs: 1, ReportFormat: "text", Background: color.RGBA{R: 0x11, G: 0x22, B: 0x33, A: 0xFF}}, err: nil},
+		"--background=0a0b0c":  {args: []string{"--background=0a0b0c", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: jpegDecoder(t), Encoder: pngEncoder(t), Force: false, Jobs: 1, ReportFormat: "text", Background: color.RGBA{R: 0x0A, G: 0x0B, B: 0x0C, A: 0xFF}}, err: nil},
+		"--background=#ffff":   {args: []string{"--background=#ffff", "./testdata/"}, dirname: "", options: nil, err: errors.New("--background must be a hex color such as \"#ffffff\"")},
+		"--background=#gggggg": {args: []string{"--background=#gggggg", "./testdata/"}, dirname: "", options: nil, err: errors.New("--background must be a hex color such as \"#ffffff\"")},
+		"--extract-frames":     {args: []string{"--extract-frames", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: jpegDecoder(t), Encoder: pngEncoder(t), Force: false, Jobs: 1, ReportFormat: "text", ExtractFrames: true}, err: nil},
+
+		"--dry-run": {args: []string{"--dry-run", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: jpegDecoder(t), Encoder: pngEncoder(t), Force: false, Jobs: 1, DryRun: true, ReportFormat: "text"}, err: nil},
+
+		"--format=json": {args: []string{"--format=json", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: jpegDecoder(t), Encoder: pngEncoder(t), Force: false, Jobs: 1, ReportFormat: "json"}, err: nil},
+		"--format=xml":  {args: []string{"--format=xml", "./testdata/"}, dirname: "", options: nil, err: errors.New("--format is not included in the list: \"text\", \"json\"")},
+
+		// resizing
+		"--width=100":        {args: []string{"--width=100", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: jpegDecoder(t), Encoder: pngEncoder(t), Transformers: []conversion.Transformer{&resizing.Resizer{Width: 100, Filter: resizing.Lanczos}}, Force: false, Jobs: 1, ReportFormat: "text"}, err: nil},
+		"--height=100":       {args: []string{"--height=100", "--resample=nearest", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: jpegDecoder(t), Encoder: pngEncoder(t), Transformers: []conversion.Transformer{&resizing.Resizer{Height: 100, Filter: nil}}, Force: false, Jobs: 1, ReportFormat: "text"}, err: nil},
+		"--max-dimension=50": {args: []string{"--max-dimension=50", "--resample=bilinear", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: jpegDecoder(t), Encoder: pngEncoder(t), Transformers: []conversion.Transformer{&resizing.Resizer{MaxDimension: 50, Filter: resizing.Bilinear}}, Force: false, Jobs: 1, ReportFormat: "text"}, err: nil},
+		"--width=-1":         {args: []string{"--width=-1", "./testdata/"}, dirname: "", options: nil, err: errors.New("--width must be greater than or equal to 0")},
+		"--height=-1":        {args: []string{"--height=-1", "./testdata/"}, dirname: "", options: nil, err: errors.New("--height must be greater than or equal to 0")},
+		"--max-dimension=-1": {args: []string{"--max-dimension=-1", "./testdata/"}, dirname: "", options: nil, err: errors.New("--max-dimension must be greater than or equal to 0")},
+		"--resample=foo":     {args: []string{"--resample=foo", "./testdata/"}, dirname: "", options: nil, err: errors.New("--resample is not included in the list: \"nearest\", \"bilinear\", \"catmull-rom\", \"lanczos\"")},
 
 		// by format
-		"JPEG to PNG": {args: []string{"-J", "-p", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: jpegDecoder(t), Encoder: pngEncoder(t), Force: false}, err: nil},
-		"JPEG to GIF": {args: []string{"-J", "-g", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: jpegDecoder(t), Encoder: gifEncoder(t), Force: false}, err: nil},
-		"PNG to JPEG": {args: []string{"-P", "-j", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: pngDecoder(t), Encoder: jpegEncoder(t), Force: false}, err: nil},
-		"PNG to GIF":  {args: []string{"-P", "-g", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: pngDecoder(t), Encoder: gifEncoder(t), Force: false}, err: nil},
-		"GIF to JPEG": {args: []string{"-G", "-j", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: gifDecoder(t), Encoder: jpegEncoder(t), Force: false}, err: nil},
-		"GIF to PNG":  {args: []string{"-G", "-p", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: gifDecoder(t), Encoder: pngEncoder(t), Force: false}, err: nil},
+		"BMP to PNG":              {args: []string{"-B", "-p", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: &conversion.Bmp{}, Encoder: pngEncoder(t), Force: false, Jobs: 1, ReportFormat: "text"}, err: nil},
+		"JPEG to BMP":             {args: []string{"-J", "-b", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: jpegDecoder(t), Encoder: &conversion.Bmp{}, Force: false, Jobs: 1, ReportFormat: "text"}, err: nil},
+		"WebP to PNG":             {args: []string{"-W", "-p", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: &conversion.WebP{}, Encoder: pngEncoder(t), Force: false, Jobs: 1, ReportFormat: "text"}, err: nil},
+		"PPM to PAM":              {args: []string{"-N", "-n", "--netpbm-format=pam", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: &conversion.Netpbm{}, Encoder: &conversion.Netpbm{Variant: conversion.NetpbmPAM}, Force: false, Jobs: 1, ReportFormat: "text"}, err: nil},
+		"JPEG to PGM":             {args: []string{"-J", "-n", "--netpbm-format=pgm", "--netpbm-plain", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: jpegDecoder(t), Encoder: &conversion.Netpbm{Variant: conversion.NetpbmPGM, Plain: true}, Force: false, Jobs: 1, ReportFormat: "text"}, err: nil},
+		"--netpbm-format=foo":     {args: []string{"-n", "--netpbm-format=foo", "./testdata/"}, dirname: "", options: nil, err: errors.New("--netpbm-format is not included in the list: \"pbm\", \"pgm\", \"ppm\", \"pam\"")},
+		"--netpbm-plain with PAM": {args: []string{"-n", "--netpbm-format=pam", "--netpbm-plain", "./testdata/"}, dirname: "", options: nil, err: errors.New("--netpbm-plain cannot be used with PAM")},
+		"--to=pgm":                {args: []string{"-J", "--to=pgm", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: jpegDecoder(t), Encoder: &conversion.Netpbm{Variant: conversion.NetpbmPGM}, Force: false, Jobs: 1, ReportFormat: "text"}, err: nil},
+		"--to=pam --netpbm-plain": {args: []string{"--to=pam", "--netpbm-plain", "./testdata/"}, dirname: "", options: nil, err: errors.New("--netpbm-plain cannot be used with PAM")},
+		"--to=pnm":                {args: []string{"-J", "--to=pnm", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: jpegDecoder(t), Encoder: &conversion.Netpbm{Variant: conversion.NetpbmPPM}, Force: false, Jobs: 1, ReportFormat: "text"}, err: nil},
+		"--to=pgm with others":    {args: []string{"--to=pgm", "--netpbm-format=pbm", "./testdata/"}, dirname: "", options: nil, err: errors.New("--netpbm-format conflicts with --to=pgm")},
+		"QOI to PNG":              {args: []string{"-Q", "-p", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: &conversion.Qoi{}, Encoder: pngEncoder(t), Force: false, Jobs: 1, ReportFormat: "text"}, err: nil},
+		"PNG to QOI":              {args: []string{"-P", "-q", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: pngDecoder(t), Encoder: &conversion.Qoi{}, Force: false, Jobs: 1, ReportFormat: "text"}, err: nil},
+		"ICO to PNG":              {args: []string{"-I", "-p", "--ico-size=48", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: &conversion.Ico{Size: 48}, Encoder: pngEncoder(t), Force: false, Jobs: 1, ReportFormat: "text"}, err: nil},
+		"PNG to ICO":              {args: []string{"-P", "-i", "--ico-sizes=16,32", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: pngDecoder(t), Encoder: &conversion.Ico{Sizes: []int{16, 32}}, Force: false, Jobs: 1, ReportFormat: "text"}, err: nil},
+		"--ico-size=300":          {args: []string{"-I", "-p", "--ico-size=300", "./testdata/"}, dirname: "", options: nil, err: errors.New("--ico-size must be from 0 to 256, where 0 means the largest entry")},
+		"TGA to PNG":              {args: []string{"--from=tga", "-p", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: &conversion.Tga{}, Encoder: pngEncoder(t), Force: false, Jobs: 1, ReportFormat: "text"}, err: nil},
+		"PNG to TGA":              {args: []string{"-P", "--to=targa", "--tga-rle", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: pngDecoder(t), Encoder: &conversion.Tga{RLE: true}, Force: false, Jobs: 1, ReportFormat: "text"}, err: nil},
+		"TIFF to PNG":             {args: []string{"-T", "-p", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: &conversion.Tiff{}, Encoder: pngEncoder(t), Force: false, Jobs: 1, ReportFormat: "text"}, err: nil},
+		"JPEG to TIFF":            {args: []string{"-J", "-t", "--tiff-compression=deflate", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: jpegDecoder(t), Encoder: &conversion.Tiff{Compression: conversion.TiffDeflate}, Force: false, Jobs: 1, ReportFormat: "text"}, err: nil},
+		"JPEG to PNG":             {args: []string{"-J", "-p", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: jpegDecoder(t), Encoder: pngEncoder(t), Force: false, Jobs: 1, ReportFormat: "text"}, err: nil},
+		"JPEG to GIF":             {args: []string{"-J", "-g", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: jpegDecoder(t), Encoder: gifEncoder(t), Force: false, Jobs: 1, ReportFormat: "text"}, err: nil},
+		"PNG to JPEG":             {args: []string{"-P", "-j", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: pngDecoder(t), Encoder: jpegEncoder(t), Force: false, Jobs: 1, ReportFormat: "text"}, err: nil},
+		"PNG to GIF":              {args: []string{"-P", "-g", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: pngDecoder(t), Encoder: gifEncoder(t), Force: false, Jobs: 1, ReportFormat: "text"}, err: nil},
+		"GIF to JPEG":             {args: []string{"-G", "-j", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: gifDecoder(t), Encoder: jpegEncoder(t), Force: false, Jobs: 1, ReportFormat: "text"}, err: nil},
+		"GIF to PNG":              {args: []string{"-G", "-p", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: gifDecoder(t), Encoder: pngEncoder(t), Force: false, Jobs: 1, ReportFormat: "text"}, err: nil},
+
+		// auto-detection
+		"any to PNG":  {args: []string{"-A", "-p", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: nil, Encoder: pngEncoder(t), Candidates: []conversion.Decoder{&conversion.Bmp{}, gifDecoder(t), &conversion.Ico{}, jpegDecoder(t), &conversion.Netpbm{}, &conversion.Qoi{}, &conversion.Tga{}, &conversion.Tiff{}, &conversion.WebP{}}, Force: false, Jobs: 1, ReportFormat: "text"}, err: nil},
+		"any to JPEG": {args: []string{"-A", "-j", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: nil, Encoder: jpegEncoder(t), Candidates: []conversion.Decoder{&conversion.Bmp{}, gifDecoder(t), &conversion.Ico{}, &conversion.Netpbm{}, pngDecoder(t), &conversion.Qoi{}, &conversion.Tga{}, &conversion.Tiff{}, &conversion.WebP{}}, Force: false, Jobs: 1, ReportFormat: "text"}, err: nil},
+		"any to GIF":  {args: []string{"-A", "-g", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: nil, Encoder: gifEncoder(t), Candidates: []conversion.Decoder{&conversion.Bmp{}, &conversion.Ico{}, jpegDecoder(t), &conversion.Netpbm{}, pngDecoder(t), &conversion.Qoi{}, &conversion.Tga{}, &conversion.Tiff{}, &conversion.WebP{}}, Force: false, Jobs: 1, ReportFormat: "text"}, err: nil},
+
+		// by format name
+		"--from=gif --to=jpeg": {args: []string{"--from=gif", "--to=jpeg", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: gifDecoder(t), Encoder: jpegEncoder(t), Force: false, Jobs: 1, ReportFormat: "text"}, err: nil},
+		"--from=png --to=jpg":  {args: []string{"--from=png", "--to=jpg", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: pngDecoder(t), Encoder: jpegEncoder(t), Force: false, Jobs: 1, ReportFormat: "text"}, err: nil},
+		"--from=foo":           {args: []string{"--from=foo", "./testdata/"}, dirname: "", options: nil, err: errors.New("--from is not a registered format: foo")},
+		"--to=foo":             {args: []string{"--to=foo", "./testdata/"}, dirname: "", options: nil, err: errors.New("--to is not a registered format: foo")},
 
 		// quality option
 		"--quality=0":   {args: []string{"-P", "-j", "--quality=0", "./testdata/"}, dirname: "", options: nil, err: errors.New("--quality must be greater than or equal to 1")},
-		"--quality=1":   {args: []string{"-P", "-j", "--quality=1", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: pngDecoder(t), Encoder: &conversion.Jpeg{Options: &jpeg.Options{Quality: 1}}, Force: false}, err: nil},
-		"--quality=100": {args: []string{"-P", "-j", "--quality=100", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: pngDecoder(t), Encoder: &conversion.Jpeg{Options: &jpeg.Options{Quality: 100}}, Force: false}, err: nil},
+		"--quality=1":   {args: []string{"-P", "-j", "--quality=1", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: pngDecoder(t), Encoder: &conversion.Jpeg{Options: &jpeg.Options{Quality: 1}}, Force: false, Jobs: 1, ReportFormat: "text"}, err: nil},
+		"--quality=100": {args: []string{"-P", "-j", "--quality=100", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: pngDecoder(t), Encoder: &conversion.Jpeg{Options: &jpeg.Options{Quality: 100}}, Force: false, Jobs: 1, ReportFormat: "text"}, err: nil},
 		"--quality=101": {args: []string{"-P", "-j", "--quality=101", "./testdata/"}, dirname: "", options: nil, err: errors.New("--quality must be less than or equal to 100")},
 
 		// num-colors option
-		"--num-colors=0":   {args: []string{"-J", "-g", "--num-colors=0", "./testdata/"}, dirname: "", options: nil, err: errors.New("--num-colors must be greater than or equal to 1")},
-		"--num-colors=1":   {args: []string{"-J", "-g", "--num-colors=1", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: jpegDecoder(t), Encoder: &conversion.Gif{Options: &gif.Options{NumColors: 1}}, Force: false}, err: nil},
-		"--num-colors=256": {args: []string{"-J", "-g", "--num-colors=256", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: jpegDecoder(t), Encoder: &conversion.Gif{Options: &gif.Options{NumColors: 256}}, Force: false}, err: nil},
-		"--num-colors=257": {args: []string{"-J", "-g", "--num-colors=257", "./testdata/"}, dirname: "", options: nil, err: errors.New("--num-colors must be less than or equal to 256")},
+		"--num-colors=0": {args: []string{"-J", "-g", "--num-colors=0", "./testdata/"}, dirname: "", options: nil, err: errors.New("--num-colors must be greater than or equal to 1")},
+		"--num-colors=1": {args: []string{"-J", "-g", "--num-colors=1", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: jpegDecoder(t), Encoder: &conversion.Gif{Options: &gif.Options{NumColors: 1}}, Force: false, Jobs: 1, ReportFormat: "text"}, err: nil},
+		"--gif-quantizer=k-means --gif-dither=none": {args: []string{"-J", "-g", "--gif-quantizer=k-means", "--gif-dither=none", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: jpegDecoder(t), Encoder: &conversion.Gif{Options: &gif.Options{NumColors: 256, Quantizer: conversion.KMeans{}, Drawer: draw.Src}}, Force: false, Jobs: 1, ReportFormat: "text"}, err: nil},
+		"--gif-shared-palette":                      {args: []string{"-J", "-g", "--gif-shared-palette", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: jpegDecoder(t), Encoder: gifEncoder(t), Force: false, Jobs: 1, ReportFormat: "text", SharedPalette: true}, err: nil},
+		"--gif-shared-palette to PNG":               {args: []string{"-J", "-p", "--gif-shared-palette", "./testdata/"}, dirname: "", options: nil, err: errors.New("--gif-shared-palette can be specified only when converting to GIF")},
+		"--num-colors=256":                          {args: []string{"-J", "-g", "--num-colors=256", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: jpegDecoder(t), Encoder: &conversion.Gif{Options: &gif.Options{NumColors: 256}}, Force: false, Jobs: 1, ReportFormat: "text"}, err: nil},
+		"--num-colors=257":                          {args: []string{"-J", "-g", "--num-colors=257", "./testdata/"}, dirname: "", options: nil, err: errors.New("--num-colors must be less than or equal to 256")},
 
 		// compression-level option
-		"--compression-level=default":          {args: []string{"-J", "-p", "--compression-level=default", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: jpegDecoder(t), Encoder: &conversion.Png{Encoder: &png.Encoder{CompressionLevel: png.DefaultCompression}}, Force: false}, err: nil},
-		"--compression-level=no":               {args: []string{"-J", "-p", "--compression-level=no", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: jpegDecoder(t), Encoder: &conversion.Png{Encoder: &png.Encoder{CompressionLevel: png.NoCompression}}, Force: false}, err: nil},
-		"--compression-level=best-speed":       {args: []string{"-J", "-p", "--compression-level=best-speed", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: jpegDecoder(t), Encoder: &conversion.Png{Encoder: &png.Encoder{CompressionLevel: png.BestSpeed}}, Force: false}, err: nil},
-		"--compression-level=best-compression": {args: []string{"-J", "-p", "--compression-level=best-compression", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: jpegDecoder(t), Encoder: &conversion.Png{Encoder: &png.Encoder{CompressionLevel: png.BestCompression}}, Force: false}, err: nil},
+		"--compression-level=default":          {args: []string{"-J", "-p", "--compression-level=default", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: jpegDecoder(t), Encoder: &conversion.Png{Encoder: &png.Encoder{CompressionLevel: png.DefaultCompression}}, Force: false, Jobs: 1, ReportFormat: "text"}, err: nil},
+		"--compression-level=no":               {args: []string{"-J", "-p", "--compression-level=no", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: jpegDecoder(t), Encoder: &conversion.Png{Encoder: &png.Encoder{CompressionLevel: png.NoCompression}}, Force: false, Jobs: 1, ReportFormat: "text"}, err: nil},
+		"--compression-level=best-speed":       {args: []string{"-J", "-p", "--compression-level=best-speed", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: jpegDecoder(t), Encoder: &conversion.Png{Encoder: &png.Encoder{CompressionLevel: png.BestSpeed}}, Force: false, Jobs: 1, ReportFormat: "text"}, err: nil},
+		"--compression-level=best-compression": {args: []string{"-J", "-p", "--compression-level=best-compression", "./testdata/"}, dirname: "./testdata/", options: &Options{Decoder: jpegDecoder(t), Encoder: &conversion.Png{Encoder: &png.Encoder{CompressionLevel: png.BestCompression}}, Force: false, Jobs: 1, ReportFormat: "text"}, err: nil},
 		"--compression-level=foo":              {args: []string{"-J", "-p", "--compression-level=foo", "./testdata/"}, dirname: "", options: nil, err: errors.New("--compression-level is not included in the list: \"default\", \"no\", \"best-speed\", \"best-compression\"")},
 	}
 
@@ -84,9 +154,108 @@ func TestOpt_Parse(t *testing.T) {
 					t.FailNow()
 				}
 
+				if !reflect.DeepEqual(options.Candidates, c.options.Candidates) {
+					t.FailNow()
+				}
+
+				if len(options.Transformers) != len(c.options.Transformers) {
+					t.FailNow()
+				}
+				for i := range options.Transformers {
+					// Filters have functions, which are not comparable by reflect.DeepEqual.
+					if *options.Transformers[i].(*resizing.Resizer) != *c.options.Transformers[i].(*resizing.Resizer) {
+						t.FailNow()
+					}
+				}
+
 				if options.Force != c.options.Force {
 					t.FailNow()
 				}
+
+				if options.OutDir != c.options.OutDir {
+					t.FailNow()
+				}
+
+				if options.Incremental != c.options.Incremental {
+					t.FailNow()
+				}
+
+				if options.ManifestPath != c.options.ManifestPath {
+					t.FailNow()
+				}
+
+				if options.Jobs != c.options.Jobs {
+					t.FailNow()
+				}
+
+				if options.KeepGoing != c.options.KeepGoing {
+					t.FailNow()
+				}
+
+				if options.DryRun != c.options.DryRun {
+					t.FailNow()
+				}
+
+				if options.ReportFormat != c.options.ReportFormat {
+					t.FailNow()
+				}
+
+				if options.ExtractFrames != c.options.ExtractFrames {
+					t.FailNow()
+				}
+
+				if options.SharedPalette != c.options.SharedPalette {
+					t.FailNow()
+				}
+
+				// White unless specified
+				expectedBackground := c.options.Background
+				if expectedBackground == nil {
+					expectedBackground = color.RGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}
+				}
+				if options.Background != expectedBackground {
+					t.Errorf(`expected="%v" actual="%v"`, expectedBackground, options.Background)
+				}
+			}
+		})
+	}
+}
+
+func TestOpt_Parse_NetpbmAlias(t *testing.T) {
+	cases := map[string]struct {
+		to      string
+		extname string
+		header  string
+	}{
+		"pbm": {to: "pbm", extname: "pbm", header: "P4\n"},
+		"pgm": {to: "pgm", extname: "pgm", header: "P5\n"},
+		"ppm": {to: "ppm", extname: "ppm", header: "P6\n"},
+		"pam": {to: "pam", extname: "pam", header: "P7\n"},
+		"pnm": {to: "pnm", extname: "ppm", header: "P6\n"},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			_, options, err := Parse("--to="+c.to, "./testdata/")
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+
+			actual := options.Encoder.Extname()
+			if actual != c.extname {
+				t.Errorf(`expected="%s" actual="%s"`, c.extname, actual)
+			}
+
+			var buf bytes.Buffer
+			err = options.Encoder.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1)))
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+			if !strings.HasPrefix(buf.String(), c.header) {
+				t.Errorf(`expected="%s" actual="%s"`, c.header, buf.String())
 			}
 		})
 	}
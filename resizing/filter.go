@@ -0,0 +1,48 @@
+package resizing
+
+import "math"
+
+// Filter is a resampling kernel which is zero outside of [-Support, Support].
+type Filter struct {
+	Support float64
+	Kernel  func(float64) float64
+}
+
+// Filters available in addition to nearest neighbor, which is represented by nil.
+var (
+	Bilinear = &Filter{Support: 1, Kernel: func(x float64) float64 {
+		x = math.Abs(x)
+		if x < 1 {
+			return 1 - x
+		}
+		return 0
+	}}
+
+	CatmullRom = &Filter{Support: 2, Kernel: func(x float64) float64 {
+		x = math.Abs(x)
+		switch {
+		case x < 1:
+			return (1.5*x-2.5)*x*x + 1
+		case x < 2:
+			return ((-0.5*x+2.5)*x-4)*x + 2
+		default:
+			return 0
+		}
+	}}
+
+	Lanczos = &Filter{Support: 3, Kernel: func(x float64) float64 {
+		x = math.Abs(x)
+		if x < 3 {
+			return sinc(x) * sinc(x/3)
+		}
+		return 0
+	}}
+)
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	x *= math.Pi
+	return math.Sin(x) / x
+}
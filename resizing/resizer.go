@@ -0,0 +1,249 @@
+/*
+Package resizing resizes images keeping the aspect ratio.
+
+It is implemented with separable convolution in the standard library only.
+*/
+package resizing
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// Resizer resizes images. It satisfies conversion.Transformer.
+type Resizer struct {
+	// When only one of Width and Height is specified, the other follows the aspect ratio.
+	// When both are specified, the image is fitted within them keeping the aspect ratio.
+	Width  int
+	Height int
+
+	// The longer side is shrunk to MaxDimension if it exceeds. Images are never enlarged by it.
+	MaxDimension int
+
+	// Nearest if nil.
+	Filter *Filter
+}
+
+// Transform returns the resized image, or img itself if its size does not change.
+// Images of 16 bits per sample are resized by Resize64 so that the depth is kept.
+func (r *Resizer) Transform(img image.Image) (image.Image, error) {
+	bounds := img.Bounds()
+
+	w, h := r.Size(bounds.Dx(), bounds.Dy())
+	if w == bounds.Dx() && h == bounds.Dy() {
+		return img, nil
+	}
+
+	switch img.ColorModel() {
+	case color.RGBA64Model, color.NRGBA64Model, color.Gray16Model:
+		return Resize64(img, w, h, r.Filter), nil
+	}
+	return Resize(img, w, h, r.Filter), nil
+}
+
+// Size returns the size which an image of the specified size is resized to.
+func (r *Resizer) Size(w int, h int) (int, int) {
+	if w == 0 || h == 0 {
+		return w, h
+	}
+
+	scale := 1.0
+
+	switch {
+	case r.Width > 0 && r.Height > 0:
+		scale = math.Min(float64(r.Width)/float64(w), float64(r.Height)/float64(h))
+	case r.Width > 0:
+		scale = float64(r.Width) / float64(w)
+	case r.Height > 0:
+		scale = float64(r.Height) / float64(h)
+	}
+
+	if r.MaxDimension > 0 {
+		longer := math.Max(float64(w), float64(h)) * scale
+		if longer > float64(r.MaxDimension) {
+			scale *= float64(r.MaxDimension) / longer
+		}
+	}
+
+	return scaled(w, scale), scaled(h, scale)
+}
+
+func scaled(n int, scale float64) int {
+	m := int(math.Round(float64(n) * scale))
+	if m < 1 {
+		return 1
+	}
+	return m
+}
+
+// Resize resamples img to w x h with the filter, or nearest neighbor if filter is nil.
+func Resize(img image.Image, w int, h int, filter *Filter) *image.RGBA {
+	bounds := img.Bounds()
+
+	src, ok := img.(*image.RGBA)
+	if !ok || bounds.Min != (image.Point{}) {
+		src = image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+		draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	resample(src.Bounds().Dx(), src.Bounds().Dy(), w, h, filter, 0xFF,
+		func(y int, row []float32) {
+			for i, v := range src.Pix[y*src.Stride : y*src.Stride+len(row)] {
+				row[i] = float32(v)
+			}
+		},
+		func(x int, y int, sum [4]uint32) {
+			d := dst.Pix[y*dst.Stride+4*x:]
+			for i, v := range sum {
+				d[i] = uint8(v)
+			}
+		},
+	)
+
+	return dst
+}
+
+// Resize64 is Resize keeping 16 bits per sample.
+func Resize64(img image.Image, w int, h int, filter *Filter) *image.RGBA64 {
+	bounds := img.Bounds()
+
+	src, ok := img.(*image.RGBA64)
+	if !ok || bounds.Min != (image.Point{}) {
+		src = image.NewRGBA64(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+		draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+	}
+
+	dst := image.NewRGBA64(image.Rect(0, 0, w, h))
+	resample(src.Bounds().Dx(), src.Bounds().Dy(), w, h, filter, 0xFFFF,
+		func(y int, row []float32) {
+			p := src.Pix[y*src.Stride:]
+			for i := range row {
+				row[i] = float32(uint16(p[2*i])<<8 | uint16(p[2*i+1]))
+			}
+		},
+		func(x int, y int, sum [4]uint32) {
+			d := dst.Pix[y*dst.Stride+8*x:]
+			for i, v := range sum {
+				d[2*i] = uint8(v >> 8)
+				d[2*i+1] = uint8(v)
+			}
+		},
+	)
+
+	return dst
+}
+
+// resample resamples the premultiplied RGBA samples of srcW x srcH, whose maximum is max, to w x h.
+// readRow reads the 4*srcW samples of the row y, and set sets the clamped samples of the destination pixel.
+func resample(srcW int, srcH int, w int, h int, filter *Filter, max uint32, readRow func(y int, row []float32), set func(x int, y int, sum [4]uint32)) {
+	xContribs := contributions(w, srcW, filter)
+	yContribs := contributions(h, srcH, filter)
+
+	// Resample horizontally into tmp, which has srcH rows of w premultiplied pixels.
+	row := make([]float32, 4*srcW)
+	tmp := make([]float32, 4*w*srcH)
+	for y := 0; y < srcH; y++ {
+		readRow(y, row)
+		for x, c := range xContribs {
+			var sum [4]float32
+			for k, weight := range c.weights {
+				p := row[4*(c.start+k):]
+				sum[0] += weight * p[0]
+				sum[1] += weight * p[1]
+				sum[2] += weight * p[2]
+				sum[3] += weight * p[3]
+			}
+			copy(tmp[4*(y*w+x):], sum[:])
+		}
+	}
+
+	// Then vertically into the destination.
+	for y, c := range yContribs {
+		for x := 0; x < w; x++ {
+			var sum [4]float32
+			for k, weight := range c.weights {
+				p := tmp[4*((c.start+k)*w+x):]
+				sum[0] += weight * p[0]
+				sum[1] += weight * p[1]
+				sum[2] += weight * p[2]
+				sum[3] += weight * p[3]
+			}
+
+			a := clamp(sum[3], max)
+			// Premultiplied colors cannot exceed alpha.
+			set(x, y, [4]uint32{clamp(sum[0], a), clamp(sum[1], a), clamp(sum[2], a), a})
+		}
+	}
+}
+
+func clamp(v float32, max uint32) uint32 {
+	v += 0.5
+	switch {
+	case v < 0:
+		return 0
+	case v > float32(max):
+		return max
+	default:
+		return uint32(v)
+	}
+}
+
+// contribution holds the weights of the source pixels from start for a destination pixel.
+type contribution struct {
+	start   int
+	weights []float32
+}
+
+func contributions(dstLen int, srcLen int, filter *Filter) []contribution {
+	contribs := make([]contribution, dstLen)
+	scale := float64(srcLen) / float64(dstLen)
+
+	if filter == nil {
+		for i := range contribs {
+			j := int((float64(i) + 0.5) * scale)
+			if j > srcLen-1 {
+				j = srcLen - 1
+			}
+			contribs[i] = contribution{start: j, weights: []float32{1}}
+		}
+		return contribs
+	}
+
+	// When shrinking, the filter is stretched so that every source pixel contributes.
+	filterScale := math.Max(scale, 1)
+	support := filter.Support * filterScale
+
+	for i := range contribs {
+		center := (float64(i) + 0.5) * scale
+		left := int(math.Floor(center - support))
+		if left < 0 {
+			left = 0
+		}
+		right := int(math.Ceil(center + support))
+		if right > srcLen {
+			right = srcLen
+		}
+
+		weights := make([]float64, right-left)
+		sum := 0.0
+		for j := left; j < right; j++ {
+			weight := filter.Kernel((float64(j) + 0.5 - center) / filterScale)
+			weights[j-left] = weight
+			sum += weight
+		}
+
+		c := contribution{start: left, weights: make([]float32, len(weights))}
+		for k, weight := range weights {
+			if sum != 0 {
+				weight /= sum
+			}
+			c.weights[k] = float32(weight)
+		}
+		contribs[i] = c
+	}
+
+	return contribs
+}
@@ -0,0 +1,198 @@
+package resizing
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestResizing_Resizer_Size(t *testing.T) {
+	cases := map[string]struct {
+		resizer  Resizer
+		w        int
+		h        int
+		expected image.Point
+	}{
+		"nothing":                         {resizer: Resizer{}, w: 400, h: 300, expected: image.Pt(400, 300)},
+		"width":                           {resizer: Resizer{Width: 200}, w: 400, h: 300, expected: image.Pt(200, 150)},
+		"height":                          {resizer: Resizer{Height: 600}, w: 400, h: 300, expected: image.Pt(800, 600)},
+		"width and height (wide)":         {resizer: Resizer{Width: 100, Height: 100}, w: 400, h: 300, expected: image.Pt(100, 75)},
+		"width and height (tall)":         {resizer: Resizer{Width: 100, Height: 100}, w: 300, h: 400, expected: image.Pt(75, 100)},
+		"max dimension (shrink)":          {resizer: Resizer{MaxDimension: 200}, w: 300, h: 400, expected: image.Pt(150, 200)},
+		"max dimension (never enlarge)":   {resizer: Resizer{MaxDimension: 800}, w: 300, h: 400, expected: image.Pt(300, 400)},
+		"width and max dimension":         {resizer: Resizer{Width: 800, MaxDimension: 400}, w: 400, h: 300, expected: image.Pt(400, 300)},
+		"at least one pixel":              {resizer: Resizer{Width: 10}, w: 1000, h: 10, expected: image.Pt(10, 1)},
+		"empty image":                     {resizer: Resizer{Width: 10}, w: 0, h: 0, expected: image.Pt(0, 0)},
+		"width and height (same aspect)":  {resizer: Resizer{Width: 200, Height: 150}, w: 400, h: 300, expected: image.Pt(200, 150)},
+		"height and max dimension (tall)": {resizer: Resizer{Height: 1000, MaxDimension: 500}, w: 300, h: 400, expected: image.Pt(375, 500)},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			w, h := c.resizer.Size(c.w, c.h)
+
+			actual := image.Pt(w, h)
+			if actual != c.expected {
+				t.Errorf(`expected="%s" actual="%s"`, c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestResizing_Resizer_Transform(t *testing.T) {
+	cases := map[string]struct {
+		filter *Filter
+	}{
+		"nearest":     {filter: nil},
+		"bilinear":    {filter: Bilinear},
+		"catmull-rom": {filter: CatmullRom},
+		"lanczos":     {filter: Lanczos},
+	}
+
+	expected := color.NRGBA{R: 0x12, G: 0x34, B: 0x56, A: 0xFF}
+
+	src := image.NewNRGBA(image.Rect(10, 10, 50, 40))
+	for y := src.Rect.Min.Y; y < src.Rect.Max.Y; y++ {
+		for x := src.Rect.Min.X; x < src.Rect.Max.X; x++ {
+			src.SetNRGBA(x, y, expected)
+		}
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			for _, width := range []int{13, 40, 97} {
+				r := &Resizer{Width: width, Filter: c.filter}
+
+				img, err := r.Transform(src)
+				if err != nil {
+					t.Fatalf("err %s", err)
+				}
+
+				w, h := r.Size(40, 30)
+				if img.Bounds() != image.Rect(0, 0, w, h) && img != src {
+					t.Errorf(`expected="%s" actual="%s"`, image.Rect(0, 0, w, h), img.Bounds())
+				}
+
+				// A uniform image stays uniform.
+				b := img.Bounds()
+				for y := b.Min.Y; y < b.Max.Y; y++ {
+					for x := b.Min.X; x < b.Max.X; x++ {
+						actual := color.NRGBAModel.Convert(img.At(x, y))
+						if actual != expected {
+							t.Fatalf(`(%d, %d): expected="%v" actual="%v"`, x, y, expected, actual)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestResizing_Resizer_Transform_16Bits(t *testing.T) {
+	cases := map[string]struct {
+		filter *Filter
+	}{
+		"nearest": {filter: nil},
+		"lanczos": {filter: Lanczos},
+	}
+
+	// The low 8 bits are lost if it is resized in 8 bits.
+	expected := color.NRGBA64{R: 0x1234, G: 0x5678, B: 0x9ABC, A: 0xFFFF}
+
+	src := image.NewNRGBA64(image.Rect(0, 0, 40, 30))
+	for y := 0; y < 30; y++ {
+		for x := 0; x < 40; x++ {
+			src.SetNRGBA64(x, y, expected)
+		}
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			img, err := (&Resizer{Width: 13, Filter: c.filter}).Transform(src)
+			if err != nil {
+				t.Fatalf("err %s", err)
+			}
+
+			if _, ok := img.(*image.RGBA64); !ok {
+				t.Fatalf("unexpected type %T", img)
+			}
+
+			b := img.Bounds()
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					actual := color.NRGBA64Model.Convert(img.At(x, y))
+					if actual != expected {
+						t.Fatalf(`(%d, %d): expected="%v" actual="%v"`, x, y, expected, actual)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestResizing_Resizer_Transform_Unchanged(t *testing.T) {
+	t.Parallel()
+
+	src := image.NewRGBA(image.Rect(0, 0, 4, 3))
+
+	actual, err := (&Resizer{Width: 4}).Transform(src)
+	if err != nil {
+		t.Fatalf("err %s", err)
+	}
+	if actual != src {
+		t.Error("expected the same image")
+	}
+}
+
+func TestResizing_Resize_Nearest(t *testing.T) {
+	t.Parallel()
+
+	black := color.RGBA{A: 0xFF}
+	white := color.RGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}
+
+	src := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	src.SetRGBA(0, 0, black)
+	src.SetRGBA(1, 0, white)
+	src.SetRGBA(0, 1, white)
+	src.SetRGBA(1, 1, black)
+
+	dst := Resize(src, 4, 4, nil)
+
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			expected := src.RGBAAt(x/2, y/2)
+			actual := dst.RGBAAt(x, y)
+			if actual != expected {
+				t.Errorf(`(%d, %d): expected="%v" actual="%v"`, x, y, expected, actual)
+			}
+		}
+	}
+}
+
+func TestResizing_Resize_Shrink(t *testing.T) {
+	t.Parallel()
+
+	// Vertical stripes of black and white are averaged into gray.
+	src := image.NewRGBA(image.Rect(0, 0, 8, 1))
+	for x := 0; x < 8; x += 2 {
+		src.SetRGBA(x, 0, color.RGBA{A: 0xFF})
+		src.SetRGBA(x+1, 0, color.RGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF})
+	}
+
+	dst := Resize(src, 1, 1, Bilinear)
+
+	expected := color.RGBA{R: 0x80, G: 0x80, B: 0x80, A: 0xFF}
+	actual := dst.RGBAAt(0, 0)
+	if actual != expected {
+		t.Errorf(`expected="%v" actual="%v"`, expected, actual)
+	}
+}